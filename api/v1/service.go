@@ -0,0 +1,312 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"connectrpc.com/connect"
+	apiv1 "github.com/bit-bom/minefield/gen/api/v1"
+	"github.com/bit-bom/minefield/gen/api/v1/apiv1connect"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+	"github.com/bit-bom/minefield/pkg/jobs"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// queryBatchSize is the number of nodes sent in each message of a streamed query result.
+const queryBatchSize = 1000
+
+// maxUploadSize is the most SBOM data, across all documents, a single upload can store.
+const maxUploadSize = 256 << 20
+
+type Service struct {
+	storage pkg.Storage
+	runner  *jobs.Runner
+}
+
+var _ apiv1connect.MinefieldServiceHandler = (*Service)(nil)
+
+func NewService(storage pkg.Storage, runner *jobs.Runner) *Service {
+	return &Service{storage: storage, runner: runner}
+}
+
+// HandlerOptions are the options the service's handler is served with. They reject any message larger than an upload may be.
+func HandlerOptions() []connect.HandlerOption {
+	return []connect.HandlerOption{connect.WithReadMaxBytes(maxUploadSize)}
+}
+
+func (s *Service) Query(ctx context.Context, req *connect.Request[apiv1.QueryRequest], stream *connect.ServerStream[apiv1.QueryResponse]) error {
+	result, err := pkg.ParseAndExecute(ctx, req.Msg.Script, s.storage, "")
+	if err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	ids := result.ToArray()
+	for start := 0; start < len(ids); start += queryBatchSize {
+		batch := ids[start:min(start+queryBatchSize, len(ids))]
+		nodes, err := s.storage.GetNodes(ctx, batch)
+		if err != nil {
+			return connect.NewError(connect.CodeInternal, err)
+		}
+
+		resp := &apiv1.QueryResponse{Nodes: make([]*apiv1.Node, 0, len(batch))}
+		for _, id := range batch {
+			node, ok := nodes[id]
+			if !ok {
+				continue
+			}
+			protoNode, err := NodeToServiceNode(node, false)
+			if err != nil {
+				return connect.NewError(connect.CodeInternal, err)
+			}
+			resp.Nodes = append(resp.Nodes, protoNode)
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) IngestSBOM(ctx context.Context, stream *connect.ClientStream[apiv1.IngestSBOMRequest]) (*connect.Response[apiv1.IngestSBOMResponse], error) {
+	var documents uint32
+	size := 0
+	for stream.Receive() {
+		msg := stream.Msg()
+		if size += len(msg.Data); size > maxUploadSize {
+			return nil, connect.NewError(connect.CodeResourceExhausted, fmt.Errorf("stream is larger than %d bytes", maxUploadSize))
+		}
+		if err := ingest.SBOMFromReader(ctx, bytes.NewReader(msg.Data), s.storage); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("failed to ingest SBOM %s: %w", msg.Name, err))
+		}
+		documents++
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&apiv1.IngestSBOMResponse{Documents: documents}), nil
+}
+
+func (s *Service) Cache(ctx context.Context, _ *connect.Request[apiv1.CacheRequest]) (*connect.Response[apiv1.CacheResponse], error) {
+	if err := pkg.Cache(ctx, s.storage); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	return connect.NewResponse(&apiv1.CacheResponse{}), nil
+}
+
+func (s *Service) GetNode(ctx context.Context, req *connect.Request[apiv1.GetNodeRequest]) (*connect.Response[apiv1.GetNodeResponse], error) {
+	node, err := s.getNode(ctx, req.Msg)
+	if err != nil {
+		return nil, err
+	}
+	protoNode, err := NodeToServiceNode(node, true)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	return connect.NewResponse(&apiv1.GetNodeResponse{Node: protoNode}), nil
+}
+
+func (s *Service) Leaderboard(ctx context.Context, req *connect.Request[apiv1.LeaderboardRequest]) (*connect.Response[apiv1.LeaderboardResponse], error) {
+	entries, err := pkg.CustomLeaderboard(ctx, s.storage, req.Msg.Script)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	}
+
+	if req.Msg.MaxOutput > 0 && len(entries) > int(req.Msg.MaxOutput) {
+		entries = entries[:req.Msg.MaxOutput]
+	}
+
+	resp := &apiv1.LeaderboardResponse{Entries: make([]*apiv1.LeaderboardEntry, 0, len(entries))}
+	for _, entry := range entries {
+		protoNode, err := NodeToServiceNode(entry.Node, false)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+		resp.Entries = append(resp.Entries, &apiv1.LeaderboardEntry{Node: protoNode, Count: uint32(len(entry.Output))})
+	}
+	return connect.NewResponse(resp), nil
+}
+
+func (s *Service) Why(ctx context.Context, req *connect.Request[apiv1.WhyRequest]) (*connect.Response[apiv1.WhyResponse], error) {
+	from, err := s.getNodeByName(ctx, req.Msg.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.getNodeByName(ctx, req.Msg.To)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := from.ShortestPath(ctx, s.storage, to)
+	if errors.Is(err, pkg.ErrNoPath) {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	} else if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	nodes, err := s.storage.GetNodes(ctx, path)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	resp := &apiv1.WhyResponse{Path: make([]*apiv1.Node, 0, len(path))}
+	for _, id := range path {
+		protoNode, err := NodeToServiceNode(nodes[id], false)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+		resp.Path = append(resp.Path, protoNode)
+	}
+	return connect.NewResponse(resp), nil
+}
+
+func (s *Service) StartJob(ctx context.Context, req *connect.Request[apiv1.StartJobRequest]) (*connect.Response[apiv1.StartJobResponse], error) {
+	// Jobs that take paths would read whatever the server can, so clients upload SBOMs with UploadSBOM instead
+	if pkg.JobType(req.Msg.Type) == pkg.IngestSBOMJob || len(req.Msg.Args) > 0 {
+		return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("%s jobs with arguments can't be started over the API, upload SBOMs with UploadSBOM", req.Msg.Type))
+	}
+	job, err := s.runner.Submit(ctx, pkg.JobType(req.Msg.Type), req.Msg.Args)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return connect.NewResponse(&apiv1.StartJobResponse{Job: JobToServiceJob(job)}), nil
+}
+
+func (s *Service) UploadSBOM(ctx context.Context, stream *connect.ClientStream[apiv1.IngestSBOMRequest]) (*connect.Response[apiv1.StartJobResponse], error) {
+	dir, err := os.MkdirTemp("", "minefield-upload-")
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	size := 0
+	for i := 0; stream.Receive(); i++ {
+		if size += len(stream.Msg().Data); size > maxUploadSize {
+			os.RemoveAll(dir)
+			return nil, connect.NewError(connect.CodeResourceExhausted, fmt.Errorf("upload is larger than %d bytes", maxUploadSize))
+		}
+		// Prefix the index so documents uploaded with the same name don't overwrite each other
+		name := strconv.Itoa(i) + "-" + pkg.SanitizeFilename(stream.Msg().Name)
+		if err := os.WriteFile(filepath.Join(dir, name), stream.Msg().Data, 0o600); err != nil {
+			os.RemoveAll(dir)
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("failed to store upload: %w", err))
+		}
+	}
+	if err := stream.Err(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	job, err := s.runner.Submit(ctx, pkg.IngestSBOMJob, []string{dir})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	go func() {
+		<-s.runner.Done(job.ID)
+		os.RemoveAll(dir)
+	}()
+
+	return connect.NewResponse(&apiv1.StartJobResponse{Job: JobToServiceJob(job)}), nil
+}
+
+func (s *Service) GetJob(ctx context.Context, req *connect.Request[apiv1.GetJobRequest]) (*connect.Response[apiv1.GetJobResponse], error) {
+	job, err := s.storage.GetJob(ctx, req.Msg.Id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+	return connect.NewResponse(&apiv1.GetJobResponse{Job: JobToServiceJob(job)}), nil
+}
+
+func (s *Service) ListJobs(ctx context.Context, _ *connect.Request[apiv1.ListJobsRequest]) (*connect.Response[apiv1.ListJobsResponse], error) {
+	jobs, err := s.storage.GetJobs(ctx)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	resp := &apiv1.ListJobsResponse{Jobs: make([]*apiv1.Job, 0, len(jobs))}
+	for _, job := range jobs {
+		resp.Jobs = append(resp.Jobs, JobToServiceJob(job))
+	}
+	return connect.NewResponse(resp), nil
+}
+
+func (s *Service) CancelJob(ctx context.Context, req *connect.Request[apiv1.CancelJobRequest]) (*connect.Response[apiv1.CancelJobResponse], error) {
+	if err := s.runner.Cancel(ctx, req.Msg.Id); err != nil {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	}
+	return connect.NewResponse(&apiv1.CancelJobResponse{}), nil
+}
+
+func (s *Service) getNode(ctx context.Context, req *apiv1.GetNodeRequest) (*pkg.Node, error) {
+	switch n := req.Node.(type) {
+	case *apiv1.GetNodeRequest_Id:
+		node, err := s.storage.GetNode(ctx, n.Id)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+		return node, nil
+	case *apiv1.GetNodeRequest_Name:
+		return s.getNodeByName(ctx, n.Name)
+	default:
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("either id or name must be set"))
+	}
+}
+
+func (s *Service) getNodeByName(ctx context.Context, name string) (*pkg.Node, error) {
+	id, err := s.storage.NameToID(ctx, name)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+	node, err := s.storage.GetNode(ctx, id)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+	return node, nil
+}
+
+// NodeToServiceNode converts a graph node into its API representation.
+// The direct dependencies and dependents are only included when withEdges is set, since they can be large.
+func NodeToServiceNode(node *pkg.Node, withEdges bool) (*apiv1.Node, error) {
+	metadata, err := json.Marshal(node.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal node metadata: %w", err)
+	}
+
+	protoNode := &apiv1.Node{
+		Id:       node.ID,
+		Name:     node.Name,
+		Type:     node.Type,
+		Metadata: metadata,
+	}
+	if withEdges {
+		protoNode.Dependencies = node.Children.ToArray()
+		protoNode.Dependents = node.Parents.ToArray()
+	}
+	return protoNode, nil
+}
+
+// JobToServiceJob converts a job record into its API representation.
+func JobToServiceJob(job *pkg.Job) *apiv1.Job {
+	protoJob := &apiv1.Job{
+		Id:        job.ID,
+		Type:      string(job.Type),
+		Args:      job.Args,
+		Status:    string(job.Status),
+		Done:      int64(job.Done),
+		Total:     int64(job.Total),
+		Logs:      job.Logs,
+		Error:     job.Error,
+		CreatedAt: timestamppb.New(job.CreatedAt),
+	}
+	if !job.StartedAt.IsZero() {
+		protoJob.StartedAt = timestamppb.New(job.StartedAt)
+	}
+	if !job.FinishedAt.IsZero() {
+		protoJob.FinishedAt = timestamppb.New(job.FinishedAt)
+	}
+	return protoJob
+}
@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"connectrpc.com/connect"
+	apiv1 "github.com/bit-bom/minefield/gen/api/v1"
+	"github.com/bit-bom/minefield/gen/api/v1/apiv1connect"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/jobs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestServer(t *testing.T) (apiv1connect.MinefieldServiceClient, *jobs.Runner) {
+	storage := pkg.NewMemoryStorage()
+	runner := jobs.NewRunner(storage)
+	mux := http.NewServeMux()
+	mux.Handle(apiv1connect.NewMinefieldServiceHandler(NewService(storage, runner), HandlerOptions()...))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return apiv1connect.NewMinefieldServiceClient(server.Client(), server.URL, connect.WithGRPC()), runner
+}
+
+func TestService(t *testing.T) {
+	client, _ := setupTestServer(t)
+	ctx := context.Background()
+
+	upload := client.IngestSBOM(ctx)
+	for _, file := range []string{"../../test/libA.json", "../../test/libB.json", "../../test/dep1.json"} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.NoError(t, upload.Send(&apiv1.IngestSBOMRequest{Name: file, Data: data}))
+	}
+	ingested, err := upload.CloseAndReceive()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), ingested.Msg.Documents)
+
+	_, err = client.Cache(ctx, connect.NewRequest(&apiv1.CacheRequest{}))
+	require.NoError(t, err)
+
+	stream, err := client.Query(ctx, connect.NewRequest(&apiv1.QueryRequest{Script: "dependents PACKAGE pkg:generic/dep1@1.0.0"}))
+	require.NoError(t, err)
+	var names []string
+	for stream.Receive() {
+		for _, node := range stream.Msg().Nodes {
+			names = append(names, node.Name)
+		}
+	}
+	require.NoError(t, stream.Err())
+	assert.ElementsMatch(t, []string{"pkg:generic/lib-A@1.0.0", "pkg:generic/lib-B@1.0.0"}, names)
+
+	node, err := client.GetNode(ctx, connect.NewRequest(&apiv1.GetNodeRequest{Node: &apiv1.GetNodeRequest_Name{Name: "pkg:generic/lib-A@1.0.0"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "PACKAGE", node.Msg.Node.Type)
+	assert.Len(t, node.Msg.Node.Dependencies, 1)
+
+	leaderboard, err := client.Leaderboard(ctx, connect.NewRequest(&apiv1.LeaderboardRequest{Script: "dependents PACKAGE", MaxOutput: 1}))
+	require.NoError(t, err)
+	require.Len(t, leaderboard.Msg.Entries, 1)
+	assert.Equal(t, "pkg:generic/dep2@1.0.0", leaderboard.Msg.Entries[0].Node.Name)
+	assert.Equal(t, uint32(3), leaderboard.Msg.Entries[0].Count)
+
+	why, err := client.Why(ctx, connect.NewRequest(&apiv1.WhyRequest{From: "pkg:generic/lib-A@1.0.0", To: "pkg:generic/dep2@1.0.0"}))
+	require.NoError(t, err)
+	var path []string
+	for _, n := range why.Msg.Path {
+		path = append(path, n.Name)
+	}
+	assert.Equal(t, []string{"pkg:generic/lib-A@1.0.0", "pkg:generic/dep1@1.0.0", "pkg:generic/dep2@1.0.0"}, path)
+
+	_, err = client.Why(ctx, connect.NewRequest(&apiv1.WhyRequest{From: "pkg:generic/dep2@1.0.0", To: "pkg:generic/lib-A@1.0.0"}))
+	assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+
+	upload = client.IngestSBOM(ctx)
+	_ = upload.Send(&apiv1.IngestSBOMRequest{Name: "large.json", Data: make([]byte, maxUploadSize+1)})
+	_, err = upload.CloseAndReceive()
+	assert.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+}
+
+func TestServiceJobs(t *testing.T) {
+	client, runner := setupTestServer(t)
+	ctx := context.Background()
+
+	upload := client.UploadSBOM(ctx)
+	for _, file := range []string{"../../test/libA.json", "../../test/libB.json"} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.NoError(t, upload.Send(&apiv1.IngestSBOMRequest{Name: file, Data: data}))
+	}
+	started, err := upload.CloseAndReceive()
+	require.NoError(t, err)
+	assert.Equal(t, string(pkg.IngestSBOMJob), started.Msg.Job.Type)
+	runner.Wait()
+
+	job, err := client.GetJob(ctx, connect.NewRequest(&apiv1.GetJobRequest{Id: started.Msg.Job.Id}))
+	require.NoError(t, err)
+	assert.Equal(t, string(pkg.JobSucceeded), job.Msg.Job.Status, job.Msg.Job.Error)
+	assert.Equal(t, int64(2), job.Msg.Job.Done)
+
+	_, err = client.StartJob(ctx, connect.NewRequest(&apiv1.StartJobRequest{Type: string(pkg.CacheJob)}))
+	require.NoError(t, err)
+	runner.Wait()
+
+	list, err := client.ListJobs(ctx, connect.NewRequest(&apiv1.ListJobsRequest{}))
+	require.NoError(t, err)
+	assert.Len(t, list.Msg.Jobs, 2)
+
+	_, err = client.StartJob(ctx, connect.NewRequest(&apiv1.StartJobRequest{Type: "unknown"}))
+	assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+	// Jobs that read paths on the server can't be started by clients
+	_, err = client.StartJob(ctx, connect.NewRequest(&apiv1.StartJobRequest{Type: string(pkg.IngestSBOMJob), Args: []string{"/etc"}}))
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+	_, err = client.StartJob(ctx, connect.NewRequest(&apiv1.StartJobRequest{Type: string(pkg.IngestOSVJob), Args: []string{"/etc/passwd"}}))
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+
+	upload = client.UploadSBOM(ctx)
+	data := make([]byte, 1<<20)
+	for i := 0; i <= maxUploadSize/len(data); i++ {
+		if err := upload.Send(&apiv1.IngestSBOMRequest{Name: "large.json", Data: data}); err != nil {
+			break
+		}
+	}
+	_, err = upload.CloseAndReceive()
+	assert.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+
+	_, err = client.CancelJob(ctx, connect.NewRequest(&apiv1.CancelJobRequest{Id: started.Msg.Job.Id}))
+	assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+}
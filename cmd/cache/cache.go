@@ -13,8 +13,9 @@ type options struct {
 
 func (o *options) AddFlags(_ *cobra.Command) {}
 
-func (o *options) Run(_ *cobra.Command, _ []string) error {
-	if err := pkg.Cache(o.storage); err != nil {
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	if err := pkg.Cache(ctx, o.storage); err != nil {
 		return fmt.Errorf("failed to cache: %w", err)
 	}
 
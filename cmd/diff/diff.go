@@ -0,0 +1,136 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage      pkg.Storage
+	from         string
+	to           string
+	fromSnapshot string
+	toSnapshot   string
+	output       string
+	top          int
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.from, "from", "", "name of the root whose dependencies are the old side, the whole graph if empty")
+	cmd.Flags().StringVar(&o.to, "to", "", "name of the root whose dependencies are the new side, the whole graph if empty")
+	cmd.Flags().StringVar(&o.fromSnapshot, "from-snapshot", "", "snapshot file to read the old side from instead of the store")
+	cmd.Flags().StringVar(&o.toSnapshot, "to-snapshot", "", "snapshot file to read the new side from instead of the store")
+	cmd.Flags().StringVar(&o.output, "output", "text", "report format, text or json")
+	cmd.Flags().IntVar(&o.top, "top", pkg.DefaultDiffLeaderboardSize, "number of most depended on packages whose leaderboard positions are compared")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+
+	if o.output != "text" && o.output != "json" {
+		return fmt.Errorf("unknown output format %s, expected text or json", o.output)
+	}
+	if o.from == "" && o.to == "" && o.fromSnapshot == "" && o.toSnapshot == "" {
+		return fmt.Errorf("nothing to compare, set --from and --to, or --from-snapshot and --to-snapshot")
+	}
+
+	from, err := o.side(cmd, o.from, o.fromSnapshot)
+	if err != nil {
+		return err
+	}
+	to, err := o.side(cmd, o.to, o.toSnapshot)
+	if err != nil {
+		return err
+	}
+	diff, err := pkg.DiffGraphs(ctx, from, to, pkg.DiffOptions{LeaderboardSize: o.top})
+	if err != nil {
+		return fmt.Errorf("failed to diff graphs: %w", err)
+	}
+
+	if o.output == "json" {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal diff: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printDiff(diff)
+	return nil
+}
+
+// side reads the graph of a side from its snapshot file, or from the store when there's none.
+func (o *options) side(cmd *cobra.Command, root, snapshotPath string) (pkg.DiffSide, error) {
+	if snapshotPath == "" {
+		return pkg.DiffSide{Storage: o.storage, Root: root}, nil
+	}
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return pkg.DiffSide{}, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+	snapshot, err := pkg.ReadSnapshot(file)
+	if err != nil {
+		return pkg.DiffSide{}, fmt.Errorf("failed to read %s: %w", snapshotPath, err)
+	}
+	storage := pkg.NewMemoryStorage()
+	if err := pkg.LoadSnapshot(cmd.Context(), snapshot, storage); err != nil {
+		return pkg.DiffSide{}, fmt.Errorf("failed to load %s: %w", snapshotPath, err)
+	}
+	return pkg.DiffSide{Storage: storage, Root: root}, nil
+}
+
+func printDiff(diff *pkg.GraphDiff) {
+	fmt.Printf("Added: %d\n", len(diff.Added))
+	for _, name := range diff.Added {
+		fmt.Printf("  + %s\n", name)
+	}
+	fmt.Printf("Removed: %d\n", len(diff.Removed))
+	for _, name := range diff.Removed {
+		fmt.Printf("  - %s\n", name)
+	}
+	fmt.Printf("Version changes: %d\n", len(diff.VersionChanges))
+	for _, change := range diff.VersionChanges {
+		fmt.Printf("  %s %s -> %s\n", change.Package, change.From, change.To)
+	}
+	fmt.Printf("New vulnerabilities: %d\n", len(diff.NewVulnerabilities))
+	for _, change := range diff.NewVulnerabilities {
+		fmt.Printf("  %s via %s\n", change.Vulnerability, strings.Join(change.Packages, ", "))
+	}
+	fmt.Printf("Fixed vulnerabilities: %d\n", len(diff.FixedVulnerabilities))
+	for _, change := range diff.FixedVulnerabilities {
+		fmt.Printf("  %s\n", change.Vulnerability)
+	}
+	fmt.Printf("Leaderboard changes: %d\n", len(diff.LeaderboardChanges))
+	for _, position := range diff.LeaderboardChanges {
+		fmt.Printf("  %s %s -> %s\n", position.Package, rank(position.From), rank(position.To))
+	}
+}
+
+func rank(position int) string {
+	if position == 0 {
+		return "unranked"
+	}
+	return fmt.Sprintf("#%d", position)
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "diff",
+		Short:             "Compare the dependencies of two roots, or two snapshots of the graph",
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
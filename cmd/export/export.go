@@ -0,0 +1,32 @@
+package export
+
+import (
+	"github.com/bit-bom/minefield/cmd/export/graph"
+	"github.com/bit-bom/minefield/cmd/export/sbom"
+	"github.com/bit-bom/minefield/cmd/export/vex"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct{}
+
+func (o *options) AddFlags(_ *cobra.Command) {
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "export",
+		Short:             "Export documents about the products in the graph",
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+	}
+
+	o.AddFlags(cmd)
+
+	cmd.AddCommand(graph.New(storage))
+	cmd.AddCommand(sbom.New(storage))
+	cmd.AddCommand(vex.New(storage))
+
+	return cmd
+}
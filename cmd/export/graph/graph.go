@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage    pkg.Storage
+	format     string
+	label      string
+	attributes []string
+	output     string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.format, "format", "graphml", fmt.Sprintf("graph format, one of %s or neo4j-csv", strings.Join(export.GraphFormats, ", ")))
+	cmd.Flags().StringVar(&o.label, "label", "name", "what to label nodes with, name, id, type or a metadata attribute such as version")
+	cmd.Flags().StringSliceVar(&o.attributes, "attributes", nil, "metadata attributes to include on each node, or * for all of them")
+	cmd.Flags().StringVar(&o.output, "output", "", "file to write the graph to, stdout by default, or the directory to write nodes.csv and relationships.csv to for neo4j-csv")
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	opts := export.GraphOptions{
+		Label:      o.label,
+		Attributes: o.attributes,
+	}
+
+	// Without a query, the whole graph is exported
+	var nodes *roaring.Bitmap
+	if script := strings.Join(args, " "); script != "" {
+		var err error
+		nodes, err = pkg.ParseAndExecute(ctx, script, o.storage, "")
+		if err != nil {
+			return fmt.Errorf("failed to parse and execute script: %w", err)
+		}
+	}
+
+	if o.format == "neo4j-csv" {
+		if o.output == "" {
+			return fmt.Errorf("neo4j-csv needs an output directory")
+		}
+		return o.writeNeo4jCSV(cmd, nodes, opts)
+	}
+
+	var w io.Writer = os.Stdout
+	if o.output != "" {
+		file, err := os.Create(o.output)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := export.WriteGraph(ctx, o.storage, nodes, o.format, w, opts); err != nil {
+		return fmt.Errorf("failed to export graph: %w", err)
+	}
+	return nil
+}
+
+func (o *options) writeNeo4jCSV(cmd *cobra.Command, nodes *roaring.Bitmap, opts export.GraphOptions) error {
+	if err := os.MkdirAll(o.output, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	nodesFile, err := os.Create(filepath.Join(o.output, "nodes.csv"))
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer nodesFile.Close()
+	relationshipsFile, err := os.Create(filepath.Join(o.output, "relationships.csv"))
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer relationshipsFile.Close()
+
+	if err := export.WriteNeo4jCSV(cmd.Context(), o.storage, nodes, nodesFile, relationshipsFile, opts); err != nil {
+		return fmt.Errorf("failed to export graph: %w", err)
+	}
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "graph [script]",
+		Short:             "Export the graph, or the nodes a query returns, as GraphML, GEXF, Mermaid, Cytoscape JSON, DOT or for Neo4j",
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,78 @@
+package sbom
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+	roots   []string
+	format  string
+	name    string
+	version string
+	author  string
+	output  string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&o.roots, "root", nil, "purls of the components to export with their dependencies, merged under a release component when there are several")
+	cmd.Flags().StringVar(&o.format, "format", "cyclonedx-1.5", fmt.Sprintf("SBOM format, one of %s", strings.Join(formats(), ", ")))
+	cmd.Flags().StringVar(&o.name, "name", "", "name of the document and of the release component, the root's purl by default")
+	cmd.Flags().StringVar(&o.version, "version", "", "version of the release component")
+	cmd.Flags().StringVar(&o.author, "author", export.DefaultAuthor, "author of the document")
+	cmd.Flags().StringVar(&o.output, "output", "", "file to write the SBOM to, stdout by default")
+	_ = cmd.MarkFlagRequired("root")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	data, err := export.SBOM(ctx, o.storage, o.roots, o.format, export.SBOMOptions{
+		Name:    o.name,
+		Version: o.version,
+		Author:  o.author,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export SBOM: %w", err)
+	}
+
+	if o.output == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.WriteFile(o.output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write SBOM: %w", err)
+	}
+	return nil
+}
+
+func formats() []string {
+	var names []string
+	for name := range export.SBOMFormats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "sbom",
+		Short:             "Export the dependency closure of components as a CycloneDX or SPDX SBOM",
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
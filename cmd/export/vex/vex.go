@@ -0,0 +1,80 @@
+package vex
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage   pkg.Storage
+	product   string
+	format    string
+	author    string
+	namespace string
+	id        string
+	output    string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.product, "product", "", "purl of the product to export the VEX document of")
+	cmd.Flags().StringVar(&o.format, "format", "openvex", "document format, openvex or csaf")
+	cmd.Flags().StringVar(&o.author, "author", export.DefaultAuthor, "author of the document, the publisher for CSAF")
+	cmd.Flags().StringVar(&o.namespace, "namespace", "", "namespace of the CSAF publisher")
+	cmd.Flags().StringVar(&o.id, "id", "", "document ID, derived from the statements by default")
+	cmd.Flags().StringVar(&o.output, "output", "", "file to write the document to, stdout by default")
+	_ = cmd.MarkFlagRequired("product")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	opts := export.VEXOptions{
+		Author:    o.author,
+		Namespace: o.namespace,
+		ID:        o.id,
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	switch o.format {
+	case "openvex":
+		data, err = export.OpenVEX(ctx, o.storage, o.product, opts)
+	case "csaf":
+		data, err = export.CSAFVEX(ctx, o.storage, o.product, opts)
+	default:
+		return fmt.Errorf("unknown format %s, expected openvex or csaf", o.format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export VEX document: %w", err)
+	}
+
+	if o.output == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	if err := os.WriteFile(o.output, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write VEX document: %w", err)
+	}
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "vex",
+		Short:             "Export the VEX status of every vulnerability reachable from a product as OpenVEX or CSAF",
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
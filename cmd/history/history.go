@@ -0,0 +1,69 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+	output  string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.output, "output", "table", "output format, table or json")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+
+	if o.output != "table" && o.output != "json" {
+		return fmt.Errorf("unknown output format %s, expected table or json", o.output)
+	}
+	versions, err := o.storage.GetGraphVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get graph versions: %w", err)
+	}
+
+	if o.output == "json" {
+		data, err := json.MarshalIndent(versions, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal graph versions: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Version", "Created", "Source", "Documents"})
+	table.SetAutoWrapText(false)
+	for _, version := range versions {
+		table.Append([]string{strconv.FormatUint(uint64(version.Version), 10), version.Created.Format(time.RFC3339), version.Source, strings.Join(version.Documents, "\n")})
+	}
+	table.Render()
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "history",
+		Short:             "List the versions of the graph and the documents whose ingest created them",
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -1,8 +1,10 @@
 package ingest
 
 import (
+	"github.com/bit-bom/minefield/cmd/ingest/lockfile"
 	"github.com/bit-bom/minefield/cmd/ingest/osv"
 	"github.com/bit-bom/minefield/cmd/ingest/sbom"
+	"github.com/bit-bom/minefield/cmd/ingest/vex"
 	"github.com/bit-bom/minefield/pkg"
 	"github.com/spf13/cobra"
 )
@@ -20,7 +22,9 @@ func New(storage pkg.Storage) *cobra.Command {
 		DisableAutoGenTag: true,
 	}
 
+	cmd.AddCommand(lockfile.New(storage))
 	cmd.AddCommand(osv.New(storage))
 	cmd.AddCommand(sbom.New(storage))
+	cmd.AddCommand(vex.New(storage))
 	return cmd
 }
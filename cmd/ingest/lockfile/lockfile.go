@@ -0,0 +1,75 @@
+package lockfile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+	format  string
+	name    string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	formats := make([]string, len(ingest.LockfileFormats))
+	for i, format := range ingest.LockfileFormats {
+		formats[i] = string(format)
+	}
+	cmd.Flags().StringVar(&o.format, "format", "", fmt.Sprintf("lockfile format, detected from the file name if empty (%s)", strings.Join(formats, ", ")))
+	cmd.Flags().StringVar(&o.name, "name", "", "name that identifies the project of a lockfile read from stdin, so ingesting it again replaces it")
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	path := args[0]
+
+	if path == ingest.StdinPath && (o.format == "" || o.name == "") {
+		return fmt.Errorf("--format and --name are required when reading a lockfile from stdin")
+	}
+
+	report, err := ingest.Lockfile(ctx, path, o.storage, ingest.LockfileOptions{Format: ingest.LockfileFormat(o.format), Name: o.name})
+	if report != nil {
+		fmt.Printf("Files ingested: %d\n", report.Files)
+		fmt.Printf("Nodes created: %d\n", report.Nodes)
+		fmt.Printf("Edges created: %d\n", report.Edges)
+		fmt.Printf("Duplicate nodes: %d\n", report.Duplicates)
+		fmt.Printf("Edges removed: %d\n", report.RemovedEdges)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ingest lockfile: %w", err)
+	}
+
+	fmt.Println("Lockfile ingested successfully")
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:   "lockfile [path]",
+		Short: "Ingest the dependency tree in a lockfile into the storage",
+		Long: `Ingest the dependency tree in a lockfile into the storage, without generating an SBOM first.
+
+Supported lockfiles are go.mod, go.sum, the output of go mod graph saved as go.mod.graph,
+package-lock.json, yarn.lock, pnpm-lock.yaml, poetry.lock, Cargo.lock and Gemfile.lock.
+The path can be a lockfile, a directory searched recursively for the preferred lockfile of each ecosystem
+in every directory, such as go.mod over go.sum and package-lock.json over yarn.lock,
+or - to read a lockfile of the given --format from stdin.
+
+Each lockfile is recorded as a document identified by its ecosystem and the absolute path of its directory,
+so ingesting it again replaces what it declared before. Lockfiles read from stdin are identified by --name instead.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -2,6 +2,8 @@ package osv
 
 import (
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/bit-bom/minefield/pkg"
 	"github.com/bit-bom/minefield/pkg/ingest"
@@ -9,14 +11,50 @@ import (
 )
 
 type options struct {
-	storage pkg.Storage
+	storage     pkg.Storage
+	from        string
+	url         string
+	batchSize   int
+	concurrency int
+	retries     int
+	timeout     time.Duration
+	cacheDir    string
+	cacheTTL    time.Duration
 }
 
-func (o *options) AddFlags(_ *cobra.Command) {}
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.from, "from", "", "match packages against a local OSV export, a zip of OSV JSON files such as an ecosystem's all.zip or a directory of them, instead of querying OSV.dev")
+	cmd.Flags().StringVar(&o.url, "osv-url", ingest.DefaultOSVURL, "base URL of the OSV API, such as a mirror of api.osv.dev")
+	cmd.Flags().IntVar(&o.batchSize, "batch-size", ingest.DefaultOSVBatchSize, "number of packages to query OSV for in each request, at most 1000")
+	cmd.Flags().IntVar(&o.concurrency, "concurrency", ingest.DefaultOSVConcurrency, "number of requests to send to OSV at once")
+	cmd.Flags().IntVar(&o.retries, "retries", ingest.DefaultOSVRetries, "number of times to retry a request that is rate limited or fails with a server error, with exponential backoff")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", ingest.DefaultOSVTimeout, "timeout of each request to OSV")
+	cmd.Flags().StringVar(&o.cacheDir, "cache-dir", "", "directory to cache OSV responses in")
+	cmd.Flags().DurationVar(&o.cacheTTL, "cache-ttl", 24*time.Hour, "how long cached OSV responses are used for, 0 to use them forever")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	if o.from != "" {
+		if err := ingest.VulnerabilitiesFromOSVExport(ctx, o.storage, o.from, nil); err != nil {
+			return fmt.Errorf("failed to ingest vulnerabilities from %s: %w", o.from, err)
+		}
+		fmt.Println("Vulnerabilities ingested successfully")
+		return nil
+	}
+
+	client := ingest.NewOSVClient(ingest.OSVClientOptions{
+		BaseURL:     o.url,
+		HTTPClient:  &http.Client{Timeout: o.timeout},
+		BatchSize:   o.batchSize,
+		Concurrency: o.concurrency,
+		Retries:     o.retries,
+		CacheDir:    o.cacheDir,
+		CacheTTL:    o.cacheTTL,
+	})
 
-func (o *options) Run(_ *cobra.Command, _ []string) error {
 	// Ingest SBOM
-	if err := ingest.Vulnerabilities(o.storage); err != nil {
+	if err := ingest.VulnerabilitiesWithClient(ctx, o.storage, client, nil); err != nil {
 		return fmt.Errorf("failed to ingest SBOM: %w", err)
 	}
 
@@ -29,8 +67,16 @@ func New(storage pkg.Storage) *cobra.Command {
 		storage: storage,
 	}
 	cmd := &cobra.Command{
-		Use:               "osv",
-		Short:             "Ingest vulnerabilities into the storage",
+		Use:   "osv",
+		Short: "Ingest vulnerabilities into the storage",
+		Long: `Ingest vulnerabilities into the storage.
+
+By default packages are looked up on OSV.dev, in batches of up to 1000 with --concurrency requests at once.
+Rate limited and failed requests are retried with exponential backoff, and --cache-dir keeps responses
+on disk for --cache-ttl so repeated runs don't query OSV again. With --from, packages are matched against a local
+OSV export instead, without any network calls, such as the all.zip files of https://osv-vulnerabilities.storage.googleapis.com.
+Affected versions are matched locally using the SEMVER and ECOSYSTEM ranges and the listed versions;
+GIT ranges only match the commits they name.`,
 		RunE:              o.Run,
 		DisableAutoGenTag: true,
 	}
@@ -1,7 +1,13 @@
 package sbom
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/bit-bom/minefield/pkg"
 	"github.com/bit-bom/minefield/pkg/ingest"
@@ -9,30 +15,173 @@ import (
 )
 
 type options struct {
-	storage pkg.Storage
+	storage         pkg.Storage
+	workers         int
+	include         []string
+	exclude         []string
+	continueOnError bool
+	relationships   []string
+	spdxNamespace   bool
+	validate        bool
+	dryRun          bool
+	output          string
+	watch           bool
+	debounce        time.Duration
+	cache           bool
+	watchState      string
 }
 
-func (o *options) AddFlags(_ *cobra.Command) {}
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&o.workers, "workers", runtime.NumCPU(), "number of SBOMs to ingest concurrently")
+	cmd.Flags().StringSliceVar(&o.include, "include", nil, "only ingest files in a directory or archive matching these glob patterns")
+	cmd.Flags().StringSliceVar(&o.exclude, "exclude", nil, "skip files and directories matching these glob patterns")
+	cmd.Flags().BoolVar(&o.continueOnError, "continue-on-error", false, "keep ingesting after a SBOM fails and report the failures at the end")
+	cmd.Flags().BoolVar(&o.validate, "validate", false, "check each SBOM for problems first, and don't ingest SBOMs with errors")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "validate SBOMs and report what would be ingested, without writing anything")
+	cmd.Flags().StringVar(&o.output, "output", "text", "report format, text or json")
+	cmd.Flags().BoolVar(&o.watch, "watch", false, "keep watching the directory and ingest SBOMs as they're added or changed, until interrupted")
+	cmd.Flags().DurationVar(&o.debounce, "debounce", ingest.DefaultWatchDebounce, "how long to wait for changes to settle before ingesting, when watching")
+	cmd.Flags().BoolVar(&o.cache, "cache", false, "cache the graph after each batch of SBOMs is ingested, when watching")
+	cmd.Flags().StringVar(&o.watchState, "watch-state", "", "file to remember which SBOMs were ingested in, so a restarted watch doesn't ingest them again")
+	cmd.Flags().StringSliceVar(&o.relationships, "relationship", nil, "override how a relationship type is added to the graph, as TYPE=dependsOn, TYPE=dependencyOf or TYPE=ignore (e.g. CONTAINS=ignore)")
+	cmd.Flags().BoolVar(&o.spdxNamespace, "spdx-namespace-identity", false, "identify SPDX documents by their namespace instead of their name, for tools that keep the namespace the same across versions")
+}
 
-func (o *options) Run(_ *cobra.Command, args []string) error {
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	sbomPath := args[0]
 
+	if o.output != "text" && o.output != "json" {
+		return fmt.Errorf("unknown output format %s, expected text or json", o.output)
+	}
+	relationships, err := ingest.ParseRelationshipMapping(o.relationships)
+	if err != nil {
+		return err
+	}
+
+	sbomOptions := ingest.SBOMOptions{
+		Workers:         o.workers,
+		Include:         o.include,
+		Exclude:         o.exclude,
+		ContinueOnError: o.continueOnError,
+		Relationships:   relationships,
+		Validate:        o.validate,
+		DryRun:          o.dryRun,
+
+		SPDXNamespaceIdentity: o.spdxNamespace,
+	}
+
+	if o.watch {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err := ingest.Watch(ctx, sbomPath, o.storage, ingest.WatchOptions{
+			SBOMOptions: sbomOptions,
+			Debounce:    o.debounce,
+			Cache:       o.cache,
+			StatePath:   o.watchState,
+			OnBatch: func(report *ingest.SBOMReport, err error) {
+				if report != nil {
+					if printErr := o.printReport(report); printErr != nil {
+						fmt.Fprintln(os.Stderr, printErr)
+					}
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to ingest SBOMs: %v\n", err)
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", sbomPath, err)
+		}
+		return nil
+	}
+
 	// Ingest SBOM
-	if err := ingest.SBOM(sbomPath, o.storage); err != nil {
+	report, err := ingest.SBOMWithOptions(ctx, sbomPath, o.storage, sbomOptions)
+	if report != nil {
+		if err := o.printReport(report); err != nil {
+			return err
+		}
+	}
+	if err != nil {
 		return fmt.Errorf("failed to ingest SBOM: %w", err)
 	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("failed to ingest %d of %d SBOMs", len(report.Errors), len(report.Errors)+report.Files)
+	}
+	if errors := report.ValidationErrors(); errors > 0 {
+		return fmt.Errorf("found %d validation errors", errors)
+	}
 
-	fmt.Println("SBOM ingested successfully")
+	if o.output == "text" {
+		if o.dryRun {
+			fmt.Println("SBOM validated, nothing was written")
+		} else {
+			fmt.Println("SBOM ingested successfully")
+		}
+	}
 	return nil
 }
 
+func (o *options) printReport(report *ingest.SBOMReport) error {
+	if o.output == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	printReport(report)
+	return nil
+}
+
+func printReport(report *ingest.SBOMReport) {
+	fmt.Printf("Files ingested: %d\n", report.Files)
+	fmt.Printf("Nodes created: %d\n", report.Nodes)
+	fmt.Printf("Edges created: %d\n", report.Edges)
+	fmt.Printf("Duplicate nodes: %d\n", report.Duplicates)
+	fmt.Printf("Edges removed: %d\n", report.RemovedEdges)
+	if len(report.Issues) > 0 {
+		fmt.Printf("Issues: %d\n", len(report.Issues))
+		for _, issue := range report.Issues {
+			fmt.Printf("  %s %s: %s: %s\n", issue.Severity, issue.Document, issue.Code, issue.Message)
+		}
+	}
+	if len(report.Errors) > 0 {
+		fmt.Printf("Errors: %d\n", len(report.Errors))
+		for _, fileErr := range report.Errors {
+			fmt.Printf("  %s: %v\n", fileErr.Path, fileErr.Err)
+		}
+	}
+}
+
 func New(storage pkg.Storage) *cobra.Command {
 	o := &options{
 		storage: storage,
 	}
 	cmd := &cobra.Command{
-		Use:               "sbom [sbomPath]",
-		Short:             "Ingest an SBOM into the storage",
+		Use:   "sbom [sbomPath]",
+		Short: "Ingest an SBOM into the storage",
+		Long: `Ingest an SBOM into the storage.
+
+The path can be an SBOM file, a .tar, .tar.gz or .zip archive of SBOMs, an OCI image layout,
+a directory of any of those, or - to read an SBOM or archive from stdin.
+SBOMs in OCI image layouts are found by media type, including SBOMs wrapped in in-toto attestations.
+
+Relationships are added in the direction SPDX defines them, so a package depends on what it contains
+or what is its BUILD_TOOL_OF, DEV_DEPENDENCY_OF and so on. Relationships such as COPY_OF, VARIANT_OF
+and OTHER are left out. Use --relationship to change how a type is added.
+
+--validate checks for dangling edges, duplicate node IDs, invalid or missing purls and new dependency cycles,
+and --dry-run reports them along with what would be ingested without writing anything.
+The command exits with an error if any SBOM has a validation error.
+
+--watch ingests the SBOMs in a directory and then keeps ingesting SBOMs as they're added or changed,
+reporting each batch, until interrupted. SBOMs are remembered by content hash, so rewriting a file
+with the same content doesn't ingest it again, and failed SBOMs are tried again when they change.
+With --cache the graph is cached incrementally after each batch.`,
 		Args:              cobra.ExactArgs(1),
 		RunE:              o.Run,
 		DisableAutoGenTag: true,
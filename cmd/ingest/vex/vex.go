@@ -0,0 +1,55 @@
+package vex
+
+import (
+	"fmt"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+}
+
+func (o *options) AddFlags(_ *cobra.Command) {}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	report, err := ingest.VEX(ctx, args[0], o.storage)
+	if report != nil {
+		fmt.Printf("Documents ingested: %d\n", report.Documents)
+		fmt.Printf("Statements recorded: %d\n", report.Statements)
+		fmt.Printf("Unmatched statements: %d\n", report.Unmatched)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ingest VEX: %w", err)
+	}
+
+	fmt.Println("VEX ingested successfully")
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:   "vex [path]",
+		Short: "Ingest OpenVEX and CycloneDX VEX statements about vulnerabilities",
+		Long: `Ingest OpenVEX and CycloneDX VEX statements about vulnerabilities.
+
+Each statement's status, justification and impact statement are recorded on the dependencies of the packages
+it names on the vulnerability, scoped to the product it applies to. Vulnerabilities that statements say a product
+isn't affected by, or has fixed, are left out of its vulnerability reports and queries.
+Ingest vulnerabilities first, as statements about vulnerabilities that aren't in the graph are skipped.
+The path can be a VEX document, an archive or directory of them, or - to read one from stdin.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,41 @@
+package cancel
+
+import (
+	"fmt"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/jobs"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+}
+
+func (o *options) AddFlags(_ *cobra.Command) {}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := jobs.Cancel(ctx, o.storage, args[0]); err != nil {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	fmt.Println("Cancellation requested for job", args[0])
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "cancel [jobID]",
+		Short:             "Cancel a pending or running job",
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"github.com/bit-bom/minefield/cmd/jobs/cancel"
+	"github.com/bit-bom/minefield/cmd/jobs/list"
+	"github.com/bit-bom/minefield/cmd/jobs/status"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+func New(storage pkg.Storage) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "jobs",
+		Short:             "inspect and cancel background jobs",
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(list.New(storage))
+	cmd.AddCommand(status.New(storage))
+	cmd.AddCommand(cancel.New(storage))
+	return cmd
+}
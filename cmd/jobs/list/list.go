@@ -0,0 +1,63 @@
+package list
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage   pkg.Storage
+	maxOutput int
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&o.maxOutput, "max-output", 10, "max output length")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	jobs, err := o.storage.GetJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get jobs: %w", err)
+	}
+
+	// Newest jobs first
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Type", "Args", "Status", "Progress", "Created"})
+
+	for index, job := range jobs {
+		if index > o.maxOutput {
+			break
+		}
+		table.Append([]string{job.ID, string(job.Type), strings.Join(job.Args, " "), string(job.Status), fmt.Sprintf("%d/%d", job.Done, job.Total), job.CreatedAt.Format("2006-01-02 15:04:05")})
+	}
+
+	table.Render()
+
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "list",
+		Short:             "List jobs, newest first",
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
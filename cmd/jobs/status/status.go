@@ -0,0 +1,66 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+	logs    bool
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.logs, "logs", false, "print the job's logs")
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	job, err := o.storage.GetJob(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	fmt.Println("ID:      ", job.ID)
+	fmt.Println("Type:    ", job.Type)
+	fmt.Println("Args:    ", strings.Join(job.Args, " "))
+	fmt.Println("Status:  ", job.Status)
+	fmt.Printf("Progress:  %d/%d\n", job.Done, job.Total)
+	fmt.Println("Created: ", job.CreatedAt.Format(time.RFC3339))
+	if !job.StartedAt.IsZero() {
+		fmt.Println("Started: ", job.StartedAt.Format(time.RFC3339))
+	}
+	if !job.FinishedAt.IsZero() {
+		fmt.Println("Finished:", job.FinishedAt.Format(time.RFC3339))
+	}
+	if job.Error != "" {
+		fmt.Println("Error:   ", job.Error)
+	}
+	if o.logs {
+		for _, line := range job.Logs {
+			fmt.Println(line)
+		}
+	}
+
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "status [jobID]",
+		Short:             "Show the status and progress of a job",
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -19,8 +19,9 @@ func (o *options) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().IntVar(&o.maxOutput, "max-output", 10, "max output length")
 }
 
-func (o *options) Run(_ *cobra.Command, _ []string) error {
-	keys, err := o.storage.GetAllKeys()
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	keys, err := o.storage.GetAllKeys(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to query keys: %w", err)
 	}
@@ -33,7 +34,7 @@ func (o *options) Run(_ *cobra.Command, _ []string) error {
 		if index > o.maxOutput {
 			break
 		}
-		node, err := o.storage.GetNode(key)
+		node, err := o.storage.GetNode(ctx, key)
 		if err != nil {
 			fmt.Println("Failed to get name for ID:", err)
 			continue
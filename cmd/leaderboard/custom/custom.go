@@ -3,7 +3,6 @@ package custom
 import (
 	"fmt"
 	"os"
-	"sort"
 	"strconv"
 
 	"github.com/bit-bom/minefield/pkg"
@@ -17,54 +16,17 @@ type options struct {
 	maxOutput int
 }
 
-type query struct {
-	node   *pkg.Node
-	output []uint32
-}
-
 func (o *options) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&o.all, "all", false, "show the queries output for each node")
 	cmd.Flags().IntVar(&o.maxOutput, "max-output", 10, "max output length")
 }
 
-func (o *options) Run(_ *cobra.Command, args []string) error {
-	uncachedNodes, err := o.storage.ToBeCached()
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	entries, err := pkg.CustomLeaderboard(ctx, o.storage, args[0])
 	if err != nil {
 		return err
 	}
-	if len(uncachedNodes) != 0 {
-		return fmt.Errorf("cannot use sorted leaderboards without caching")
-	}
-
-	keys, err := o.storage.GetAllKeys()
-	if err != nil {
-		return fmt.Errorf("failed to query keys: %w", err)
-	}
-
-	// Print dependencies
-	queries := []query{}
-
-	for _, key := range keys {
-		node, err := o.storage.GetNode(key)
-		if err != nil {
-			return err
-		}
-
-		if node.Name == "" {
-			continue
-		}
-
-		execute, err := pkg.ParseAndExecute(args[0], o.storage, node.Name)
-		if err != nil {
-			return err
-		}
-
-		queries = append(queries, query{node: node, output: execute.ToArray()})
-	}
-
-	sort.Slice(queries, func(i, j int) bool {
-		return len(queries[i].output) > len(queries[j].output)
-	})
 
 	table := tablewriter.NewWriter(os.Stdout)
 
@@ -74,14 +36,14 @@ func (o *options) Run(_ *cobra.Command, args []string) error {
 		table.SetHeader([]string{"Name", "Type", "ID", "QueryLength"})
 	}
 
-	for index, q := range queries {
+	for index, entry := range entries {
 		if index > o.maxOutput {
 			break
 		}
 		if o.all {
-			table.Append([]string{q.node.Name, q.node.Type, strconv.Itoa(int(q.node.ID)), fmt.Sprint(q.output)})
+			table.Append([]string{entry.Node.Name, entry.Node.Type, strconv.Itoa(int(entry.Node.ID)), fmt.Sprint(entry.Output)})
 		} else {
-			table.Append([]string{q.node.Name, q.node.Type, strconv.Itoa(int(q.node.ID)), fmt.Sprint(len(q.output))})
+			table.Append([]string{entry.Node.Name, entry.Node.Type, strconv.Itoa(int(entry.Node.ID)), fmt.Sprint(len(entry.Output))})
 		}
 	}
 
@@ -43,8 +43,9 @@ func (o *options) validateWeights(weights *weightedNACD.Weights) error {
 	return nil
 }
 
-func (o *options) Run(_ *cobra.Command, _ []string) error {
-	uncachedNodes, err := o.storage.ToBeCached()
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	uncachedNodes, err := o.storage.ToBeCached(ctx)
 	if err != nil {
 		return err
 	}
@@ -67,7 +68,7 @@ func (o *options) Run(_ *cobra.Command, _ []string) error {
 		return err
 	}
 
-	results, err := weightedNACD.WeightedNACD(o.storage, weights)
+	results, err := weightedNACD.WeightedNACD(ctx, o.storage, weights)
 	if err != nil {
 		return fmt.Errorf("failed to calculate weighted NACD: %w", err)
 	}
@@ -80,7 +81,7 @@ func (o *options) Run(_ *cobra.Command, _ []string) error {
 		if index > o.maxOutput {
 			break
 		}
-		node, err := o.storage.GetNode(result.Id)
+		node, err := o.storage.GetNode(ctx, result.Id)
 		if err != nil {
 			fmt.Println("Failed to get node for ID:", err)
 			continue
@@ -0,0 +1,44 @@
+package copynamespace
+
+import (
+	"fmt"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+}
+
+func (o *options) AddFlags(_ *cobra.Command) {
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := o.storage.CopyNamespace(ctx, args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("Copied namespace %s to %s\n", args[0], args[1])
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:   "copy [from] [to]",
+		Short: "Create a namespace with a copy of the graph, caches, jobs and history of another",
+		Long: `Create a namespace with a copy of the graph, caches, jobs and history of another.
+
+The copy is made key by key and isn't atomic: anything written to the namespace being copied while it's copied
+may be only partly in the copy. Stop ingests, caching and jobs on it first to get a consistent copy.`,
+		Args:              cobra.ExactArgs(2),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,40 @@
+package create
+
+import (
+	"fmt"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+}
+
+func (o *options) AddFlags(_ *cobra.Command) {
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := o.storage.CreateNamespace(ctx, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Created namespace %s\n", args[0])
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "create [namespace]",
+		Short:             "Create an empty namespace",
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
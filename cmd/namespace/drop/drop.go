@@ -0,0 +1,40 @@
+package drop
+
+import (
+	"fmt"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+}
+
+func (o *options) AddFlags(_ *cobra.Command) {
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := o.storage.DropNamespace(ctx, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped namespace %s\n", args[0])
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "drop [namespace]",
+		Short:             "Delete a namespace and everything in it",
+		Args:              cobra.ExactArgs(1),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,34 @@
+package namespace
+
+import (
+	"github.com/bit-bom/minefield/cmd/namespace/copynamespace"
+	"github.com/bit-bom/minefield/cmd/namespace/create"
+	"github.com/bit-bom/minefield/cmd/namespace/drop"
+	"github.com/bit-bom/minefield/cmd/namespace/list"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct{}
+
+func (o *options) AddFlags(_ *cobra.Command) {
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "namespace",
+		Short:             "Manage the namespaces that keep separate graphs in one storage backend",
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+	}
+
+	o.AddFlags(cmd)
+
+	cmd.AddCommand(list.New(storage))
+	cmd.AddCommand(create.New(storage))
+	cmd.AddCommand(copynamespace.New(storage))
+	cmd.AddCommand(drop.New(storage))
+
+	return cmd
+}
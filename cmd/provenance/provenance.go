@@ -0,0 +1,88 @@
+package provenance
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+}
+
+func (o *options) AddFlags(_ *cobra.Command) {}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	ids := make([]uint32, len(args))
+	for i, name := range args {
+		id, err := o.storage.NameToID(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get node ID for name %s: %w", name, err)
+		}
+		ids[i] = id
+	}
+
+	var (
+		documents *roaring.Bitmap
+		err       error
+	)
+	if len(ids) == 1 {
+		documents, err = o.storage.GetNodeProvenance(ctx, ids[0])
+	} else {
+		documents, err = o.storage.GetEdgeProvenance(ctx, pkg.Edge{From: ids[0], To: ids[1]})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get provenance: %w", err)
+	}
+
+	nodes, err := o.storage.GetNodes(ctx, documents.ToArray())
+	if err != nil {
+		return fmt.Errorf("failed to get documents: %w", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "ID", "Version", "Date", "Authors", "Tools"})
+
+	for _, id := range documents.ToArray() {
+		node, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		metadata, err := pkg.NodeDocumentMetadata(node)
+		if err != nil {
+			return err
+		}
+		var date string
+		if !metadata.Date.IsZero() {
+			date = metadata.Date.Format(time.RFC3339)
+		}
+		table.Append([]string{node.Name, metadata.ID, metadata.Version, date, strings.Join(metadata.Authors, ", "), strings.Join(metadata.Tools, ", ")})
+	}
+
+	table.Render()
+
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "provenance [node] [dependency]",
+		Short:             "List the SBOM documents that declared a node, or that declared it depends on another node",
+		Args:              cobra.RangeArgs(1, 2),
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
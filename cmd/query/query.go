@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -14,58 +15,102 @@ import (
 )
 
 type options struct {
-	storage   pkg.Storage
-	outputdir string
-	maxOutput int
+	storage          pkg.Storage
+	outputdir        string
+	maxOutput        int
+	asOf             string
+	acrossNamespaces []string
 }
 
 func (o *options) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&o.outputdir, "output-dir", "", "specify dir to write the output to")
 	cmd.Flags().IntVar(&o.maxOutput, "max-output", 10, "max output length")
+	cmd.Flags().StringVar(&o.asOf, "as-of", "", "query the graph as it was in a version, given by its number, an RFC 3339 timestamp or a date")
+	cmd.Flags().StringSliceVar(&o.acrossNamespaces, "across-namespaces", nil, "run the query in each of these namespaces instead of the current one, * for all of them")
 }
 
-func (o *options) Run(_ *cobra.Command, args []string) error {
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	script := strings.Join(args, " ")
 
-	execute, err := pkg.ParseAndExecute(script, o.storage, "")
-	if err != nil {
-		return fmt.Errorf("failed to parse and execute script: %w", err)
+	// Queries only run in other namespaces when asked to, labeling the results with their namespace
+	storages := map[string]pkg.Storage{"": o.storage}
+	header := []string{"Name", "Type", "ID"}
+	if len(o.acrossNamespaces) > 0 {
+		var err error
+		if storages, err = pkg.NamespaceStorages(ctx, o.storage, o.acrossNamespaces); err != nil {
+			return err
+		}
+		header = append([]string{"Namespace"}, header...)
 	}
+
 	// Print dependencies
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Type", "ID"})
+	table.SetHeader(header)
 
-	for index, key := range execute.ToArray() {
-		if index > o.maxOutput {
-			break
+	namespaces := make([]string, 0, len(storages))
+	for namespace := range storages {
+		namespaces = append(namespaces, namespace)
+	}
+	slices.Sort(namespaces)
+	for _, namespace := range namespaces {
+		storage := storages[namespace]
+		if o.asOf != "" {
+			version, err := pkg.ResolveGraphVersion(ctx, storage, o.asOf)
+			if err != nil {
+				return err
+			}
+			if storage, err = pkg.GraphAsOf(ctx, storage, version); err != nil {
+				return fmt.Errorf("failed to get graph version %d: %w", version, err)
+			}
 		}
-		node, err := o.storage.GetNode(key)
+
+		execute, err := pkg.ParseAndExecute(ctx, script, storage, "")
 		if err != nil {
-			fmt.Println("Failed to get name for ID:", err)
-			continue
+			return fmt.Errorf("failed to parse and execute script: %w", err)
 		}
 
-		table.Append([]string{node.Name, node.Type, strconv.Itoa(int(node.ID))})
-
-		if o.outputdir != "" {
-			data, err := json.MarshalIndent(node.Metadata, "", "	")
-			if err != nil {
-				return fmt.Errorf("failed to marshal node metadata: %w", err)
+		for index, key := range execute.ToArray() {
+			if index > o.maxOutput {
+				break
 			}
-			if _, err := os.Stat(o.outputdir); err != nil {
-				return fmt.Errorf("output directory does not exist: %w", err)
+			node, err := storage.GetNode(ctx, key)
+			if err != nil {
+				fmt.Println("Failed to get name for ID:", err)
+				continue
 			}
 
-			filePath := filepath.Join(o.outputdir, pkg.SanitizeFilename(node.Name)+".json")
-			file, err := os.Create(filePath)
-			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
+			row := []string{node.Name, node.Type, strconv.Itoa(int(node.ID))}
+			if namespace != "" {
+				row = append([]string{namespace}, row...)
 			}
-			defer file.Close()
+			table.Append(row)
 
-			_, err = file.Write(data)
-			if err != nil {
-				return fmt.Errorf("failed to write data to file: %w", err)
+			if o.outputdir != "" {
+				data, err := json.MarshalIndent(node.Metadata, "", "	")
+				if err != nil {
+					return fmt.Errorf("failed to marshal node metadata: %w", err)
+				}
+				if _, err := os.Stat(o.outputdir); err != nil {
+					return fmt.Errorf("output directory does not exist: %w", err)
+				}
+
+				// Nodes of different namespaces can share a name, so each namespace gets its own directory
+				dir := filepath.Join(o.outputdir, pkg.SanitizeFilename(namespace))
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					return fmt.Errorf("failed to create directory: %w", err)
+				}
+				filePath := filepath.Join(dir, pkg.SanitizeFilename(node.Name)+".json")
+				file, err := os.Create(filePath)
+				if err != nil {
+					return fmt.Errorf("failed to create file: %w", err)
+				}
+				defer file.Close()
+
+				_, err = file.Write(data)
+				if err != nil {
+					return fmt.Errorf("failed to write data to file: %w", err)
+				}
 			}
 		}
 	}
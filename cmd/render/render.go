@@ -0,0 +1,83 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/render"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage  pkg.Storage
+	output   string
+	layout   string
+	maxDepth int
+	maxNodes int
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.output, "output", "graph.svg", "file to write the SVG diagram to, - for stdout")
+	cmd.Flags().StringVar(&o.layout, "layout", render.LayoutAuto, "layout, layered for DAGs, force for any graph, or auto to pick one")
+	cmd.Flags().IntVar(&o.maxDepth, "max-depth", 0, "leave out nodes more than this many edges below the roots of the subgraph, 0 for no limit")
+	cmd.Flags().IntVar(&o.maxNodes, "max-nodes", render.DefaultMaxNodes, "max number of nodes to render, keeping those closest to the roots, -1 for no limit")
+}
+
+func (o *options) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	// Without a query, the whole graph is rendered
+	var nodes *roaring.Bitmap
+	if script := strings.Join(args, " "); script != "" {
+		var err error
+		nodes, err = pkg.ParseAndExecute(ctx, script, o.storage, "")
+		if err != nil {
+			return fmt.Errorf("failed to parse and execute script: %w", err)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if o.output != "-" {
+		file, err := os.Create(o.output)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	result, err := render.SVG(ctx, o.storage, nodes, w, render.Options{
+		Layout:   o.layout,
+		MaxDepth: o.maxDepth,
+		MaxNodes: o.maxNodes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render graph: %w", err)
+	}
+
+	if o.output != "-" {
+		fmt.Printf("Rendered %d nodes and %d edges to %s with the %s layout\n", result.Nodes, result.Edges, o.output, result.Layout)
+	}
+	if result.Omitted > 0 {
+		fmt.Fprintf(os.Stderr, "Left out %d nodes over the depth or size limits\n", result.Omitted)
+	}
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "render [script]",
+		Short:             "Render the graph, or the nodes a query returns, as an SVG diagram",
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
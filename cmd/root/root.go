@@ -1,25 +1,60 @@
 package root
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/bit-bom/minefield/cmd/cache"
+	"github.com/bit-bom/minefield/cmd/diff"
+	"github.com/bit-bom/minefield/cmd/export"
+	"github.com/bit-bom/minefield/cmd/history"
 	"github.com/bit-bom/minefield/cmd/ingest"
+	"github.com/bit-bom/minefield/cmd/jobs"
 	"github.com/bit-bom/minefield/cmd/leaderboard"
+	"github.com/bit-bom/minefield/cmd/namespace"
+	"github.com/bit-bom/minefield/cmd/provenance"
 	"github.com/bit-bom/minefield/cmd/query"
+	"github.com/bit-bom/minefield/cmd/render"
+	"github.com/bit-bom/minefield/cmd/server"
+	"github.com/bit-bom/minefield/cmd/snapshot"
+	"github.com/bit-bom/minefield/cmd/vulns"
 	"github.com/bit-bom/minefield/pkg"
 	"github.com/spf13/cobra"
 )
 
-type options struct{}
+type options struct {
+	storage   pkg.Storage
+	namespace string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&o.namespace, "namespace", pkg.DefaultNamespace, "namespace of the graph to use")
+}
 
-func (o *options) AddFlags(_ *cobra.Command) {
+// useNamespace switches the storage to the namespace chosen, before any command uses it.
+func (o *options) useNamespace(cmd *cobra.Command, _ []string) error {
+	if o.namespace == pkg.DefaultNamespace {
+		return nil
+	}
+	namespaces, err := o.storage.Namespaces(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	if !slices.Contains(namespaces, o.namespace) {
+		return fmt.Errorf("namespace %s: %w, create it with namespace create", o.namespace, pkg.ErrNamespaceNotFound)
+	}
+	return o.storage.UseNamespace(o.namespace)
 }
 
 func New(storage pkg.Storage) *cobra.Command {
-	o := &options{}
+	o := &options{
+		storage: storage,
+	}
 	cmd := &cobra.Command{
 		Use:               "bitbom",
 		Short:             "graphing SBOM's with the power of roaring bitmaps",
 		SilenceUsage:      true,
+		PersistentPreRunE: o.useNamespace,
 		DisableAutoGenTag: true,
 	}
 
@@ -29,6 +64,16 @@ func New(storage pkg.Storage) *cobra.Command {
 	cmd.AddCommand(ingest.New(storage))
 	cmd.AddCommand(cache.New(storage))
 	cmd.AddCommand(leaderboard.New(storage))
+	cmd.AddCommand(jobs.New(storage))
+	cmd.AddCommand(provenance.New(storage))
+	cmd.AddCommand(server.New(storage))
+	cmd.AddCommand(vulns.New(storage))
+	cmd.AddCommand(export.New(storage))
+	cmd.AddCommand(render.New(storage))
+	cmd.AddCommand(diff.New(storage))
+	cmd.AddCommand(snapshot.New(storage))
+	cmd.AddCommand(history.New(storage))
+	cmd.AddCommand(namespace.New(storage))
 
 	return cmd
 }
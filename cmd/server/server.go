@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	service "github.com/bit-bom/minefield/api/v1"
+	"github.com/bit-bom/minefield/gen/api/v1/apiv1connect"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/jobs"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type options struct {
+	storage pkg.Storage
+	addr    string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.addr, "addr", "localhost:8089", "address to serve the API on")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	mux := http.NewServeMux()
+	runner := jobs.NewRunner(o.storage)
+	orphaned, err := runner.FailOrphaned(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to fail orphaned jobs: %w", err)
+	}
+	if orphaned > 0 {
+		fmt.Println("Marked", orphaned, "jobs left unfinished by a previous server as failed")
+	}
+	path, handler := apiv1connect.NewMinefieldServiceHandler(service.NewService(o.storage, runner), service.HandlerOptions()...)
+	mux.Handle(path, handler)
+
+	// h2c lets gRPC clients use HTTP/2 without TLS
+	server := &http.Server{
+		Addr:              o.addr,
+		Handler:           h2c.NewHandler(mux, &http2.Server{}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Println("Serving the minefield API on", o.addr)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	runner.Wait()
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:   "server",
+		Short: "Serve the minefield gRPC/Connect API",
+		Long: `Serve the minefield gRPC/Connect API.
+
+A server serves the one namespace given by --namespace for its whole lifetime, and requests can't choose another.
+Run a server per namespace to serve several.`,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
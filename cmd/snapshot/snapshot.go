@@ -0,0 +1,53 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage pkg.Storage
+	output  string
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.output, "output", "-", "file to write the snapshot to, - for stdout")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+
+	var w io.Writer = os.Stdout
+	if o.output != "-" {
+		file, err := os.Create(o.output)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := pkg.WriteSnapshot(ctx, o.storage, w); err != nil {
+		return fmt.Errorf("failed to snapshot graph: %w", err)
+	}
+	return nil
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "snapshot",
+		Short:             "Write a snapshot of the graph that diff can compare",
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
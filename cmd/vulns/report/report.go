@@ -0,0 +1,123 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	storage           pkg.Storage
+	products          []string
+	by                string
+	output            string
+	includeSuppressed bool
+}
+
+func (o *options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&o.products, "product", nil, "products to report on, by default the root components of every ingested SBOM")
+	cmd.Flags().StringVar(&o.by, "by", "product", "report view, product to list the vulnerabilities of each product or vulnerability to list the products each affects")
+	cmd.Flags().StringVar(&o.output, "output", "table", "report format, table, json or csv")
+	cmd.Flags().BoolVar(&o.includeSuppressed, "include-suppressed", false, "include vulnerabilities VEX statements say a product isn't affected by or has fixed")
+}
+
+func (o *options) Run(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	if o.by != "product" && o.by != "vulnerability" {
+		return fmt.Errorf("unknown report view %s, expected product or vulnerability", o.by)
+	}
+	if o.output != "table" && o.output != "json" && o.output != "csv" {
+		return fmt.Errorf("unknown output format %s, expected table, json or csv", o.output)
+	}
+
+	exposures, err := pkg.VulnerabilityExposures(ctx, o.storage, pkg.ExposureOptions{
+		Products:          o.products,
+		IncludeSuppressed: o.includeSuppressed,
+		FixedVersion: func(vuln *pkg.VulnerabilityMetadata, node *pkg.Node) string {
+			return ingest.FixedVersion(vuln, node.Name)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to report vulnerabilities: %w", err)
+	}
+
+	var (
+		report any
+		header []string
+		rows   [][]string
+	)
+	if o.by == "product" {
+		report = exposures
+		header = []string{"Product", "Vulnerability", "Severity", "Score", "Package", "Fixed", "Status", "Path"}
+		for _, exposure := range exposures {
+			rows = append(rows, []string{exposure.Product, exposure.Vulnerability, string(exposure.Severity), formatScore(exposure.Score), exposure.Package, exposure.FixedVersion, string(exposure.Status), strings.Join(exposure.Path, " -> ")})
+		}
+	} else {
+		impacts := pkg.VulnerabilityImpacts(exposures)
+		report = impacts
+		header = []string{"Vulnerability", "Severity", "Score", "Products", "Packages"}
+		for _, impact := range impacts {
+			rows = append(rows, []string{impact.Vulnerability, string(impact.Severity), formatScore(impact.Score), strings.Join(impact.Products, "\n"), strings.Join(impact.Packages, "\n")})
+		}
+	}
+
+	switch o.output {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(string(data))
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		for _, row := range rows {
+			for i := range row {
+				row[i] = strings.ReplaceAll(row[i], "\n", " ")
+			}
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	default:
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(header)
+		table.SetAutoWrapText(false)
+		table.AppendBulk(rows)
+		table.Render()
+	}
+	return nil
+}
+
+func formatScore(score float64) string {
+	if score == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(score, 'f', 1, 64)
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{
+		storage: storage,
+	}
+	cmd := &cobra.Command{
+		Use:               "report",
+		Short:             "List the vulnerabilities each product is exposed to, or the products each vulnerability affects",
+		Args:              cobra.NoArgs,
+		RunE:              o.Run,
+		DisableAutoGenTag: true,
+	}
+	o.AddFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,28 @@
+package vulns
+
+import (
+	"github.com/bit-bom/minefield/cmd/vulns/report"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/spf13/cobra"
+)
+
+type options struct{}
+
+func (o *options) AddFlags(_ *cobra.Command) {
+}
+
+func New(storage pkg.Storage) *cobra.Command {
+	o := &options{}
+	cmd := &cobra.Command{
+		Use:               "vulns",
+		Short:             "Report on the vulnerabilities products are exposed to",
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+	}
+
+	o.AddFlags(cmd)
+
+	cmd.AddCommand(report.New(storage))
+
+	return cmd
+}
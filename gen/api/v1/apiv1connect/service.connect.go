@@ -0,0 +1,419 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: api/v1/service.proto
+
+package apiv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/bit-bom/minefield/gen/api/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// MinefieldServiceName is the fully-qualified name of the MinefieldService service.
+	MinefieldServiceName = "minefield.v1.MinefieldService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// MinefieldServiceQueryProcedure is the fully-qualified name of the MinefieldService's Query RPC.
+	MinefieldServiceQueryProcedure = "/minefield.v1.MinefieldService/Query"
+	// MinefieldServiceIngestSBOMProcedure is the fully-qualified name of the MinefieldService's
+	// IngestSBOM RPC.
+	MinefieldServiceIngestSBOMProcedure = "/minefield.v1.MinefieldService/IngestSBOM"
+	// MinefieldServiceCacheProcedure is the fully-qualified name of the MinefieldService's Cache RPC.
+	MinefieldServiceCacheProcedure = "/minefield.v1.MinefieldService/Cache"
+	// MinefieldServiceGetNodeProcedure is the fully-qualified name of the MinefieldService's GetNode
+	// RPC.
+	MinefieldServiceGetNodeProcedure = "/minefield.v1.MinefieldService/GetNode"
+	// MinefieldServiceLeaderboardProcedure is the fully-qualified name of the MinefieldService's
+	// Leaderboard RPC.
+	MinefieldServiceLeaderboardProcedure = "/minefield.v1.MinefieldService/Leaderboard"
+	// MinefieldServiceWhyProcedure is the fully-qualified name of the MinefieldService's Why RPC.
+	MinefieldServiceWhyProcedure = "/minefield.v1.MinefieldService/Why"
+	// MinefieldServiceStartJobProcedure is the fully-qualified name of the MinefieldService's StartJob
+	// RPC.
+	MinefieldServiceStartJobProcedure = "/minefield.v1.MinefieldService/StartJob"
+	// MinefieldServiceUploadSBOMProcedure is the fully-qualified name of the MinefieldService's
+	// UploadSBOM RPC.
+	MinefieldServiceUploadSBOMProcedure = "/minefield.v1.MinefieldService/UploadSBOM"
+	// MinefieldServiceGetJobProcedure is the fully-qualified name of the MinefieldService's GetJob RPC.
+	MinefieldServiceGetJobProcedure = "/minefield.v1.MinefieldService/GetJob"
+	// MinefieldServiceListJobsProcedure is the fully-qualified name of the MinefieldService's ListJobs
+	// RPC.
+	MinefieldServiceListJobsProcedure = "/minefield.v1.MinefieldService/ListJobs"
+	// MinefieldServiceCancelJobProcedure is the fully-qualified name of the MinefieldService's
+	// CancelJob RPC.
+	MinefieldServiceCancelJobProcedure = "/minefield.v1.MinefieldService/CancelJob"
+)
+
+// These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
+var (
+	minefieldServiceServiceDescriptor           = v1.File_api_v1_service_proto.Services().ByName("MinefieldService")
+	minefieldServiceQueryMethodDescriptor       = minefieldServiceServiceDescriptor.Methods().ByName("Query")
+	minefieldServiceIngestSBOMMethodDescriptor  = minefieldServiceServiceDescriptor.Methods().ByName("IngestSBOM")
+	minefieldServiceCacheMethodDescriptor       = minefieldServiceServiceDescriptor.Methods().ByName("Cache")
+	minefieldServiceGetNodeMethodDescriptor     = minefieldServiceServiceDescriptor.Methods().ByName("GetNode")
+	minefieldServiceLeaderboardMethodDescriptor = minefieldServiceServiceDescriptor.Methods().ByName("Leaderboard")
+	minefieldServiceWhyMethodDescriptor         = minefieldServiceServiceDescriptor.Methods().ByName("Why")
+	minefieldServiceStartJobMethodDescriptor    = minefieldServiceServiceDescriptor.Methods().ByName("StartJob")
+	minefieldServiceUploadSBOMMethodDescriptor  = minefieldServiceServiceDescriptor.Methods().ByName("UploadSBOM")
+	minefieldServiceGetJobMethodDescriptor      = minefieldServiceServiceDescriptor.Methods().ByName("GetJob")
+	minefieldServiceListJobsMethodDescriptor    = minefieldServiceServiceDescriptor.Methods().ByName("ListJobs")
+	minefieldServiceCancelJobMethodDescriptor   = minefieldServiceServiceDescriptor.Methods().ByName("CancelJob")
+)
+
+// MinefieldServiceClient is a client for the minefield.v1.MinefieldService service.
+type MinefieldServiceClient interface {
+	// Query executes a query script and streams the matching nodes in batches.
+	Query(context.Context, *connect.Request[v1.QueryRequest]) (*connect.ServerStreamForClient[v1.QueryResponse], error)
+	// IngestSBOM ingests every SBOM document sent on the stream. Streams are limited to 256 MiB.
+	IngestSBOM(context.Context) *connect.ClientStreamForClient[v1.IngestSBOMRequest, v1.IngestSBOMResponse]
+	Cache(context.Context, *connect.Request[v1.CacheRequest]) (*connect.Response[v1.CacheResponse], error)
+	GetNode(context.Context, *connect.Request[v1.GetNodeRequest]) (*connect.Response[v1.GetNodeResponse], error)
+	Leaderboard(context.Context, *connect.Request[v1.LeaderboardRequest]) (*connect.Response[v1.LeaderboardResponse], error)
+	// Why returns the shortest dependency path between two nodes.
+	Why(context.Context, *connect.Request[v1.WhyRequest]) (*connect.Response[v1.WhyResponse], error)
+	// StartJob runs an ingest or cache operation in the background.
+	StartJob(context.Context, *connect.Request[v1.StartJobRequest]) (*connect.Response[v1.StartJobResponse], error)
+	// UploadSBOM stores the uploaded SBOM documents and ingests them in a background job. Uploads are limited to 256 MiB.
+	UploadSBOM(context.Context) *connect.ClientStreamForClient[v1.IngestSBOMRequest, v1.StartJobResponse]
+	GetJob(context.Context, *connect.Request[v1.GetJobRequest]) (*connect.Response[v1.GetJobResponse], error)
+	ListJobs(context.Context, *connect.Request[v1.ListJobsRequest]) (*connect.Response[v1.ListJobsResponse], error)
+	CancelJob(context.Context, *connect.Request[v1.CancelJobRequest]) (*connect.Response[v1.CancelJobResponse], error)
+}
+
+// NewMinefieldServiceClient constructs a client for the minefield.v1.MinefieldService service. By
+// default, it uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses,
+// and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the
+// connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewMinefieldServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) MinefieldServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &minefieldServiceClient{
+		query: connect.NewClient[v1.QueryRequest, v1.QueryResponse](
+			httpClient,
+			baseURL+MinefieldServiceQueryProcedure,
+			connect.WithSchema(minefieldServiceQueryMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		ingestSBOM: connect.NewClient[v1.IngestSBOMRequest, v1.IngestSBOMResponse](
+			httpClient,
+			baseURL+MinefieldServiceIngestSBOMProcedure,
+			connect.WithSchema(minefieldServiceIngestSBOMMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		cache: connect.NewClient[v1.CacheRequest, v1.CacheResponse](
+			httpClient,
+			baseURL+MinefieldServiceCacheProcedure,
+			connect.WithSchema(minefieldServiceCacheMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		getNode: connect.NewClient[v1.GetNodeRequest, v1.GetNodeResponse](
+			httpClient,
+			baseURL+MinefieldServiceGetNodeProcedure,
+			connect.WithSchema(minefieldServiceGetNodeMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		leaderboard: connect.NewClient[v1.LeaderboardRequest, v1.LeaderboardResponse](
+			httpClient,
+			baseURL+MinefieldServiceLeaderboardProcedure,
+			connect.WithSchema(minefieldServiceLeaderboardMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		why: connect.NewClient[v1.WhyRequest, v1.WhyResponse](
+			httpClient,
+			baseURL+MinefieldServiceWhyProcedure,
+			connect.WithSchema(minefieldServiceWhyMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		startJob: connect.NewClient[v1.StartJobRequest, v1.StartJobResponse](
+			httpClient,
+			baseURL+MinefieldServiceStartJobProcedure,
+			connect.WithSchema(minefieldServiceStartJobMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		uploadSBOM: connect.NewClient[v1.IngestSBOMRequest, v1.StartJobResponse](
+			httpClient,
+			baseURL+MinefieldServiceUploadSBOMProcedure,
+			connect.WithSchema(minefieldServiceUploadSBOMMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		getJob: connect.NewClient[v1.GetJobRequest, v1.GetJobResponse](
+			httpClient,
+			baseURL+MinefieldServiceGetJobProcedure,
+			connect.WithSchema(minefieldServiceGetJobMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		listJobs: connect.NewClient[v1.ListJobsRequest, v1.ListJobsResponse](
+			httpClient,
+			baseURL+MinefieldServiceListJobsProcedure,
+			connect.WithSchema(minefieldServiceListJobsMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		cancelJob: connect.NewClient[v1.CancelJobRequest, v1.CancelJobResponse](
+			httpClient,
+			baseURL+MinefieldServiceCancelJobProcedure,
+			connect.WithSchema(minefieldServiceCancelJobMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// minefieldServiceClient implements MinefieldServiceClient.
+type minefieldServiceClient struct {
+	query       *connect.Client[v1.QueryRequest, v1.QueryResponse]
+	ingestSBOM  *connect.Client[v1.IngestSBOMRequest, v1.IngestSBOMResponse]
+	cache       *connect.Client[v1.CacheRequest, v1.CacheResponse]
+	getNode     *connect.Client[v1.GetNodeRequest, v1.GetNodeResponse]
+	leaderboard *connect.Client[v1.LeaderboardRequest, v1.LeaderboardResponse]
+	why         *connect.Client[v1.WhyRequest, v1.WhyResponse]
+	startJob    *connect.Client[v1.StartJobRequest, v1.StartJobResponse]
+	uploadSBOM  *connect.Client[v1.IngestSBOMRequest, v1.StartJobResponse]
+	getJob      *connect.Client[v1.GetJobRequest, v1.GetJobResponse]
+	listJobs    *connect.Client[v1.ListJobsRequest, v1.ListJobsResponse]
+	cancelJob   *connect.Client[v1.CancelJobRequest, v1.CancelJobResponse]
+}
+
+// Query calls minefield.v1.MinefieldService.Query.
+func (c *minefieldServiceClient) Query(ctx context.Context, req *connect.Request[v1.QueryRequest]) (*connect.ServerStreamForClient[v1.QueryResponse], error) {
+	return c.query.CallServerStream(ctx, req)
+}
+
+// IngestSBOM calls minefield.v1.MinefieldService.IngestSBOM.
+func (c *minefieldServiceClient) IngestSBOM(ctx context.Context) *connect.ClientStreamForClient[v1.IngestSBOMRequest, v1.IngestSBOMResponse] {
+	return c.ingestSBOM.CallClientStream(ctx)
+}
+
+// Cache calls minefield.v1.MinefieldService.Cache.
+func (c *minefieldServiceClient) Cache(ctx context.Context, req *connect.Request[v1.CacheRequest]) (*connect.Response[v1.CacheResponse], error) {
+	return c.cache.CallUnary(ctx, req)
+}
+
+// GetNode calls minefield.v1.MinefieldService.GetNode.
+func (c *minefieldServiceClient) GetNode(ctx context.Context, req *connect.Request[v1.GetNodeRequest]) (*connect.Response[v1.GetNodeResponse], error) {
+	return c.getNode.CallUnary(ctx, req)
+}
+
+// Leaderboard calls minefield.v1.MinefieldService.Leaderboard.
+func (c *minefieldServiceClient) Leaderboard(ctx context.Context, req *connect.Request[v1.LeaderboardRequest]) (*connect.Response[v1.LeaderboardResponse], error) {
+	return c.leaderboard.CallUnary(ctx, req)
+}
+
+// Why calls minefield.v1.MinefieldService.Why.
+func (c *minefieldServiceClient) Why(ctx context.Context, req *connect.Request[v1.WhyRequest]) (*connect.Response[v1.WhyResponse], error) {
+	return c.why.CallUnary(ctx, req)
+}
+
+// StartJob calls minefield.v1.MinefieldService.StartJob.
+func (c *minefieldServiceClient) StartJob(ctx context.Context, req *connect.Request[v1.StartJobRequest]) (*connect.Response[v1.StartJobResponse], error) {
+	return c.startJob.CallUnary(ctx, req)
+}
+
+// UploadSBOM calls minefield.v1.MinefieldService.UploadSBOM.
+func (c *minefieldServiceClient) UploadSBOM(ctx context.Context) *connect.ClientStreamForClient[v1.IngestSBOMRequest, v1.StartJobResponse] {
+	return c.uploadSBOM.CallClientStream(ctx)
+}
+
+// GetJob calls minefield.v1.MinefieldService.GetJob.
+func (c *minefieldServiceClient) GetJob(ctx context.Context, req *connect.Request[v1.GetJobRequest]) (*connect.Response[v1.GetJobResponse], error) {
+	return c.getJob.CallUnary(ctx, req)
+}
+
+// ListJobs calls minefield.v1.MinefieldService.ListJobs.
+func (c *minefieldServiceClient) ListJobs(ctx context.Context, req *connect.Request[v1.ListJobsRequest]) (*connect.Response[v1.ListJobsResponse], error) {
+	return c.listJobs.CallUnary(ctx, req)
+}
+
+// CancelJob calls minefield.v1.MinefieldService.CancelJob.
+func (c *minefieldServiceClient) CancelJob(ctx context.Context, req *connect.Request[v1.CancelJobRequest]) (*connect.Response[v1.CancelJobResponse], error) {
+	return c.cancelJob.CallUnary(ctx, req)
+}
+
+// MinefieldServiceHandler is an implementation of the minefield.v1.MinefieldService service.
+type MinefieldServiceHandler interface {
+	// Query executes a query script and streams the matching nodes in batches.
+	Query(context.Context, *connect.Request[v1.QueryRequest], *connect.ServerStream[v1.QueryResponse]) error
+	// IngestSBOM ingests every SBOM document sent on the stream. Streams are limited to 256 MiB.
+	IngestSBOM(context.Context, *connect.ClientStream[v1.IngestSBOMRequest]) (*connect.Response[v1.IngestSBOMResponse], error)
+	Cache(context.Context, *connect.Request[v1.CacheRequest]) (*connect.Response[v1.CacheResponse], error)
+	GetNode(context.Context, *connect.Request[v1.GetNodeRequest]) (*connect.Response[v1.GetNodeResponse], error)
+	Leaderboard(context.Context, *connect.Request[v1.LeaderboardRequest]) (*connect.Response[v1.LeaderboardResponse], error)
+	// Why returns the shortest dependency path between two nodes.
+	Why(context.Context, *connect.Request[v1.WhyRequest]) (*connect.Response[v1.WhyResponse], error)
+	// StartJob runs an ingest or cache operation in the background.
+	StartJob(context.Context, *connect.Request[v1.StartJobRequest]) (*connect.Response[v1.StartJobResponse], error)
+	// UploadSBOM stores the uploaded SBOM documents and ingests them in a background job. Uploads are limited to 256 MiB.
+	UploadSBOM(context.Context, *connect.ClientStream[v1.IngestSBOMRequest]) (*connect.Response[v1.StartJobResponse], error)
+	GetJob(context.Context, *connect.Request[v1.GetJobRequest]) (*connect.Response[v1.GetJobResponse], error)
+	ListJobs(context.Context, *connect.Request[v1.ListJobsRequest]) (*connect.Response[v1.ListJobsResponse], error)
+	CancelJob(context.Context, *connect.Request[v1.CancelJobRequest]) (*connect.Response[v1.CancelJobResponse], error)
+}
+
+// NewMinefieldServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewMinefieldServiceHandler(svc MinefieldServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	minefieldServiceQueryHandler := connect.NewServerStreamHandler(
+		MinefieldServiceQueryProcedure,
+		svc.Query,
+		connect.WithSchema(minefieldServiceQueryMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceIngestSBOMHandler := connect.NewClientStreamHandler(
+		MinefieldServiceIngestSBOMProcedure,
+		svc.IngestSBOM,
+		connect.WithSchema(minefieldServiceIngestSBOMMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceCacheHandler := connect.NewUnaryHandler(
+		MinefieldServiceCacheProcedure,
+		svc.Cache,
+		connect.WithSchema(minefieldServiceCacheMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceGetNodeHandler := connect.NewUnaryHandler(
+		MinefieldServiceGetNodeProcedure,
+		svc.GetNode,
+		connect.WithSchema(minefieldServiceGetNodeMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceLeaderboardHandler := connect.NewUnaryHandler(
+		MinefieldServiceLeaderboardProcedure,
+		svc.Leaderboard,
+		connect.WithSchema(minefieldServiceLeaderboardMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceWhyHandler := connect.NewUnaryHandler(
+		MinefieldServiceWhyProcedure,
+		svc.Why,
+		connect.WithSchema(minefieldServiceWhyMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceStartJobHandler := connect.NewUnaryHandler(
+		MinefieldServiceStartJobProcedure,
+		svc.StartJob,
+		connect.WithSchema(minefieldServiceStartJobMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceUploadSBOMHandler := connect.NewClientStreamHandler(
+		MinefieldServiceUploadSBOMProcedure,
+		svc.UploadSBOM,
+		connect.WithSchema(minefieldServiceUploadSBOMMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceGetJobHandler := connect.NewUnaryHandler(
+		MinefieldServiceGetJobProcedure,
+		svc.GetJob,
+		connect.WithSchema(minefieldServiceGetJobMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceListJobsHandler := connect.NewUnaryHandler(
+		MinefieldServiceListJobsProcedure,
+		svc.ListJobs,
+		connect.WithSchema(minefieldServiceListJobsMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	minefieldServiceCancelJobHandler := connect.NewUnaryHandler(
+		MinefieldServiceCancelJobProcedure,
+		svc.CancelJob,
+		connect.WithSchema(minefieldServiceCancelJobMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/minefield.v1.MinefieldService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case MinefieldServiceQueryProcedure:
+			minefieldServiceQueryHandler.ServeHTTP(w, r)
+		case MinefieldServiceIngestSBOMProcedure:
+			minefieldServiceIngestSBOMHandler.ServeHTTP(w, r)
+		case MinefieldServiceCacheProcedure:
+			minefieldServiceCacheHandler.ServeHTTP(w, r)
+		case MinefieldServiceGetNodeProcedure:
+			minefieldServiceGetNodeHandler.ServeHTTP(w, r)
+		case MinefieldServiceLeaderboardProcedure:
+			minefieldServiceLeaderboardHandler.ServeHTTP(w, r)
+		case MinefieldServiceWhyProcedure:
+			minefieldServiceWhyHandler.ServeHTTP(w, r)
+		case MinefieldServiceStartJobProcedure:
+			minefieldServiceStartJobHandler.ServeHTTP(w, r)
+		case MinefieldServiceUploadSBOMProcedure:
+			minefieldServiceUploadSBOMHandler.ServeHTTP(w, r)
+		case MinefieldServiceGetJobProcedure:
+			minefieldServiceGetJobHandler.ServeHTTP(w, r)
+		case MinefieldServiceListJobsProcedure:
+			minefieldServiceListJobsHandler.ServeHTTP(w, r)
+		case MinefieldServiceCancelJobProcedure:
+			minefieldServiceCancelJobHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedMinefieldServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedMinefieldServiceHandler struct{}
+
+func (UnimplementedMinefieldServiceHandler) Query(context.Context, *connect.Request[v1.QueryRequest], *connect.ServerStream[v1.QueryResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.Query is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) IngestSBOM(context.Context, *connect.ClientStream[v1.IngestSBOMRequest]) (*connect.Response[v1.IngestSBOMResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.IngestSBOM is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) Cache(context.Context, *connect.Request[v1.CacheRequest]) (*connect.Response[v1.CacheResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.Cache is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) GetNode(context.Context, *connect.Request[v1.GetNodeRequest]) (*connect.Response[v1.GetNodeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.GetNode is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) Leaderboard(context.Context, *connect.Request[v1.LeaderboardRequest]) (*connect.Response[v1.LeaderboardResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.Leaderboard is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) Why(context.Context, *connect.Request[v1.WhyRequest]) (*connect.Response[v1.WhyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.Why is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) StartJob(context.Context, *connect.Request[v1.StartJobRequest]) (*connect.Response[v1.StartJobResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.StartJob is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) UploadSBOM(context.Context, *connect.ClientStream[v1.IngestSBOMRequest]) (*connect.Response[v1.StartJobResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.UploadSBOM is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) GetJob(context.Context, *connect.Request[v1.GetJobRequest]) (*connect.Response[v1.GetJobResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.GetJob is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) ListJobs(context.Context, *connect.Request[v1.ListJobsRequest]) (*connect.Response[v1.ListJobsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.ListJobs is not implemented"))
+}
+
+func (UnimplementedMinefieldServiceHandler) CancelJob(context.Context, *connect.Request[v1.CancelJobRequest]) (*connect.Response[v1.CancelJobResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("minefield.v1.MinefieldService.CancelJob is not implemented"))
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+
 	"github.com/bit-bom/minefield/cmd/root"
 	"github.com/bit-bom/minefield/pkg"
 	"go.uber.org/fx"
@@ -10,8 +14,12 @@ func main() {
 	app := fx.New(
 		pkg.NewRedisStorageModule("localhost:6379"),
 		fx.Invoke(func(storage pkg.Storage) {
+			// Cancel whatever is running, all the way down to storage, on Ctrl-C
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
 			rootCmd := root.New(storage)
-			if err := rootCmd.Execute(); err != nil {
+			if err := rootCmd.ExecuteContext(ctx); err != nil {
 				panic(err)
 			}
 		}),
@@ -1,27 +1,49 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
 	"github.com/RoaringBitmap/roaring"
 )
 
-func Cache(storage Storage) error {
-	uncachedNodes, err := storage.ToBeCached()
+// cacheSteps is the number of steps CacheWithProgress reports progress for.
+const cacheSteps = 5
+
+func Cache(ctx context.Context, storage Storage) error {
+	return CacheWithProgress(ctx, storage, nil)
+}
+
+// CacheWithProgress caches the graph, calling progress after each step of the caching process.
+func CacheWithProgress(ctx context.Context, storage Storage, progress ProgressFunc) error {
+	step := 0
+	reportStep := func(message string) error {
+		step++
+		// The caching steps themselves run in memory, so check for cancellation between them
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if progress == nil {
+			return nil
+		}
+		return progress(step, cacheSteps, message)
+	}
+
+	uncachedNodes, err := storage.ToBeCached(ctx)
 	if err != nil {
 		return err
 	}
 	if len(uncachedNodes) == 0 {
 		return nil
 	}
-	keys, err := storage.GetAllKeys()
+	keys, err := storage.GetAllKeys(ctx)
 	if err != nil {
 		return fmt.Errorf("error getting keys: %w", err)
 	}
 
 	// Retrieve all nodes at once
-	allNodes, err := storage.GetNodes(keys)
+	allNodes, err := storage.GetNodes(ctx, keys)
 	if err != nil {
 		return fmt.Errorf("error getting all nodes: %w", err)
 	}
@@ -30,21 +52,33 @@ func Cache(storage Storage) error {
 	if err != nil {
 		return err
 	}
+	if err := reportStep("found dependency cycles"); err != nil {
+		return err
+	}
 
 	cachedChildren, err := buildCache(storage, uncachedNodes, ChildrenDirection, childSCC, allNodes)
 	if err != nil {
 		return err
 	}
+	if err := reportStep("built dependencies cache"); err != nil {
+		return err
+	}
 
 	parentSCC, err := findCycles(storage, ParentsDirection, len(keys), allNodes)
 	if err != nil {
 		return err
 	}
+	if err := reportStep("found dependent cycles"); err != nil {
+		return err
+	}
 
 	cachedParents, err := buildCache(storage, uncachedNodes, ParentsDirection, parentSCC, allNodes)
 	if err != nil {
 		return err
 	}
+	if err := reportStep("built dependents cache"); err != nil {
+		return err
+	}
 
 	cachedChildKeys, cachedChildValues, err := cachedChildren.GetAllKeysAndValues()
 	if err != nil {
@@ -72,10 +106,13 @@ func Cache(storage Storage) error {
 		caches = append(caches, NewNodeCache(uint32(childIntId), parentBindValue, childBindValue))
 	}
 
-	if err := storage.SaveCaches(caches); err != nil {
+	if err := storage.SaveCaches(ctx, caches); err != nil {
+		return err
+	}
+	if err := storage.ClearCacheStack(ctx); err != nil {
 		return err
 	}
-	return storage.ClearCacheStack()
+	return reportStep("saved caches")
 }
 
 func findCycles(storage Storage, direction Direction, numOfNodes int, allNodes map[uint32]*Node) (map[uint32]uint32, error) {
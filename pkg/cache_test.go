@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"log"
 	"testing"
 
@@ -8,17 +9,18 @@ import (
 )
 
 func Test_findCycles(t *testing.T) {
+	ctx := context.Background()
 	logger := log.Default()
 
-	storage := NewMockStorage()
-	node1, err := AddNode(storage, "type1", "metadata1", "1")
+	storage := NewMemoryStorage()
+	node1, err := AddNode(ctx, storage, "type1", "metadata1", "1")
 	assert.NoError(t, err)
-	node2, err := AddNode(storage, "type2", "metadata2", "2")
+	node2, err := AddNode(ctx, storage, "type2", "metadata2", "2")
 	assert.NoError(t, err)
-	err = node1.SetDependency(storage, node2)
+	err = node1.SetDependency(ctx, storage, node2)
 	assert.NoError(t, err)
 
-	allNodes, err := storage.GetNodes([]uint32{node1.ID, node2.ID})
+	allNodes, err := storage.GetNodes(ctx, []uint32{node1.ID, node2.ID})
 	assert.NoError(t, err)
 
 	got, err := findCycles(storage, "children", 2, allNodes)
@@ -31,24 +33,25 @@ func Test_findCycles(t *testing.T) {
 }
 
 func Test_findCycles_With_Cycles(t *testing.T) {
+	ctx := context.Background()
 	logger := log.Default()
 
-	storage := NewMockStorage()
-	node1, err := AddNode(storage, "type1", "metadata1", "1")
+	storage := NewMemoryStorage()
+	node1, err := AddNode(ctx, storage, "type1", "metadata1", "1")
 	assert.NoError(t, err)
-	node2, err := AddNode(storage, "type2", "metadata2", "2")
+	node2, err := AddNode(ctx, storage, "type2", "metadata2", "2")
 	assert.NoError(t, err)
-	node3, err := AddNode(storage, "type3", "metadata3", "3")
+	node3, err := AddNode(ctx, storage, "type3", "metadata3", "3")
 	assert.NoError(t, err)
 
-	err = node1.SetDependency(storage, node2)
+	err = node1.SetDependency(ctx, storage, node2)
 	assert.NoError(t, err)
-	err = node2.SetDependency(storage, node3)
+	err = node2.SetDependency(ctx, storage, node3)
 	assert.NoError(t, err)
-	err = node3.SetDependency(storage, node1)
+	err = node3.SetDependency(ctx, storage, node1)
 	assert.NoError(t, err)
 
-	allNodes, err := storage.GetNodes([]uint32{node1.ID, node2.ID, node3.ID})
+	allNodes, err := storage.GetNodes(ctx, []uint32{node1.ID, node2.ID, node3.ID})
 	assert.NoError(t, err)
 
 	got, err := findCycles(storage, "children", 3, allNodes)
@@ -59,3 +62,21 @@ func Test_findCycles_With_Cycles(t *testing.T) {
 
 	assert.Equal(t, map[uint32]uint32{1: 1, 2: 1, 3: 1}, got)
 }
+
+func TestCacheCanceled(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	node1, err := AddNode(ctx, storage, "type1", "metadata1", "1")
+	assert.NoError(t, err)
+	node2, err := AddNode(ctx, storage, "type2", "metadata2", "2")
+	assert.NoError(t, err)
+	assert.NoError(t, node1.SetDependency(ctx, storage, node2))
+
+	cancel()
+	err = Cache(ctx, storage)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	uncached, err := storage.ToBeCached(context.Background())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, uncached, "a canceled cache should leave the nodes to be cached")
+}
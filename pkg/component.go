@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// HashIndex indexes components by their hashes, formatted as algorithm:value.
+	HashIndex = "hash"
+	// LicenseIndex indexes components by the SPDX license IDs in their license expressions.
+	LicenseIndex = "license"
+	// CPEIndex indexes components by their CPE 2.2 and 2.3 names.
+	CPEIndex = "cpe"
+)
+
+// ComponentIndexes are the indexes built from component metadata, which can be queried as atoms such as license(MIT).
+var ComponentIndexes = []string{HashIndex, LicenseIndex, CPEIndex}
+
+// ComponentMetadata is the metadata of a node ingested from a SBOM component.
+type ComponentMetadata struct {
+	Name             string   `json:"name,omitempty"`
+	Version          string   `json:"version,omitempty"`
+	Description      string   `json:"description,omitempty"`
+	Licenses         []string `json:"licenses,omitempty"`
+	LicenseConcluded string   `json:"licenseConcluded,omitempty"`
+	Copyright        string   `json:"copyright,omitempty"`
+	// Hashes maps hash algorithms, such as sha256, to the component's hash.
+	Hashes map[string]string `json:"hashes,omitempty"`
+	// Identifiers maps identifier types, such as purl and cpe23, to the component's identifier.
+	Identifiers        map[string]string   `json:"identifiers,omitempty"`
+	Suppliers          []string            `json:"suppliers,omitempty"`
+	Originators        []string            `json:"originators,omitempty"`
+	ExternalReferences []ExternalReference `json:"externalReferences,omitempty"`
+	HomeURL            string              `json:"homeURL,omitempty"`
+	DownloadURL        string              `json:"downloadURL,omitempty"`
+	ReleaseDate        time.Time           `json:"releaseDate,omitempty"`
+}
+
+// ExternalReference is a link from a component to a resource about it, such as its VCS repository or an advisory.
+type ExternalReference struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// NodeComponentMetadata returns the metadata of a component node, whether or not it has been through the storage backend.
+func NodeComponentMetadata(node *Node) (*ComponentMetadata, error) {
+	if metadata, ok := node.Metadata.(*ComponentMetadata); ok {
+		return metadata, nil
+	}
+
+	// Metadata loaded from the storage backend is decoded into generic JSON values
+	data, err := json.Marshal(node.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal component metadata: %w", err)
+	}
+	var metadata ComponentMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal component metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// IndexValues returns the values the component is indexed by, keyed by index.
+func (m *ComponentMetadata) IndexValues() map[string][]string {
+	values := map[string][]string{}
+	add := func(index, value string) {
+		value = normalizeIndexValue(value)
+		if value != "" && !slices.Contains(values[index], value) {
+			values[index] = append(values[index], value)
+		}
+	}
+
+	for algorithm, hash := range m.Hashes {
+		add(HashIndex, algorithm+":"+hash)
+	}
+	for _, expression := range append(slices.Clone(m.Licenses), m.LicenseConcluded) {
+		for _, id := range LicenseIDs(expression) {
+			add(LicenseIndex, id)
+		}
+	}
+	for _, identifierType := range []string{"cpe22", "cpe23"} {
+		add(CPEIndex, m.Identifiers[identifierType])
+	}
+	for index := range values {
+		slices.Sort(values[index])
+	}
+	return values
+}
+
+// normalizeIndexValue normalizes a value the same way whether it's being indexed or queried.
+// Hashes, SPDX license IDs and CPE names are all matched case insensitively.
+func normalizeIndexValue(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// LicenseIDs returns the license IDs in a SPDX license expression, leaving out operators and exceptions.
+func LicenseIDs(expression string) []string {
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expression))
+	var ids []string
+	for i := 0; i < len(fields); i++ {
+		switch strings.ToUpper(fields[i]) {
+		case "AND", "OR":
+			continue
+		case "WITH":
+			// Skip the exception
+			i++
+			continue
+		case "NONE", "NOASSERTION":
+			continue
+		}
+		id := strings.TrimSuffix(fields[i], "+")
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
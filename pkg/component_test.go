@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLicenseIDs(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []string
+	}{
+		{expression: "MIT", want: []string{"MIT"}},
+		{expression: "(Apache-2.0 OR MIT) AND BSD-3-Clause", want: []string{"Apache-2.0", "MIT", "BSD-3-Clause"}},
+		{expression: "GPL-2.0-or-later WITH Classpath-exception-2.0", want: []string{"GPL-2.0-or-later"}},
+		{expression: "LGPL-2.1+ or MIT", want: []string{"LGPL-2.1", "MIT"}},
+		{expression: "NOASSERTION", want: nil},
+		{expression: "", want: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			assert.Equal(t, test.want, LicenseIDs(test.expression))
+		})
+	}
+}
+
+func TestComponentIndexValues(t *testing.T) {
+	metadata := &ComponentMetadata{
+		Licenses:         []string{"Apache-2.0 OR MIT"},
+		LicenseConcluded: "MIT",
+		Hashes:           map[string]string{"sha256": "ABC", "sha1": "def"},
+		Identifiers:      map[string]string{"purl": "pkg:generic/app@1.0.0", "cpe22": "cpe:/a:example:app:1.0.0"},
+	}
+	assert.Equal(t, map[string][]string{
+		HashIndex:    {"sha1:def", "sha256:abc"},
+		LicenseIndex: {"apache-2.0", "mit"},
+		CPEIndex:     {"cpe:/a:example:app:1.0.0"},
+	}, metadata.IndexValues())
+}
@@ -0,0 +1,387 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CVSSBaseScore computes the base score of a CVSS v3.0, v3.1 or v4.0 vector, such as
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H.
+// For CVSS v4.0, threat and environmental metrics in the vector are ignored, so the score is the CVSS-B score.
+func CVSSBaseScore(vector string) (float64, error) {
+	version, metrics, err := parseCVSSVector(vector)
+	if err != nil {
+		return 0, err
+	}
+	switch version {
+	case "3.0", "3.1":
+		return cvss3BaseScore(metrics)
+	case "4.0":
+		return cvss4BaseScore(metrics)
+	default:
+		return 0, fmt.Errorf("unsupported CVSS version %s in %s", version, vector)
+	}
+}
+
+func parseCVSSVector(vector string) (string, map[string]string, error) {
+	parts := strings.Split(strings.TrimSpace(vector), "/")
+	version, ok := strings.CutPrefix(parts[0], "CVSS:")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid CVSS vector %q, expected it to start with CVSS:<version>", vector)
+	}
+	metrics := map[string]string{}
+	for _, part := range parts[1:] {
+		name, value, ok := strings.Cut(part, ":")
+		if !ok || name == "" || value == "" {
+			return "", nil, fmt.Errorf("invalid metric %q in CVSS vector %s", part, vector)
+		}
+		metrics[name] = value
+	}
+	return version, metrics, nil
+}
+
+// cvssMetric looks up the value of a metric, failing if the metric is missing or has an unknown value.
+func cvssMetric(metrics map[string]string, name string, values map[string]float64) (float64, error) {
+	value, ok := metrics[name]
+	if !ok {
+		return 0, fmt.Errorf("CVSS vector is missing metric %s", name)
+	}
+	weight, ok := values[value]
+	if !ok {
+		return 0, fmt.Errorf("CVSS vector has unknown value %s for metric %s", value, name)
+	}
+	return weight, nil
+}
+
+// Weights of the CVSS v3 base metrics.
+var (
+	cvss3AttackVector       = map[string]float64{"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2}
+	cvss3AttackComplexity   = map[string]float64{"L": 0.77, "H": 0.44}
+	cvss3PrivilegesRequired = map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	// Privileges required are weighted higher when the scope changes.
+	cvss3PrivilegesRequiredChanged = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}
+	cvss3UserInteraction           = map[string]float64{"N": 0.85, "R": 0.62}
+	cvss3Scope                     = map[string]float64{"U": 0, "C": 1}
+	cvss3Impact                    = map[string]float64{"H": 0.56, "L": 0.22, "N": 0}
+)
+
+// cvss3BaseScore computes a CVSS v3 base score as the CVSS v3.1 specification defines it.
+func cvss3BaseScore(metrics map[string]string) (float64, error) {
+	scope, err := cvssMetric(metrics, "S", cvss3Scope)
+	if err != nil {
+		return 0, err
+	}
+	changed := scope == 1
+	privilegesRequired := cvss3PrivilegesRequired
+	if changed {
+		privilegesRequired = cvss3PrivilegesRequiredChanged
+	}
+
+	var weights [7]float64
+	for i, metric := range []struct {
+		name   string
+		values map[string]float64
+	}{
+		{"AV", cvss3AttackVector},
+		{"AC", cvss3AttackComplexity},
+		{"PR", privilegesRequired},
+		{"UI", cvss3UserInteraction},
+		{"C", cvss3Impact},
+		{"I", cvss3Impact},
+		{"A", cvss3Impact},
+	} {
+		if weights[i], err = cvssMetric(metrics, metric.name, metric.values); err != nil {
+			return 0, err
+		}
+	}
+	av, ac, pr, ui, c, i, a := weights[0], weights[1], weights[2], weights[3], weights[4], weights[5], weights[6]
+
+	iss := 1 - (1-c)*(1-i)*(1-a)
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * av * ac * pr * ui
+	if changed {
+		return cvss3RoundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+	}
+	return cvss3RoundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// cvss3RoundUp rounds up to one decimal place, avoiding floating point errors as CVSS v3.1 specifies.
+func cvss3RoundUp(value float64) float64 {
+	integer := int64(math.Round(value * 100000))
+	if integer%10000 == 0 {
+		return float64(integer) / 100000
+	}
+	return (math.Floor(float64(integer)/10000) + 1) / 10
+}
+
+// Levels of the CVSS v4 metrics, used to measure how far a vector is from the highest severity vector of its macrovector.
+var cvss4Levels = map[string]map[string]float64{
+	"AV": {"N": 0, "A": 0.1, "L": 0.2, "P": 0.3},
+	"PR": {"N": 0, "L": 0.1, "H": 0.2},
+	"UI": {"N": 0, "P": 0.1, "A": 0.2},
+	"AC": {"L": 0, "H": 0.1},
+	"AT": {"N": 0, "P": 0.1},
+	"VC": {"H": 0, "L": 0.1, "N": 0.2},
+	"VI": {"H": 0, "L": 0.1, "N": 0.2},
+	"VA": {"H": 0, "L": 0.1, "N": 0.2},
+	"SC": {"H": 0.1, "L": 0.2, "N": 0.3},
+	"SI": {"S": 0, "H": 0.1, "L": 0.2, "N": 0.3},
+	"SA": {"S": 0, "H": 0.1, "L": 0.2, "N": 0.3},
+	"CR": {"H": 0, "M": 0.1, "L": 0.2},
+	"IR": {"H": 0, "M": 0.1, "L": 0.2},
+	"AR": {"H": 0, "M": 0.1, "L": 0.2},
+}
+
+// cvss4BaseMetrics are the metrics a CVSS v4 vector must have.
+var cvss4BaseMetrics = []string{"AV", "AC", "AT", "PR", "UI", "VC", "VI", "VA", "SC", "SI", "SA"}
+
+// cvss4BaseScore computes a CVSS v4 score from the base metrics, as the CVSS v4.0 specification and its reference
+// implementation do: the vector's macrovector is scored from the lookup table, and the score is lowered
+// by how far the vector is from the highest severity vectors of the macrovector.
+func cvss4BaseScore(metrics map[string]string) (float64, error) {
+	m := map[string]string{}
+	for _, name := range cvss4BaseMetrics {
+		value, ok := metrics[name]
+		if !ok {
+			return 0, fmt.Errorf("CVSS vector is missing metric %s", name)
+		}
+		if _, ok := cvss4Levels[name][value]; !ok || (name == "SI" || name == "SA") && value == "S" {
+			return 0, fmt.Errorf("CVSS vector has unknown value %s for metric %s", value, name)
+		}
+		m[name] = value
+	}
+	// Vulnerabilities without any impact score 0
+	if m["VC"] == "N" && m["VI"] == "N" && m["VA"] == "N" && m["SC"] == "N" && m["SI"] == "N" && m["SA"] == "N" {
+		return 0, nil
+	}
+	// Threat and environmental metrics take their default, worst case values
+	m["CR"], m["IR"], m["AR"] = "H", "H", "H"
+
+	var eq [6]int
+	switch {
+	case m["AV"] == "N" && m["PR"] == "N" && m["UI"] == "N":
+		eq[0] = 0
+	case (m["AV"] == "N" || m["PR"] == "N" || m["UI"] == "N") && m["AV"] != "P":
+		eq[0] = 1
+	default:
+		eq[0] = 2
+	}
+	if m["AC"] != "L" || m["AT"] != "N" {
+		eq[1] = 1
+	}
+	switch {
+	case m["VC"] == "H" && m["VI"] == "H":
+		eq[2] = 0
+	case m["VC"] == "H" || m["VI"] == "H" || m["VA"] == "H":
+		eq[2] = 1
+	default:
+		eq[2] = 2
+	}
+	switch {
+	case m["SI"] == "S" || m["SA"] == "S":
+		eq[3] = 0
+	case m["SC"] == "H" || m["SI"] == "H" || m["SA"] == "H":
+		eq[3] = 1
+	default:
+		eq[3] = 2
+	}
+	// eq[4] is the exploit maturity, which defaults to attacked
+	if !(m["CR"] == "H" && m["VC"] == "H" || m["IR"] == "H" && m["VI"] == "H" || m["AR"] == "H" && m["VA"] == "H") {
+		eq[5] = 1
+	}
+
+	lookup := func(eq [6]int) float64 {
+		score, ok := cvss4Lookup[fmt.Sprintf("%d%d%d%d%d%d", eq[0], eq[1], eq[2], eq[3], eq[4], eq[5])]
+		if !ok {
+			return math.NaN()
+		}
+		return score
+	}
+	value := lookup(eq)
+
+	// The scores of the next lower macrovectors, which may not exist
+	lower := func(changes ...int) float64 {
+		next := eq
+		for i := 0; i < len(changes); i += 2 {
+			next[changes[i]] += changes[i+1]
+		}
+		return lookup(next)
+	}
+	lowerEQ1, lowerEQ2, lowerEQ4, lowerEQ5 := lower(0, 1), lower(1, 1), lower(3, 1), lower(4, 1)
+	var lowerEQ3EQ6 float64
+	switch {
+	case eq[2] == 0 && eq[5] == 0:
+		lowerEQ3EQ6 = math.Max(lower(5, 1), lower(2, 1))
+		if math.IsNaN(lower(5, 1)) || math.IsNaN(lower(2, 1)) {
+			lowerEQ3EQ6 = lower(2, 1)
+		}
+	case eq[2] == 1 && eq[5] == 0:
+		lowerEQ3EQ6 = lower(5, 1)
+	case eq[5] == 1 && eq[2] < 2:
+		lowerEQ3EQ6 = lower(2, 1)
+	default:
+		lowerEQ3EQ6 = lower(2, 1, 5, 1)
+	}
+
+	// Find the highest severity vector of the macrovector that the vector is no more severe than in any metric
+	var distances map[string]float64
+	for _, eq1 := range cvss4MaxVectors.eq1[eq[0]] {
+		for _, eq2 := range cvss4MaxVectors.eq2[eq[1]] {
+			for _, eq3eq6 := range cvss4MaxVectors.eq3eq6[eq[2]][eq[5]] {
+				for _, eq4 := range cvss4MaxVectors.eq4[eq[3]] {
+					if distances != nil {
+						continue
+					}
+					candidate := map[string]float64{}
+					ok := true
+					for _, part := range strings.Split(eq1+eq2+eq3eq6+eq4, "/") {
+						name, maxValue, _ := strings.Cut(part, ":")
+						candidate[name] = cvss4Levels[name][m[name]] - cvss4Levels[name][maxValue]
+						if candidate[name] < 0 {
+							ok = false
+						}
+					}
+					if ok {
+						distances = candidate
+					}
+				}
+			}
+		}
+	}
+	if distances == nil {
+		return 0, fmt.Errorf("no highest severity vector found for CVSS macrovector %v", eq)
+	}
+
+	const step = 0.1
+	var (
+		total    float64
+		existing int
+	)
+	for _, proportion := range []struct {
+		lower    float64
+		distance float64
+		maximum  float64
+	}{
+		{lowerEQ1, distances["AV"] + distances["PR"] + distances["UI"], cvss4MaxSeverity.eq1[eq[0]]},
+		{lowerEQ2, distances["AC"] + distances["AT"], cvss4MaxSeverity.eq2[eq[1]]},
+		{lowerEQ3EQ6, distances["VC"] + distances["VI"] + distances["VA"] + distances["CR"] + distances["IR"] + distances["AR"], cvss4MaxSeverity.eq3eq6[eq[2]][eq[5]]},
+		{lowerEQ4, distances["SC"] + distances["SI"] + distances["SA"], cvss4MaxSeverity.eq4[eq[3]]},
+		// The exploit maturity is always at its highest severity, so the vector is at no distance in it
+		{lowerEQ5, 0, 1},
+	} {
+		if math.IsNaN(proportion.lower) {
+			continue
+		}
+		existing++
+		total += (value - proportion.lower) * proportion.distance / (proportion.maximum * step)
+	}
+	if existing > 0 {
+		value -= total / float64(existing)
+	}
+	value = math.Min(math.Max(value, 0), 10)
+	return math.Round(value*10+1e-9) / 10, nil
+}
+
+// cvss4MaxVectors are the highest severity vectors of each level of each equivalence class.
+var cvss4MaxVectors = struct {
+	eq1, eq2, eq4 map[int][]string
+	eq3eq6        map[int]map[int][]string
+}{
+	eq1: map[int][]string{
+		0: {"AV:N/PR:N/UI:N/"},
+		1: {"AV:A/PR:N/UI:N/", "AV:N/PR:L/UI:N/", "AV:N/PR:N/UI:P/"},
+		2: {"AV:P/PR:N/UI:N/", "AV:A/PR:L/UI:P/"},
+	},
+	eq2: map[int][]string{
+		0: {"AC:L/AT:N/"},
+		1: {"AC:H/AT:N/", "AC:L/AT:P/"},
+	},
+	eq3eq6: map[int]map[int][]string{
+		0: {
+			0: {"VC:H/VI:H/VA:H/CR:H/IR:H/AR:H/"},
+			1: {"VC:H/VI:H/VA:L/CR:M/IR:M/AR:H/", "VC:H/VI:H/VA:H/CR:M/IR:M/AR:M/"},
+		},
+		1: {
+			0: {"VC:L/VI:H/VA:H/CR:H/IR:H/AR:H/", "VC:H/VI:L/VA:H/CR:H/IR:H/AR:H/"},
+			1: {"VC:L/VI:H/VA:L/CR:H/IR:M/AR:H/", "VC:L/VI:H/VA:H/CR:H/IR:M/AR:M/", "VC:H/VI:L/VA:H/CR:M/IR:H/AR:M/", "VC:H/VI:L/VA:L/CR:M/IR:H/AR:H/", "VC:L/VI:L/VA:H/CR:H/IR:H/AR:M/"},
+		},
+		2: {
+			1: {"VC:L/VI:L/VA:L/CR:H/IR:H/AR:H/"},
+		},
+	},
+	eq4: map[int][]string{
+		0: {"SC:H/SI:S/SA:S"},
+		1: {"SC:H/SI:H/SA:H"},
+		2: {"SC:L/SI:L/SA:L"},
+	},
+}
+
+// cvss4MaxSeverity are the largest distances, in steps, of a vector from the highest severity vector of its level of each equivalence class.
+var cvss4MaxSeverity = struct {
+	eq1, eq2, eq4 map[int]float64
+	eq3eq6        map[int]map[int]float64
+}{
+	eq1:    map[int]float64{0: 1, 1: 4, 2: 5},
+	eq2:    map[int]float64{0: 1, 1: 2},
+	eq3eq6: map[int]map[int]float64{0: {0: 7, 1: 6}, 1: {0: 8, 1: 8}, 2: {1: 10}},
+	eq4:    map[int]float64{0: 6, 1: 5, 2: 4},
+}
+
+// cvss4Lookup scores each macrovector, from the CVSS v4.0 specification.
+var cvss4Lookup = map[string]float64{
+	"000000": 10, "000001": 9.9, "000010": 9.8, "000011": 9.5, "000020": 9.5, "000021": 9.2,
+	"000100": 10, "000101": 9.6, "000110": 9.3, "000111": 8.7, "000120": 9.1, "000121": 8.1,
+	"000200": 9.3, "000201": 9, "000210": 8.9, "000211": 8, "000220": 8.1, "000221": 6.8,
+	"001000": 9.8, "001001": 9.5, "001010": 9.5, "001011": 9.2, "001020": 9, "001021": 8.4,
+	"001100": 9.3, "001101": 9.2, "001110": 8.9, "001111": 8.1, "001120": 8.1, "001121": 6.5,
+	"001200": 8.8, "001201": 8, "001210": 7.8, "001211": 7, "001220": 6.9, "001221": 4.8,
+	"002001": 9.2, "002011": 8.2, "002021": 7.2, "002101": 7.9, "002111": 6.9, "002121": 5,
+	"002201": 6.9, "002211": 5.5, "002221": 2.7,
+	"010000": 9.9, "010001": 9.7, "010010": 9.5, "010011": 9.2, "010020": 9.2, "010021": 8.5,
+	"010100": 9.5, "010101": 9.1, "010110": 9, "010111": 8.3, "010120": 8.4, "010121": 7.1,
+	"010200": 9.2, "010201": 8.1, "010210": 8.2, "010211": 7.1, "010220": 7.2, "010221": 5.3,
+	"011000": 9.5, "011001": 9.3, "011010": 9.2, "011011": 8.5, "011020": 8.5, "011021": 7.3,
+	"011100": 9.2, "011101": 8.2, "011110": 8, "011111": 7.2, "011120": 7, "011121": 5.9,
+	"011200": 8.4, "011201": 7, "011210": 7.1, "011211": 5.2, "011220": 5, "011221": 3,
+	"012001": 8.6, "012011": 7.5, "012021": 5.2, "012101": 7.1, "012111": 5.2, "012121": 2.9,
+	"012201": 6.3, "012211": 2.9, "012221": 1.7,
+	"100000": 9.8, "100001": 9.5, "100010": 9.4, "100011": 8.7, "100020": 9.1, "100021": 8.1,
+	"100100": 9.4, "100101": 8.9, "100110": 8.6, "100111": 7.4, "100120": 7.7, "100121": 6.4,
+	"100200": 8.7, "100201": 7.5, "100210": 7.4, "100211": 6.3, "100220": 6.3, "100221": 4.9,
+	"101000": 9.4, "101001": 8.9, "101010": 8.8, "101011": 7.7, "101020": 7.6, "101021": 6.7,
+	"101100": 8.6, "101101": 7.6, "101110": 7.4, "101111": 5.8, "101120": 5.9, "101121": 5,
+	"101200": 7.2, "101201": 5.7, "101210": 5.7, "101211": 5.2, "101220": 5.2, "101221": 2.5,
+	"102001": 8.3, "102011": 7, "102021": 5.4, "102101": 6.5, "102111": 5.8, "102121": 2.6,
+	"102201": 5.3, "102211": 2.1, "102221": 1.3,
+	"110000": 9.5, "110001": 9, "110010": 8.8, "110011": 7.6, "110020": 7.6, "110021": 7,
+	"110100": 9, "110101": 7.7, "110110": 7.5, "110111": 6.2, "110120": 6.1, "110121": 5.3,
+	"110200": 7.7, "110201": 6.6, "110210": 6.8, "110211": 5.9, "110220": 5.2, "110221": 3,
+	"111000": 8.9, "111001": 7.8, "111010": 7.6, "111011": 6.7, "111020": 6.2, "111021": 5.8,
+	"111100": 7.4, "111101": 5.9, "111110": 5.7, "111111": 5.7, "111120": 4.7, "111121": 2.3,
+	"111200": 6.1, "111201": 5.2, "111210": 5.7, "111211": 2.9, "111220": 2.4, "111221": 1.6,
+	"112001": 7.1, "112011": 5.9, "112021": 3, "112101": 5.8, "112111": 2.6, "112121": 1.5,
+	"112201": 2.3, "112211": 1.3, "112221": 0.6,
+	"200000": 9.3, "200001": 8.7, "200010": 8.6, "200011": 7.2, "200020": 7.5, "200021": 5.8,
+	"200100": 8.6, "200101": 7.4, "200110": 7.4, "200111": 6.1, "200120": 5.6, "200121": 3.4,
+	"200200": 7, "200201": 5.4, "200210": 5.2, "200211": 4, "200220": 4, "200221": 2.2,
+	"201000": 8.5, "201001": 7.5, "201010": 7.4, "201011": 5.5, "201020": 6.2, "201021": 5.1,
+	"201100": 7.2, "201101": 5.7, "201110": 5.5, "201111": 4.1, "201120": 4.6, "201121": 1.9,
+	"201200": 5.3, "201201": 3.6, "201210": 3.4, "201211": 1.9, "201220": 1.9, "201221": 0.8,
+	"202001": 6.4, "202011": 5.1, "202021": 2, "202101": 4.7, "202111": 2.1, "202121": 1.1,
+	"202201": 2.4, "202211": 0.9, "202221": 0.4,
+	"210000": 8.8, "210001": 7.5, "210010": 7.3, "210011": 5.3, "210020": 6, "210021": 5,
+	"210100": 7.3, "210101": 5.5, "210110": 5.9, "210111": 4, "210120": 4.1, "210121": 2,
+	"210200": 5.4, "210201": 4.3, "210210": 4.5, "210211": 2.2, "210220": 2, "210221": 1.1,
+	"211000": 7.5, "211001": 5.5, "211010": 5.8, "211011": 4.5, "211020": 4, "211021": 2.1,
+	"211100": 6.1, "211101": 5.1, "211110": 4.8, "211111": 1.8, "211120": 2, "211121": 0.9,
+	"211200": 4.6, "211201": 1.8, "211210": 1.7, "211211": 0.7, "211220": 0.8, "211221": 0.2,
+	"212001": 5.3, "212011": 2.4, "212021": 1.4, "212101": 2.4, "212111": 1.2, "212121": 0.5,
+	"212201": 1, "212211": 0.3, "212221": 0.1,
+}
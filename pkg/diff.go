@@ -0,0 +1,335 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/package-url/packageurl-go"
+)
+
+// DefaultDiffLeaderboardSize is how many of the most depended on packages are compared unless another size is given.
+const DefaultDiffLeaderboardSize = 10
+
+// DiffSide is one of the graphs a diff compares: the closure of a root, or the whole graph when Root is empty.
+type DiffSide struct {
+	Storage Storage
+	Root    string
+}
+
+// DiffOptions configure graph diffs.
+type DiffOptions struct {
+	// LeaderboardSize is how many of the most depended on packages of each side are compared, DefaultDiffLeaderboardSize
+	// by default.
+	LeaderboardSize int
+}
+
+// GraphDiff is what changed from one graph to another.
+type GraphDiff struct {
+	Added                []string              `json:"added"`
+	Removed              []string              `json:"removed"`
+	VersionChanges       []VersionChange       `json:"versionChanges"`
+	NewVulnerabilities   []VulnerabilityChange `json:"newVulnerabilities"`
+	FixedVulnerabilities []VulnerabilityChange `json:"fixedVulnerabilities"`
+	LeaderboardChanges   []LeaderboardPosition `json:"leaderboardChanges"`
+}
+
+// VersionChange is a package whose version changed, identified by its purl without the version.
+type VersionChange struct {
+	Package string `json:"package"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// VulnerabilityChange is a vulnerability that is new or gone, with the packages that depend on it.
+type VulnerabilityChange struct {
+	Vulnerability string   `json:"vulnerability"`
+	Packages      []string `json:"packages"`
+}
+
+// LeaderboardPosition is the rank of a package, by its number of dependents, before and after. A rank of 0 means the
+// package was outside the leaderboard.
+type LeaderboardPosition struct {
+	Package    string `json:"package"`
+	From       int    `json:"from"`
+	To         int    `json:"to"`
+	Dependents int    `json:"dependents"`
+}
+
+// diffGraph is the part of a side that is compared.
+type diffGraph struct {
+	// packages maps the names of the packages to their nodes.
+	packages map[string]*Node
+	// vulnerabilities maps the names of the vulnerabilities to the names of the packages that depend on them.
+	vulnerabilities map[string][]string
+	// ranks maps the identities of the most depended on packages to their rank and number of dependents.
+	ranks map[string][2]int
+}
+
+// DiffGraphs compares two graphs: the packages added and removed, the packages whose version changed, the
+// vulnerabilities that are new or fixed and the changes to the leaderboard of the most depended on packages.
+// Packages are matched across versions on their purl without the version.
+func DiffGraphs(ctx context.Context, from, to DiffSide, opts DiffOptions) (*GraphDiff, error) {
+	if opts.LeaderboardSize <= 0 {
+		opts.LeaderboardSize = DefaultDiffLeaderboardSize
+	}
+	before, err := collectDiffGraph(ctx, from, opts)
+	if err != nil {
+		return nil, err
+	}
+	after, err := collectDiffGraph(ctx, to, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &GraphDiff{
+		Added:                []string{},
+		Removed:              []string{},
+		VersionChanges:       []VersionChange{},
+		NewVulnerabilities:   []VulnerabilityChange{},
+		FixedVulnerabilities: []VulnerabilityChange{},
+		LeaderboardChanges:   []LeaderboardPosition{},
+	}
+
+	// Packages are grouped by identity, so that a version that replaces another is reported as a version change
+	versions := func(packages map[string]*Node) map[string][]string {
+		grouped := map[string][]string{}
+		for name := range packages {
+			identity := PackageIdentity(name)
+			grouped[identity] = append(grouped[identity], name)
+		}
+		return grouped
+	}
+	beforeVersions, afterVersions := versions(before.packages), versions(after.packages)
+	for identity, names := range afterVersions {
+		removed := slices.DeleteFunc(slices.Clone(beforeVersions[identity]), func(name string) bool { return after.packages[name] != nil })
+		added := slices.DeleteFunc(slices.Clone(names), func(name string) bool { return before.packages[name] != nil })
+		if len(removed) == 1 && len(added) == 1 {
+			diff.VersionChanges = append(diff.VersionChanges, VersionChange{Package: identity, From: packageVersion(removed[0]), To: packageVersion(added[0])})
+			continue
+		}
+		diff.Added = append(diff.Added, added...)
+	}
+	for identity, names := range beforeVersions {
+		removed := slices.DeleteFunc(slices.Clone(names), func(name string) bool { return after.packages[name] != nil })
+		added := slices.DeleteFunc(slices.Clone(afterVersions[identity]), func(name string) bool { return before.packages[name] != nil })
+		if len(removed) == 1 && len(added) == 1 {
+			continue
+		}
+		diff.Removed = append(diff.Removed, removed...)
+	}
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	slices.SortFunc(diff.VersionChanges, func(a, b VersionChange) int { return strings.Compare(a.Package, b.Package) })
+
+	for name, packages := range after.vulnerabilities {
+		if _, ok := before.vulnerabilities[name]; !ok {
+			diff.NewVulnerabilities = append(diff.NewVulnerabilities, VulnerabilityChange{Vulnerability: name, Packages: packages})
+		}
+	}
+	for name, packages := range before.vulnerabilities {
+		if _, ok := after.vulnerabilities[name]; !ok {
+			diff.FixedVulnerabilities = append(diff.FixedVulnerabilities, VulnerabilityChange{Vulnerability: name, Packages: packages})
+		}
+	}
+	compareVulnerabilities := func(a, b VulnerabilityChange) int { return strings.Compare(a.Vulnerability, b.Vulnerability) }
+	slices.SortFunc(diff.NewVulnerabilities, compareVulnerabilities)
+	slices.SortFunc(diff.FixedVulnerabilities, compareVulnerabilities)
+
+	for identity, rank := range after.ranks {
+		if before.ranks[identity][0] != rank[0] {
+			diff.LeaderboardChanges = append(diff.LeaderboardChanges, LeaderboardPosition{Package: identity, From: before.ranks[identity][0], To: rank[0], Dependents: rank[1]})
+		}
+	}
+	for identity, rank := range before.ranks {
+		if _, ok := after.ranks[identity]; !ok {
+			diff.LeaderboardChanges = append(diff.LeaderboardChanges, LeaderboardPosition{Package: identity, From: rank[0]})
+		}
+	}
+	slices.SortFunc(diff.LeaderboardChanges, func(a, b LeaderboardPosition) int {
+		// Packages that left the leaderboard come last
+		if a.To == 0 || b.To == 0 {
+			return b.To - a.To
+		}
+		return a.To - b.To
+	})
+	return diff, nil
+}
+
+// collectDiffGraph gets the packages, vulnerabilities and leaderboard of one side of a diff.
+// Vulnerabilities that VEX statements suppress for the root, or for every root of the whole graph that reaches them,
+// are left out.
+func collectDiffGraph(ctx context.Context, side DiffSide, opts DiffOptions) (*diffGraph, error) {
+	var (
+		ids  *roaring.Bitmap
+		root *Node
+	)
+	if side.Root == "" {
+		keys, err := side.Storage.GetAllKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys: %w", err)
+		}
+		ids = roaring.BitmapOf(keys...)
+	} else {
+		id, err := side.Storage.NameToID(ctx, side.Root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node ID for name %s: %w", side.Root, err)
+		}
+		root, err = side.Storage.GetNode(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node for id %v: %w", id, err)
+		}
+		// The root itself isn't compared, as comparing two releases of a product would always report it
+		ids, err = root.QueryDependencies(ctx, side.Storage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query dependencies of %s: %w", root.Name, err)
+		}
+	}
+	nodes, err := side.Storage.GetNodes(ctx, ids.ToArray())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	graph := &diffGraph{packages: map[string]*Node{}, vulnerabilities: map[string][]string{}, ranks: map[string][2]int{}}
+	var vulnerabilities []*Node
+	for _, node := range nodes {
+		switch node.Type {
+		case DocumentNodeType:
+		case VulnerabilityNodeType:
+			vulnerabilities = append(vulnerabilities, node)
+		default:
+			graph.packages[node.Name] = node
+		}
+	}
+
+	// The dependencies of each package are walked once within the side, which counts the dependents of every package
+	// in the side and gives the closures of the roots
+	dependents := map[uint32]int{}
+	roots := map[uint32]*roaring.Bitmap{}
+	if root != nil {
+		roots[root.ID] = ids
+	}
+	for _, node := range graph.packages {
+		reachable := roaring.New()
+		queue := []*Node{node}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, child := range current.Children.ToArray() {
+				dependency, ok := nodes[child]
+				if !ok || dependency.Type == DocumentNodeType || !reachable.CheckedAdd(child) {
+					continue
+				}
+				if dependency.Type != VulnerabilityNodeType {
+					dependents[child]++
+				}
+				queue = append(queue, dependency)
+			}
+		}
+		if root == nil && !hasPackageParent(node, nodes) {
+			roots[node.ID] = reachable
+		}
+	}
+
+	for _, vulnerability := range vulnerabilities {
+		suppressed, err := diffVulnerabilitySuppressed(ctx, side.Storage, roots, vulnerability)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check VEX statements on %s: %w", vulnerability.Name, err)
+		}
+		if suppressed {
+			continue
+		}
+		packages := []string{}
+		for _, parent := range vulnerability.Parents.ToArray() {
+			if dependent, ok := nodes[parent]; ok && dependent.Type != DocumentNodeType {
+				packages = append(packages, dependent.Name)
+			}
+		}
+		slices.Sort(packages)
+		graph.vulnerabilities[vulnerability.Name] = packages
+	}
+
+	// Packages are ranked by the number of packages in the side that depend on them
+	type ranked struct {
+		identity   string
+		dependents int
+	}
+	var leaderboard []ranked
+	best := map[string]int{}
+	for name, node := range graph.packages {
+		count := dependents[node.ID]
+		if count == 0 {
+			continue
+		}
+		identity := PackageIdentity(name)
+		best[identity] = max(best[identity], count)
+	}
+	for identity, dependents := range best {
+		leaderboard = append(leaderboard, ranked{identity: identity, dependents: dependents})
+	}
+	slices.SortFunc(leaderboard, func(a, b ranked) int {
+		if a.dependents != b.dependents {
+			return b.dependents - a.dependents
+		}
+		return strings.Compare(a.identity, b.identity)
+	})
+	for i, entry := range leaderboard {
+		if i >= opts.LeaderboardSize {
+			break
+		}
+		graph.ranks[entry.identity] = [2]int{i + 1, entry.dependents}
+	}
+	return graph, nil
+}
+
+// hasPackageParent reports whether a package is depended on by another package of the side, rather than only by
+// documents.
+func hasPackageParent(node *Node, nodes map[uint32]*Node) bool {
+	for _, parent := range node.Parents.ToArray() {
+		if dependent, ok := nodes[parent]; ok && dependent.Type != DocumentNodeType {
+			return true
+		}
+	}
+	return false
+}
+
+// diffVulnerabilitySuppressed reports whether VEX statements suppress a vulnerability for every root that reaches it.
+// A vulnerability that no root reaches, such as one only depended on within a cycle, isn't suppressed.
+func diffVulnerabilitySuppressed(ctx context.Context, storage Storage, roots map[uint32]*roaring.Bitmap, vulnerability *Node) (bool, error) {
+	reached := false
+	for root, reachable := range roots {
+		if !reachable.Contains(vulnerability.ID) {
+			continue
+		}
+		reached = true
+		suppressed, err := VulnerabilitySuppressed(ctx, storage, root, reachable, vulnerability)
+		if err != nil || !suppressed {
+			return false, err
+		}
+	}
+	return reached, nil
+}
+
+// PackageIdentity returns a package's purl without its version, qualifiers and subpath, which identifies the package
+// across versions. Names that aren't purls are their own identity.
+func PackageIdentity(name string) string {
+	purl, err := packageurl.FromString(name)
+	if err != nil {
+		return name
+	}
+	purl.Version = ""
+	purl.Qualifiers = nil
+	purl.Subpath = ""
+	return purl.ToString()
+}
+
+// packageVersion returns the version of a package named by its purl.
+func packageVersion(name string) string {
+	purl, err := packageurl.FromString(name)
+	if err != nil {
+		return ""
+	}
+	return purl.Version
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffGraphs(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	vulnerability := func(id string) *Node {
+		node, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: id})
+		require.NoError(t, err)
+		return node
+	}
+
+	// Release 1 depends on lib-a 1.0.0, lib-b, lib-c and left-pad, release 2 bumps lib-a, drops left-pad and
+	// adds lib-d, which brings in a vulnerability
+	v1, v2 := addTestNode(t, storage, "pkg:generic/app@1.0.0"), addTestNode(t, storage, "pkg:generic/app@2.0.0")
+	libA1, libA2 := addTestNode(t, storage, "pkg:npm/lib-a@1.0.0"), addTestNode(t, storage, "pkg:npm/lib-a@1.1.0?arch=any")
+	libB, libC, libD := addTestNode(t, storage, "pkg:npm/lib-b@1.0.0"), addTestNode(t, storage, "pkg:npm/lib-c@1.0.0"), addTestNode(t, storage, "pkg:npm/lib-d@1.0.0")
+	leftPad := addTestNode(t, storage, "left-pad")
+	old, recent, triaged := vulnerability("GHSA-0001"), vulnerability("GHSA-0002"), vulnerability("GHSA-0003")
+
+	for _, dependency := range []*Node{libA1, libB, libC, leftPad} {
+		addTestDependency(t, storage, v1, dependency)
+	}
+	addTestDependency(t, storage, libA1, libB)
+	addTestDependency(t, storage, libC, libB)
+	addTestDependency(t, storage, leftPad, old)
+	for _, dependency := range []*Node{libA2, libB, libC, libD} {
+		addTestDependency(t, storage, v2, dependency)
+	}
+	addTestDependency(t, storage, libA2, libC)
+	addTestDependency(t, storage, libD, libC)
+	addTestDependency(t, storage, libD, recent)
+	// Release 2 isn't affected by the vulnerability lib-d brings in, according to a VEX statement
+	addTestDependency(t, storage, libD, triaged)
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: libD.ID, To: triaged.ID}, &VEXStatement{Product: v2.ID, Status: VEXNotAffected}))
+	require.NoError(t, Cache(ctx, storage))
+
+	diff, err := DiffGraphs(ctx, DiffSide{Storage: storage, Root: v1.Name}, DiffSide{Storage: storage, Root: v2.Name}, DiffOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &GraphDiff{
+		Added:                []string{libD.Name},
+		Removed:              []string{leftPad.Name},
+		VersionChanges:       []VersionChange{{Package: "pkg:npm/lib-a", From: "1.0.0", To: "1.1.0"}},
+		NewVulnerabilities:   []VulnerabilityChange{{Vulnerability: "GHSA-0002", Packages: []string{libD.Name}}},
+		FixedVulnerabilities: []VulnerabilityChange{{Vulnerability: "GHSA-0001", Packages: []string{leftPad.Name}}},
+		// lib-b stays first, and lib-c is now depended on by lib-a and lib-d
+		LeaderboardChanges: []LeaderboardPosition{{Package: "pkg:npm/lib-c", From: 0, To: 2, Dependents: 2}},
+	}, diff)
+
+	// A graph has no differences with itself
+	diff, err = DiffGraphs(ctx, DiffSide{Storage: storage}, DiffSide{Storage: storage}, DiffOptions{LeaderboardSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, &GraphDiff{
+		Added:                []string{},
+		Removed:              []string{},
+		VersionChanges:       []VersionChange{},
+		NewVulnerabilities:   []VulnerabilityChange{},
+		FixedVulnerabilities: []VulnerabilityChange{},
+		LeaderboardChanges:   []LeaderboardPosition{},
+	}, diff)
+
+	// The whole graph is only spared the vulnerabilities VEX statements suppress for every root that reaches them
+	diff, err = DiffGraphs(ctx, DiffSide{Storage: NewMemoryStorage()}, DiffSide{Storage: storage}, DiffOptions{})
+	require.NoError(t, err)
+	var found []string
+	for _, change := range diff.NewVulnerabilities {
+		found = append(found, change.Vulnerability)
+	}
+	assert.Equal(t, []string{"GHSA-0001", "GHSA-0002"}, found)
+
+	_, err = DiffGraphs(ctx, DiffSide{Storage: storage, Root: "missing"}, DiffSide{Storage: storage}, DiffOptions{})
+	assert.Error(t, err)
+}
+
+func TestPackageIdentity(t *testing.T) {
+	assert.Equal(t, "pkg:npm/%40scope/lib", PackageIdentity("pkg:npm/%40scope/lib@1.0.0?arch=any#dist"))
+	assert.Equal(t, "pkg:golang/github.com/a/b", PackageIdentity("pkg:golang/github.com/a/b@v1.2.3"))
+	assert.Equal(t, "left-pad", PackageIdentity("left-pad"))
+	assert.Equal(t, "v1.2.3", packageVersion("pkg:golang/github.com/a/b@v1.2.3"))
+}
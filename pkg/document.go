@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentNodeType is the type of the nodes that represent ingested SBOM documents.
+// A document node depends on the document's root components.
+const DocumentNodeType = "DOCUMENT"
+
+// DocumentMetadata is the metadata of a document node.
+type DocumentMetadata struct {
+	// ID is the document's serial number or namespace, if it has one.
+	ID      string    `json:"id,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Version string    `json:"version,omitempty"`
+	Authors []string  `json:"authors,omitempty"`
+	Tools   []string  `json:"tools,omitempty"`
+	Date    time.Time `json:"date,omitempty"`
+	// RootElements are the names of the document's root components.
+	RootElements []string `json:"rootElements,omitempty"`
+}
+
+// Edge is a dependency from one node to another.
+type Edge struct {
+	From uint32
+	To   uint32
+}
+
+func (e Edge) String() string {
+	return fmt.Sprintf("%d:%d", e.From, e.To)
+}
+
+// EdgeType is the SBOM relationship an edge was declared with.
+type EdgeType struct {
+	// Type is the protobom edge type, such as dependsOn or devDependency.
+	Type string `json:"type"`
+	// Reversed is set when the relationship was declared from the dependency to the dependent, such as dependencyOf.
+	Reversed bool `json:"reversed,omitempty"`
+}
+
+// ParseEdge parses an edge formatted by Edge.String.
+func ParseEdge(s string) (Edge, error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return Edge{}, fmt.Errorf("invalid edge %s", s)
+	}
+	fromID, err := strconv.ParseUint(from, 10, 32)
+	if err != nil {
+		return Edge{}, fmt.Errorf("invalid edge %s: %w", s, err)
+	}
+	toID, err := strconv.ParseUint(to, 10, 32)
+	if err != nil {
+		return Edge{}, fmt.Errorf("invalid edge %s: %w", s, err)
+	}
+	return Edge{From: uint32(fromID), To: uint32(toID)}, nil
+}
+
+// NodeDocumentMetadata returns the metadata of a document node, whether or not it has been through the storage backend.
+func NodeDocumentMetadata(node *Node) (*DocumentMetadata, error) {
+	if node.Type != DocumentNodeType {
+		return nil, fmt.Errorf("node %s is a %s, not a document", node.Name, node.Type)
+	}
+	if metadata, ok := node.Metadata.(*DocumentMetadata); ok {
+		return metadata, nil
+	}
+
+	// Metadata loaded from the storage backend is decoded into generic JSON values
+	data, err := json.Marshal(node.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document metadata: %w", err)
+	}
+	var metadata DocumentMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal document metadata: %w", err)
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,481 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+)
+
+// GraphFormats are the formats graphs can be written as with WriteGraph.
+var GraphFormats = []string{"cypher", "cytoscape", "dot", "gexf", "graphml", "mermaid"}
+
+// AllAttributes includes every metadata attribute of the nodes when given as an attribute.
+const AllAttributes = "*"
+
+// reservedAttributes are the attributes every node is exported with, which metadata attributes can't replace.
+var reservedAttributes = []string{"id", "label", "name", "type"}
+
+// GraphOptions configure exported graphs.
+type GraphOptions struct {
+	// Label is what nodes are labelled with: name, id, type or a metadata attribute such as version.
+	// Nodes without the attribute are labelled with their name, which is also the default.
+	Label string
+	// Attributes are the top-level metadata attributes to include on each node, or AllAttributes.
+	// Attributes named like the id, label, name and type every node has are left out.
+	Attributes []string
+}
+
+// graphNode is a node of an exported graph.
+type graphNode struct {
+	id         uint32
+	nodeType   string
+	name       string
+	label      string
+	attributes map[string]string
+}
+
+// graph is the subgraph of a set of nodes, with the edges between them.
+type graph struct {
+	nodes []graphNode
+	edges []pkg.Edge
+	// attributes are the names of the attributes of any of the nodes, sorted.
+	attributes []string
+}
+
+// collectGraph gets the subgraph of the given nodes, or of every node if ids is nil.
+func collectGraph(ctx context.Context, storage pkg.Storage, ids *roaring.Bitmap, opts GraphOptions) (*graph, error) {
+	var keys []uint32
+	if ids == nil {
+		var err error
+		keys, err = storage.GetAllKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get nodes: %w", err)
+		}
+	} else {
+		keys = ids.ToArray()
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	slices.Sort(keys)
+
+	result := &graph{}
+	seen := map[string]bool{}
+	for _, id := range keys {
+		node, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		attributes, err := nodeAttributes(node)
+		if err != nil {
+			return nil, err
+		}
+		selected := map[string]string{}
+		for name, value := range attributes {
+			if slices.Contains(reservedAttributes, name) {
+				continue
+			}
+			if slices.Contains(opts.Attributes, AllAttributes) || slices.Contains(opts.Attributes, name) {
+				selected[name] = value
+				if !seen[name] {
+					seen[name] = true
+					result.attributes = append(result.attributes, name)
+				}
+			}
+		}
+
+		label := node.Name
+		switch opts.Label {
+		case "", "name":
+		case "id":
+			label = strconv.FormatUint(uint64(node.ID), 10)
+		case "type":
+			label = node.Type
+		default:
+			if value := attributes[opts.Label]; value != "" {
+				label = value
+			}
+		}
+		result.nodes = append(result.nodes, graphNode{id: node.ID, nodeType: node.Type, name: node.Name, label: label, attributes: selected})
+
+		for _, child := range node.Children.ToArray() {
+			if _, ok := nodes[child]; ok {
+				result.edges = append(result.edges, pkg.Edge{From: node.ID, To: child})
+			}
+		}
+	}
+	slices.Sort(result.attributes)
+	return result, nil
+}
+
+// nodeAttributes flattens the top-level metadata of a node into strings, writing values that aren't strings as JSON.
+func nodeAttributes(node *pkg.Node) (map[string]string, error) {
+	attributes := map[string]string{}
+	if node.Metadata == nil {
+		return attributes, nil
+	}
+	data, err := json.Marshal(node.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata of %s: %w", node.Name, err)
+	}
+	var metadata map[string]json.RawMessage
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		// Metadata that isn't an object has no attributes
+		return attributes, nil
+	}
+	for name, raw := range metadata {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		attributes[name] = value
+	}
+	return attributes, nil
+}
+
+// WriteGraph writes the subgraph of the given nodes, or of the whole graph if nodes is nil, in one of GraphFormats.
+func WriteGraph(ctx context.Context, storage pkg.Storage, nodes *roaring.Bitmap, format string, w io.Writer, opts GraphOptions) error {
+	writers := map[string]func(io.Writer, *graph) error{
+		"cypher":    writeCypher,
+		"cytoscape": writeCytoscape,
+		"dot":       writeDOT,
+		"gexf":      writeGEXF,
+		"graphml":   writeGraphML,
+		"mermaid":   writeMermaid,
+	}
+	write, ok := writers[format]
+	if !ok {
+		return fmt.Errorf("unknown graph format %s, expected one of %s", format, strings.Join(GraphFormats, ", "))
+	}
+	g, err := collectGraph(ctx, storage, nodes, opts)
+	if err != nil {
+		return err
+	}
+	if err := write(w, g); err != nil {
+		return fmt.Errorf("failed to write %s graph: %w", format, err)
+	}
+	return nil
+}
+
+// WriteNeo4jCSV writes the subgraph of the given nodes, or of the whole graph if nodes is nil, as the node and
+// relationship CSV files of neo4j-admin database import.
+func WriteNeo4jCSV(ctx context.Context, storage pkg.Storage, nodes *roaring.Bitmap, nodesWriter, relationshipsWriter io.Writer, opts GraphOptions) error {
+	g, err := collectGraph(ctx, storage, nodes, opts)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(nodesWriter)
+	header := append([]string{"id:ID", ":LABEL", "name", "label"}, g.attributes...)
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write nodes: %w", err)
+	}
+	for _, node := range g.nodes {
+		record := []string{strconv.FormatUint(uint64(node.id), 10), node.nodeType, node.name, node.label}
+		for _, attribute := range g.attributes {
+			record = append(record, node.attributes[attribute])
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write nodes: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write nodes: %w", err)
+	}
+
+	writer = csv.NewWriter(relationshipsWriter)
+	if err := writer.Write([]string{":START_ID", ":END_ID", ":TYPE"}); err != nil {
+		return fmt.Errorf("failed to write relationships: %w", err)
+	}
+	for _, edge := range g.edges {
+		if err := writer.Write([]string{strconv.FormatUint(uint64(edge.From), 10), strconv.FormatUint(uint64(edge.To), 10), "DEPENDS_ON"}); err != nil {
+			return fmt.Errorf("failed to write relationships: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write relationships: %w", err)
+	}
+	return nil
+}
+
+func writeDOT(w io.Writer, g *graph) error {
+	var b strings.Builder
+	b.WriteString("digraph G {\n")
+	b.WriteString("node [shape=ellipse, style=filled, fillcolor=lightblue];\n")
+	b.WriteString("edge [color=gray];\n")
+	for _, node := range g.nodes {
+		fmt.Fprintf(&b, "%d [label=%s, type=%s, name=%s", node.id, pkg.DOTQuote(node.label), pkg.DOTQuote(node.nodeType), pkg.DOTQuote(node.name))
+		for _, attribute := range g.attributes {
+			if value, ok := node.attributes[attribute]; ok {
+				fmt.Fprintf(&b, ", %s=%s", pkg.DOTQuote(attribute), pkg.DOTQuote(value))
+			}
+		}
+		b.WriteString("];\n")
+	}
+	for _, edge := range g.edges {
+		fmt.Fprintf(&b, "%d -> %d;\n", edge.From, edge.To)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMermaid(w io.Writer, g *graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, node := range g.nodes {
+		lines := []string{node.label}
+		for _, attribute := range g.attributes {
+			if value, ok := node.attributes[attribute]; ok {
+				lines = append(lines, attribute+": "+value)
+			}
+		}
+		for i, line := range lines {
+			lines[i] = mermaidEscape(line)
+		}
+		fmt.Fprintf(&b, "  n%d[\"%s\"]\n", node.id, strings.Join(lines, "<br/>"))
+	}
+	for _, edge := range g.edges {
+		fmt.Fprintf(&b, "  n%d --> n%d\n", edge.From, edge.To)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidEscape escapes text in a quoted Mermaid label with entity codes.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", " ").Replace(s)
+}
+
+type cytoscapeElement struct {
+	Data map[string]string `json:"data"`
+}
+
+func writeCytoscape(w io.Writer, g *graph) error {
+	elements := struct {
+		Nodes []cytoscapeElement `json:"nodes"`
+		Edges []cytoscapeElement `json:"edges"`
+	}{Nodes: []cytoscapeElement{}, Edges: []cytoscapeElement{}}
+	for _, node := range g.nodes {
+		data := map[string]string{}
+		for attribute, value := range node.attributes {
+			data[attribute] = value
+		}
+		data["id"] = strconv.FormatUint(uint64(node.id), 10)
+		data["label"] = node.label
+		data["name"] = node.name
+		data["type"] = node.nodeType
+		elements.Nodes = append(elements.Nodes, cytoscapeElement{Data: data})
+	}
+	for _, edge := range g.edges {
+		elements.Edges = append(elements.Edges, cytoscapeElement{Data: map[string]string{
+			"id":     fmt.Sprintf("%d-%d", edge.From, edge.To),
+			"source": strconv.FormatUint(uint64(edge.From), 10),
+			"target": strconv.FormatUint(uint64(edge.To), 10),
+		}})
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"elements": elements}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func writeCypher(w io.Writer, g *graph) error {
+	var b strings.Builder
+	for _, node := range g.nodes {
+		properties := []string{
+			"id: " + strconv.FormatUint(uint64(node.id), 10),
+			"name: " + cypherQuote(node.name),
+			"label: " + cypherQuote(node.label),
+		}
+		for _, attribute := range g.attributes {
+			if value, ok := node.attributes[attribute]; ok {
+				properties = append(properties, cypherName(attribute)+": "+cypherQuote(value))
+			}
+		}
+		fmt.Fprintf(&b, "CREATE (:Node:%s {%s});\n", cypherName(node.nodeType), strings.Join(properties, ", "))
+	}
+	if len(g.edges) > 0 {
+		b.WriteString("CREATE INDEX node_id IF NOT EXISTS FOR (n:Node) ON (n.id);\n")
+	}
+	for _, edge := range g.edges {
+		fmt.Fprintf(&b, "MATCH (a:Node {id: %d}), (b:Node {id: %d}) CREATE (a)-[:DEPENDS_ON]->(b);\n", edge.From, edge.To)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// cypherQuote quotes a Cypher string literal.
+func cypherQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
+
+// cypherName quotes a Cypher label or property name.
+func cypherName(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, g *graph) error {
+	document := graphMLDocument{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphMLGraph{ID: "G", EdgeDefault: "directed"},
+	}
+	names := append([]string{"label", "name", "type"}, g.attributes...)
+	keys := map[string]string{}
+	for i, name := range names {
+		keys[name] = fmt.Sprintf("d%d", i)
+		document.Keys = append(document.Keys, graphMLKey{ID: keys[name], For: "node", AttrName: name, AttrType: "string"})
+	}
+	for _, node := range g.nodes {
+		element := graphMLNode{ID: fmt.Sprintf("n%d", node.id), Data: []graphMLData{
+			{Key: keys["label"], Value: node.label},
+			{Key: keys["name"], Value: node.name},
+			{Key: keys["type"], Value: node.nodeType},
+		}}
+		for _, attribute := range g.attributes {
+			if value, ok := node.attributes[attribute]; ok {
+				element.Data = append(element.Data, graphMLData{Key: keys[attribute], Value: value})
+			}
+		}
+		document.Graph.Nodes = append(document.Graph.Nodes, element)
+	}
+	for i, edge := range g.edges {
+		document.Graph.Edges = append(document.Graph.Edges, graphMLEdge{ID: fmt.Sprintf("e%d", i), Source: fmt.Sprintf("n%d", edge.From), Target: fmt.Sprintf("n%d", edge.To)})
+	}
+	return writeXML(w, document)
+}
+
+type gexfDocument struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string         `xml:"defaultedgetype,attr"`
+	Attributes      gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode     `xml:"nodes>node"`
+	Edges           []gexfEdge     `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+func writeGEXF(w io.Writer, g *graph) error {
+	document := gexfDocument{
+		Xmlns:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph:   gexfGraph{DefaultEdgeType: "directed", Attributes: gexfAttributes{Class: "node"}},
+	}
+	names := append([]string{"name", "type"}, g.attributes...)
+	for i, name := range names {
+		document.Graph.Attributes.Attributes = append(document.Graph.Attributes.Attributes, gexfAttribute{ID: strconv.Itoa(i), Title: name, Type: "string"})
+	}
+	for _, node := range g.nodes {
+		element := gexfNode{ID: strconv.FormatUint(uint64(node.id), 10), Label: node.label, AttValues: []gexfAttValue{
+			{For: "0", Value: node.name},
+			{For: "1", Value: node.nodeType},
+		}}
+		for i, attribute := range g.attributes {
+			if value, ok := node.attributes[attribute]; ok {
+				element.AttValues = append(element.AttValues, gexfAttValue{For: strconv.Itoa(i + 2), Value: value})
+			}
+		}
+		document.Graph.Nodes = append(document.Graph.Nodes, element)
+	}
+	for i, edge := range g.edges {
+		document.Graph.Edges = append(document.Graph.Edges, gexfEdge{ID: strconv.Itoa(i), Source: strconv.FormatUint(uint64(edge.From), 10), Target: strconv.FormatUint(uint64(edge.To), 10)})
+	}
+	return writeXML(w, document)
+}
+
+func writeXML(w io.Writer, document any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
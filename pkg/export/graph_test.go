@@ -0,0 +1,135 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addTestNode adds a package with its component metadata to the storage backend.
+func addTestNode(t *testing.T, storage pkg.Storage, name string, metadata *pkg.ComponentMetadata) *pkg.Node {
+	node, err := pkg.AddNode(context.Background(), storage, "PACKAGE", metadata, name)
+	require.NoError(t, err)
+	return node
+}
+
+// labelGraph adds an app depending on a library whose description needs escaping in every format, and a tool
+// depending on the app, and returns the three nodes.
+func labelGraph(t *testing.T, storage pkg.Storage) (*pkg.Node, *pkg.Node, *pkg.Node) {
+	ctx := context.Background()
+	app := addTestNode(t, storage, "pkg:generic/app@1.0.0", &pkg.ComponentMetadata{Name: "app", Version: "1.0.0"})
+	lib := addTestNode(t, storage, "pkg:npm/lib@2.0.0", &pkg.ComponentMetadata{Name: "lib", Version: "2.0.0", Description: "Says \"<hi>\" \\ & `bye`\non two lines", Licenses: []string{"MIT"}})
+	tool := addTestNode(t, storage, "pkg:generic/tool@3.0.0", nil)
+	require.NoError(t, app.SetDependency(ctx, storage, lib))
+	require.NoError(t, tool.SetDependency(ctx, storage, app))
+	return app, lib, tool
+}
+
+func TestWriteGraph(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	app, lib, tool := labelGraph(t, storage)
+	description := "Says \"<hi>\" \\ & `bye`\non two lines"
+	opts := GraphOptions{Label: "version", Attributes: []string{"description", "licenses", "name"}}
+	subgraph := roaring.BitmapOf(app.ID, lib.ID)
+
+	write := func(format string, nodes *roaring.Bitmap) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, WriteGraph(ctx, storage, nodes, format, &buf, opts))
+		return buf.Bytes()
+	}
+
+	t.Run("graphml", func(t *testing.T) {
+		var document graphMLDocument
+		require.NoError(t, xml.Unmarshal(write("graphml", subgraph), &document))
+		assert.Equal(t, []graphMLKey{
+			{ID: "d0", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "d1", For: "node", AttrName: "name", AttrType: "string"},
+			{ID: "d2", For: "node", AttrName: "type", AttrType: "string"},
+			{ID: "d3", For: "node", AttrName: "description", AttrType: "string"},
+			{ID: "d4", For: "node", AttrName: "licenses", AttrType: "string"},
+		}, document.Keys)
+		require.Len(t, document.Graph.Nodes, 2)
+		assert.Equal(t, []graphMLData{
+			{Key: "d0", Value: "2.0.0"},
+			{Key: "d1", Value: lib.Name},
+			{Key: "d2", Value: "PACKAGE"},
+			{Key: "d3", Value: description},
+			{Key: "d4", Value: `["MIT"]`},
+		}, document.Graph.Nodes[1].Data)
+		assert.Equal(t, []graphMLEdge{{ID: "e0", Source: "n1", Target: "n2"}}, document.Graph.Edges)
+	})
+
+	t.Run("gexf", func(t *testing.T) {
+		var document gexfDocument
+		require.NoError(t, xml.Unmarshal(write("gexf", nil), &document))
+		require.Len(t, document.Graph.Nodes, 3)
+		assert.Equal(t, "2.0.0", document.Graph.Nodes[1].Label)
+		assert.Contains(t, document.Graph.Nodes[1].AttValues, gexfAttValue{For: "2", Value: description})
+		// Nodes without the label attribute are labelled with their name
+		assert.Equal(t, tool.Name, document.Graph.Nodes[2].Label)
+		assert.Len(t, document.Graph.Edges, 2)
+	})
+
+	t.Run("cytoscape", func(t *testing.T) {
+		var document struct {
+			Elements struct {
+				Nodes []cytoscapeElement `json:"nodes"`
+				Edges []cytoscapeElement `json:"edges"`
+			} `json:"elements"`
+		}
+		require.NoError(t, json.Unmarshal(write("cytoscape", subgraph), &document))
+		require.Len(t, document.Elements.Nodes, 2)
+		assert.Equal(t, map[string]string{"id": "2", "label": "2.0.0", "name": lib.Name, "type": "PACKAGE", "description": description, "licenses": `["MIT"]`}, document.Elements.Nodes[1].Data)
+		assert.Equal(t, []cytoscapeElement{{Data: map[string]string{"id": "1-2", "source": "1", "target": "2"}}}, document.Elements.Edges)
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		dot := string(write("dot", subgraph))
+		assert.Contains(t, dot, `"description"="Says \"<hi>\" \\ & `+"`bye`"+`\non two lines"`)
+		assert.Contains(t, dot, "1 -> 2;\n")
+		assert.NotContains(t, dot, "3 ->")
+	})
+
+	t.Run("mermaid", func(t *testing.T) {
+		mermaid := string(write("mermaid", subgraph))
+		assert.Contains(t, mermaid, `n2["2.0.0<br/>description: Says #quot;#lt;hi#gt;#quot; \ & `+"`bye`"+` on two lines<br/>licenses: [#quot;MIT#quot;]"]`)
+		assert.Contains(t, mermaid, "n1 --> n2\n")
+	})
+
+	t.Run("cypher", func(t *testing.T) {
+		cypher := string(write("cypher", subgraph))
+		assert.Contains(t, cypher, "CREATE (:Node:`PACKAGE` {id: 2, name: \"pkg:npm/lib@2.0.0\", label: \"2.0.0\", `description`: \"Says \\\"<hi>\\\" \\\\ & `bye`\\non two lines\", `licenses`: \"[\\\"MIT\\\"]\"});\n")
+		assert.Contains(t, cypher, "MATCH (a:Node {id: 1}), (b:Node {id: 2}) CREATE (a)-[:DEPENDS_ON]->(b);\n")
+	})
+
+	var buf bytes.Buffer
+	assert.Error(t, WriteGraph(ctx, storage, nil, "png", &buf, opts))
+}
+
+func TestWriteNeo4jCSV(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	_, lib, _ := labelGraph(t, storage)
+
+	var nodes, relationships bytes.Buffer
+	require.NoError(t, WriteNeo4jCSV(ctx, storage, nil, &nodes, &relationships, GraphOptions{Attributes: []string{AllAttributes}}))
+
+	records, err := csv.NewReader(&nodes).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id:ID", ":LABEL", "name", "label", "description", "licenses", "releaseDate", "version"}, records[0])
+	assert.Equal(t, []string{"2", "PACKAGE", lib.Name, lib.Name, "Says \"<hi>\" \\ & `bye`\non two lines", `["MIT"]`, "0001-01-01T00:00:00Z", "2.0.0"}, records[2])
+	assert.Equal(t, []string{"3", "PACKAGE", "pkg:generic/tool@3.0.0", "pkg:generic/tool@3.0.0", "", "", "", ""}, records[3])
+
+	records, err = csv.NewReader(&relationships).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{":START_ID", ":END_ID", ":TYPE"}, {"1", "2", "DEPENDS_ON"}, {"3", "1", "DEPENDS_ON"}}, records)
+}
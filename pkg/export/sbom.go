@@ -0,0 +1,343 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/google/uuid"
+	"github.com/protobom/protobom/pkg/formats"
+	"github.com/protobom/protobom/pkg/native"
+	"github.com/protobom/protobom/pkg/sbom"
+	"github.com/protobom/protobom/pkg/writer"
+	"github.com/spdx/tools-golang/spdx"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SBOMFormats maps the formats SBOMs can be exported as to their protobom formats.
+var SBOMFormats = map[string]formats.Format{
+	"cyclonedx-1.4": formats.CDX14JSON,
+	"cyclonedx-1.5": formats.CDX15JSON,
+	"spdx-2.3":      formats.SPDX23JSON,
+}
+
+// releaseNodeID is the ID of the node an exported SBOM with several roots describes, depending on every root.
+const releaseNodeID = "release"
+
+// SBOMOptions configure exported SBOMs.
+type SBOMOptions struct {
+	// Name is the name of the document, and of the release component when several roots are exported.
+	// By default, it is the name of the only root or "release".
+	Name string
+	// Version is the version of the release component when several roots are exported.
+	Version string
+	// Author is the author of the document.
+	Author string
+	// Timestamp is when the document was created, now by default.
+	Timestamp time.Time
+}
+
+func (o SBOMOptions) withDefaults(roots []*pkg.Node) SBOMOptions {
+	if o.Name == "" {
+		o.Name = releaseNodeID
+		if len(roots) == 1 {
+			o.Name = roots[0].Name
+		}
+	}
+	if o.Author == "" {
+		o.Author = DefaultAuthor
+	}
+	if o.Timestamp.IsZero() {
+		o.Timestamp = time.Now()
+	}
+	o.Timestamp = o.Timestamp.UTC().Truncate(time.Second)
+	return o
+}
+
+// SBOMDocument builds a protobom document of the dependency closure of the given roots, restoring the metadata of
+// each component and the dependencies between them, with the relationship types they were ingested with.
+// Documents and vulnerabilities in the closure are left out.
+// When there are several roots, the document describes a release component depending on all of them.
+func SBOMDocument(ctx context.Context, storage pkg.Storage, rootNames []string, opts SBOMOptions) (*sbom.Document, error) {
+	document, _, err := sbomDocument(ctx, storage, rootNames, opts)
+	return document, err
+}
+
+// sbomDocument builds the document SBOMDocument returns, along with the dependencies between its nodes
+// as dependsOn edges from each dependent, whatever relationship types they were ingested with.
+func sbomDocument(ctx context.Context, storage pkg.Storage, rootNames []string, opts SBOMOptions) (*sbom.Document, []*sbom.Edge, error) {
+	if len(rootNames) == 0 {
+		return nil, nil, fmt.Errorf("no roots to export")
+	}
+	var roots []*pkg.Node
+	closure := map[uint32]*pkg.Node{}
+	for _, name := range rootNames {
+		id, err := storage.NameToID(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get node ID for name %s: %w", name, err)
+		}
+		root, err := storage.GetNode(ctx, id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get node for id %v: %w", id, err)
+		}
+		roots = append(roots, root)
+		closure[root.ID] = root
+
+		dependencies, err := root.QueryDependencies(ctx, storage)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query dependencies of %s: %w", root.Name, err)
+		}
+		nodes, err := storage.GetNodes(ctx, dependencies.ToArray())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get dependencies of %s: %w", root.Name, err)
+		}
+		for id, node := range nodes {
+			if node.Type != pkg.DocumentNodeType && node.Type != pkg.VulnerabilityNodeType {
+				closure[id] = node
+			}
+		}
+	}
+	opts = opts.withDefaults(roots)
+
+	ids := make([]uint32, 0, len(closure))
+	for id := range closure {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	document := sbom.NewDocument()
+	document.Metadata.Name = opts.Name
+	document.Metadata.Version = "1"
+	document.Metadata.Date = timestamppb.New(opts.Timestamp)
+	document.Metadata.Authors = []*sbom.Person{{Name: opts.Author}}
+	document.Metadata.Tools = []*sbom.Tool{{Name: "minefield"}}
+
+	var dependencies []*sbom.Edge
+	if len(roots) > 1 {
+		release := &sbom.Node{Id: releaseNodeID, Type: sbom.Node_PACKAGE, Name: opts.Name, Version: opts.Version}
+		document.NodeList.AddRootNode(release)
+		edge := &sbom.Edge{Type: sbom.Edge_dependsOn, From: releaseNodeID}
+		for _, root := range roots {
+			edge.To = append(edge.To, sbomNodeID(root.ID))
+		}
+		document.NodeList.AddEdge(edge)
+		dependencies = append(dependencies, edge)
+	}
+	for _, id := range ids {
+		node, err := sbomNode(closure[id])
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(roots) == 1 && id == roots[0].ID {
+			document.NodeList.AddRootNode(node)
+		} else {
+			document.NodeList.AddNode(node)
+		}
+	}
+	var edges []pkg.Edge
+	for _, id := range ids {
+		dependency := &sbom.Edge{Type: sbom.Edge_dependsOn, From: sbomNodeID(id)}
+		for _, child := range closure[id].Children.ToArray() {
+			if _, ok := closure[child]; ok {
+				dependency.To = append(dependency.To, sbomNodeID(child))
+				edges = append(edges, pkg.Edge{From: id, To: child})
+			}
+		}
+		if len(dependency.To) > 0 {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	types, err := storage.GetEdgeTypes(ctx, edges)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get edge types: %w", err)
+	}
+	for _, edge := range typedEdges(edges, types) {
+		document.NodeList.AddEdge(edge)
+	}
+
+	// The serial number is derived from the contents, so exporting an unchanged graph gives the same document
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(document.NodeList)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal document: %w", err)
+	}
+	document.Metadata.Id = "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, data).String()
+	return document, dependencies, nil
+}
+
+// typedEdges groups the edges of the graph into SBOM edges of the relationship types they were ingested with,
+// declared in the direction of the relationship. Edges without a known type are dependsOn edges.
+func typedEdges(edges []pkg.Edge, types map[pkg.Edge]pkg.EdgeType) []*sbom.Edge {
+	type key struct {
+		from     uint32
+		edgeType sbom.Edge_Type
+	}
+	var result []*sbom.Edge
+	grouped := map[key]*sbom.Edge{}
+	for _, edge := range edges {
+		from, to, edgeType := edge.From, edge.To, sbom.Edge_dependsOn
+		if declared, ok := types[edge]; ok {
+			if value, ok := sbom.Edge_Type_value[declared.Type]; ok {
+				edgeType = sbom.Edge_Type(value)
+				if declared.Reversed {
+					from, to = to, from
+				}
+			}
+		}
+		k := key{from: from, edgeType: edgeType}
+		if grouped[k] == nil {
+			grouped[k] = &sbom.Edge{Type: edgeType, From: sbomNodeID(from)}
+			result = append(result, grouped[k])
+		}
+		grouped[k].To = append(grouped[k].To, sbomNodeID(to))
+	}
+	return result
+}
+
+// SBOM exports the dependency closure of the given roots as a SBOM in one of SBOMFormats.
+func SBOM(ctx context.Context, storage pkg.Storage, rootNames []string, format string, opts SBOMOptions) ([]byte, error) {
+	protobomFormat, ok := SBOMFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown SBOM format %s", format)
+	}
+	document, dependencies, err := sbomDocument(ctx, storage, rootNames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	serializer, err := writer.GetFormatSerializer(protobomFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get serializer: %w", err)
+	}
+	var nativeDocument any
+	if protobomFormat.Type() == formats.CDXFORMAT {
+		nativeDocument, err = cycloneDXBOM(serializer, document, dependencies)
+	} else {
+		nativeDocument, err = spdxDocument(serializer, document)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := serializer.Render(nativeDocument, &buf, &native.RenderOptions{Indent: 2}, nil); err != nil {
+		return nil, fmt.Errorf("failed to write SBOM: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// cycloneDXBOM serializes a document to CycloneDX. Protobom leaves the components other components depend on out of
+// the BOM, so the components are serialized without their edges and the dependencies are added back afterwards.
+// CycloneDX has no relationship types, so every dependency is listed under its dependent.
+func cycloneDXBOM(serializer native.Serializer, document *sbom.Document, dependencies []*sbom.Edge) (*cdx.BOM, error) {
+	nodes := proto.Clone(document).(*sbom.Document)
+	nodes.NodeList.Edges = nil
+	nativeDocument, err := serializer.Serialize(nodes, &native.SerializeOptions{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize SBOM: %w", err)
+	}
+	bom, ok := nativeDocument.(*cdx.BOM)
+	if !ok {
+		return nil, fmt.Errorf("unexpected CycloneDX document %T", nativeDocument)
+	}
+	if bom.Components != nil {
+		slices.SortFunc(*bom.Components, func(a, b cdx.Component) int { return strings.Compare(a.BOMRef, b.BOMRef) })
+	}
+
+	cdxDependencies := []cdx.Dependency{}
+	for _, edge := range dependencies {
+		dependsOn := slices.Clone(edge.GetTo())
+		cdxDependencies = append(cdxDependencies, cdx.Dependency{Ref: edge.GetFrom(), Dependencies: &dependsOn})
+	}
+	bom.Dependencies = &cdxDependencies
+	return bom, nil
+}
+
+// spdxDocument serializes a document to SPDX, with a unique namespace and the document's creation date.
+func spdxDocument(serializer native.Serializer, document *sbom.Document) (*spdx.Document, error) {
+	nativeDocument, err := serializer.Serialize(document, &native.SerializeOptions{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize SBOM: %w", err)
+	}
+	spdxDocument, ok := nativeDocument.(*spdx.Document)
+	if !ok {
+		return nil, fmt.Errorf("unexpected SPDX document %T", nativeDocument)
+	}
+	spdxDocument.DocumentNamespace = "https://spdx.org/spdxdocs/minefield/" + strings.TrimPrefix(document.GetMetadata().GetId(), "urn:uuid:")
+	spdxDocument.CreationInfo.Created = document.GetMetadata().GetDate().AsTime().Format(time.RFC3339)
+	return spdxDocument, nil
+}
+
+// sbomNodeID is the ID of a graph node in exported SBOMs, valid as both a SPDX ID and a CycloneDX BOM reference.
+func sbomNodeID(id uint32) string {
+	return fmt.Sprintf("minefield-%d", id)
+}
+
+// sbomNode restores the SBOM node a graph node was ingested from.
+func sbomNode(node *pkg.Node) (*sbom.Node, error) {
+	metadata, err := pkg.NodeComponentMetadata(node)
+	if err != nil {
+		return nil, err
+	}
+	nodeType := sbom.Node_PACKAGE
+	if node.Type == sbom.Node_FILE.String() {
+		nodeType = sbom.Node_FILE
+	}
+	result := &sbom.Node{
+		Id:               sbomNodeID(node.ID),
+		Type:             nodeType,
+		Name:             metadata.Name,
+		Version:          metadata.Version,
+		Description:      metadata.Description,
+		Licenses:         metadata.Licenses,
+		LicenseConcluded: metadata.LicenseConcluded,
+		Copyright:        metadata.Copyright,
+		UrlHome:          metadata.HomeURL,
+		UrlDownload:      metadata.DownloadURL,
+		Hashes:           map[int32]string{},
+		Identifiers:      map[int32]string{},
+	}
+	if result.Name == "" {
+		result.Name = node.Name
+	}
+	if !metadata.ReleaseDate.IsZero() {
+		result.ReleaseDate = timestamppb.New(metadata.ReleaseDate)
+	}
+	for algorithm, hash := range metadata.Hashes {
+		if value, ok := sbom.HashAlgorithm_value[strings.ToUpper(strings.ReplaceAll(algorithm, "-", "_"))]; ok {
+			result.Hashes[value] = hash
+		}
+	}
+	for identifierType, identifier := range metadata.Identifiers {
+		if value, ok := sbom.SoftwareIdentifierType_value[strings.ToUpper(identifierType)]; ok {
+			result.Identifiers[value] = identifier
+		}
+	}
+	// Nodes are named by their purl, which is kept when the component declared no other
+	if _, ok := result.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)]; !ok && strings.HasPrefix(node.Name, "pkg:") {
+		result.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] = node.Name
+	}
+	for _, supplier := range metadata.Suppliers {
+		result.Suppliers = append(result.Suppliers, &sbom.Person{Name: supplier})
+	}
+	for _, originator := range metadata.Originators {
+		result.Originators = append(result.Originators, &sbom.Person{Name: originator})
+	}
+	for _, reference := range metadata.ExternalReferences {
+		referenceType := sbom.ExternalReference_OTHER
+		if value, ok := sbom.ExternalReference_ExternalReferenceType_value[strings.ToUpper(reference.Type)]; ok {
+			referenceType = sbom.ExternalReference_ExternalReferenceType(value)
+		}
+		result.ExternalReferences = append(result.ExternalReferences, &sbom.ExternalReference{
+			Type:    referenceType,
+			Url:     reference.URL,
+			Comment: reference.Comment,
+		})
+	}
+	return result, nil
+}
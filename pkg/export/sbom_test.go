@@ -0,0 +1,153 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/protobom/protobom/pkg/reader"
+	"github.com/protobom/protobom/pkg/sbom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sbomGraph adds two products sharing a library, the library's vulnerability and a document, and returns the products.
+func sbomGraph(t *testing.T, storage pkg.Storage) (*pkg.Node, *pkg.Node) {
+	ctx := context.Background()
+	app := addTestNode(t, storage, "pkg:generic/app@1.0.0", &pkg.ComponentMetadata{
+		Name:               "app",
+		Version:            "1.0.0",
+		Licenses:           []string{"Apache-2.0"},
+		Hashes:             map[string]string{"sha256": "abc123", "sha3-256": "def456"},
+		Identifiers:        map[string]string{"purl": "pkg:generic/app@1.0.0", "cpe23": "cpe:2.3:a:example:app:1.0.0:*:*:*:*:*:*:*"},
+		Suppliers:          []string{"Example Inc"},
+		ExternalReferences: []pkg.ExternalReference{{Type: "vcs", URL: "https://github.com/example/app"}},
+	})
+	server := addTestNode(t, storage, "pkg:generic/server@2.0.0", &pkg.ComponentMetadata{Name: "server", Version: "2.0.0"})
+	lib := addTestNode(t, storage, "pkg:npm/lib@3.0.0", &pkg.ComponentMetadata{Name: "lib", Version: "3.0.0", Licenses: []string{"MIT"}})
+	vuln, err := pkg.AddVulnerability(ctx, storage, &pkg.VulnerabilityMetadata{ID: "GHSA-lib-0001"})
+	require.NoError(t, err)
+	document, err := pkg.AddNode(ctx, storage, pkg.DocumentNodeType, &pkg.DocumentMetadata{Name: "doc"}, "doc")
+	require.NoError(t, err)
+	require.NoError(t, document.SetDependency(ctx, storage, app))
+	require.NoError(t, app.SetDependency(ctx, storage, lib))
+	require.NoError(t, server.SetDependency(ctx, storage, lib))
+	require.NoError(t, lib.SetDependency(ctx, storage, vuln))
+	require.NoError(t, pkg.Cache(ctx, storage))
+	return app, server
+}
+
+func TestSBOMDocument(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	app, server := sbomGraph(t, storage)
+	timestamp := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	document, err := SBOMDocument(ctx, storage, []string{app.Name}, SBOMOptions{Timestamp: timestamp})
+	require.NoError(t, err)
+	assert.Equal(t, app.Name, document.GetMetadata().GetName())
+	assert.Equal(t, []string{sbomNodeID(app.ID)}, document.GetNodeList().GetRootElements())
+	require.Len(t, document.GetNodeList().GetNodes(), 2)
+
+	root := document.GetNodeList().GetNodeByID(sbomNodeID(app.ID))
+	require.NotNil(t, root)
+	assert.Equal(t, "app", root.GetName())
+	assert.Equal(t, "1.0.0", root.GetVersion())
+	assert.Equal(t, []string{"Apache-2.0"}, root.GetLicenses())
+	assert.Equal(t, map[int32]string{int32(sbom.HashAlgorithm_SHA256): "abc123", int32(sbom.HashAlgorithm_SHA3_256): "def456"}, root.GetHashes())
+	assert.Equal(t, "cpe:2.3:a:example:app:1.0.0:*:*:*:*:*:*:*", root.GetIdentifiers()[int32(sbom.SoftwareIdentifierType_CPE23)])
+	assert.Equal(t, sbom.PackageURL(app.Name), root.Purl())
+	assert.Equal(t, "Example Inc", root.GetSuppliers()[0].GetName())
+	assert.Equal(t, sbom.ExternalReference_VCS, root.GetExternalReferences()[0].GetType())
+
+	require.Len(t, document.GetNodeList().GetEdges(), 1)
+	assert.Equal(t, sbom.Edge_dependsOn, document.GetNodeList().GetEdges()[0].GetType())
+	assert.Equal(t, sbomNodeID(app.ID), document.GetNodeList().GetEdges()[0].GetFrom())
+
+	// Exporting an unchanged graph gives the same serial number
+	again, err := SBOMDocument(ctx, storage, []string{app.Name}, SBOMOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, document.GetMetadata().GetId(), again.GetMetadata().GetId())
+
+	// Several roots are merged under a release component
+	merged, err := SBOMDocument(ctx, storage, []string{app.Name, server.Name}, SBOMOptions{Name: "release", Version: "2024.4"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{releaseNodeID}, merged.GetNodeList().GetRootElements())
+	assert.Len(t, merged.GetNodeList().GetNodes(), 4)
+	assert.ElementsMatch(t, []string{sbomNodeID(app.ID), sbomNodeID(server.ID)}, merged.GetNodeList().GetEdges()[0].GetTo())
+
+	_, err = SBOMDocument(ctx, storage, []string{"pkg:generic/unknown@1.0.0"}, SBOMOptions{})
+	assert.Error(t, err)
+	_, err = SBOMDocument(ctx, storage, nil, SBOMOptions{})
+	assert.Error(t, err)
+}
+
+func TestSBOM(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	app, server := sbomGraph(t, storage)
+
+	for format := range SBOMFormats {
+		t.Run(format, func(t *testing.T) {
+			data, err := SBOM(ctx, storage, []string{app.Name, server.Name}, format, SBOMOptions{Name: "release", Version: "2024.4"})
+			require.NoError(t, err)
+
+			// The exported SBOM can be read back
+			document, err := reader.New().ParseStream(bytes.NewReader(data))
+			require.NoError(t, err)
+			var purls []string
+			for _, node := range document.GetNodeList().GetNodes() {
+				if purl := string(node.Purl()); purl != "" {
+					purls = append(purls, purl)
+				}
+			}
+			assert.ElementsMatch(t, []string{app.Name, server.Name, "pkg:npm/lib@3.0.0"}, purls)
+		})
+	}
+
+	_, err := SBOM(ctx, storage, []string{app.Name}, "spdx-3.0", SBOMOptions{})
+	assert.Error(t, err)
+}
+
+func TestSBOMEdgeTypes(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	app, server := sbomGraph(t, storage)
+	lib, err := storage.NameToID(ctx, "pkg:npm/lib@3.0.0")
+	require.NoError(t, err)
+	// lib was declared as a dev dependency of app, while server's dependency on it has no recorded type
+	require.NoError(t, storage.SetEdgeTypes(ctx, map[pkg.Edge]pkg.EdgeType{
+		{From: app.ID, To: lib}: {Type: sbom.Edge_devDependency.String(), Reversed: true},
+	}))
+
+	document, err := SBOMDocument(ctx, storage, []string{app.Name, server.Name}, SBOMOptions{})
+	require.NoError(t, err)
+	edges := map[sbom.Edge_Type][]string{}
+	for _, edge := range document.GetNodeList().GetEdges() {
+		for _, to := range edge.GetTo() {
+			edges[edge.GetType()] = append(edges[edge.GetType()], edge.GetFrom()+">"+to)
+		}
+	}
+	assert.Equal(t, []string{sbomNodeID(lib) + ">" + sbomNodeID(app.ID)}, edges[sbom.Edge_devDependency])
+	assert.Contains(t, edges[sbom.Edge_dependsOn], sbomNodeID(server.ID)+">"+sbomNodeID(lib))
+
+	// The type survives a round trip through SPDX, and CycloneDX, which has no types, lists lib under app
+	for format, want := range map[string]string{
+		"spdx-2.3":      sbom.Edge_devDependency.String() + ":" + sbomNodeID(lib) + ">" + sbomNodeID(app.ID),
+		"cyclonedx-1.5": sbomNodeID(app.ID) + ">" + sbomNodeID(lib),
+	} {
+		data, err := SBOM(ctx, storage, []string{app.Name}, format, SBOMOptions{})
+		require.NoError(t, err)
+		parsed, err := reader.New().ParseStream(bytes.NewReader(data))
+		require.NoError(t, err)
+		var edges []string
+		for _, edge := range parsed.GetNodeList().GetEdges() {
+			for _, to := range edge.GetTo() {
+				edges = append(edges, edge.GetType().String()+":"+edge.GetFrom()+">"+to, edge.GetFrom()+">"+to)
+			}
+		}
+		assert.Contains(t, edges, want, format)
+	}
+}
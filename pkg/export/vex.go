@@ -0,0 +1,507 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+)
+
+// DefaultAuthor is the author of exported documents unless another is given.
+const DefaultAuthor = "minefield"
+
+// VEXOptions configure exported VEX documents.
+type VEXOptions struct {
+	// Author is the author of an OpenVEX document and the publisher of a CSAF document.
+	Author string
+	// Namespace is the URL of the CSAF publisher.
+	Namespace string
+	// ID identifies the document. By default, it is derived from the document's contents.
+	ID string
+	// Timestamp is when the document was issued, now by default.
+	Timestamp time.Time
+}
+
+func (o VEXOptions) withDefaults() VEXOptions {
+	if o.Author == "" {
+		o.Author = DefaultAuthor
+	}
+	if o.Namespace == "" {
+		o.Namespace = "https://github.com/bit-bom/minefield"
+	}
+	if o.Timestamp.IsZero() {
+		o.Timestamp = time.Now()
+	}
+	o.Timestamp = o.Timestamp.UTC().Truncate(time.Second)
+	return o
+}
+
+// vexFinding is the status of a vulnerability in one of the packages of a product that depend on it.
+type vexFinding struct {
+	pkg             string
+	status          pkg.VEXStatus
+	justification   string
+	impactStatement string
+	actionStatement string
+	timestamp       time.Time
+}
+
+// vexVulnerability is a vulnerability reachable from a product, with its status in each package that depends on it.
+type vexVulnerability struct {
+	name     string
+	metadata *pkg.VulnerabilityMetadata
+	findings []vexFinding
+}
+
+// collectVEX finds every vulnerability reachable from a product and the status VEX statements give it in each package that depends on it.
+// Vulnerabilities without a statement are under investigation.
+func collectVEX(ctx context.Context, storage pkg.Storage, productName string) (*pkg.Node, []vexVulnerability, error) {
+	id, err := storage.NameToID(ctx, productName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get node ID for name %s: %w", productName, err)
+	}
+	product, err := storage.GetNode(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get node for id %v: %w", id, err)
+	}
+	dependencies, err := product.QueryDependencies(ctx, storage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query dependencies of %s: %w", product.Name, err)
+	}
+	reachable := dependencies.Clone()
+	reachable.Add(product.ID)
+
+	vulnerabilityIDs, err := pkg.VulnerabilityNodes(ctx, storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	vulnerabilityIDs.And(dependencies)
+	nodes, err := storage.GetNodes(ctx, vulnerabilityIDs.ToArray())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get vulnerabilities: %w", err)
+	}
+
+	var vulns []vexVulnerability
+	for _, node := range nodes {
+		metadata, err := pkg.NodeVulnerabilityMetadata(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		parentIDs := node.Parents.Clone()
+		parentIDs.And(reachable)
+		parents, err := storage.GetNodes(ctx, parentIDs.ToArray())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get packages depending on %s: %w", node.Name, err)
+		}
+
+		vuln := vexVulnerability{name: node.Name, metadata: metadata}
+		for _, parent := range parents {
+			statement, err := pkg.ProductVEXStatement(ctx, storage, product.ID, pkg.Edge{From: parent.ID, To: node.ID})
+			if err != nil {
+				return nil, nil, err
+			}
+			finding := vexFinding{pkg: parent.Name, status: pkg.VEXUnderInvestigation}
+			if statement != nil {
+				finding = vexFinding{
+					pkg:             parent.Name,
+					status:          statement.Status,
+					justification:   statement.Justification,
+					impactStatement: statement.ImpactStatement,
+					actionStatement: statement.ActionStatement,
+					timestamp:       statement.Timestamp,
+				}
+			}
+			if finding.status == pkg.VEXAffected && finding.actionStatement == "" {
+				finding.actionStatement = "No remediation is known"
+				if fixed := ingest.FixedVersion(metadata, parent.Name); fixed != "" {
+					finding.actionStatement = fmt.Sprintf("Update %s to %s", parent.Name, fixed)
+				}
+			}
+			if finding.status == pkg.VEXNotAffected && finding.justification == "" && finding.impactStatement == "" {
+				finding.impactStatement = "Recorded as not affected without a justification"
+			}
+			vuln.findings = append(vuln.findings, finding)
+		}
+		slices.SortFunc(vuln.findings, func(a, b vexFinding) int { return strings.Compare(a.pkg, b.pkg) })
+		vulns = append(vulns, vuln)
+	}
+	slices.SortFunc(vulns, func(a, b vexVulnerability) int { return strings.Compare(a.name, b.name) })
+	return product, vulns, nil
+}
+
+// aliases returns the other IDs of a vulnerability.
+func (v vexVulnerability) aliases() []string {
+	var aliases []string
+	for _, id := range v.metadata.IDs() {
+		if id != v.name && id != "" {
+			aliases = append(aliases, id)
+		}
+	}
+	return aliases
+}
+
+// groups groups the findings of a vulnerability that have the same status, justification and statements.
+func (v vexVulnerability) groups() [][]vexFinding {
+	var groups [][]vexFinding
+	for _, finding := range v.findings {
+		i := slices.IndexFunc(groups, func(group []vexFinding) bool {
+			g := group[0]
+			return g.status == finding.status && g.justification == finding.justification &&
+				g.impactStatement == finding.impactStatement && g.actionStatement == finding.actionStatement
+		})
+		if i < 0 {
+			groups = append(groups, []vexFinding{finding})
+			continue
+		}
+		groups[i] = append(groups[i], finding)
+	}
+	return groups
+}
+
+// openVEXContext is the OpenVEX version documents are exported as.
+const openVEXContext = "https://openvex.dev/ns/v0.2.0"
+
+type openVEXDocument struct {
+	Context    string             `json:"@context"`
+	ID         string             `json:"@id"`
+	Author     string             `json:"author"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Version    int                `json:"version"`
+	Tooling    string             `json:"tooling,omitempty"`
+	Statements []openVEXStatement `json:"statements"`
+}
+
+type openVEXStatement struct {
+	Vulnerability   openVEXVulnerability `json:"vulnerability"`
+	Timestamp       *time.Time           `json:"timestamp,omitempty"`
+	Products        []openVEXProduct     `json:"products"`
+	Status          pkg.VEXStatus        `json:"status"`
+	Justification   string               `json:"justification,omitempty"`
+	ImpactStatement string               `json:"impact_statement,omitempty"`
+	ActionStatement string               `json:"action_statement,omitempty"`
+}
+
+type openVEXVulnerability struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+type openVEXProduct struct {
+	ID            string             `json:"@id"`
+	Identifiers   map[string]string  `json:"identifiers,omitempty"`
+	Subcomponents []openVEXComponent `json:"subcomponents,omitempty"`
+}
+
+type openVEXComponent struct {
+	ID string `json:"@id"`
+}
+
+// OpenVEX exports the status of every vulnerability reachable from a product as an OpenVEX document,
+// with a statement for each group of packages that depend on a vulnerability and share its status.
+func OpenVEX(ctx context.Context, storage pkg.Storage, productName string, opts VEXOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+	product, vulns, err := collectVEX(ctx, storage, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	document := openVEXDocument{
+		Context:    openVEXContext,
+		ID:         opts.ID,
+		Author:     opts.Author,
+		Timestamp:  opts.Timestamp,
+		Version:    1,
+		Tooling:    DefaultAuthor,
+		Statements: []openVEXStatement{},
+	}
+	for _, vuln := range vulns {
+		for _, group := range vuln.groups() {
+			statement := openVEXStatement{
+				Vulnerability: openVEXVulnerability{
+					Name:        vuln.name,
+					Description: vuln.metadata.Summary,
+					Aliases:     vuln.aliases(),
+				},
+				Products:        []openVEXProduct{{ID: product.Name}},
+				Status:          group[0].status,
+				Justification:   group[0].justification,
+				ImpactStatement: group[0].impactStatement,
+				ActionStatement: group[0].actionStatement,
+			}
+			if strings.HasPrefix(product.Name, "pkg:") {
+				statement.Products[0].Identifiers = map[string]string{"purl": product.Name}
+			}
+			var latest time.Time
+			for _, finding := range group {
+				if finding.timestamp.After(latest) {
+					latest = finding.timestamp.UTC()
+					statement.Timestamp = &latest
+				}
+				if finding.pkg != product.Name {
+					statement.Products[0].Subcomponents = append(statement.Products[0].Subcomponents, openVEXComponent{ID: finding.pkg})
+				}
+			}
+			document.Statements = append(document.Statements, statement)
+		}
+	}
+	if document.ID == "" {
+		document.ID, err = canonicalID("https://openvex.dev/docs/public/vex-", document.Statements)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal OpenVEX document: %w", err)
+	}
+	return data, nil
+}
+
+// canonicalID derives an ID from the contents of a document, so exporting the same state gives the same ID.
+func canonicalID(prefix string, contents any) (string, error) {
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal document: %w", err)
+	}
+	return fmt.Sprintf("%s%x", prefix, sha256.Sum256(data)), nil
+}
+
+type csafDocument struct {
+	Document        csafMetadata        `json:"document"`
+	ProductTree     csafProductTree     `json:"product_tree"`
+	Vulnerabilities []csafVulnerability `json:"vulnerabilities"`
+}
+
+type csafMetadata struct {
+	Category    string        `json:"category"`
+	CSAFVersion string        `json:"csaf_version"`
+	Publisher   csafPublisher `json:"publisher"`
+	Title       string        `json:"title"`
+	Tracking    csafTracking  `json:"tracking"`
+}
+
+type csafPublisher struct {
+	Category  string `json:"category"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type csafTracking struct {
+	CurrentReleaseDate time.Time      `json:"current_release_date"`
+	ID                 string         `json:"id"`
+	InitialReleaseDate time.Time      `json:"initial_release_date"`
+	RevisionHistory    []csafRevision `json:"revision_history"`
+	Status             string         `json:"status"`
+	Version            string         `json:"version"`
+	Generator          *csafGenerator `json:"generator,omitempty"`
+}
+
+type csafRevision struct {
+	Date    time.Time `json:"date"`
+	Number  string    `json:"number"`
+	Summary string    `json:"summary"`
+}
+
+type csafGenerator struct {
+	Engine struct {
+		Name string `json:"name"`
+	} `json:"engine"`
+}
+
+type csafProductTree struct {
+	FullProductNames []csafProduct      `json:"full_product_names"`
+	Relationships    []csafRelationship `json:"relationships,omitempty"`
+}
+
+type csafProduct struct {
+	Name                        string                 `json:"name"`
+	ProductID                   string                 `json:"product_id"`
+	ProductIdentificationHelper *csafIdentificationRef `json:"product_identification_helper,omitempty"`
+}
+
+type csafIdentificationRef struct {
+	Purl string `json:"purl"`
+}
+
+type csafRelationship struct {
+	Category                  string      `json:"category"`
+	FullProductName           csafProduct `json:"full_product_name"`
+	ProductReference          string      `json:"product_reference"`
+	RelatesToProductReference string      `json:"relates_to_product_reference"`
+}
+
+type csafVulnerability struct {
+	CVE           string              `json:"cve,omitempty"`
+	IDs           []csafID            `json:"ids,omitempty"`
+	Notes         []csafNote          `json:"notes,omitempty"`
+	ProductStatus map[string][]string `json:"product_status"`
+	Flags         []csafFlag          `json:"flags,omitempty"`
+	Threats       []csafNote          `json:"threats,omitempty"`
+	Remediations  []csafRemediation   `json:"remediations,omitempty"`
+}
+
+type csafID struct {
+	SystemName string `json:"system_name"`
+	Text       string `json:"text"`
+}
+
+// csafNote is a note, or a threat, which has the same layout with details in place of text.
+type csafNote struct {
+	Category   string   `json:"category"`
+	Text       string   `json:"text,omitempty"`
+	Details    string   `json:"details,omitempty"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+}
+
+type csafFlag struct {
+	Label      string   `json:"label"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+type csafRemediation struct {
+	Category   string   `json:"category"`
+	Details    string   `json:"details"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+// csafProductStatuses maps VEX statuses to the CSAF product status they're listed under.
+var csafProductStatuses = map[pkg.VEXStatus]string{
+	pkg.VEXNotAffected:        "known_not_affected",
+	pkg.VEXAffected:           "known_affected",
+	pkg.VEXFixed:              "fixed",
+	pkg.VEXUnderInvestigation: "under_investigation",
+}
+
+// CSAFVEX exports the status of every vulnerability reachable from a product as a CSAF 2.0 VEX document.
+// Each package that depends on a vulnerability is a component of the product in the product tree,
+// and the statuses refer to the package as part of the product.
+func CSAFVEX(ctx context.Context, storage pkg.Storage, productName string, opts VEXOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+	product, vulns, err := collectVEX(ctx, storage, productName)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := csafProductTree{FullProductNames: []csafProduct{csafProductName(product.Name, "CSAFPID-0001")}}
+	componentIDs := map[string]string{product.Name: "CSAFPID-0001"}
+	// productIDs are the IDs of the packages as part of the product, which the statuses refer to
+	productIDs := map[string]string{product.Name: "CSAFPID-0001"}
+	var packages []string
+	for _, vuln := range vulns {
+		for _, finding := range vuln.findings {
+			if _, ok := componentIDs[finding.pkg]; !ok {
+				componentIDs[finding.pkg] = ""
+				packages = append(packages, finding.pkg)
+			}
+		}
+	}
+	slices.Sort(packages)
+	for i, name := range packages {
+		componentID := fmt.Sprintf("CSAFPID-%04d", i+2)
+		componentIDs[name] = componentID
+		productIDs[name] = componentID + ":CSAFPID-0001"
+		tree.FullProductNames = append(tree.FullProductNames, csafProductName(name, componentID))
+		tree.Relationships = append(tree.Relationships, csafRelationship{
+			Category:                  "default_component_of",
+			FullProductName:           csafProduct{Name: name + " as a component of " + product.Name, ProductID: productIDs[name]},
+			ProductReference:          componentID,
+			RelatesToProductReference: "CSAFPID-0001",
+		})
+	}
+
+	document := csafDocument{
+		Document: csafMetadata{
+			Category:    "csaf_vex",
+			CSAFVersion: "2.0",
+			Publisher:   csafPublisher{Category: "vendor", Name: opts.Author, Namespace: opts.Namespace},
+			Title:       "VEX for " + product.Name,
+			Tracking: csafTracking{
+				CurrentReleaseDate: opts.Timestamp,
+				ID:                 opts.ID,
+				InitialReleaseDate: opts.Timestamp,
+				RevisionHistory:    []csafRevision{{Date: opts.Timestamp, Number: "1", Summary: "Initial version"}},
+				Status:             "final",
+				Version:            "1",
+			},
+		},
+		ProductTree:     tree,
+		Vulnerabilities: []csafVulnerability{},
+	}
+	document.Document.Tracking.Generator = &csafGenerator{}
+	document.Document.Tracking.Generator.Engine.Name = DefaultAuthor
+
+	for _, vuln := range vulns {
+		entry := csafVulnerability{ProductStatus: map[string][]string{}}
+		for _, id := range append([]string{vuln.name}, vuln.aliases()...) {
+			if entry.CVE == "" && strings.HasPrefix(id, "CVE-") {
+				entry.CVE = id
+				continue
+			}
+			entry.IDs = append(entry.IDs, csafID{SystemName: idSystem(id), Text: id})
+		}
+		if vuln.metadata.Summary != "" {
+			entry.Notes = append(entry.Notes, csafNote{Category: "summary", Text: vuln.metadata.Summary})
+		}
+		for _, group := range vuln.groups() {
+			var ids []string
+			for _, finding := range group {
+				ids = append(ids, productIDs[finding.pkg])
+			}
+			status := csafProductStatuses[group[0].status]
+			entry.ProductStatus[status] = append(entry.ProductStatus[status], ids...)
+			if group[0].justification != "" {
+				entry.Flags = append(entry.Flags, csafFlag{Label: group[0].justification, ProductIDs: ids})
+			}
+			if group[0].impactStatement != "" {
+				entry.Threats = append(entry.Threats, csafNote{Category: "impact", Details: group[0].impactStatement, ProductIDs: ids})
+			}
+			if group[0].status == pkg.VEXAffected {
+				category := "none_available"
+				if strings.HasPrefix(group[0].actionStatement, "Update ") {
+					category = "vendor_fix"
+				}
+				entry.Remediations = append(entry.Remediations, csafRemediation{Category: category, Details: group[0].actionStatement, ProductIDs: ids})
+			}
+		}
+		for _, ids := range entry.ProductStatus {
+			slices.Sort(ids)
+		}
+		document.Vulnerabilities = append(document.Vulnerabilities, entry)
+	}
+	if document.Document.Tracking.ID == "" {
+		document.Document.Tracking.ID, err = canonicalID("minefield-vex-", document.Vulnerabilities)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CSAF document: %w", err)
+	}
+	return data, nil
+}
+
+func csafProductName(name, id string) csafProduct {
+	product := csafProduct{Name: name, ProductID: id}
+	if strings.HasPrefix(name, "pkg:") {
+		product.ProductIdentificationHelper = &csafIdentificationRef{Purl: name}
+	}
+	return product
+}
+
+// idSystem names the database a vulnerability ID comes from, after its prefix.
+func idSystem(id string) string {
+	if prefix, _, ok := strings.Cut(id, "-"); ok {
+		return prefix
+	}
+	return "OSV"
+}
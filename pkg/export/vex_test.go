@@ -0,0 +1,163 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vexGraph adds a product depending on three vulnerable packages, one vulnerability triaged as not affected,
+// one as affected and one not triaged, and returns the product.
+func vexGraph(t *testing.T, storage pkg.Storage) *pkg.Node {
+	ctx := context.Background()
+	addVulnerability := func(pkgNode *pkg.Node, metadata *pkg.VulnerabilityMetadata) *pkg.Node {
+		node, err := pkg.AddVulnerability(ctx, storage, metadata)
+		require.NoError(t, err)
+		require.NoError(t, pkgNode.SetDependency(ctx, storage, node))
+		return node
+	}
+	app := addTestNode(t, storage, "pkg:generic/app@1.0.0", nil)
+	lodash, minimist, express := addTestNode(t, storage, "pkg:npm/lodash@4.17.20", nil), addTestNode(t, storage, "pkg:npm/minimist@1.2.5", nil), addTestNode(t, storage, "pkg:npm/express@4.0.0", nil)
+	for _, dependency := range []*pkg.Node{lodash, minimist, express} {
+		require.NoError(t, app.SetDependency(ctx, storage, dependency))
+	}
+
+	lodashVuln := addVulnerability(lodash, &pkg.VulnerabilityMetadata{ID: "GHSA-lodash-0001", Aliases: []string{"CVE-2021-23337"}, Summary: "Command injection in lodash"})
+	minimistVuln := addVulnerability(minimist, &pkg.VulnerabilityMetadata{
+		ID: "GHSA-minimist-0001",
+		Affected: []pkg.AffectedPackage{{
+			Package: pkg.VulnerablePackage{Ecosystem: "npm", Name: "minimist"},
+			Ranges:  []pkg.AffectedRange{{Type: "SEMVER", Events: []pkg.RangeEvent{{Introduced: "0"}, {Fixed: "1.2.6"}}}},
+		}},
+	})
+	addVulnerability(express, &pkg.VulnerabilityMetadata{ID: "GHSA-express-0001"})
+
+	timestamp := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.SetVEXStatement(ctx, pkg.Edge{From: lodash.ID, To: lodashVuln.ID}, &pkg.VEXStatement{
+		Product:         app.ID,
+		Status:          pkg.VEXNotAffected,
+		Justification:   "vulnerable_code_not_in_execute_path",
+		ImpactStatement: "app never calls lodash.template",
+		Timestamp:       timestamp,
+	}))
+	require.NoError(t, storage.SetVEXStatement(ctx, pkg.Edge{From: minimist.ID, To: minimistVuln.ID}, &pkg.VEXStatement{Status: pkg.VEXAffected, Timestamp: timestamp}))
+	require.NoError(t, pkg.Cache(ctx, storage))
+	return app
+}
+
+func TestOpenVEX(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	app := vexGraph(t, storage)
+	timestamp := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	data, err := OpenVEX(ctx, storage, app.Name, VEXOptions{Timestamp: timestamp})
+	require.NoError(t, err)
+	var document openVEXDocument
+	require.NoError(t, json.Unmarshal(data, &document))
+	assert.Equal(t, openVEXContext, document.Context)
+	assert.Contains(t, document.ID, "https://openvex.dev/docs/public/vex-")
+	assert.Equal(t, DefaultAuthor, document.Author)
+	assert.Equal(t, timestamp, document.Timestamp)
+
+	statementTimestamp := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	product := func(subcomponent string) []openVEXProduct {
+		return []openVEXProduct{{ID: app.Name, Identifiers: map[string]string{"purl": app.Name}, Subcomponents: []openVEXComponent{{ID: subcomponent}}}}
+	}
+	assert.Equal(t, []openVEXStatement{
+		{
+			Vulnerability:   openVEXVulnerability{Name: "CVE-2021-23337", Description: "Command injection in lodash", Aliases: []string{"GHSA-lodash-0001"}},
+			Timestamp:       &statementTimestamp,
+			Products:        product("pkg:npm/lodash@4.17.20"),
+			Status:          pkg.VEXNotAffected,
+			Justification:   "vulnerable_code_not_in_execute_path",
+			ImpactStatement: "app never calls lodash.template",
+		},
+		{
+			Vulnerability: openVEXVulnerability{Name: "GHSA-express-0001"},
+			Products:      product("pkg:npm/express@4.0.0"),
+			Status:        pkg.VEXUnderInvestigation,
+		},
+		{
+			Vulnerability:   openVEXVulnerability{Name: "GHSA-minimist-0001"},
+			Timestamp:       &statementTimestamp,
+			Products:        product("pkg:npm/minimist@1.2.5"),
+			Status:          pkg.VEXAffected,
+			ActionStatement: "Update pkg:npm/minimist@1.2.5 to 1.2.6",
+		},
+	}, document.Statements)
+
+	// Exporting the same state gives the same document, and the document can be ingested again
+	again, err := OpenVEX(ctx, storage, app.Name, VEXOptions{Timestamp: timestamp})
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	path := filepath.Join(t.TempDir(), "app.openvex.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	report, err := ingest.VEX(ctx, path, storage)
+	require.NoError(t, err)
+	assert.Equal(t, &ingest.VEXReport{Documents: 1, Statements: 3}, report)
+
+	_, err = OpenVEX(ctx, storage, "pkg:generic/unknown@1.0.0", VEXOptions{})
+	assert.Error(t, err)
+}
+
+func TestCSAFVEX(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	app := vexGraph(t, storage)
+	timestamp := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	data, err := CSAFVEX(ctx, storage, app.Name, VEXOptions{Author: "Example", Namespace: "https://example.com", ID: "EXAMPLE-VEX-1", Timestamp: timestamp})
+	require.NoError(t, err)
+	var document csafDocument
+	require.NoError(t, json.Unmarshal(data, &document))
+
+	assert.Equal(t, "csaf_vex", document.Document.Category)
+	assert.Equal(t, "2.0", document.Document.CSAFVersion)
+	assert.Equal(t, csafPublisher{Category: "vendor", Name: "Example", Namespace: "https://example.com"}, document.Document.Publisher)
+	assert.Equal(t, "EXAMPLE-VEX-1", document.Document.Tracking.ID)
+	assert.Equal(t, timestamp, document.Document.Tracking.CurrentReleaseDate)
+
+	assert.Equal(t, []csafProduct{
+		{Name: app.Name, ProductID: "CSAFPID-0001", ProductIdentificationHelper: &csafIdentificationRef{Purl: app.Name}},
+		{Name: "pkg:npm/express@4.0.0", ProductID: "CSAFPID-0002", ProductIdentificationHelper: &csafIdentificationRef{Purl: "pkg:npm/express@4.0.0"}},
+		{Name: "pkg:npm/lodash@4.17.20", ProductID: "CSAFPID-0003", ProductIdentificationHelper: &csafIdentificationRef{Purl: "pkg:npm/lodash@4.17.20"}},
+		{Name: "pkg:npm/minimist@1.2.5", ProductID: "CSAFPID-0004", ProductIdentificationHelper: &csafIdentificationRef{Purl: "pkg:npm/minimist@1.2.5"}},
+	}, document.ProductTree.FullProductNames)
+	require.Len(t, document.ProductTree.Relationships, 3)
+	assert.Equal(t, csafRelationship{
+		Category:                  "default_component_of",
+		FullProductName:           csafProduct{Name: "pkg:npm/express@4.0.0 as a component of " + app.Name, ProductID: "CSAFPID-0002:CSAFPID-0001"},
+		ProductReference:          "CSAFPID-0002",
+		RelatesToProductReference: "CSAFPID-0001",
+	}, document.ProductTree.Relationships[0])
+
+	assert.Equal(t, []csafVulnerability{
+		{
+			CVE:           "CVE-2021-23337",
+			IDs:           []csafID{{SystemName: "GHSA", Text: "GHSA-lodash-0001"}},
+			Notes:         []csafNote{{Category: "summary", Text: "Command injection in lodash"}},
+			ProductStatus: map[string][]string{"known_not_affected": {"CSAFPID-0003:CSAFPID-0001"}},
+			Flags:         []csafFlag{{Label: "vulnerable_code_not_in_execute_path", ProductIDs: []string{"CSAFPID-0003:CSAFPID-0001"}}},
+			Threats:       []csafNote{{Category: "impact", Details: "app never calls lodash.template", ProductIDs: []string{"CSAFPID-0003:CSAFPID-0001"}}},
+		},
+		{
+			IDs:           []csafID{{SystemName: "GHSA", Text: "GHSA-express-0001"}},
+			ProductStatus: map[string][]string{"under_investigation": {"CSAFPID-0002:CSAFPID-0001"}},
+		},
+		{
+			IDs:           []csafID{{SystemName: "GHSA", Text: "GHSA-minimist-0001"}},
+			ProductStatus: map[string][]string{"known_affected": {"CSAFPID-0004:CSAFPID-0001"}},
+			Remediations:  []csafRemediation{{Category: "vendor_fix", Details: "Update pkg:npm/minimist@1.2.5 to 1.2.6", ProductIDs: []string{"CSAFPID-0004:CSAFPID-0001"}}},
+		},
+	}, document.Vulnerabilities)
+}
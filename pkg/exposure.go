@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+// ExposureOptions configure how vulnerability exposure is computed.
+type ExposureOptions struct {
+	// Products are the names of the nodes to report on. By default, the root components of every ingested document are,
+	// or the nodes nothing depends on if no documents were ingested.
+	Products []string
+	// FixedVersion returns the version of the package that fixes the vulnerability, or an empty string if it isn't known.
+	FixedVersion func(vulnerability *VulnerabilityMetadata, pkg *Node) string
+	// IncludeSuppressed reports vulnerabilities that VEX statements say the product isn't affected by or has fixed.
+	IncludeSuppressed bool
+}
+
+// VulnerabilityExposure is a vulnerability a product is exposed to, directly or through its dependencies.
+type VulnerabilityExposure struct {
+	Product       string        `json:"product"`
+	Vulnerability string        `json:"vulnerability"`
+	Aliases       []string      `json:"aliases,omitempty"`
+	Severity      SeverityLevel `json:"severity,omitempty"`
+	Score         float64       `json:"score,omitempty"`
+	// Package is the vulnerable package, the last node on the path before the vulnerability.
+	Package      string `json:"package"`
+	FixedVersion string `json:"fixedVersion,omitempty"`
+	// Path is the shortest dependency path from the product to the vulnerable package.
+	Path []string `json:"path"`
+	// Status, Justification and ImpactStatement are from the VEX statement about the vulnerability in the package, if there is one.
+	Status          VEXStatus `json:"status,omitempty"`
+	Justification   string    `json:"justification,omitempty"`
+	ImpactStatement string    `json:"impactStatement,omitempty"`
+}
+
+// VulnerabilityImpact is a vulnerability together with every product exposed to it.
+type VulnerabilityImpact struct {
+	Vulnerability string        `json:"vulnerability"`
+	Aliases       []string      `json:"aliases,omitempty"`
+	Severity      SeverityLevel `json:"severity,omitempty"`
+	Score         float64       `json:"score,omitempty"`
+	Products      []string      `json:"products"`
+	// Packages are the vulnerable packages the products depend on.
+	Packages []string `json:"packages"`
+}
+
+// VulnerabilityExposures returns every vulnerability reachable from each product, sorted by product and then by severity, most severe first.
+// Vulnerabilities are left out if VEX statements suppress every dependency of the product on them, unless suppressed ones are included.
+// The dependencies of each product are taken from the cache, so the graph has to be cached first.
+func VulnerabilityExposures(ctx context.Context, storage Storage, opts ExposureOptions) ([]*VulnerabilityExposure, error) {
+	uncachedNodes, err := storage.ToBeCached(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(uncachedNodes) != 0 {
+		return nil, fmt.Errorf("cannot report vulnerability exposure without caching")
+	}
+
+	vulnerabilities, err := VulnerabilityNodes(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	products, err := exposureProducts(ctx, storage, opts.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	var exposures []*VulnerabilityExposure
+	for _, product := range products {
+		cache, err := storage.GetCache(ctx, product.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dependencies of %s: %w", product.Name, err)
+		}
+		exposed := roaring.And(cache.allChildren, vulnerabilities)
+		if exposed.IsEmpty() {
+			continue
+		}
+
+		nodes, err := storage.GetNodes(ctx, cache.allChildren.ToArray())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dependencies of %s: %w", product.Name, err)
+		}
+		nodes[product.ID] = product
+		previous, depth := breadthFirst(product, nodes)
+
+		for _, id := range exposed.ToArray() {
+			vulnerability := nodes[id]
+			vulnerable, statement, err := exposingParent(ctx, storage, product.ID, vulnerability, depth)
+			if err != nil {
+				return nil, err
+			}
+			if vulnerable == 0 || statement.Suppresses() && !opts.IncludeSuppressed {
+				continue
+			}
+
+			path := []*Node{vulnerability}
+			for at := vulnerable; ; at = previous[at] {
+				path = append(path, nodes[at])
+				if at == product.ID {
+					break
+				}
+			}
+			slices.Reverse(path)
+
+			exposure, err := newVulnerabilityExposure(path, opts.FixedVersion)
+			if err != nil {
+				return nil, err
+			}
+			if statement != nil {
+				exposure.Status, exposure.Justification, exposure.ImpactStatement = statement.Status, statement.Justification, statement.ImpactStatement
+			}
+			exposures = append(exposures, exposure)
+		}
+	}
+
+	slices.SortStableFunc(exposures, func(a, b *VulnerabilityExposure) int {
+		if c := strings.Compare(a.Product, b.Product); c != 0 {
+			return c
+		}
+		if c := compareSeverity(a.Severity, a.Score, b.Severity, b.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Vulnerability, b.Vulnerability)
+	})
+	return exposures, nil
+}
+
+// exposureProducts returns the nodes named, or the default products if none are.
+func exposureProducts(ctx context.Context, storage Storage, names []string) ([]*Node, error) {
+	var products []*Node
+	for _, name := range names {
+		id, err := storage.NameToID(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node ID for name %s: %w", name, err)
+		}
+		node, err := storage.GetNode(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node for id %v: %w", id, err)
+		}
+		products = append(products, node)
+	}
+	if len(names) > 0 {
+		return products, nil
+	}
+
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all keys: %w", err)
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	roots := roaring.New()
+	for _, node := range nodes {
+		if node.Type == DocumentNodeType {
+			roots.Or(node.Children)
+		}
+	}
+	if roots.IsEmpty() {
+		for id, node := range nodes {
+			if node.Parents.IsEmpty() && node.Type != VulnerabilityNodeType {
+				roots.Add(id)
+			}
+		}
+	}
+	for _, id := range roots.ToArray() {
+		if node, ok := nodes[id]; ok {
+			products = append(products, node)
+		}
+	}
+	return products, nil
+}
+
+// breadthFirst searches breadth first from the product, returning the node before each node reached
+// on its shortest path from the product, and the length of that path.
+func breadthFirst(product *Node, nodes map[uint32]*Node) (map[uint32]uint32, map[uint32]int) {
+	previous := map[uint32]uint32{product.ID: product.ID}
+	depth := map[uint32]int{product.ID: 0}
+	queue := []*Node{product}
+	for len(queue) > 0 {
+		curNode := queue[0]
+		queue = queue[1:]
+		for _, childID := range curNode.Children.ToArray() {
+			child, ok := nodes[childID]
+			if _, visited := previous[childID]; visited || !ok {
+				continue
+			}
+			previous[childID] = curNode.ID
+			depth[childID] = depth[curNode.ID] + 1
+			queue = append(queue, child)
+		}
+	}
+	return previous, depth
+}
+
+// exposingParent picks the package through which the product is exposed to a vulnerability, the closest one to the product
+// whose dependency on the vulnerability VEX statements don't suppress, or the closest one if they all are suppressed.
+// It returns the package's ID, 0 if the product doesn't reach the vulnerability, and the VEX statement on its dependency.
+func exposingParent(ctx context.Context, storage Storage, product uint32, vulnerability *Node, depth map[uint32]int) (uint32, *VEXStatement, error) {
+	var (
+		best          uint32
+		bestStatement *VEXStatement
+	)
+	for _, parent := range vulnerability.Parents.ToArray() {
+		if _, reached := depth[parent]; !reached {
+			continue
+		}
+		statement, err := ProductVEXStatement(ctx, storage, product, Edge{From: parent, To: vulnerability.ID})
+		if err != nil {
+			return 0, nil, err
+		}
+		if best == 0 || bestStatement.Suppresses() && !statement.Suppresses() ||
+			bestStatement.Suppresses() == statement.Suppresses() && depth[parent] < depth[best] {
+			best, bestStatement = parent, statement
+		}
+	}
+	return best, bestStatement, nil
+}
+
+func newVulnerabilityExposure(path []*Node, fixedVersion func(*VulnerabilityMetadata, *Node) string) (*VulnerabilityExposure, error) {
+	vulnerability := path[len(path)-1]
+	metadata, err := NodeVulnerabilityMetadata(vulnerability)
+	if err != nil {
+		return nil, err
+	}
+	path = path[:len(path)-1]
+	vulnerable := path[len(path)-1]
+
+	exposure := &VulnerabilityExposure{
+		Product:       path[0].Name,
+		Vulnerability: vulnerability.Name,
+		Severity:      metadata.SeverityLevel,
+		Score:         metadata.CVSSScore,
+		Package:       vulnerable.Name,
+	}
+	for _, id := range metadata.IDs() {
+		if id != vulnerability.Name {
+			exposure.Aliases = append(exposure.Aliases, id)
+		}
+	}
+	for _, node := range path {
+		exposure.Path = append(exposure.Path, node.Name)
+	}
+	if fixedVersion != nil {
+		exposure.FixedVersion = fixedVersion(metadata, vulnerable)
+	}
+	return exposure, nil
+}
+
+// VulnerabilityImpacts groups exposures by vulnerability, sorted by severity, most severe first.
+func VulnerabilityImpacts(exposures []*VulnerabilityExposure) []*VulnerabilityImpact {
+	var impacts []*VulnerabilityImpact
+	byName := map[string]*VulnerabilityImpact{}
+	for _, exposure := range exposures {
+		impact, ok := byName[exposure.Vulnerability]
+		if !ok {
+			impact = &VulnerabilityImpact{
+				Vulnerability: exposure.Vulnerability,
+				Aliases:       exposure.Aliases,
+				Severity:      exposure.Severity,
+				Score:         exposure.Score,
+			}
+			byName[exposure.Vulnerability] = impact
+			impacts = append(impacts, impact)
+		}
+		impact.Products = appendMissing(impact.Products, exposure.Product)
+		impact.Packages = appendMissing(impact.Packages, exposure.Package)
+	}
+	for _, impact := range impacts {
+		slices.Sort(impact.Products)
+		slices.Sort(impact.Packages)
+	}
+	slices.SortStableFunc(impacts, func(a, b *VulnerabilityImpact) int {
+		if c := compareSeverity(a.Severity, a.Score, b.Severity, b.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Vulnerability, b.Vulnerability)
+	})
+	return impacts
+}
+
+// compareSeverity orders vulnerabilities by severity and then by score, most severe first.
+func compareSeverity(severityA SeverityLevel, scoreA float64, severityB SeverityLevel, scoreB float64) int {
+	if c := severityB.Compare(severityA); c != 0 {
+		return c
+	}
+	switch {
+	case scoreA > scoreB:
+		return -1
+	case scoreA < scoreB:
+		return 1
+	}
+	return 0
+}
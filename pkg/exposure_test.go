@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVulnerabilityExposures(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	document, err := AddNode(ctx, storage, DocumentNodeType, &DocumentMetadata{Name: "doc"}, "doc")
+	require.NoError(t, err)
+	app, server := addTestNode(t, storage, "pkg:generic/app@1.0.0"), addTestNode(t, storage, "pkg:generic/server@1.0.0")
+	libA, libB, libC, libD := addTestNode(t, storage, "pkg:generic/lib-A@1.0.0"), addTestNode(t, storage, "pkg:generic/lib-B@1.0.0"), addTestNode(t, storage, "pkg:generic/lib-C@1.0.0"), addTestNode(t, storage, "pkg:generic/lib-D@1.0.0")
+	critical, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{
+		ID:       "GHSA-0001",
+		Aliases:  []string{"CVE-2024-0001"},
+		Severity: []VulnerabilitySeverity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}},
+	})
+	require.NoError(t, err)
+	moderate, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GHSA-0002", DatabaseSpecific: map[string]any{"severity": "MODERATE"}})
+	require.NoError(t, err)
+
+	// app -> lib-C -> lib-D -> lib-B and the shortcut app -> lib-A -> lib-B, server -> lib-B
+	addTestDependency(t, storage, document, app)
+	addTestDependency(t, storage, document, server)
+	addTestDependency(t, storage, app, libC)
+	addTestDependency(t, storage, libC, libD)
+	addTestDependency(t, storage, libD, libB)
+	addTestDependency(t, storage, app, libA)
+	addTestDependency(t, storage, libA, libB)
+	addTestDependency(t, storage, server, libB)
+	addTestDependency(t, storage, libB, critical)
+	addTestDependency(t, storage, libA, moderate)
+
+	_, err = VulnerabilityExposures(ctx, storage, ExposureOptions{})
+	assert.Error(t, err, "the graph isn't cached")
+	require.NoError(t, Cache(ctx, storage))
+
+	fixedVersion := func(_ *VulnerabilityMetadata, pkg *Node) string {
+		if pkg.ID == libB.ID {
+			return "1.0.1"
+		}
+		return ""
+	}
+	exposures, err := VulnerabilityExposures(ctx, storage, ExposureOptions{FixedVersion: fixedVersion})
+	require.NoError(t, err)
+	assert.Equal(t, []*VulnerabilityExposure{
+		{
+			Product:       app.Name,
+			Vulnerability: "CVE-2024-0001",
+			Aliases:       []string{"GHSA-0001"},
+			Severity:      SeverityCritical,
+			Score:         9.8,
+			Package:       libB.Name,
+			FixedVersion:  "1.0.1",
+			Path:          []string{app.Name, libA.Name, libB.Name},
+		},
+		{
+			Product:       app.Name,
+			Vulnerability: "GHSA-0002",
+			Severity:      SeverityMedium,
+			Package:       libA.Name,
+			Path:          []string{app.Name, libA.Name},
+		},
+		{
+			Product:       server.Name,
+			Vulnerability: "CVE-2024-0001",
+			Aliases:       []string{"GHSA-0001"},
+			Severity:      SeverityCritical,
+			Score:         9.8,
+			Package:       libB.Name,
+			FixedVersion:  "1.0.1",
+			Path:          []string{server.Name, libB.Name},
+		},
+	}, exposures)
+
+	assert.Equal(t, []*VulnerabilityImpact{
+		{
+			Vulnerability: "CVE-2024-0001",
+			Aliases:       []string{"GHSA-0001"},
+			Severity:      SeverityCritical,
+			Score:         9.8,
+			Products:      []string{app.Name, server.Name},
+			Packages:      []string{libB.Name},
+		},
+		{
+			Vulnerability: "GHSA-0002",
+			Severity:      SeverityMedium,
+			Products:      []string{app.Name},
+			Packages:      []string{libA.Name},
+		},
+	}, VulnerabilityImpacts(exposures))
+
+	// Any node can be reported on
+	exposures, err = VulnerabilityExposures(ctx, storage, ExposureOptions{Products: []string{libC.Name}})
+	require.NoError(t, err)
+	require.Len(t, exposures, 1)
+	assert.Equal(t, []string{libC.Name, libD.Name, libB.Name}, exposures[0].Path)
+
+	_, err = VulnerabilityExposures(ctx, storage, ExposureOptions{Products: []string{"pkg:generic/unknown@1.0.0"}})
+	assert.Error(t, err)
+
+	// VEX statements suppress vulnerabilities for the product they're scoped to
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: libA.ID, To: moderate.ID}, &VEXStatement{Product: app.ID, Status: VEXNotAffected, Justification: "vulnerable_code_not_in_execute_path"}))
+	// and only that product, so app is still exposed to the critical one
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: libB.ID, To: critical.ID}, &VEXStatement{Product: server.ID, Status: VEXFixed}))
+	exposures, err = VulnerabilityExposures(ctx, storage, ExposureOptions{})
+	require.NoError(t, err)
+	var exposed []string
+	for _, exposure := range exposures {
+		exposed = append(exposed, exposure.Product+" "+exposure.Vulnerability)
+	}
+	assert.Equal(t, []string{app.Name + " CVE-2024-0001"}, exposed)
+
+	exposures, err = VulnerabilityExposures(ctx, storage, ExposureOptions{IncludeSuppressed: true})
+	require.NoError(t, err)
+	require.Len(t, exposures, 3)
+	assert.Equal(t, VEXNotAffected, exposures[1].Status)
+	assert.Equal(t, "vulnerable_code_not_in_execute_path", exposures[1].Justification)
+	assert.Equal(t, VEXFixed, exposures[2].Status)
+
+	// Queries for the vulnerabilities of a product leave out suppressed ones too
+	vulns, err := ParseAndExecute(ctx, "dependencies VULNERABILITY "+app.Name, storage, "")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{critical.ID}, vulns.ToArray())
+	vulns, err = ParseAndExecute(ctx, "dependencies VULNERABILITY "+libA.Name, storage, "")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{critical.ID, moderate.ID}, vulns.ToArray())
+
+	// Statements without a product apply everywhere, unless a product has its own
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: libB.ID, To: critical.ID}, &VEXStatement{Status: VEXNotAffected}))
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: libB.ID, To: critical.ID}, &VEXStatement{Product: app.ID, Status: VEXAffected}))
+	exposures, err = VulnerabilityExposures(ctx, storage, ExposureOptions{})
+	require.NoError(t, err)
+	require.Len(t, exposures, 1)
+	assert.Equal(t, app.Name, exposures[0].Product)
+	assert.Equal(t, VEXAffected, exposures[0].Status)
+}
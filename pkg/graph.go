@@ -1,10 +1,12 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/RoaringBitmap/roaring"
@@ -12,7 +14,11 @@ import (
 
 var (
 	ErrNodeAlreadyExists = errors.New("node with name already exists")
+	ErrNodeNotFound      = errors.New("node with name not found")
 	ErrSelfDependency    = errors.New("cannot add self as dependency")
+	ErrNoPath            = errors.New("no dependency path between nodes")
+	// ErrReadOnlyGraph is returned by the writes to a read-only view of the graph, such as a past version.
+	ErrReadOnlyGraph = errors.New("graph is read-only")
 )
 
 type Direction string
@@ -48,6 +54,11 @@ func NewNodeCache(id uint32, allParents, allChildren *roaring.Bitmap) *NodeCache
 	}
 }
 
+// AllChildren returns every node the cached node transitively depends on.
+func (nc *NodeCache) AllChildren() *roaring.Bitmap {
+	return nc.allChildren
+}
+
 // MarshalJSON is a custom JSON marshalling method for NodeCache.
 // It converts the roaring bitmaps to byte slices for JSON serialization.
 func (nc *NodeCache) MarshalJSON() ([]byte, error) {
@@ -153,41 +164,44 @@ func (n *Node) UnmarshalJSON(data []byte) error {
 }
 
 // AddNode becomes generic in terms of metadata
-func AddNode(storage Storage, _type string, metadata any, name string) (*Node, error) {
-	var ID uint32
-	if id, err := storage.NameToID(name); err == nil {
-		return storage.GetNode(id)
-	} else {
-		ID, err = storage.GenerateID()
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate ID: %w", err)
-		}
-	}
+// If a node with the name already exists, the existing node is returned instead.
+func AddNode(ctx context.Context, storage Storage, _type string, metadata any, name string) (*Node, error) {
+	n, _, err := GetOrAddNode(ctx, storage, _type, metadata, name)
+	return n, err
+}
 
+// GetOrAddNode is AddNode, also reporting whether the node was created.
+func GetOrAddNode(ctx context.Context, storage Storage, _type string, metadata any, name string) (*Node, bool, error) {
 	n := &Node{
-		ID:       ID,
 		Type:     _type,
 		Name:     name,
 		Metadata: metadata,
 		Children: roaring.New(),
 		Parents:  roaring.New(),
 	}
+
+	ID, err := storage.CreateNode(ctx, n)
+	if errors.Is(err, ErrNodeAlreadyExists) {
+		existing, err := storage.GetNode(ctx, ID)
+		return existing, false, err
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to create node: %w", err)
+	}
+	n.ID = ID
+
 	nCache := &NodeCache{
 		nodeID:      ID,
 		allParents:  roaring.New(),
 		allChildren: roaring.New(),
 	}
-	if err := storage.SaveNode(n); err != nil {
-		return nil, fmt.Errorf("failed to save node: %w", err)
-	}
-	if err := storage.SaveCache(nCache); err != nil {
-		return nil, err
+	if err := storage.SaveCache(ctx, nCache); err != nil {
+		return nil, false, err
 	}
-	return n, nil
+	return n, true, nil
 }
 
 // SetDependency now uses generic types for metadata
-func (n *Node) SetDependency(storage Storage, neighbor *Node) error {
+func (n *Node) SetDependency(ctx context.Context, storage Storage, neighbor *Node) error {
 	if n == nil {
 		return fmt.Errorf("cannot add dependency to nil node")
 	}
@@ -201,19 +215,17 @@ func (n *Node) SetDependency(storage Storage, neighbor *Node) error {
 		return fmt.Errorf("storage cannot be nil")
 	}
 
+	if err := storage.AddDependency(ctx, n.ID, neighbor.ID); err != nil {
+		return fmt.Errorf("failed to add dependency: %w", err)
+	}
+
+	// Keep the in-memory nodes in line with what was saved
 	n.Children.Add(neighbor.ID)
 	neighbor.Parents.Add(n.ID)
-
-	if err := storage.SaveNode(n); err != nil {
-		return fmt.Errorf("failed to save node: %w", err)
-	}
-	if err := storage.SaveNode(neighbor); err != nil {
-		return fmt.Errorf("failed to save neighbor node: %w", err)
-	}
 	return nil
 }
 
-func (n *Node) queryBitmap(storage Storage, direction Direction) (*roaring.Bitmap, error) {
+func (n *Node) queryBitmap(ctx context.Context, storage Storage, direction Direction) (*roaring.Bitmap, error) {
 	if n == nil {
 		return nil, fmt.Errorf("cannot query bitmap of nil node")
 	}
@@ -246,7 +258,7 @@ func (n *Node) queryBitmap(storage Storage, direction Direction) (*roaring.Bitma
 
 		result.Or(bitmap)
 		for _, nID := range bitmap.Clone().ToArray() {
-			node, err := storage.GetNode(nID)
+			node, err := storage.GetNode(ctx, nID)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get node: %w", err)
 			}
@@ -259,25 +271,25 @@ func (n *Node) queryBitmap(storage Storage, direction Direction) (*roaring.Bitma
 	return result, nil
 }
 
-func (n *Node) QueryDependentsNoCache(storage Storage) (*roaring.Bitmap, error) {
-	return n.queryBitmap(storage, ParentsDirection)
+func (n *Node) QueryDependentsNoCache(ctx context.Context, storage Storage) (*roaring.Bitmap, error) {
+	return n.queryBitmap(ctx, storage, ParentsDirection)
 }
 
-func (n *Node) QueryDependenciesNoCache(storage Storage) (*roaring.Bitmap, error) {
-	return n.queryBitmap(storage, ChildrenDirection)
+func (n *Node) QueryDependenciesNoCache(ctx context.Context, storage Storage) (*roaring.Bitmap, error) {
+	return n.queryBitmap(ctx, storage, ChildrenDirection)
 }
 
 // QueryDependents checks if all nodes are cached, if so find the dependents in the cache, if not find the dependents without searching the cache
-func (n *Node) QueryDependents(storage Storage) (*roaring.Bitmap, error) {
-	uncachedNodes, err := storage.ToBeCached()
+func (n *Node) QueryDependents(ctx context.Context, storage Storage) (*roaring.Bitmap, error) {
+	uncachedNodes, err := storage.ToBeCached(ctx)
 	if err != nil {
 		return nil, err
 	}
 	if len(uncachedNodes) > 0 {
-		return n.QueryDependentsNoCache(storage)
+		return n.QueryDependentsNoCache(ctx, storage)
 	}
 
-	nCache, err := storage.GetCache(n.ID)
+	nCache, err := storage.GetCache(ctx, n.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -285,16 +297,16 @@ func (n *Node) QueryDependents(storage Storage) (*roaring.Bitmap, error) {
 	return nCache.allParents, nil
 }
 
-func (n *Node) QueryDependencies(storage Storage) (*roaring.Bitmap, error) {
-	uncachedNodes, err := storage.ToBeCached()
+func (n *Node) QueryDependencies(ctx context.Context, storage Storage) (*roaring.Bitmap, error) {
+	uncachedNodes, err := storage.ToBeCached(ctx)
 	if err != nil {
 		return nil, err
 	}
 	if len(uncachedNodes) > 0 {
-		return n.QueryDependenciesNoCache(storage)
+		return n.QueryDependenciesNoCache(ctx, storage)
 	}
 
-	nCache, err := storage.GetCache(n.ID)
+	nCache, err := storage.GetCache(ctx, n.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -302,8 +314,50 @@ func (n *Node) QueryDependencies(storage Storage) (*roaring.Bitmap, error) {
 	return nCache.allChildren, nil
 }
 
-func GenerateDOT(storage Storage) (string, error) {
-	keys, err := storage.GetAllKeys()
+// ShortestPath returns the IDs of the nodes on the shortest dependency path from n to target, including both ends.
+func (n *Node) ShortestPath(ctx context.Context, storage Storage, target *Node) ([]uint32, error) {
+	if n == nil || target == nil {
+		return nil, fmt.Errorf("cannot find path between nil nodes")
+	}
+	if storage == nil {
+		return nil, fmt.Errorf("storage cannot be nil")
+	}
+
+	previous := map[uint32]uint32{n.ID: n.ID}
+	queue := []*Node{n}
+
+	for len(queue) > 0 {
+		curNode := queue[0]
+		queue = queue[1:]
+
+		if curNode.ID == target.ID {
+			path := []uint32{curNode.ID}
+			for id := curNode.ID; id != n.ID; {
+				id = previous[id]
+				path = append(path, id)
+			}
+			slices.Reverse(path)
+			return path, nil
+		}
+
+		for _, childID := range curNode.Children.ToArray() {
+			if _, visited := previous[childID]; visited {
+				continue
+			}
+			previous[childID] = curNode.ID
+			child, err := storage.GetNode(ctx, childID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get node: %w", err)
+			}
+			queue = append(queue, child)
+		}
+	}
+
+	return nil, ErrNoPath
+}
+
+func GenerateDOT(ctx context.Context, storage Storage) (string, error) {
+	keys, err := storage.GetAllKeys(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -314,14 +368,14 @@ func GenerateDOT(storage Storage) (string, error) {
 	dotBuilder.WriteString("edge [color=gray];\n")                                       // Edge style
 
 	for _, key := range keys {
-		node, err := storage.GetNode(key)
+		node, err := storage.GetNode(ctx, key)
 		if err != nil {
 			return "", err
 		}
 
 		// Add the node with a label that includes type and additional metadata if needed
-		label := fmt.Sprintf("%s\\nMetadata: %v", node.Type, node.Metadata)
-		dotBuilder.WriteString(fmt.Sprintf("%d [label=\"%s\"];\n", node.ID, label))
+		label := fmt.Sprintf("%s\nMetadata: %v", node.Type, node.Metadata)
+		dotBuilder.WriteString(fmt.Sprintf("%d [label=%s];\n", node.ID, DOTQuote(label)))
 
 		// Add edges for children
 		for _, childID := range node.Children.ToArray() {
@@ -332,13 +386,18 @@ func GenerateDOT(storage Storage) (string, error) {
 	return dotBuilder.String(), nil
 }
 
-func RenderGraph(storage Storage) error {
-	dotString, err := GenerateDOT(storage)
+// DOTQuote quotes a DOT ID, escaping quotes and backslashes and writing newlines as line breaks.
+func DOTQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func RenderGraph(ctx context.Context, storage Storage) error {
+	dotString, err := GenerateDOT(ctx, storage)
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command("dot", "-Tpng", "-o", "graph.png", "-Kfdp") // Using fdp for a spring model layout
+	cmd := exec.CommandContext(ctx, "dot", "-Tpng", "-o", "graph.png", "-Kfdp") // Using fdp for a spring model layout
 	cmd.Stdin = strings.NewReader(dotString)
 	if err := cmd.Run(); err != nil {
 		return err
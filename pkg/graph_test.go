@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -9,26 +10,41 @@ import (
 
 	"github.com/RoaringBitmap/roaring"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// addTestNode adds a package to the storage backend.
+func addTestNode(t *testing.T, storage Storage, name string) *Node {
+	node, err := AddNode(context.Background(), storage, "PACKAGE", nil, name)
+	require.NoError(t, err)
+	return node
+}
+
+// addTestDependency makes one node depend on another.
+func addTestDependency(t *testing.T, storage Storage, from, to *Node) {
+	require.NoError(t, from.SetDependency(context.Background(), storage, to))
+}
+
 func TestAddNode(t *testing.T) {
-	storage := NewMockStorage()
-	node, err := AddNode(storage, "type1", "metadata1", "name1")
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	node, err := AddNode(ctx, storage, "type1", "metadata1", "name1")
 
 	assert.NoError(t, err)
-	pulledNode, err := storage.GetNode(node.ID)
+	pulledNode, err := storage.GetNode(ctx, node.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, node, pulledNode, "Expected 1 node")
 }
 
 func TestSetDependency(t *testing.T) {
-	storage := NewMockStorage()
-	node1, err := AddNode(storage, "type1", "metadata1", "name1")
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	node1, err := AddNode(ctx, storage, "type1", "metadata1", "name1")
 	assert.NoError(t, err, "Expected no error")
-	node2, err := AddNode(storage, "type2", "metadata2", "name2")
+	node2, err := AddNode(ctx, storage, "type2", "metadata2", "name2")
 	assert.NoError(t, err, "Expected no error")
 
-	err = node1.SetDependency(storage, node2)
+	err = node1.SetDependency(ctx, storage, node2)
 
 	assert.NoError(t, err)
 	assert.Contains(t, node1.Children.ToArray(), node2.ID, "Expected node1 to have node2 as child dependency")
@@ -36,22 +52,24 @@ func TestSetDependency(t *testing.T) {
 }
 
 func TestSetDependent(t *testing.T) {
-	storage := NewMockStorage()
-	node1, err := AddNode(storage, "type1", "metadata1", "name1")
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	node1, err := AddNode(ctx, storage, "type1", "metadata1", "name1")
 	assert.NoError(t, err, "Expected no error")
-	node2, err := AddNode(storage, "type2", "metadata2", "name2")
+	node2, err := AddNode(ctx, storage, "type2", "metadata2", "name2")
 	assert.NoError(t, err, "Expected no error")
 
-	err = node1.SetDependency(storage, node2)
+	err = node1.SetDependency(ctx, storage, node2)
 
 	assert.NoError(t, err)
 	assert.Contains(t, node2.Parents.ToArray(), node1.ID, "Expected node2 to have node1 as parent dependency")
 }
 
 func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
+	ctx := context.Background()
 	tests := []int{1000}
 	for _, n := range tests {
-		storage := NewMockStorage()
+		storage := NewMemoryStorage()
 		nodes := make([]*Node, n)
 		expectedDependents := make(map[uint32][]uint32)
 		expectedDependencies := make(map[uint32][]uint32)
@@ -59,7 +77,7 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 		// Create nodes and set dependencies
 
 		for i := 0; i < n; i++ {
-			node, err := AddNode(storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
+			node, err := AddNode(ctx, storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
 			assert.NoError(t, err)
 			nodes[i] = node
 		}
@@ -75,10 +93,10 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 				if targetIndex != i { // Avoid self-dependency and control cycle creation
 					v := max(targetIndex-rand.Intn(100), 0)
 					if shouldCycle && v != i {
-						err := nodes[i].SetDependency(storage, nodes[v])
+						err := nodes[i].SetDependency(ctx, storage, nodes[v])
 						assert.NoError(t, err)
 					} else {
-						err := nodes[i].SetDependency(storage, nodes[targetIndex])
+						err := nodes[i].SetDependency(ctx, storage, nodes[targetIndex])
 						assert.NoError(t, err)
 					}
 
@@ -88,11 +106,11 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 
 		// Precompute expected results for QueryDependentsNoCache and QueryDependenciesNoCache
 		for _, node := range nodes {
-			dependents, err := node.QueryDependentsNoCache(storage)
+			dependents, err := node.QueryDependentsNoCache(ctx, storage)
 			assert.NoError(t, err)
 			expectedDependents[node.ID] = dependents.ToArray()
 
-			dependencies, err := node.QueryDependenciesNoCache(storage)
+			dependencies, err := node.QueryDependenciesNoCache(ctx, storage)
 			assert.NoError(t, err)
 			expectedDependencies[node.ID] = dependencies.ToArray()
 		}
@@ -100,7 +118,7 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 		start := time.Now()
 
 		// Cache the current state
-		err := Cache(storage)
+		err := Cache(ctx, storage)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -111,7 +129,7 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 
 		// Benchmark QueryDependents, QueryDependencies and Cache
 		for _, node := range nodes {
-			dependents, err := node.QueryDependents(storage)
+			dependents, err := node.QueryDependents(ctx, storage)
 			assert.NoError(t, err)
 			depArr := []uint32{}
 			if dependents != nil {
@@ -119,7 +137,7 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 			}
 			assert.Equal(t, expectedDependents[node.ID], depArr, fmt.Sprintf("Dependents of node %v", node.ID))
 
-			dependencies, err := node.QueryDependencies(storage)
+			dependencies, err := node.QueryDependencies(ctx, storage)
 			assert.NoError(t, err)
 			depArr = []uint32{}
 			if dependencies != nil {
@@ -131,9 +149,10 @@ func TestRandomGraphDependenciesWithControlledCircles(t *testing.T) {
 }
 
 func TestRandomGraphDependenciesNoCircles(t *testing.T) {
+	ctx := context.Background()
 	tests := []int{1000}
 	for _, n := range tests {
-		storage := NewMockStorage()
+		storage := NewMemoryStorage()
 		nodes := make([]*Node, n)
 		expectedDependents := make(map[uint32][]uint32)
 		expectedDependencies := make(map[uint32][]uint32)
@@ -141,7 +160,7 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 		// Create nodes and set dependencies
 
 		for i := 0; i < n; i++ {
-			node, err := AddNode(storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
+			node, err := AddNode(ctx, storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
 			assert.NoError(t, err)
 			nodes[i] = node
 		}
@@ -156,7 +175,7 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 			for j := 0; j < 15 && j < len(possibleDeps); j++ { // Each node has up to 10 random dependencies
 				targetIndex := possibleDeps[j] + i + 1
 				if targetIndex < n {
-					err := nodes[i].SetDependency(storage, nodes[targetIndex])
+					err := nodes[i].SetDependency(ctx, storage, nodes[targetIndex])
 					assert.NoError(t, err)
 					m[int(nodes[i].ID)] = append(m[int(nodes[i].ID)], int(nodes[targetIndex].ID))
 				}
@@ -165,11 +184,11 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 
 		// Precompute expected results for QueryDependentsNoCache and QueryDependenciesNoCache
 		for _, node := range nodes {
-			dependents, err := node.QueryDependentsNoCache(storage)
+			dependents, err := node.QueryDependentsNoCache(ctx, storage)
 			assert.NoError(t, err)
 			expectedDependents[node.ID] = dependents.ToArray()
 
-			dependencies, err := node.QueryDependenciesNoCache(storage)
+			dependencies, err := node.QueryDependenciesNoCache(ctx, storage)
 			assert.NoError(t, err)
 			expectedDependencies[node.ID] = dependencies.ToArray()
 		}
@@ -177,7 +196,7 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 		start := time.Now()
 
 		// Cache the current state
-		err := Cache(storage)
+		err := Cache(ctx, storage)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -188,7 +207,7 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 
 		// Benchmark QueryDependents, QueryDependencies and Cache
 		for _, node := range nodes {
-			dependents, err := node.QueryDependents(storage)
+			dependents, err := node.QueryDependents(ctx, storage)
 			assert.NoError(t, err)
 			depArr := []uint32{}
 			if dependents != nil {
@@ -196,7 +215,7 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 			}
 			assert.Equal(t, expectedDependents[node.ID], depArr, fmt.Sprintf("Dependents of node %v", node.ID))
 
-			dependencies, err := node.QueryDependencies(storage)
+			dependencies, err := node.QueryDependencies(ctx, storage)
 			assert.NoError(t, err)
 			depArr = []uint32{}
 			if dependencies != nil {
@@ -208,74 +227,75 @@ func TestRandomGraphDependenciesNoCircles(t *testing.T) {
 }
 
 func TestComplexCircularDependency(t *testing.T) {
-	storage := NewMockStorage()
+	ctx := context.Background()
+	storage := NewMemoryStorage()
 	nodes := make([]*Node, 13)
 	var err error
 
 	// Create nodes
 	for i := 0; i < 13; i++ {
-		nodes[i], err = AddNode(storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
+		nodes[i], err = AddNode(ctx, storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
 		assert.NoError(t, err, "Expected no error")
 	}
 
 	// Create circular dependencies like figure 8s
 	// Circle 1: node0 -> node1 -> node2 -> node0
-	err = nodes[0].SetDependency(storage, nodes[1])
+	err = nodes[0].SetDependency(ctx, storage, nodes[1])
 	assert.NoError(t, err)
-	err = nodes[1].SetDependency(storage, nodes[2])
+	err = nodes[1].SetDependency(ctx, storage, nodes[2])
 	assert.NoError(t, err)
-	err = nodes[2].SetDependency(storage, nodes[0])
+	err = nodes[2].SetDependency(ctx, storage, nodes[0])
 	assert.NoError(t, err)
 
 	// Circle 2: node3 -> node4 -> node5 -> node3
-	err = nodes[3].SetDependency(storage, nodes[4])
+	err = nodes[3].SetDependency(ctx, storage, nodes[4])
 	assert.NoError(t, err)
-	err = nodes[4].SetDependency(storage, nodes[5])
+	err = nodes[4].SetDependency(ctx, storage, nodes[5])
 	assert.NoError(t, err)
-	err = nodes[5].SetDependency(storage, nodes[3])
+	err = nodes[5].SetDependency(ctx, storage, nodes[3])
 	assert.NoError(t, err)
 
 	// Figure 8 linking Circle 1 and Circle 2: node2 -> node3
-	err = nodes[2].SetDependency(storage, nodes[3])
+	err = nodes[2].SetDependency(ctx, storage, nodes[3])
 	assert.NoError(t, err)
 
 	// Additional circle: node6 -> node7 -> node8 -> node9 -> node6
-	err = nodes[6].SetDependency(storage, nodes[7])
+	err = nodes[6].SetDependency(ctx, storage, nodes[7])
 	assert.NoError(t, err)
-	err = nodes[7].SetDependency(storage, nodes[8])
+	err = nodes[7].SetDependency(ctx, storage, nodes[8])
 	assert.NoError(t, err)
-	err = nodes[8].SetDependency(storage, nodes[9])
+	err = nodes[8].SetDependency(ctx, storage, nodes[9])
 	assert.NoError(t, err)
-	err = nodes[9].SetDependency(storage, nodes[6])
+	err = nodes[9].SetDependency(ctx, storage, nodes[6])
 	assert.NoError(t, err)
 
 	// Linking node9 to node1 to form another figure 8 between Circle 1 and the additional circle
-	err = nodes[9].SetDependency(storage, nodes[1])
+	err = nodes[9].SetDependency(ctx, storage, nodes[1])
 	assert.NoError(t, err)
 
 	// Additional independent circle: node10 -> node11 -> node12 -> node10
-	err = nodes[10].SetDependency(storage, nodes[11])
+	err = nodes[10].SetDependency(ctx, storage, nodes[11])
 	assert.NoError(t, err)
-	err = nodes[11].SetDependency(storage, nodes[12])
+	err = nodes[11].SetDependency(ctx, storage, nodes[12])
 	assert.NoError(t, err)
-	err = nodes[12].SetDependency(storage, nodes[10])
+	err = nodes[12].SetDependency(ctx, storage, nodes[10])
 	assert.NoError(t, err)
 
-	if err := Cache(storage); err != nil {
+	if err := Cache(ctx, storage); err != nil {
 		t.Fatal(err)
 	}
 
 	// Test QueryDependents and QueryDependencies for complex circular dependencies
 	for _, node := range nodes {
-		dependents, err := node.QueryDependents(storage)
+		dependents, err := node.QueryDependents(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying cached dependents")
-		dependentsNoCache, err := node.QueryDependentsNoCache(storage)
+		dependentsNoCache, err := node.QueryDependentsNoCache(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying non-cached dependents")
 		assert.Equal(t, dependentsNoCache.ToArray(), dependents.ToArray(), "Cached and non-cached dependents should match")
 
-		dependencies, err := node.QueryDependencies(storage)
+		dependencies, err := node.QueryDependencies(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying cached dependencies")
-		dependenciesNoCache, err := node.QueryDependenciesNoCache(storage)
+		dependenciesNoCache, err := node.QueryDependenciesNoCache(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying non-cached dependencies")
 		assert.Equal(t, dependenciesNoCache.ToArray(), dependencies.ToArray(), "Cached and non-cached dependencies should match")
 	}
@@ -283,25 +303,26 @@ func TestComplexCircularDependency(t *testing.T) {
 }
 
 func TestSimpleCircle(t *testing.T) {
-	storage := NewMockStorage()
+	ctx := context.Background()
+	storage := NewMemoryStorage()
 	nodes := make([]*Node, 3)
 	var err error
 
 	// Create nodes
 	for i := 0; i < 3; i++ {
-		nodes[i], err = AddNode(storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
+		nodes[i], err = AddNode(ctx, storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
 		assert.NoError(t, err, "Expected no error")
 	}
 
 	// Simple Circle: node0 -> node1 -> node2 -> node0
-	err = nodes[0].SetDependency(storage, nodes[1])
+	err = nodes[0].SetDependency(ctx, storage, nodes[1])
 	assert.NoError(t, err)
-	err = nodes[1].SetDependency(storage, nodes[2])
+	err = nodes[1].SetDependency(ctx, storage, nodes[2])
 	assert.NoError(t, err)
-	err = nodes[2].SetDependency(storage, nodes[0])
+	err = nodes[2].SetDependency(ctx, storage, nodes[0])
 	assert.NoError(t, err)
 
-	if err := Cache(storage); err != nil {
+	if err := Cache(ctx, storage); err != nil {
 		t.Fatal(err)
 	}
 
@@ -309,54 +330,55 @@ func TestSimpleCircle(t *testing.T) {
 
 	// Test QueryDependents and QueryDependencies for simple circle
 	for _, node := range nodes {
-		dependents, err := node.QueryDependents(storage)
+		dependents, err := node.QueryDependents(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying cached dependents")
-		dependentsNoCache, err := node.QueryDependentsNoCache(storage)
+		dependentsNoCache, err := node.QueryDependentsNoCache(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying non-cached dependents")
 		assert.Equal(t, dependentsNoCache.ToArray(), dependents.ToArray(), "Cached and non-cached dependents should match")
 
-		dependencies, err := node.QueryDependencies(storage)
+		dependencies, err := node.QueryDependencies(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying cached dependencies")
-		dependenciesNoCache, err := node.QueryDependenciesNoCache(storage)
+		dependenciesNoCache, err := node.QueryDependenciesNoCache(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying non-cached dependencies")
 		assert.Equal(t, dependenciesNoCache.ToArray(), dependencies.ToArray(), "Cached and non-cached dependencies should match")
 	}
 }
 
 func TestIntermediateSimpleCircles(t *testing.T) {
-	storage := NewMockStorage()
+	ctx := context.Background()
+	storage := NewMemoryStorage()
 	nodes := make([]*Node, 6)
 	var err error
 
 	// Create nodes
 	for i := 0; i < 6; i++ {
-		nodes[i], err = AddNode(storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
+		nodes[i], err = AddNode(ctx, storage, fmt.Sprintf("type %d", i+1), fmt.Sprintf("metadata %d", i), fmt.Sprintf("name %d", i+1))
 		assert.NoError(t, err, "Expected no error")
 	}
 
 	// Circle 1: node0 -> node1 -> node2 -> node0
-	err = nodes[0].SetDependency(storage, nodes[1])
+	err = nodes[0].SetDependency(ctx, storage, nodes[1])
 	assert.NoError(t, err)
-	err = nodes[1].SetDependency(storage, nodes[2])
+	err = nodes[1].SetDependency(ctx, storage, nodes[2])
 	assert.NoError(t, err)
-	err = nodes[2].SetDependency(storage, nodes[0])
+	err = nodes[2].SetDependency(ctx, storage, nodes[0])
 	assert.NoError(t, err)
 
 	// Circle 2: node3 -> node4 -> node5 -> node3
-	err = nodes[3].SetDependency(storage, nodes[4])
+	err = nodes[3].SetDependency(ctx, storage, nodes[4])
 	assert.NoError(t, err)
-	err = nodes[4].SetDependency(storage, nodes[5])
+	err = nodes[4].SetDependency(ctx, storage, nodes[5])
 	assert.NoError(t, err)
-	err = nodes[5].SetDependency(storage, nodes[3])
+	err = nodes[5].SetDependency(ctx, storage, nodes[3])
 	assert.NoError(t, err)
 
 	// Linking Circle 1 and Circle 2
-	err = nodes[2].SetDependency(storage, nodes[3])
+	err = nodes[2].SetDependency(ctx, storage, nodes[3])
 	assert.NoError(t, err)
-	// err = nodes[5].SetDependency(storage, nodes[0])
+	// err = nodes[5].SetDependency(ctx, storage, nodes[0])
 	// assert.NoError(t, err)
 
-	if err := Cache(storage); err != nil {
+	if err := Cache(ctx, storage); err != nil {
 		t.Fatal(err)
 	}
 
@@ -364,15 +386,15 @@ func TestIntermediateSimpleCircles(t *testing.T) {
 
 	// Test QueryDependents and QueryDependencies for intermediate simple circles
 	for _, node := range nodes {
-		dependents, err := node.QueryDependents(storage)
+		dependents, err := node.QueryDependents(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying cached dependents")
-		dependentsNoCache, err := node.QueryDependentsNoCache(storage)
+		dependentsNoCache, err := node.QueryDependentsNoCache(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying non-cached dependents")
 		assert.Equal(t, dependentsNoCache.ToArray(), dependents.ToArray(), "Cached and non-cached dependents should match")
 
-		dependencies, err := node.QueryDependencies(storage)
+		dependencies, err := node.QueryDependencies(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying cached dependencies")
-		dependenciesNoCache, err := node.QueryDependenciesNoCache(storage)
+		dependenciesNoCache, err := node.QueryDependenciesNoCache(ctx, storage)
 		assert.NoError(t, err, "Expected no error when querying non-cached dependencies")
 		assert.Equal(t, dependenciesNoCache.ToArray(), dependencies.ToArray(), "Cached and non-cached dependencies should match")
 	}
@@ -429,3 +451,32 @@ func TestNodeCacheJSONMarshalUnmarshal(t *testing.T) {
 	assert.True(t, nodeCache.allParents.Equals(unmarshaledNodeCache.allParents))
 	assert.True(t, nodeCache.allChildren.Equals(unmarshaledNodeCache.allChildren))
 }
+
+func TestShortestPath(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	nodes := make([]*Node, 5)
+	var err error
+	for i := range nodes {
+		nodes[i], err = AddNode(ctx, storage, "PACKAGE", nil, fmt.Sprintf("name %d", i+1))
+		assert.NoError(t, err)
+	}
+
+	// 0 -> 1 -> 2 -> 3 and the shortcut 0 -> 4 -> 3
+	assert.NoError(t, nodes[0].SetDependency(ctx, storage, nodes[1]))
+	assert.NoError(t, nodes[1].SetDependency(ctx, storage, nodes[2]))
+	assert.NoError(t, nodes[2].SetDependency(ctx, storage, nodes[3]))
+	assert.NoError(t, nodes[0].SetDependency(ctx, storage, nodes[4]))
+	assert.NoError(t, nodes[4].SetDependency(ctx, storage, nodes[3]))
+
+	path, err := nodes[0].ShortestPath(ctx, storage, nodes[3])
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{nodes[0].ID, nodes[4].ID, nodes[3].ID}, path)
+
+	path, err = nodes[0].ShortestPath(ctx, storage, nodes[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{nodes[0].ID}, path)
+
+	_, err = nodes[3].ShortestPath(ctx, storage, nodes[0])
+	assert.ErrorIs(t, err, ErrNoPath)
+}
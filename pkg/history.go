@@ -0,0 +1,350 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+const (
+	// VersionSourceSBOM is the source of the graph versions created by ingesting SBOMs and lockfiles.
+	VersionSourceSBOM = "sbom"
+	// VersionSourceVulnerabilities is the source of the graph versions created by ingesting vulnerabilities.
+	VersionSourceVulnerabilities = "vulnerabilities"
+)
+
+// GraphVersion is a version of the graph, created by an ingest.
+type GraphVersion struct {
+	Version uint32    `json:"version"`
+	Created time.Time `json:"created"`
+	// Source is what was ingested, such as VersionSourceSBOM.
+	Source string `json:"source"`
+	// Documents are the names of the document nodes the ingest added or updated.
+	Documents []string `json:"documents,omitempty"`
+}
+
+// BaselineGraphVersion is the version the children nodes had before they were first recorded are kept under, for nodes
+// that predate the history.
+const BaselineGraphVersion = 0
+
+// GraphChanges collects the nodes an ingest run changes, so that the run is recorded as one version of the graph.
+// It's safe for concurrent use, and a nil GraphChanges collects nothing.
+type GraphChanges struct {
+	mu sync.Mutex
+	// before are the children of the nodes that existed before the run, as they were before it changed them.
+	before map[uint32]*roaring.Bitmap
+	// created are the nodes the run created.
+	created   *roaring.Bitmap
+	documents []string
+}
+
+func NewGraphChanges() *GraphChanges {
+	return &GraphChanges{before: map[uint32]*roaring.Bitmap{}, created: roaring.New()}
+}
+
+// Track keeps the children of nodes the run may change, and must be called before it changes them.
+// Nodes that are tracked again keep the children they had the first time.
+func (c *GraphChanges) Track(nodes ...*Node) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, node := range nodes {
+		if _, ok := c.before[node.ID]; !ok {
+			c.before[node.ID] = cloneBitmap(node.Children)
+		}
+	}
+}
+
+// Created records that the run created the nodes.
+func (c *GraphChanges) Created(ids ...uint32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created.AddMany(ids)
+}
+
+// AddDocument records that the run added or updated the document node.
+func (c *GraphChanges) AddDocument(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !slices.Contains(c.documents, name) {
+		c.documents = append(c.documents, name)
+	}
+}
+
+// Record records a new version of the graph, created by the run from the source, unless the run changed nothing.
+// Only the nodes the run created and the tracked nodes whose children changed are recorded, with their children as
+// they are now. A node that predates the history is recorded with its children from before the run as its baseline.
+func (c *GraphChanges) Record(ctx context.Context, storage Storage, source string) (*GraphVersion, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids := c.created.Clone()
+	for id := range c.before {
+		ids.Add(id)
+	}
+	nodes, err := storage.GetNodes(ctx, ids.ToArray())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	baseline, children := map[uint32]*roaring.Bitmap{}, map[uint32]*roaring.Bitmap{}
+	for id, node := range nodes {
+		if c.created.Contains(id) {
+			children[id] = cloneBitmap(node.Children)
+			continue
+		}
+		if before := c.before[id]; !before.Equals(node.Children) {
+			baseline[id], children[id] = before, cloneBitmap(node.Children)
+		}
+	}
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	version := &GraphVersion{Created: time.Now().UTC(), Source: source, Documents: slices.Clone(c.documents)}
+	slices.Sort(version.Documents)
+	if err := storage.AddGraphVersion(ctx, version, baseline, children); err != nil {
+		return nil, fmt.Errorf("failed to add graph version: %w", err)
+	}
+	return version, nil
+}
+
+// ResolveGraphVersion returns the version of the graph asOf names, either a version number, or an RFC 3339 timestamp
+// or a date, which name the last version created by then.
+func ResolveGraphVersion(ctx context.Context, storage Storage, asOf string) (uint32, error) {
+	versions, err := storage.GetGraphVersions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get graph versions: %w", err)
+	}
+
+	if number, err := strconv.ParseUint(asOf, 10, 32); err == nil {
+		for _, version := range versions {
+			if version.Version == uint32(number) {
+				return version.Version, nil
+			}
+		}
+		return 0, fmt.Errorf("graph version %d not found", number)
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		date, dateErr := time.Parse(time.DateOnly, asOf)
+		if dateErr != nil {
+			return 0, fmt.Errorf("invalid version %q, expected a version number, an RFC 3339 timestamp or a date", asOf)
+		}
+		// A date includes everything ingested during that day
+		timestamp = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	var found *GraphVersion
+	for _, version := range versions {
+		if !version.Created.After(timestamp) && (found == nil || version.Version > found.Version) {
+			found = version
+		}
+	}
+	if found == nil {
+		return 0, fmt.Errorf("no graph version was created by %s", timestamp.Format(time.RFC3339))
+	}
+	return found.Version, nil
+}
+
+// GraphAsOf returns a read-only view of the graph as it was in a version, whose dependencies are cached in memory.
+// Node metadata, VEX statements, edge types, provenance and indexes are read from the storage as they are now, since
+// only the dependencies are versioned. Nodes that were never recorded in a version predate the history, and are kept
+// with their current dependencies, while nodes that were first recorded in a later version are kept with their
+// baseline if they predate the history, and left out otherwise.
+func GraphAsOf(ctx context.Context, storage Storage, version uint32) (Storage, error) {
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keys: %w", err)
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	histories, err := storage.GetNodeHistories(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node histories: %w", err)
+	}
+
+	// Each node has the children of the last version it was recorded in, up to the requested one
+	children := map[uint32]*roaring.Bitmap{}
+	for id, node := range nodes {
+		history := histories[id]
+		if len(history) == 0 {
+			children[id] = cloneBitmap(node.Children)
+			continue
+		}
+		recorded, found := uint32(0), false
+		for v := range history {
+			if v <= version && (!found || v > recorded) {
+				recorded, found = v, true
+			}
+		}
+		if found {
+			children[id] = cloneBitmap(history[recorded])
+		}
+	}
+
+	parents := map[uint32]*roaring.Bitmap{}
+	for id := range children {
+		parents[id] = roaring.New()
+	}
+	for id, dependencies := range children {
+		for _, child := range dependencies.ToArray() {
+			if _, ok := children[child]; !ok {
+				dependencies.Remove(child)
+				continue
+			}
+			parents[child].Add(id)
+		}
+	}
+	graph, existed := NewMemoryStorage(), roaring.New()
+	for _, id := range keys {
+		if _, ok := children[id]; !ok {
+			continue
+		}
+		existed.Add(id)
+		node := *nodes[id]
+		node.Children, node.Parents = children[id], parents[id]
+		if err := graph.SaveNode(ctx, &node); err != nil {
+			return nil, fmt.Errorf("failed to save node %s: %w", node.Name, err)
+		}
+	}
+	if err := Cache(ctx, graph); err != nil {
+		return nil, fmt.Errorf("failed to cache graph version %d: %w", version, err)
+	}
+	return &graphVersionView{Storage: storage, graph: graph, nodes: existed}, nil
+}
+
+// graphVersionView is a read-only view of a version of the graph. Its nodes, dependencies and caches are kept in
+// memory, everything else is read from the storage.
+type graphVersionView struct {
+	Storage
+	graph *MemoryStorage
+	// nodes are the IDs of the nodes that existed in the version.
+	nodes *roaring.Bitmap
+}
+
+func (v *graphVersionView) NameToID(ctx context.Context, name string) (uint32, error) {
+	return v.graph.NameToID(ctx, name)
+}
+
+func (v *graphVersionView) GetNode(ctx context.Context, id uint32) (*Node, error) {
+	return v.graph.GetNode(ctx, id)
+}
+
+func (v *graphVersionView) GetNodes(ctx context.Context, ids []uint32) (map[uint32]*Node, error) {
+	return v.graph.GetNodes(ctx, ids)
+}
+
+func (v *graphVersionView) GetAllKeys(ctx context.Context) ([]uint32, error) {
+	return v.graph.GetAllKeys(ctx)
+}
+
+func (v *graphVersionView) GetCache(ctx context.Context, id uint32) (*NodeCache, error) {
+	return v.graph.GetCache(ctx, id)
+}
+
+func (v *graphVersionView) ToBeCached(ctx context.Context) ([]uint32, error) {
+	return v.graph.ToBeCached(ctx)
+}
+
+// GetIndex leaves out the nodes that didn't exist in the version.
+func (v *graphVersionView) GetIndex(ctx context.Context, index, value string) (*roaring.Bitmap, error) {
+	ids, err := v.Storage.GetIndex(ctx, index, value)
+	if err != nil {
+		return nil, err
+	}
+	return roaring.And(ids, v.nodes), nil
+}
+
+func (v *graphVersionView) InNamespace(string) (Storage, error) {
+	return nil, fmt.Errorf("a graph version can't be used across namespaces")
+}
+
+func (v *graphVersionView) UseNamespace(string) error {
+	return fmt.Errorf("a graph version can't be used across namespaces")
+}
+
+func (v *graphVersionView) SaveNode(context.Context, *Node) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) SaveNodeMetadata(context.Context, uint32, any) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) CreateNode(context.Context, *Node) (uint32, error) {
+	return 0, ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) AddDependency(context.Context, uint32, uint32) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) RemoveDependency(context.Context, uint32, uint32) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) SaveCache(context.Context, *NodeCache) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) SaveCaches(context.Context, []*NodeCache) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) AddNodeToCachedStack(context.Context, uint32) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) ClearCacheStack(context.Context) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) GenerateID(context.Context) (uint32, error) {
+	return 0, ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) SaveJob(context.Context, *Job) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) RequestJobCancel(context.Context, string) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) AddProvenance(context.Context, uint32, []uint32, []Edge) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) RemoveProvenance(context.Context, uint32, []uint32, []Edge) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) SetEdgeTypes(context.Context, map[Edge]EdgeType) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) AddToIndex(context.Context, string, string, []uint32) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) SetVEXStatement(context.Context, Edge, *VEXStatement) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) AddGraphVersion(context.Context, *GraphVersion, map[uint32]*roaring.Bitmap, map[uint32]*roaring.Bitmap) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) CreateNamespace(context.Context, string) error { return ErrReadOnlyGraph }
+
+func (v *graphVersionView) CopyNamespace(context.Context, string, string) error {
+	return ErrReadOnlyGraph
+}
+
+func (v *graphVersionView) DropNamespace(context.Context, string) error { return ErrReadOnlyGraph }
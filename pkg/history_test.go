@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphAsOf(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	// tool and helper predate the history, so they're in every version
+	tool, helper := addTestNode(t, storage, "pkg:generic/tool@1.0.0"), addTestNode(t, storage, "pkg:generic/helper@1.0.0")
+	changes := NewGraphChanges()
+	app, lib1 := addTestNode(t, storage, "pkg:generic/app@1.0.0"), addTestNode(t, storage, "pkg:generic/lib@1.0.0")
+	changes.Created(app.ID, lib1.ID)
+	changes.AddDocument("document:v1")
+	require.NoError(t, app.SetDependency(ctx, storage, lib1))
+	first, err := changes.Record(ctx, storage, VersionSourceSBOM)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), first.Version)
+
+	// The next version swaps lib 1.0.0 for lib 2.0.0, and tool starts depending on helper
+	changes = NewGraphChanges()
+	changes.Track(app, lib1, tool)
+	changes.AddDocument("document:v1")
+	lib2 := addTestNode(t, storage, "pkg:generic/lib@2.0.0")
+	changes.Created(lib2.ID)
+	require.NoError(t, storage.RemoveDependency(ctx, app.ID, lib1.ID))
+	app, err = storage.GetNode(ctx, app.ID)
+	require.NoError(t, err)
+	require.NoError(t, app.SetDependency(ctx, storage, lib2))
+	require.NoError(t, tool.SetDependency(ctx, storage, helper))
+	second, err := changes.Record(ctx, storage, VersionSourceSBOM)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), second.Version)
+
+	versions, err := storage.GetGraphVersions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*GraphVersion{first, second}, versions)
+
+	// Only the nodes whose dependencies changed are recorded, with a baseline for tool, which predates the history
+	histories, err := storage.GetNodeHistories(ctx, []uint32{app.ID, lib1.ID, tool.ID, helper.ID})
+	require.NoError(t, err)
+	assert.Len(t, histories[app.ID], 2)
+	assert.Len(t, histories[lib1.ID], 1)
+	assert.Contains(t, histories[tool.ID], uint32(BaselineGraphVersion))
+	assert.NotContains(t, histories, helper.ID)
+
+	for version, want := range map[uint32][2][]uint32{1: {{lib1.ID}, {}}, 2: {{lib2.ID}, {helper.ID}}} {
+		asOf, err := GraphAsOf(ctx, storage, version)
+		require.NoError(t, err)
+		result, err := ParseAndExecute(ctx, "dependencies PACKAGE pkg:generic/app@1.0.0", asOf, "")
+		require.NoError(t, err)
+		assert.Equal(t, want[0], result.ToArray(), "version %d", version)
+		result, err = ParseAndExecute(ctx, "dependencies PACKAGE pkg:generic/tool@1.0.0", asOf, "")
+		require.NoError(t, err)
+		assert.Equal(t, want[1], result.ToArray(), "version %d", version)
+
+		// Nodes added in later versions don't exist yet, unless they predate the history
+		_, err = asOf.NameToID(ctx, helper.Name)
+		assert.NoError(t, err)
+		_, err = asOf.NameToID(ctx, lib2.Name)
+		assert.Equal(t, version == 2, err == nil)
+	}
+
+	// A run that changes nothing isn't a version
+	changes = NewGraphChanges()
+	changes.Track(app, tool)
+	version, err := changes.Record(ctx, storage, VersionSourceSBOM)
+	require.NoError(t, err)
+	assert.Nil(t, version)
+}
+
+func TestGraphAsOfKeepsUnversionedData(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	changes := NewGraphChanges()
+	app := addTestNode(t, storage, "pkg:generic/app@1.0.0")
+	lib, err := AddNode(ctx, storage, "PACKAGE", &ComponentMetadata{Licenses: []string{"MIT"}}, "pkg:generic/lib@1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, storage.AddToIndex(ctx, LicenseIndex, "mit", []uint32{lib.ID}))
+	triaged, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GHSA-0001"})
+	require.NoError(t, err)
+	open, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GHSA-0002"})
+	require.NoError(t, err)
+	changes.Created(app.ID, lib.ID, triaged.ID, open.ID)
+	require.NoError(t, app.SetDependency(ctx, storage, lib))
+	require.NoError(t, lib.SetDependency(ctx, storage, triaged))
+	require.NoError(t, lib.SetDependency(ctx, storage, open))
+	require.NoError(t, storage.SetEdgeTypes(ctx, map[Edge]EdgeType{{From: app.ID, To: lib.ID}: {Type: "devDependency"}}))
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: lib.ID, To: triaged.ID}, &VEXStatement{Product: app.ID, Status: VEXNotAffected}))
+	version, err := changes.Record(ctx, storage, VersionSourceSBOM)
+	require.NoError(t, err)
+	require.NoError(t, Cache(ctx, storage))
+
+	// A node added in a later version is left out of the indexes
+	changes = NewGraphChanges()
+	later, err := AddNode(ctx, storage, "PACKAGE", &ComponentMetadata{Licenses: []string{"MIT"}}, "pkg:generic/later@1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, storage.AddToIndex(ctx, LicenseIndex, "mit", []uint32{later.ID}))
+	changes.Created(later.ID)
+	_, err = changes.Record(ctx, storage, VersionSourceSBOM)
+	require.NoError(t, err)
+
+	asOf, err := GraphAsOf(ctx, storage, version.Version)
+	require.NoError(t, err)
+
+	// app's dependencies haven't changed since the version, so querying them gives the same results as the graph itself
+	for _, script := range []string{
+		"dependencies VULNERABILITY pkg:generic/app@1.0.0",
+		"dependencies PACKAGE pkg:generic/app@1.0.0",
+	} {
+		want, err := ParseAndExecute(ctx, script, storage, "")
+		require.NoError(t, err)
+		got, err := ParseAndExecute(ctx, script, asOf, "")
+		require.NoError(t, err)
+		assert.Equal(t, want.ToArray(), got.ToArray(), script)
+	}
+	vulnerabilities, err := ParseAndExecute(ctx, "dependencies VULNERABILITY pkg:generic/app@1.0.0", asOf, "")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{open.ID}, vulnerabilities.ToArray())
+
+	licensed, err := ParseAndExecute(ctx, "license(MIT)", asOf, "")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{lib.ID}, licensed.ToArray())
+
+	types, err := asOf.GetEdgeTypes(ctx, []Edge{{From: app.ID, To: lib.ID}})
+	require.NoError(t, err)
+	assert.Equal(t, "devDependency", types[Edge{From: app.ID, To: lib.ID}].Type)
+
+	// The view can't change the graph
+	assert.ErrorIs(t, asOf.AddDependency(ctx, app.ID, later.ID), ErrReadOnlyGraph)
+	_, err = AddNode(ctx, asOf, "PACKAGE", nil, "pkg:generic/other@1.0.0")
+	assert.ErrorIs(t, err, ErrReadOnlyGraph)
+}
+
+func TestResolveGraphVersion(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	march := time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+	for _, created := range []time.Time{march, march.AddDate(0, 1, 0)} {
+		require.NoError(t, storage.AddGraphVersion(ctx, &GraphVersion{Created: created, Source: VersionSourceSBOM}, nil, map[uint32]*roaring.Bitmap{}))
+	}
+
+	for asOf, want := range map[string]uint32{
+		"1":                    1,
+		"2":                    2,
+		"2024-03-15":           1,
+		"2024-03-31T00:00:00Z": 1,
+		"2024-04-15T12:00:00Z": 2,
+		"2025-01-01":           2,
+	} {
+		version, err := ResolveGraphVersion(ctx, storage, asOf)
+		assert.NoError(t, err, asOf)
+		assert.Equal(t, want, version, asOf)
+	}
+	for _, asOf := range []string{"3", "2024-03-14", "last march"} {
+		_, err := ResolveGraphVersion(ctx, storage, asOf)
+		assert.Error(t, err, asOf)
+	}
+}
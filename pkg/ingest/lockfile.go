@@ -0,0 +1,333 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/package-url/packageurl-go"
+	"github.com/protobom/protobom/pkg/sbom"
+)
+
+// LockfileFormat is a lockfile format that can be ingested.
+type LockfileFormat string
+
+const (
+	GoModFormat       LockfileFormat = "go.mod"
+	GoSumFormat       LockfileFormat = "go.sum"
+	GoModGraphFormat  LockfileFormat = "go-mod-graph"
+	PackageLockFormat LockfileFormat = "package-lock.json"
+	YarnLockFormat    LockfileFormat = "yarn.lock"
+	PnpmLockFormat    LockfileFormat = "pnpm-lock.yaml"
+	PoetryLockFormat  LockfileFormat = "poetry.lock"
+	CargoLockFormat   LockfileFormat = "Cargo.lock"
+	GemfileLockFormat LockfileFormat = "Gemfile.lock"
+)
+
+// goModGraphFileName is the file name the output of go mod graph is detected by.
+const goModGraphFileName = "go.mod.graph"
+
+// lockfileSkippedDirs are the directories not searched for lockfiles, since they hold dependencies rather than projects.
+var lockfileSkippedDirs = []string{"node_modules", "vendor", ".git"}
+
+// LockfileFormats are the formats that can be ingested, in the order they are preferred when a directory has several lockfiles for the same ecosystem.
+var LockfileFormats = []LockfileFormat{GoModGraphFormat, GoModFormat, GoSumFormat, PackageLockFormat, PnpmLockFormat, YarnLockFormat, PoetryLockFormat, CargoLockFormat, GemfileLockFormat}
+
+// lockfileEcosystems are the package ecosystems, named by purl type, whose projects each format locks.
+// Lockfiles of the same ecosystem in a directory usually describe the same project.
+var lockfileEcosystems = map[LockfileFormat]string{
+	GoModFormat:       packageurl.TypeGolang,
+	GoSumFormat:       packageurl.TypeGolang,
+	GoModGraphFormat:  packageurl.TypeGolang,
+	PackageLockFormat: packageurl.TypeNPM,
+	YarnLockFormat:    packageurl.TypeNPM,
+	PnpmLockFormat:    packageurl.TypeNPM,
+	PoetryLockFormat:  packageurl.TypePyPi,
+	CargoLockFormat:   packageurl.TypeCargo,
+	GemfileLockFormat: packageurl.TypeGem,
+}
+
+// lockfileParsers parse the contents of a lockfile in the given directory into a dependency graph.
+// The directory is used to find the project's manifest, which names the project and its direct dependencies for some formats.
+var lockfileParsers = map[LockfileFormat]func(data []byte, dir string) (*dependencyGraph, error){
+	GoModFormat:       parseGoMod,
+	GoSumFormat:       parseGoSum,
+	GoModGraphFormat:  parseGoModGraph,
+	PackageLockFormat: parsePackageLock,
+	YarnLockFormat:    parseYarnLock,
+	PnpmLockFormat:    parsePnpmLock,
+	PoetryLockFormat:  parsePoetryLock,
+	CargoLockFormat:   parseCargoLock,
+	GemfileLockFormat: parseGemfileLock,
+}
+
+// DetectLockfileFormat detects the format of a lockfile from its file name.
+// The output of go mod graph is detected when it's saved as go.mod.graph.
+func DetectLockfileFormat(path string) (LockfileFormat, error) {
+	name := filepath.Base(path)
+	if name == goModGraphFileName {
+		return GoModGraphFormat, nil
+	}
+	for _, format := range LockfileFormats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown lockfile %s", path)
+}
+
+// LockfileOptions configures how lockfiles are ingested.
+type LockfileOptions struct {
+	// Format is the format of the lockfile, if it's empty it's detected from each file name.
+	Format LockfileFormat
+	// Name identifies the project of a lockfile read from stdin, which has no path to identify it by.
+	Name string
+}
+
+// Lockfile ingests the dependency tree in a lockfile, or in every lockfile below a directory, into the storage backend.
+// If opts.Format is set, path must be a file or StdinPath, and lockfiles read from stdin must have opts.Name set.
+// Each lockfile is ingested as a document identified by its ecosystem and the absolute path of its directory, or the
+// name for stdin, so re-ingesting an updated lockfile replaces what it declared before.
+func Lockfile(ctx context.Context, path string, storage pkg.Storage, opts LockfileOptions) (*SBOMReport, error) {
+	if path == StdinPath && opts.Name == "" {
+		return nil, fmt.Errorf("a name is required to ingest a lockfile from stdin")
+	}
+	files, err := lockfiles(path, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lockfiles are recorded as one version of the graph, including those ingested before one fails
+	report := &SBOMReport{}
+	changes := pkg.NewGraphChanges()
+	for _, file := range files {
+		stats, err := processLockfile(ctx, file, opts.Name, storage, changes)
+		if err != nil {
+			_, _ = changes.Record(context.WithoutCancel(ctx), storage, pkg.VersionSourceSBOM)
+			return report, fmt.Errorf("failed to ingest lockfile %s: %w", file.path, err)
+		}
+		report.Files++
+		report.Nodes += stats.nodes
+		report.Edges += stats.edges
+		report.Duplicates += stats.duplicates
+		report.RemovedEdges += stats.removedEdges
+	}
+	if _, err := changes.Record(ctx, storage, pkg.VersionSourceSBOM); err != nil {
+		return report, fmt.Errorf("failed to record graph version: %w", err)
+	}
+	return report, nil
+}
+
+type lockfile struct {
+	path   string
+	format LockfileFormat
+}
+
+// lockfiles finds the lockfiles at path.
+// In a directory tree only the preferred lockfile of each ecosystem is used in each directory, so a directory with a
+// Go module and a JavaScript package has both ingested, but not both its package-lock.json and yarn.lock.
+func lockfiles(path string, format LockfileFormat) ([]lockfile, error) {
+	if format != "" {
+		if _, ok := lockfileParsers[format]; !ok {
+			return nil, fmt.Errorf("unknown lockfile format %s", format)
+		}
+		return []lockfile{{path: path, format: format}}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing path %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		format, err := DetectLockfileFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		return []lockfile{{path: path, format: format}}, nil
+	}
+
+	var files []lockfile
+	err = filepath.WalkDir(path, func(dir string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read directory %s: %w", dir, err)
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if dir != path && slices.Contains(lockfileSkippedDirs, entry.Name()) {
+			return filepath.SkipDir
+		}
+		found := map[string]bool{}
+		for _, format := range LockfileFormats {
+			if found[lockfileEcosystems[format]] {
+				continue
+			}
+			name := string(format)
+			if format == GoModGraphFormat {
+				name = goModGraphFileName
+			}
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+				files = append(files, lockfile{path: filepath.Join(dir, name), format: format})
+				found[lockfileEcosystems[format]] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no lockfiles found in %s", path)
+	}
+	return files, nil
+}
+
+// processLockfile ingests a lockfile as a document. Lockfiles read from stdin are identified by name.
+func processLockfile(ctx context.Context, file lockfile, name string, storage pkg.Storage, changes *pkg.GraphChanges) (ingestStats, error) {
+	var (
+		data     []byte
+		err      error
+		dir      string
+		identity = name
+	)
+	if file.path == StdinPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file.path)
+	}
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	if file.path != StdinPath {
+		if dir, err = filepath.Abs(filepath.Dir(file.path)); err != nil {
+			return ingestStats{}, fmt.Errorf("failed to resolve the directory of the lockfile: %w", err)
+		}
+		identity = dir
+	}
+
+	graph, err := lockfileParsers[file.format](data, dir)
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("failed to parse %s: %w", file.format, err)
+	}
+	document := graph.document(file.format)
+	// Lockfiles of the same ecosystem in a directory describe the same project, so they replace each other
+	document.Metadata.Id = fmt.Sprintf("lockfile:%s:%s", lockfileEcosystems[file.format], identity)
+	return processSBOMDocument(ctx, document, storage, documentOptions{}, changes)
+}
+
+// dependencyGraph is the dependency tree of a project, read from a lockfile.
+type dependencyGraph struct {
+	// root is the purl of the project itself, if it's known.
+	root     string
+	packages map[string]*lockfilePackage
+	order    []string
+}
+
+// lockfilePackage is a package in a lockfile, identified by its purl.
+type lockfilePackage struct {
+	purl         string
+	name         string
+	version      string
+	dependencies []string
+}
+
+func newDependencyGraph() *dependencyGraph {
+	return &dependencyGraph{packages: map[string]*lockfilePackage{}}
+}
+
+// add adds a package to the graph, unless it's already there, and returns its purl.
+func (g *dependencyGraph) add(purlType, namespace, name, version string) string {
+	purl := packageurl.NewPackageURL(purlType, namespace, name, version, nil, "").ToString()
+	if _, ok := g.packages[purl]; !ok {
+		fullName := name
+		if namespace != "" {
+			fullName = namespace + "/" + name
+		}
+		g.packages[purl] = &lockfilePackage{purl: purl, name: fullName, version: version}
+		g.order = append(g.order, purl)
+	}
+	return purl
+}
+
+// setRoot adds the project's own package to the graph.
+func (g *dependencyGraph) setRoot(purlType, namespace, name, version string) string {
+	g.root = g.add(purlType, namespace, name, version)
+	return g.root
+}
+
+// depend records that the package from depends on the package to, both of which must have been added.
+func (g *dependencyGraph) depend(from, to string) {
+	if from == to {
+		return
+	}
+	dependent := g.packages[from]
+	if !slices.Contains(dependent.dependencies, to) {
+		dependent.dependencies = append(dependent.dependencies, to)
+	}
+}
+
+// ensureRoot makes sure the graph has a root when the lockfile doesn't name the project.
+// The root is named after the project's directory and depends on every package that nothing else depends on.
+func (g *dependencyGraph) ensureRoot(purlType, dir string) {
+	if g.root != "" {
+		return
+	}
+	claimed := map[string]bool{}
+	for _, p := range g.packages {
+		for _, dependency := range p.dependencies {
+			claimed[dependency] = true
+		}
+	}
+	packages := slices.Clone(g.order)
+	root := g.setRoot(purlType, "", projectName(dir), "")
+	for _, purl := range packages {
+		if !claimed[purl] {
+			g.depend(root, purl)
+		}
+	}
+}
+
+// projectName names a project that the lockfile doesn't name after its directory.
+func projectName(dir string) string {
+	name := filepath.Base(dir)
+	if dir == "" || name == "." || name == string(filepath.Separator) {
+		return "project"
+	}
+	return name
+}
+
+// document converts the graph into a SBOM document, so it's ingested the same way as SBOMs.
+func (g *dependencyGraph) document(format LockfileFormat) *sbom.Document {
+	document := sbom.NewDocument()
+	document.Metadata.Tools = append(document.Metadata.Tools, &sbom.Tool{Name: "minefield"})
+	if root, ok := g.packages[g.root]; ok {
+		document.Metadata.Name = fmt.Sprintf("%s %s", root.name, format)
+	}
+
+	for _, purl := range g.order {
+		p := g.packages[purl]
+		node := &sbom.Node{
+			Id:          purl,
+			Type:        sbom.Node_PACKAGE,
+			Name:        p.name,
+			Version:     p.version,
+			Identifiers: map[int32]string{int32(sbom.SoftwareIdentifierType_PURL): purl},
+		}
+		if purl == g.root {
+			document.NodeList.AddRootNode(node)
+		} else {
+			document.NodeList.AddNode(node)
+		}
+	}
+	for _, purl := range g.order {
+		for _, dependency := range g.packages[purl].dependencies {
+			document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: purl, To: []string{dependency}})
+		}
+	}
+	return document
+}
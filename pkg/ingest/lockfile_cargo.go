@@ -0,0 +1,62 @@
+package ingest
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseCargoLock reads a Cargo.lock file.
+// Packages without a source are the workspace's own crates, and the first of them is the root.
+func parseCargoLock(data []byte, dir string) (*dependencyGraph, error) {
+	var lock struct {
+		Package []struct {
+			Name         string   `toml:"name"`
+			Version      string   `toml:"version"`
+			Source       string   `toml:"source"`
+			Dependencies []string `toml:"dependencies"`
+		} `toml:"package"`
+	}
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	g := newDependencyGraph()
+	// Dependencies name a crate, adding its version and source only when several versions of it are locked
+	byName := map[string][]string{}
+	byVersion := map[string]string{}
+	var local []string
+	for _, p := range lock.Package {
+		purl := g.add("cargo", "", p.Name, p.Version)
+		byName[p.Name] = append(byName[p.Name], purl)
+		byVersion[p.Name+" "+p.Version] = purl
+		if p.Source == "" {
+			local = append(local, purl)
+		}
+	}
+	for _, p := range lock.Package {
+		from := byVersion[p.Name+" "+p.Version]
+		for _, dependency := range p.Dependencies {
+			fields := strings.Fields(dependency)
+			var (
+				to string
+				ok bool
+			)
+			switch {
+			case len(fields) >= 2:
+				to, ok = byVersion[fields[0]+" "+fields[1]]
+			case len(fields) == 1 && len(byName[fields[0]]) == 1:
+				to, ok = byName[fields[0]][0], true
+			}
+			if ok {
+				g.depend(from, to)
+			}
+		}
+	}
+
+	if len(local) == 1 {
+		g.root = local[0]
+	}
+	g.ensureRoot("cargo", dir)
+	return g, nil
+}
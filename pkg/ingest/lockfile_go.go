@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// goModule adds a Go module to the graph.
+func (g *dependencyGraph) goModule(modulePath, version string) string {
+	namespace, name := path.Split(modulePath)
+	return g.add("golang", strings.TrimSuffix(namespace, "/"), name, version)
+}
+
+// parseGoMod reads the main module and its requirements from a go.mod file, applying replacements.
+// go.mod only lists the requirements of the main module, use the output of go mod graph for the whole tree.
+func parseGoMod(data []byte, _ string) (*dependencyGraph, error) {
+	file, err := modfile.Parse("go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if file.Module == nil {
+		return nil, fmt.Errorf("go.mod has no module directive")
+	}
+
+	replacements := map[string]modfile.Replace{}
+	for _, replace := range file.Replace {
+		replacements[replace.Old.Path+"@"+replace.Old.Version] = *replace
+	}
+
+	g := newDependencyGraph()
+	root := g.goModule(file.Module.Mod.Path, "")
+	g.root = root
+	for _, require := range file.Require {
+		mod := require.Mod
+		replace, ok := replacements[mod.Path+"@"+mod.Version]
+		if !ok {
+			replace, ok = replacements[mod.Path+"@"]
+		}
+		if ok {
+			if replace.New.Version == "" {
+				// Replaced by a local directory, which isn't a published module
+				continue
+			}
+			mod = replace.New
+		}
+		g.depend(root, g.goModule(mod.Path, mod.Version))
+	}
+	return g, nil
+}
+
+// parseGoSum reads the modules in a go.sum file.
+// go.sum has no dependency edges, so the main module from the go.mod next to it depends on every module that is a requirement,
+// and the others are only added as nodes.
+func parseGoSum(data []byte, dir string) (*dependencyGraph, error) {
+	g := newDependencyGraph()
+	if dir != "" {
+		if goMod, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			if g, err = parseGoMod(goMod, dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed go.sum line %q", scanner.Text())
+		}
+		// Only the go.mod files of modules listed with a /go.mod suffix are downloaded, they aren't part of the build
+		if strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		g.goModule(fields[0], fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	g.ensureRoot("golang", dir)
+	return g, nil
+}
+
+// parseGoModGraph reads the module requirement graph printed by go mod graph.
+// Each line is a module followed by one of its requirements, where the main module has no version.
+func parseGoModGraph(data []byte, dir string) (*dependencyGraph, error) {
+	g := newDependencyGraph()
+	module := func(s string) (string, bool) {
+		modulePath, version, _ := strings.Cut(s, "@")
+		// The go and toolchain versions are listed as requirements too
+		if modulePath == "go" || modulePath == "toolchain" {
+			return "", false
+		}
+		return g.goModule(modulePath, version), true
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed go mod graph line %q", scanner.Text())
+		}
+		from, ok := module(fields[0])
+		if !ok {
+			continue
+		}
+		if g.root == "" && !strings.Contains(fields[0], "@") {
+			g.root = from
+		}
+		if to, ok := module(fields[1]); ok {
+			g.depend(from, to)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	g.ensureRoot("golang", dir)
+	return g, nil
+}
@@ -0,0 +1,540 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// npmPackage adds a npm package to the graph, splitting off its scope.
+func (g *dependencyGraph) npmPackage(name, version string) string {
+	namespace, base := "", name
+	if strings.HasPrefix(name, "@") {
+		if scope, rest, ok := strings.Cut(name, "/"); ok {
+			namespace, base = scope, rest
+		}
+	}
+	return g.add("npm", namespace, base, version)
+}
+
+// packageJSON is the part of a package.json file that names the project and its direct dependencies.
+type packageJSON struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// readPackageJSON reads the package.json in dir, returning nil if there isn't one.
+func readPackageJSON(dir string) (*packageJSON, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var manifest packageJSON
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse package.json: %w", err)
+	}
+	return &manifest, nil
+}
+
+// allDependencies returns the direct dependencies of a package.json, sorted by name.
+func (p *packageJSON) allDependencies() [][2]string {
+	var dependencies [][2]string
+	for _, section := range []map[string]string{p.Dependencies, p.DevDependencies, p.OptionalDependencies} {
+		for name, spec := range section {
+			dependencies = append(dependencies, [2]string{name, spec})
+		}
+	}
+	sort.Slice(dependencies, func(i, j int) bool { return dependencies[i][0] < dependencies[j][0] })
+	return dependencies
+}
+
+// packageLock is a package-lock.json or npm-shrinkwrap.json file.
+type packageLock struct {
+	Name            string                        `json:"name"`
+	Version         string                        `json:"version"`
+	LockfileVersion int                           `json:"lockfileVersion"`
+	Packages        map[string]packageLockEntry   `json:"packages"`
+	Dependencies    map[string]packageLockV1Entry `json:"dependencies"`
+}
+
+// packageLockEntry is a package in the packages section of lockfile versions 2 and 3, keyed by its location.
+type packageLockEntry struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Resolved             string            `json:"resolved"`
+	Link                 bool              `json:"link"`
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+}
+
+// packageLockV1Entry is a package in the nested dependencies section of lockfile version 1.
+type packageLockV1Entry struct {
+	Version      string                        `json:"version"`
+	Requires     map[string]string             `json:"requires"`
+	Dependencies map[string]packageLockV1Entry `json:"dependencies"`
+}
+
+// parsePackageLock reads the tree of installed packages from a package-lock.json file.
+// Dependencies are resolved the way node does, by looking in the node_modules directories from the dependent up to the root.
+func parsePackageLock(data []byte, dir string) (*dependencyGraph, error) {
+	var lock packageLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	packages := lock.Packages
+	if packages == nil {
+		// Lockfile version 1 nests packages instead of listing their locations, so flatten them into the same shape
+		packages = map[string]packageLockEntry{}
+		root := packageLockEntry{Name: lock.Name, Version: lock.Version}
+		if manifest, err := readPackageJSON(dir); err != nil {
+			return nil, err
+		} else if manifest != nil {
+			root.Dependencies, root.DevDependencies, root.OptionalDependencies = manifest.Dependencies, manifest.DevDependencies, manifest.OptionalDependencies
+		} else {
+			root.Dependencies = map[string]string{}
+			for name, entry := range lock.Dependencies {
+				root.Dependencies[name] = entry.Version
+			}
+		}
+		packages[""] = root
+		flattenPackageLockV1("", lock.Dependencies, packages)
+	}
+
+	// Workspaces are linked into node_modules, and listed under their own location
+	resolve := func(location string) (string, packageLockEntry, bool) {
+		entry, ok := packages[location]
+		for ok && entry.Link {
+			location = entry.Resolved
+			entry, ok = packages[location]
+		}
+		return location, entry, ok
+	}
+	nameOf := func(location string, entry packageLockEntry) string {
+		if entry.Name != "" {
+			return entry.Name
+		}
+		if i := strings.LastIndex(location, "node_modules/"); i >= 0 {
+			return location[i+len("node_modules/"):]
+		}
+		return filepath.Base(location)
+	}
+
+	g := newDependencyGraph()
+	purls := map[string]string{}
+	locations := sortedKeys(packages)
+	for _, location := range locations {
+		entry := packages[location]
+		if entry.Link {
+			continue
+		}
+		if location == "" {
+			name, version := entry.Name, entry.Version
+			if name == "" {
+				name, version = lock.Name, lock.Version
+			}
+			if name == "" {
+				continue
+			}
+			purls[location] = g.npmPackage(name, version)
+			g.root = purls[location]
+			continue
+		}
+		purls[location] = g.npmPackage(nameOf(location, entry), entry.Version)
+	}
+
+	for _, location := range locations {
+		entry := packages[location]
+		if entry.Link {
+			continue
+		}
+		from, ok := purls[location]
+		if !ok {
+			continue
+		}
+
+		sections := []map[string]string{entry.Dependencies, entry.OptionalDependencies, entry.PeerDependencies}
+		// Development dependencies are only installed for the project and its workspaces
+		if !strings.Contains(location, "node_modules/") {
+			sections = append(sections, entry.DevDependencies)
+		}
+		for _, section := range sections {
+			for _, name := range sortedKeys(section) {
+				dependency, ok := findNodeModule(location, name, resolve)
+				if !ok {
+					// Optional and peer dependencies may not be installed
+					continue
+				}
+				if to, ok := purls[dependency]; ok {
+					g.depend(from, to)
+				}
+			}
+		}
+	}
+
+	g.ensureRoot("npm", dir)
+	return g, nil
+}
+
+// findNodeModule finds where the package name required from location is installed.
+func findNodeModule(location, name string, resolve func(string) (string, packageLockEntry, bool)) (string, bool) {
+	for {
+		candidate := "node_modules/" + name
+		if location != "" {
+			candidate = location + "/node_modules/" + name
+		}
+		if resolved, _, ok := resolve(candidate); ok {
+			return resolved, true
+		}
+		if location == "" {
+			return "", false
+		}
+		if i := strings.LastIndex(location, "/node_modules/"); i >= 0 {
+			location = location[:i]
+		} else {
+			location = ""
+		}
+	}
+}
+
+func flattenPackageLockV1(location string, dependencies map[string]packageLockV1Entry, packages map[string]packageLockEntry) {
+	for name, entry := range dependencies {
+		child := "node_modules/" + name
+		if location != "" {
+			child = location + "/node_modules/" + name
+		}
+		packages[child] = packageLockEntry{Version: entry.Version, Dependencies: entry.Requires}
+		flattenPackageLockV1(child, entry.Dependencies, packages)
+	}
+}
+
+// yarnEntry is a resolved package in a yarn.lock file.
+type yarnEntry struct {
+	name         string
+	version      string
+	dependencies [][2]string
+}
+
+// parseYarnLock reads a yarn.lock file, either the classic format or the YAML format of yarn 2 and later.
+// The project and its direct dependencies are read from the package.json next to it.
+func parseYarnLock(data []byte, dir string) (*dependencyGraph, error) {
+	var (
+		entries map[string]*yarnEntry
+		err     error
+	)
+	berry := bytes.Contains(data, []byte("__metadata:"))
+	if berry {
+		entries, err = parseYarnBerryEntries(data)
+	} else {
+		entries, err = parseYarnClassicEntries(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Yarn 2 and later qualify descriptors with a protocol, which defaults to npm
+	lookup := func(name, spec string) (*yarnEntry, bool) {
+		if entry, ok := entries[name+"@"+spec]; ok {
+			return entry, true
+		}
+		entry, ok := entries[name+"@npm:"+spec]
+		return entry, ok
+	}
+
+	g := newDependencyGraph()
+	descriptors := sortedKeys(entries)
+
+	purls := map[*yarnEntry]string{}
+	for _, descriptor := range descriptors {
+		entry := entries[descriptor]
+		if _, ok := purls[entry]; !ok {
+			purls[entry] = g.npmPackage(entry.name, entry.version)
+		}
+	}
+	for _, descriptor := range descriptors {
+		entry := entries[descriptor]
+		for _, dependency := range entry.dependencies {
+			if to, ok := lookup(dependency[0], dependency[1]); ok {
+				g.depend(purls[entry], purls[to])
+			}
+		}
+	}
+
+	manifest, err := readPackageJSON(dir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil && manifest.Name != "" {
+		if workspace, ok := lookup(manifest.Name, "workspace:."); ok {
+			// Yarn 2 and later lock the project itself as a workspace
+			g.root = purls[workspace]
+		} else {
+			root := g.npmPackage(manifest.Name, manifest.Version)
+			g.root = root
+			for _, dependency := range manifest.allDependencies() {
+				if to, ok := lookup(dependency[0], dependency[1]); ok {
+					g.depend(root, purls[to])
+				}
+			}
+		}
+	}
+
+	g.ensureRoot("npm", dir)
+	return g, nil
+}
+
+// parseYarnClassicEntries reads the entries of a yarn 1 lockfile, keyed by each of their descriptors.
+func parseYarnClassicEntries(data []byte) (map[string]*yarnEntry, error) {
+	entries := map[string]*yarnEntry{}
+	var (
+		current        *yarnEntry
+		inDependencies bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		switch {
+		case indent == 0:
+			// A new entry, listing every descriptor that resolves to it
+			current = &yarnEntry{}
+			inDependencies = false
+			for _, descriptor := range strings.Split(strings.TrimSuffix(trimmed, ":"), ",") {
+				descriptor = unquote(strings.TrimSpace(descriptor))
+				name, _ := splitDescriptor(descriptor)
+				current.name = name
+				entries[descriptor] = current
+			}
+		case current == nil:
+			return nil, fmt.Errorf("unexpected line %q", line)
+		case indent == 2:
+			key, value, _ := strings.Cut(trimmed, " ")
+			inDependencies = key == "dependencies:" || key == "optionalDependencies:"
+			if key == "version" {
+				current.version = unquote(value)
+			}
+		case indent >= 4 && inDependencies:
+			name, spec, ok := strings.Cut(trimmed, " ")
+			if !ok {
+				return nil, fmt.Errorf("malformed dependency %q", line)
+			}
+			current.dependencies = append(current.dependencies, [2]string{unquote(name), unquote(spec)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parseYarnBerryEntries reads the entries of a yarn 2 or later lockfile, keyed by each of their descriptors.
+func parseYarnBerryEntries(data []byte) (map[string]*yarnEntry, error) {
+	var lock map[string]struct {
+		Version              string            `yaml:"version"`
+		Resolution           string            `yaml:"resolution"`
+		Dependencies         map[string]string `yaml:"dependencies"`
+		OptionalDependencies map[string]string `yaml:"optionalDependencies"`
+	}
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	entries := map[string]*yarnEntry{}
+	for key, value := range lock {
+		if key == "__metadata" {
+			continue
+		}
+		name, _ := splitDescriptor(value.Resolution)
+		entry := &yarnEntry{name: name, version: value.Version}
+		for _, section := range []map[string]string{value.Dependencies, value.OptionalDependencies} {
+			for dependency, spec := range section {
+				entry.dependencies = append(entry.dependencies, [2]string{dependency, spec})
+			}
+		}
+		for _, descriptor := range strings.Split(key, ",") {
+			descriptor = strings.TrimSpace(descriptor)
+			if entry.name == "" {
+				entry.name, _ = splitDescriptor(descriptor)
+			}
+			entries[descriptor] = entry
+		}
+	}
+	return entries, nil
+}
+
+// splitDescriptor splits a yarn descriptor such as @scope/name@^1.0.0 into the package name and the range.
+func splitDescriptor(descriptor string) (string, string) {
+	i := strings.LastIndex(descriptor, "@")
+	if i <= 0 {
+		return descriptor, ""
+	}
+	// The range can contain @ itself, as in name@npm:other@^1.0.0, so split at the first @ after the scope
+	if j := strings.Index(descriptor[1:], "@"); j >= 0 {
+		i = j + 1
+	}
+	return descriptor[:i], descriptor[i+1:]
+}
+
+func unquote(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return strings.Trim(s, `"`)
+}
+
+// pnpmLock is a pnpm-lock.yaml file, in any of the formats used by lockfile versions 5 to 9.
+type pnpmLock struct {
+	LockfileVersion      any                     `yaml:"lockfileVersion"`
+	Importers            map[string]pnpmImporter `yaml:"importers"`
+	Dependencies         map[string]any          `yaml:"dependencies"`
+	DevDependencies      map[string]any          `yaml:"devDependencies"`
+	OptionalDependencies map[string]any          `yaml:"optionalDependencies"`
+	Packages             map[string]pnpmPackage  `yaml:"packages"`
+	Snapshots            map[string]pnpmPackage  `yaml:"snapshots"`
+}
+
+type pnpmImporter struct {
+	Dependencies         map[string]any `yaml:"dependencies"`
+	DevDependencies      map[string]any `yaml:"devDependencies"`
+	OptionalDependencies map[string]any `yaml:"optionalDependencies"`
+}
+
+type pnpmPackage struct {
+	Name                 string            `yaml:"name"`
+	Version              string            `yaml:"version"`
+	Dependencies         map[string]string `yaml:"dependencies"`
+	OptionalDependencies map[string]string `yaml:"optionalDependencies"`
+}
+
+// parsePnpmLock reads a pnpm-lock.yaml file.
+// The root project's dependencies are in the importer for ".", or at the top level before lockfile version 9.
+func parsePnpmLock(data []byte, dir string) (*dependencyGraph, error) {
+	var lock pnpmLock
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	version, err := strconv.ParseFloat(fmt.Sprint(lock.LockfileVersion), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lockfileVersion %v", lock.LockfileVersion)
+	}
+	// Before version 6 packages are keyed as /name/version_peers, and as /name@version(peers) after
+	legacyKeys := version < 6
+
+	parseKey := func(key string) (string, string) {
+		key = strings.TrimPrefix(key, "/")
+		if legacyKeys {
+			i := strings.LastIndex(key, "/")
+			if i < 0 {
+				return key, ""
+			}
+			version, _, _ := strings.Cut(key[i+1:], "_")
+			return key[:i], version
+		}
+		key, _, _ = strings.Cut(key, "(")
+		i := strings.LastIndex(key, "@")
+		if i <= 0 {
+			return key, ""
+		}
+		return key[:i], key[i+1:]
+	}
+	// resolve returns the name and version a dependency's version refers to, which may be an aliased package key
+	resolve := func(name, version string) (string, string, bool) {
+		switch {
+		case strings.HasPrefix(version, "link:"), strings.HasPrefix(version, "file:"):
+			return "", "", false
+		case strings.HasPrefix(version, "/"):
+			name, version := parseKey(version)
+			return name, version, true
+		}
+		if legacyKeys {
+			version, _, _ = strings.Cut(version, "_")
+		} else {
+			version, _, _ = strings.Cut(version, "(")
+			// Aliases reference the real package as name@version
+			if i := strings.LastIndex(version, "@"); i > 0 {
+				return version[:i], version[i+1:], true
+			}
+		}
+		return name, version, true
+	}
+
+	g := newDependencyGraph()
+	packages := lock.Snapshots
+	if packages == nil {
+		packages = lock.Packages
+	}
+	for _, key := range sortedKeys(packages) {
+		name, version := parseKey(key)
+		if pkg := lock.Packages[key]; pkg.Name != "" {
+			name, version = pkg.Name, pkg.Version
+		}
+		from := g.npmPackage(name, version)
+		for _, section := range []map[string]string{packages[key].Dependencies, packages[key].OptionalDependencies} {
+			for _, dependency := range sortedKeys(section) {
+				if name, version, ok := resolve(dependency, section[dependency]); ok {
+					g.depend(from, g.npmPackage(name, version))
+				}
+			}
+		}
+	}
+
+	root, ok := lock.Importers["."]
+	if !ok {
+		root = pnpmImporter{Dependencies: lock.Dependencies, DevDependencies: lock.DevDependencies, OptionalDependencies: lock.OptionalDependencies}
+	}
+	manifest, err := readPackageJSON(dir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil && manifest.Name != "" {
+		g.root = g.npmPackage(manifest.Name, manifest.Version)
+	} else {
+		g.setRoot("npm", "", projectName(dir), "")
+	}
+	for _, section := range []map[string]any{root.Dependencies, root.DevDependencies, root.OptionalDependencies} {
+		for _, dependency := range sortedKeys(section) {
+			// Version 6 and later record the specifier along with the version
+			version := fmt.Sprint(section[dependency])
+			if spec, ok := section[dependency].(map[string]any); ok {
+				version = fmt.Sprint(spec["version"])
+			}
+			if name, version, ok := resolve(dependency, version); ok {
+				g.depend(g.root, g.npmPackage(name, version))
+			}
+		}
+	}
+	return g, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// pypiNameSeparators are the characters PyPI treats as equivalent in package names.
+var pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// pypiPackage adds a PyPI package to the graph, normalizing its name.
+func (g *dependencyGraph) pypiPackage(name, version string) string {
+	return g.add("pypi", "", pypiName(name), version)
+}
+
+// parsePoetryLock reads a poetry.lock file.
+// The project and its direct dependencies are read from the pyproject.toml next to it.
+func parsePoetryLock(data []byte, dir string) (*dependencyGraph, error) {
+	var lock struct {
+		Package []struct {
+			Name         string         `toml:"name"`
+			Version      string         `toml:"version"`
+			Dependencies map[string]any `toml:"dependencies"`
+		} `toml:"package"`
+	}
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	g := newDependencyGraph()
+	purls := map[string]string{}
+	for _, p := range lock.Package {
+		purls[pypiNameSeparators.ReplaceAllString(strings.ToLower(p.Name), "-")] = g.pypiPackage(p.Name, p.Version)
+	}
+	lookup := func(name string) (string, bool) {
+		purl, ok := purls[pypiNameSeparators.ReplaceAllString(strings.ToLower(name), "-")]
+		return purl, ok
+	}
+	for _, p := range lock.Package {
+		from, _ := lookup(p.Name)
+		for _, dependency := range sortedKeys(p.Dependencies) {
+			// Dependencies on packages that aren't locked, such as ones for other platforms, are skipped
+			if to, ok := lookup(dependency); ok {
+				g.depend(from, to)
+			}
+		}
+	}
+
+	project, err := readPyproject(dir)
+	if err != nil {
+		return nil, err
+	}
+	if project != nil && project.name != "" {
+		root := g.pypiPackage(project.name, project.version)
+		g.root = root
+		for _, dependency := range project.dependencies {
+			if to, ok := lookup(dependency); ok {
+				g.depend(root, to)
+			}
+		}
+	}
+
+	g.ensureRoot("pypi", dir)
+	return g, nil
+}
+
+type pyproject struct {
+	name         string
+	version      string
+	dependencies []string
+}
+
+// pep508Name matches the package name at the start of a PEP 508 requirement.
+var pep508Name = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+
+// readPyproject reads the project in the pyproject.toml in dir, returning nil if there isn't one.
+// Both the [tool.poetry] table and the standard [project] table are supported.
+func readPyproject(dir string) (*pyproject, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "pyproject.toml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Project struct {
+			Name                 string              `toml:"name"`
+			Version              string              `toml:"version"`
+			Dependencies         []string            `toml:"dependencies"`
+			OptionalDependencies map[string][]string `toml:"optional-dependencies"`
+		} `toml:"project"`
+		Tool struct {
+			Poetry struct {
+				Name            string         `toml:"name"`
+				Version         string         `toml:"version"`
+				Dependencies    map[string]any `toml:"dependencies"`
+				DevDependencies map[string]any `toml:"dev-dependencies"`
+				Group           map[string]struct {
+					Dependencies map[string]any `toml:"dependencies"`
+				} `toml:"group"`
+			} `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse pyproject.toml: %w", err)
+	}
+
+	project := &pyproject{name: file.Project.Name, version: file.Project.Version}
+	requirements := file.Project.Dependencies
+	for _, extra := range sortedKeys(file.Project.OptionalDependencies) {
+		requirements = append(requirements, file.Project.OptionalDependencies[extra]...)
+	}
+	for _, requirement := range requirements {
+		if name := pep508Name.FindString(strings.TrimSpace(requirement)); name != "" {
+			project.dependencies = append(project.dependencies, name)
+		}
+	}
+
+	poetry := file.Tool.Poetry
+	if project.name == "" {
+		project.name, project.version = poetry.Name, poetry.Version
+	}
+	sections := []map[string]any{poetry.Dependencies, poetry.DevDependencies}
+	for _, group := range sortedKeys(poetry.Group) {
+		sections = append(sections, poetry.Group[group].Dependencies)
+	}
+	for _, section := range sections {
+		for _, name := range sortedKeys(section) {
+			// Poetry lists the supported Python versions as a dependency
+			if strings.EqualFold(name, "python") {
+				continue
+			}
+			project.dependencies = append(project.dependencies, name)
+		}
+	}
+	return project, nil
+}
@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// gemPlatforms are the platform suffixes of gem versions, as in nokogiri (1.16.0-x86_64-linux).
+var gemPlatforms = []string{"-x86", "-x64", "-arm", "-aarch64", "-universal", "-java", "-mswin", "-mingw", "-darwin"}
+
+// parseGemfileLock reads a Gemfile.lock file.
+// Gems from the PATH source at the project's own directory are the project itself, which depends on the gems listed under DEPENDENCIES.
+func parseGemfileLock(data []byte, dir string) (*dependencyGraph, error) {
+	type gem struct {
+		name         string
+		version      string
+		local        bool
+		dependencies []string
+	}
+
+	var (
+		gems       []*gem
+		direct     []string
+		section    string
+		remote     string
+		current    *gem
+		lineNumber int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		trimmed := strings.TrimSpace(line)
+
+		if indent == 0 {
+			section, remote, current = trimmed, "", nil
+			continue
+		}
+		switch section {
+		case "GEM", "PATH", "GIT":
+			switch {
+			case indent == 2 && strings.HasPrefix(trimmed, "remote:"):
+				remote = strings.TrimSpace(strings.TrimPrefix(trimmed, "remote:"))
+			case indent == 4:
+				name, version, ok := parseGemSpec(trimmed)
+				if !ok {
+					return nil, fmt.Errorf("malformed gem on line %d: %q", lineNumber, line)
+				}
+				current = &gem{name: name, version: version, local: section == "PATH" && remote == "."}
+				gems = append(gems, current)
+			case indent == 6 && current != nil:
+				name, _, _ := parseGemSpec(trimmed)
+				current.dependencies = append(current.dependencies, name)
+			}
+		case "DEPENDENCIES":
+			if indent == 2 {
+				name, _, _ := parseGemSpec(trimmed)
+				direct = append(direct, strings.TrimSuffix(name, "!"))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	g := newDependencyGraph()
+	purls := map[string]string{}
+	for _, gem := range gems {
+		purl := g.add("gem", "", gem.name, gem.version)
+		// Platform specific builds of the same gem are the same package
+		if _, ok := purls[gem.name]; !ok {
+			purls[gem.name] = purl
+		}
+		if gem.local && g.root == "" {
+			g.root = purl
+		}
+	}
+	for _, gem := range gems {
+		for _, dependency := range gem.dependencies {
+			if to, ok := purls[dependency]; ok {
+				g.depend(purls[gem.name], to)
+			}
+		}
+	}
+
+	if g.root == "" && len(direct) > 0 {
+		g.setRoot("gem", "", projectName(dir), "")
+	}
+	for _, name := range direct {
+		if to, ok := purls[name]; ok {
+			g.depend(g.root, to)
+		}
+	}
+	g.ensureRoot("gem", dir)
+	return g, nil
+}
+
+// parseGemSpec parses a gem as listed in a Gemfile.lock, like rack (3.0.8) or rack (~> 3.0), stripping the version's platform.
+func parseGemSpec(spec string) (string, string, bool) {
+	name, version, ok := strings.Cut(spec, " ")
+	if !ok {
+		return name, "", true
+	}
+	if !strings.HasPrefix(version, "(") || !strings.HasSuffix(version, ")") {
+		return "", "", false
+	}
+	version = strings.TrimSuffix(strings.TrimPrefix(version, "("), ")")
+	for _, platform := range gemPlatforms {
+		if i := strings.Index(version, platform); i > 0 {
+			version = version[:i]
+			break
+		}
+	}
+	return name, version, true
+}
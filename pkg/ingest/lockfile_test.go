@@ -0,0 +1,217 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLockfiles(t *testing.T) {
+	tests := []struct {
+		path  string
+		root  string
+		edges map[string][]string
+	}{
+		{
+			path: "gomod/go.mod",
+			root: "pkg:golang/example.com/app",
+			edges: map[string][]string{
+				"pkg:golang/example.com/app": {"pkg:golang/github.com/pkg/errors@v0.9.1", "pkg:golang/golang.org/x/text@v0.15.0"},
+			},
+		},
+		{
+			path: "gomod/go.sum",
+			root: "pkg:golang/example.com/app",
+			edges: map[string][]string{
+				"pkg:golang/example.com/app": {"pkg:golang/github.com/pkg/errors@v0.9.1", "pkg:golang/golang.org/x/text@v0.15.0"},
+			},
+		},
+		{
+			path: "gomod/go.mod.graph",
+			root: "pkg:golang/example.com/app",
+			edges: map[string][]string{
+				"pkg:golang/example.com/app":           {"pkg:golang/github.com/pkg/errors@v0.9.1", "pkg:golang/golang.org/x/text@v0.15.0"},
+				"pkg:golang/golang.org/x/text@v0.15.0": {"pkg:golang/golang.org/x/tools@v0.1.0"},
+			},
+		},
+		{
+			path: "npm/package-lock.json",
+			root: "pkg:npm/app@1.0.0",
+			edges: map[string][]string{
+				"pkg:npm/app@1.0.0":           {"pkg:npm/%40scope/util@2.1.0", "pkg:npm/left-pad@1.3.0", "pkg:npm/jest@29.7.0"},
+				"pkg:npm/%40scope/util@2.1.0": {"pkg:npm/left-pad@1.1.0"},
+				"pkg:npm/ui@0.1.0":            {"pkg:npm/left-pad@1.3.0"},
+			},
+		},
+		{
+			path: "npmv1/package-lock.json",
+			root: "pkg:npm/legacy@1.0.0",
+			edges: map[string][]string{
+				"pkg:npm/legacy@1.0.0": {"pkg:npm/debug@4.3.4", "pkg:npm/ms@2.1.2"},
+				"pkg:npm/debug@4.3.4":  {"pkg:npm/ms@2.1.2"},
+			},
+		},
+		{
+			path: "yarn/yarn.lock",
+			root: "pkg:npm/app@1.0.0",
+			edges: map[string][]string{
+				"pkg:npm/app@1.0.0":            {"pkg:npm/%40babel/core@7.24.0", "pkg:npm/debug@4.3.4"},
+				"pkg:npm/%40babel/core@7.24.0": {"pkg:npm/debug@4.3.4"},
+				"pkg:npm/debug@4.3.4":          {"pkg:npm/ms@2.1.2"},
+			},
+		},
+		{
+			path: "berry/yarn.lock",
+			root: "pkg:npm/app@0.0.0-use.local",
+			edges: map[string][]string{
+				"pkg:npm/app@0.0.0-use.local": {"pkg:npm/debug@4.3.4"},
+				"pkg:npm/debug@4.3.4":         {"pkg:npm/ms@2.1.2"},
+			},
+		},
+		{
+			path: "pnpm/pnpm-lock.yaml",
+			root: "pkg:npm/pnpm",
+			edges: map[string][]string{
+				"pkg:npm/pnpm":        {"pkg:npm/debug@4.3.4", "pkg:npm/%40types/ms@0.7.34"},
+				"pkg:npm/debug@4.3.4": {"pkg:npm/ms@2.1.2", "pkg:npm/supports-color@9.4.0"},
+			},
+		},
+		{
+			path: "pnpm9/pnpm-lock.yaml",
+			root: "pkg:npm/%40example/app@2.0.0",
+			edges: map[string][]string{
+				"pkg:npm/%40example/app@2.0.0": {"pkg:npm/debug@4.3.4", "pkg:npm/ms@2.1.2"},
+				"pkg:npm/debug@4.3.4":          {"pkg:npm/ms@2.1.2"},
+			},
+		},
+		{
+			path: "poetry/poetry.lock",
+			root: "pkg:pypi/app@0.1.0",
+			edges: map[string][]string{
+				"pkg:pypi/app@0.1.0":       {"pkg:pypi/requests@2.31.0", "pkg:pypi/pytest@8.1.1"},
+				"pkg:pypi/requests@2.31.0": {"pkg:pypi/certifi@2024.2.2", "pkg:pypi/charset-normalizer@3.3.2"},
+			},
+		},
+		{
+			path: "cargo/Cargo.lock",
+			root: "pkg:cargo/app@0.1.0",
+			edges: map[string][]string{
+				"pkg:cargo/app@0.1.0":     {"pkg:cargo/rand@0.8.5", "pkg:cargo/serde@1.0.197"},
+				"pkg:cargo/serde@1.0.197": {"pkg:cargo/rand@0.7.3"},
+			},
+		},
+		{
+			path: "gem/Gemfile.lock",
+			root: "pkg:gem/app@0.1.0",
+			edges: map[string][]string{
+				"pkg:gem/app@0.1.0":       {"pkg:gem/rack@3.0.8", "pkg:gem/nokogiri@1.16.0"},
+				"pkg:gem/nokogiri@1.16.0": {"pkg:gem/racc@1.7.3"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			path := filepath.Join("testdata", "lockfiles", test.path)
+			format, err := DetectLockfileFormat(path)
+			require.NoError(t, err)
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			g, err := lockfileParsers[format](data, filepath.Dir(path))
+			require.NoError(t, err)
+			assert.Equal(t, test.root, g.root)
+
+			edges := map[string][]string{}
+			for _, purl := range g.order {
+				if dependencies := g.packages[purl].dependencies; len(dependencies) > 0 {
+					edges[purl] = dependencies
+				}
+			}
+			for from, to := range test.edges {
+				assert.ElementsMatch(t, to, edges[from], from)
+			}
+			assert.Len(t, edges, len(test.edges))
+		})
+	}
+}
+
+func TestLockfile(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	report, err := Lockfile(ctx, filepath.Join("testdata", "lockfiles"), storage, LockfileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 10, report.Files)
+
+	// The preferred lockfile of the Go module is the module graph
+	node, err := storage.NameToID(ctx, "pkg:golang/golang.org/x/tools@v0.1.0")
+	require.NoError(t, err)
+	dependents, err := storage.GetNode(ctx, node)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), dependents.Parents.GetCardinality())
+
+	// Ingesting the same lockfile again doesn't change the graph
+	report, err = Lockfile(ctx, filepath.Join("testdata", "lockfiles", "cargo", "Cargo.lock"), storage, LockfileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Edges)
+	assert.Equal(t, 0, report.RemovedEdges)
+
+	_, err = Lockfile(ctx, filepath.Join("testdata", "lockfiles", "cargo", "Cargo.lock"), storage, LockfileOptions{Format: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestLockfilesPolyglot(t *testing.T) {
+	// A directory with a Go module, a JavaScript package locked twice and a Rust crate
+	dir := t.TempDir()
+	for _, file := range []string{"gomod/go.mod", "gomod/go.sum", "npm/package-lock.json", "yarn/yarn.lock", "cargo/Cargo.lock"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "lockfiles", file))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(file)), data, 0o600))
+	}
+
+	files, err := lockfiles(dir, "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []lockfile{
+		{path: filepath.Join(dir, "go.mod"), format: GoModFormat},
+		{path: filepath.Join(dir, "package-lock.json"), format: PackageLockFormat},
+		{path: filepath.Join(dir, "Cargo.lock"), format: CargoLockFormat},
+	}, files)
+
+	report, err := Lockfile(context.Background(), dir, pkg.NewMemoryStorage(), LockfileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Files)
+}
+
+func TestLockfileIdentity(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	// Unrelated projects in directories with the same name are named the same, but are different documents
+	dir := t.TempDir()
+	for _, module := range []string{"a", "b"} {
+		project := filepath.Join(dir, module, "service")
+		require.NoError(t, os.MkdirAll(project, 0o700))
+		sum := fmt.Sprintf("example.com/%s v1.0.0 h1:abc=\n", module)
+		require.NoError(t, os.WriteFile(filepath.Join(project, "go.sum"), []byte(sum), 0o600))
+		report, err := Lockfile(ctx, filepath.Join(project, "go.sum"), storage, LockfileOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.RemovedEdges)
+	}
+
+	root, err := storage.NameToID(ctx, "pkg:golang/service")
+	require.NoError(t, err)
+	node, err := storage.GetNode(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), node.Children.GetCardinality())
+	_, err = storage.NameToID(ctx, "document:lockfile:golang:"+filepath.Join(dir, "a", "service"))
+	assert.NoError(t, err)
+
+	_, err = Lockfile(ctx, StdinPath, storage, LockfileOptions{Format: GoSumFormat})
+	assert.ErrorContains(t, err, "name is required")
+}
@@ -0,0 +1,411 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of OSVClientOptions.
+const (
+	DefaultOSVURL         = "https://api.osv.dev"
+	DefaultOSVBatchSize   = 1000
+	DefaultOSVConcurrency = 4
+	DefaultOSVRetries     = 5
+	DefaultOSVTimeout     = time.Minute
+	defaultOSVBackoff     = time.Second
+	maxOSVBackoff         = time.Minute
+)
+
+// OSVClientOptions configures how OSV is queried. Zero values use the defaults.
+type OSVClientOptions struct {
+	// BaseURL is the OSV API to query, such as a mirror of api.osv.dev.
+	BaseURL string
+	// HTTPClient sends the requests. The default times out after DefaultOSVTimeout.
+	HTTPClient *http.Client
+	// BatchSize is the number of queries sent in each querybatch request, at most the 1000 OSV allows.
+	BatchSize int
+	// Concurrency is the number of requests sent at once.
+	Concurrency int
+	// Retries is how many times a request is retried after it is rate limited or fails with a server or network error.
+	// Retries are spaced with exponential backoff starting at Backoff, unless the server asks for a delay with Retry-After.
+	Retries int
+	Backoff time.Duration
+	// CacheDir, if set, is a directory responses are cached in for CacheTTL, or forever if CacheTTL is zero.
+	CacheDir string
+	CacheTTL time.Duration
+}
+
+// OSVClient queries the OSV API in batches.
+type OSVClient struct {
+	opts OSVClientOptions
+}
+
+// NewOSVClient returns a client for the OSV API.
+func NewOSVClient(opts OSVClientOptions) *OSVClient {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultOSVURL
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: DefaultOSVTimeout}
+	}
+	if opts.BatchSize <= 0 || opts.BatchSize > DefaultOSVBatchSize {
+		opts.BatchSize = DefaultOSVBatchSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultOSVConcurrency
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultOSVBackoff
+	}
+	return &OSVClient{opts: opts}
+}
+
+// osvBatchQuery is a query with the token of the page of results to get.
+type osvBatchQuery struct {
+	Query
+	PageToken string `json:"page_token,omitempty"`
+}
+
+type osvBatchResponse struct {
+	Results []struct {
+		Vulns         []Vulnerability `json:"vulns"`
+		NextPageToken string          `json:"next_page_token"`
+	} `json:"results"`
+}
+
+// Query returns the vulnerabilities of each query, in the same order as the queries.
+// Queries are sent in batches, following page tokens until every query has all of its results.
+func (c *OSVClient) Query(ctx context.Context, queries []Query) ([][]Vulnerability, error) {
+	results := make([][]Vulnerability, len(queries))
+	var pending []int
+	for i, query := range queries {
+		var vulns []Vulnerability
+		if c.cached(queryCacheKey(query), &vulns) {
+			results[i] = vulns
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	pageTokens := make([]string, len(queries))
+	for len(pending) > 0 {
+		var (
+			mu       sync.Mutex
+			next     []int
+			firstErr error
+		)
+		batchCtx, cancel := context.WithCancel(ctx)
+		semaphore := make(chan struct{}, c.opts.Concurrency)
+		var wg sync.WaitGroup
+		for start := 0; start < len(pending); start += c.opts.BatchSize {
+			batch := pending[start:min(start+c.opts.BatchSize, len(pending))]
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				request := make([]osvBatchQuery, len(batch))
+				for i, index := range batch {
+					request[i] = osvBatchQuery{Query: queries[index], PageToken: pageTokens[index]}
+				}
+				response, err := c.queryBatch(batchCtx, request)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					return
+				}
+				for i, index := range batch {
+					results[index] = append(results[index], response.Results[i].Vulns...)
+					pageTokens[index] = response.Results[i].NextPageToken
+					if pageTokens[index] != "" {
+						next = append(next, index)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		cancel()
+		if firstErr != nil {
+			return nil, firstErr
+		}
+
+		// Queries are cached once they have all of their results
+		for _, index := range pending {
+			if pageTokens[index] == "" {
+				if err := c.cache(queryCacheKey(queries[index]), results[index]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		pending = next
+	}
+	return results, nil
+}
+
+// queryBatch sends a querybatch request.
+func (c *OSVClient) queryBatch(ctx context.Context, queries []osvBatchQuery) (*osvBatchResponse, error) {
+	body, err := json.Marshal(map[string]any{"queries": queries})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+	var response osvBatchResponse
+	if err := c.request(ctx, http.MethodPost, "/v1/querybatch", body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Results) != len(queries) {
+		return nil, fmt.Errorf("OSV returned %d results for %d queries", len(response.Results), len(queries))
+	}
+	return &response, nil
+}
+
+// FetchVulnerabilities returns the full records of vulnerabilities, in the same order, as Query only returns their IDs.
+// Each record is fetched once however many times it's listed, and cached records are used unless they're older than the vulnerability.
+func (c *OSVClient) FetchVulnerabilities(ctx context.Context, vulns []Vulnerability) ([]Vulnerability, error) {
+	records := map[string]*Vulnerability{}
+	var pending []Vulnerability
+	for _, vuln := range vulns {
+		if _, ok := records[vuln.ID]; ok {
+			continue
+		}
+		var cached Vulnerability
+		if c.cached("vuln\n"+vuln.ID, &cached) && !cached.Modified.Before(vuln.Modified) {
+			records[vuln.ID] = &cached
+			continue
+		}
+		records[vuln.ID] = nil
+		pending = append(pending, vuln)
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	semaphore := make(chan struct{}, c.opts.Concurrency)
+	for _, vuln := range pending {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			var record Vulnerability
+			err := c.request(fetchCtx, http.MethodGet, "/v1/vulns/"+url.PathEscape(vuln.ID), nil, &record)
+			if err == nil {
+				err = c.cache("vuln\n"+vuln.ID, record)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to get vulnerability %s: %w", vuln.ID, err)
+					cancel()
+				}
+				return
+			}
+			records[vuln.ID] = &record
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	result := make([]Vulnerability, len(vulns))
+	for i, vuln := range vulns {
+		result[i] = *records[vuln.ID]
+	}
+	return result, nil
+}
+
+// request sends a request to the OSV API and decodes the response,
+// retrying the request if it is rate limited or fails with a server or network error.
+func (c *OSVClient) request(ctx context.Context, method, path string, body []byte, response any) error {
+	backoff := c.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		wait, err := c.send(ctx, method, path, body, response)
+		if err == nil {
+			return nil
+		}
+		var retryable *osvRetryableError
+		if !errors.As(err, &retryable) || attempt >= c.opts.Retries {
+			return err
+		}
+
+		delay := backoff
+		if wait > 0 {
+			delay = wait
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, maxOSVBackoff)
+	}
+}
+
+// osvRetryableError is a failed request that may succeed if it is sent again.
+type osvRetryableError struct {
+	err error
+}
+
+func (e *osvRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *osvRetryableError) Unwrap() error {
+	return e.err
+}
+
+// send sends a request to the OSV API, returning how long the server asked to wait before retrying if it did.
+func (c *OSVClient) send(ctx context.Context, method, path string, body []byte, response any) (time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.opts.BaseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, &osvRetryableError{fmt.Errorf("failed to query OSV at %s: %w", c.opts.BaseURL, err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		err := fmt.Errorf("OSV query failed with status %s", resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return retryAfter(resp.Header.Get("Retry-After")), &osvRetryableError{err}
+		}
+		return 0, err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return 0, fmt.Errorf("failed to decode OSV response: %w", err)
+	}
+	return 0, nil
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or a date.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return min(time.Duration(seconds)*time.Second, maxOSVBackoff)
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return min(max(time.Until(date), 0), maxOSVBackoff)
+	}
+	return 0
+}
+
+// osvCacheEntry is a cached response.
+type osvCacheEntry struct {
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// cachePath returns the file a response is cached in, named after the hash of its key and the API it came from.
+func (c *OSVClient) cachePath(key string) string {
+	hash := sha256.Sum256([]byte(c.opts.BaseURL + "\n" + key))
+	return filepath.Join(c.opts.CacheDir, fmt.Sprintf("%x.json", hash))
+}
+
+// queryCacheKey returns the key the response to a query is cached under.
+func queryCacheKey(query Query) string {
+	// A query is only strings, so it always marshals
+	data, _ := json.Marshal(query)
+	return "query\n" + string(data)
+}
+
+// cached decodes the cached response with the given key into value, if there is one that hasn't expired.
+// An unreadable cache entry is treated as missing, and replaced once the request is sent again.
+func (c *OSVClient) cached(key string, value any) bool {
+	if c.opts.CacheDir == "" {
+		return false
+	}
+	data, err := os.ReadFile(c.cachePath(key))
+	if err != nil {
+		return false
+	}
+	var entry osvCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false
+	}
+	if c.opts.CacheTTL > 0 && time.Since(entry.FetchedAt) > c.opts.CacheTTL {
+		return false
+	}
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+func (c *OSVClient) cache(key string, value any) error {
+	if c.opts.CacheDir == "" {
+		return nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal OSV response: %w", err)
+	}
+	data, err := json.Marshal(osvCacheEntry{FetchedAt: time.Now(), Value: encoded})
+	if err != nil {
+		return fmt.Errorf("failed to marshal OSV response: %w", err)
+	}
+	if err := os.MkdirAll(c.opts.CacheDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create OSV cache: %w", err)
+	}
+	// Write the entry atomically, so concurrent runs sharing a cache never read half an entry
+	tmp, err := os.CreateTemp(c.opts.CacheDir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write OSV cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write OSV cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write OSV cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.cachePath(key)); err != nil {
+		return fmt.Errorf("failed to write OSV cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOSV serves querybatch requests, returning one vulnerability per page named after the package,
+// with two pages for lodash, and serves the records of those vulnerabilities. The first failures requests are rate limited.
+type fakeOSV struct {
+	requests atomic.Int32
+	queries  atomic.Int32
+	fetches  atomic.Int32
+	failures int32
+}
+
+// fakeOSVAliases are the aliases of the vulnerabilities fakeOSV serves, making OSV-lodash-2 and OSV-express the same vulnerability.
+var fakeOSVAliases = map[string][]string{
+	"OSV-lodash-2": {"CVE-2024-0001"},
+	"OSV-express":  {"CVE-2024-0001", "GHSA-0001"},
+}
+
+func (f *fakeOSV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if id, ok := strings.CutPrefix(r.URL.Path, "/v1/vulns/"); ok && r.Method == http.MethodGet {
+		f.fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(Vulnerability{
+			ID:       id,
+			Aliases:  fakeOSVAliases[id],
+			Summary:  "Summary of " + id,
+			Severity: []pkg.VulnerabilitySeverity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N"}},
+		})
+		return
+	}
+	if r.URL.Path != "/v1/querybatch" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	if f.requests.Add(1) <= f.failures {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	var request struct {
+		Queries []osvBatchQuery `json:"queries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.queries.Add(int32(len(request.Queries)))
+
+	type result struct {
+		Vulns         []Vulnerability `json:"vulns,omitempty"`
+		NextPageToken string          `json:"next_page_token,omitempty"`
+	}
+	results := make([]result, len(request.Queries))
+	for i, query := range request.Queries {
+		name := query.Package.Name
+		switch {
+		case name == "lodash" && query.PageToken == "":
+			results[i] = result{Vulns: []Vulnerability{{ID: "OSV-lodash-1"}}, NextPageToken: "page2"}
+		case name == "lodash":
+			results[i] = result{Vulns: []Vulnerability{{ID: "OSV-lodash-2"}}}
+		case name != "safe":
+			results[i] = result{Vulns: []Vulnerability{{ID: "OSV-" + name}}}
+		}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+func TestOSVClientQuery(t *testing.T) {
+	ctx := context.Background()
+	osv := &fakeOSV{failures: 2}
+	server := httptest.NewServer(osv)
+	defer server.Close()
+
+	queries := []Query{
+		{Package: Package{Name: "lodash", Ecosystem: "npm"}, Version: "4.17.20"},
+		{Package: Package{Name: "express", Ecosystem: "npm"}, Version: "4.0.0"},
+		{Package: Package{Name: "safe", Ecosystem: "npm"}, Version: "1.0.0"},
+	}
+	want := [][]Vulnerability{
+		{{ID: "OSV-lodash-1"}, {ID: "OSV-lodash-2"}},
+		{{ID: "OSV-express"}},
+		nil,
+	}
+
+	cacheDir := t.TempDir()
+	client := NewOSVClient(OSVClientOptions{BaseURL: server.URL + "/", BatchSize: 2, Concurrency: 2, Retries: 3, Backoff: time.Millisecond, CacheDir: cacheDir, CacheTTL: time.Hour})
+	results, err := client.Query(ctx, queries)
+	require.NoError(t, err)
+	assert.Equal(t, want, results)
+	// Two batches, a second page for lodash, and the rate limited requests
+	assert.Equal(t, int32(5), osv.requests.Load())
+	assert.Equal(t, int32(4), osv.queries.Load())
+
+	// Cached responses are used until they expire
+	results, err = client.Query(ctx, queries)
+	require.NoError(t, err)
+	assert.Equal(t, want, results)
+	assert.Equal(t, int32(5), osv.requests.Load())
+
+	expired := NewOSVClient(OSVClientOptions{BaseURL: server.URL, CacheDir: cacheDir, CacheTTL: time.Nanosecond})
+	results, err = expired.Query(ctx, queries)
+	require.NoError(t, err)
+	assert.Equal(t, want, results)
+	assert.Equal(t, int32(7), osv.requests.Load())
+}
+
+func TestOSVClientErrors(t *testing.T) {
+	ctx := context.Background()
+	queries := []Query{{Package: Package{Name: "lodash", Ecosystem: "npm"}, Version: "4.17.20"}}
+
+	// Requests are retried until the retries run out
+	osv := &fakeOSV{failures: 10}
+	server := httptest.NewServer(osv)
+	defer server.Close()
+	_, err := NewOSVClient(OSVClientOptions{BaseURL: server.URL, Retries: 2, Backoff: time.Millisecond}).Query(ctx, queries)
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), osv.requests.Load())
+
+	// Client errors aren't retried
+	var requests atomic.Int32
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer badRequest.Close()
+	_, err = NewOSVClient(OSVClientOptions{BaseURL: badRequest.URL, Retries: 2, Backoff: time.Millisecond}).Query(ctx, queries)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestVulnerabilitiesWithClient(t *testing.T) {
+	ctx := context.Background()
+	osv := &fakeOSV{}
+	server := httptest.NewServer(osv)
+	defer server.Close()
+
+	storage := pkg.NewMemoryStorage()
+	lodash, err := pkg.AddNode(ctx, storage, "PACKAGE", nil, "pkg:npm/lodash@4.17.20")
+	require.NoError(t, err)
+	express, err := pkg.AddNode(ctx, storage, "PACKAGE", nil, "pkg:npm/express@4.0.0")
+	require.NoError(t, err)
+	_, err = pkg.AddNode(ctx, storage, "PACKAGE", nil, "pkg:npm/safe@1.0.0")
+	require.NoError(t, err)
+	_, err = pkg.AddNode(ctx, storage, "PACKAGE", nil, "pkg:unknown/thing@1.0.0")
+	require.NoError(t, err)
+
+	require.NoError(t, VulnerabilitiesWithClient(ctx, storage, NewOSVClient(OSVClientOptions{BaseURL: server.URL}), nil))
+	assert.Equal(t, int32(2), osv.requests.Load())
+	assert.Equal(t, int32(3), osv.fetches.Load())
+
+	vulnerabilities := func(node *pkg.Node) []string {
+		node, err := storage.GetNode(ctx, node.ID)
+		require.NoError(t, err)
+		vulns, err := storage.GetNodes(ctx, node.Children.ToArray())
+		require.NoError(t, err)
+		var ids []string
+		for _, vuln := range vulns {
+			ids = append(ids, vuln.Name)
+		}
+		return ids
+	}
+	// OSV-lodash-2 and OSV-express alias the same CVE, so they're one vulnerability named after it
+	assert.ElementsMatch(t, []string{"OSV-lodash-1", "CVE-2024-0001"}, vulnerabilities(lodash))
+	assert.ElementsMatch(t, []string{"CVE-2024-0001"}, vulnerabilities(express))
+
+	id, err := storage.NameToID(ctx, "CVE-2024-0001")
+	require.NoError(t, err)
+	node, err := storage.GetNode(ctx, id)
+	require.NoError(t, err)
+	metadata, err := pkg.NodeVulnerabilityMetadata(node)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"OSV-lodash-2", "CVE-2024-0001", "OSV-express", "GHSA-0001"}, metadata.IDs())
+	assert.Equal(t, 7.5, metadata.CVSSScore)
+	assert.Equal(t, pkg.SeverityHigh, metadata.SeverityLevel)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, 3*time.Second, retryAfter("3"))
+	assert.Equal(t, maxOSVBackoff, retryAfter("3600"))
+	assert.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+}
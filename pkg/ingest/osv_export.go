@@ -0,0 +1,306 @@
+package ingest
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bit-bom/minefield/pkg"
+)
+
+// osvExport holds the vulnerabilities of an OSV export, by the package they affect.
+type osvExport map[string][]*Vulnerability
+
+// osvPackageKey identifies a package in an ecosystem. Ecosystem releases, such as the 11 in Debian:11, are dropped
+// and names are normalized for ecosystems that don't distinguish case or punctuation.
+func osvPackageKey(ecosystem, name string) string {
+	ecosystem, _, _ = strings.Cut(ecosystem, ":")
+	switch Ecosystem(ecosystem) {
+	case EcosystemPyPI:
+		name = pypiName(name)
+	case EcosystemNuGet, EcosystemPackagist:
+		name = strings.ToLower(name)
+	}
+	return ecosystem + "/" + name
+}
+
+// pypiName normalizes a Python package name as PEP 503 does.
+func pypiName(name string) string {
+	return pypiNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// VulnerabilitiesFromOSVExport matches the packages in the storage backend against a local OSV export,
+// adding the vulnerabilities that affect them the way Vulnerabilities does, without any network calls.
+// The export is a zip of OSV JSON files, such as the per-ecosystem all.zip files of the OSV bulk export,
+// or a directory of zips and JSON files.
+func VulnerabilitiesFromOSVExport(ctx context.Context, storage pkg.Storage, exportPath string, progress pkg.ProgressFunc) error {
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		return err
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	// Only the vulnerabilities of packages in the graph are kept, as exports can be large
+	queries := map[uint32]Query{}
+	wanted := map[string]bool{}
+	for _, key := range keys {
+		node := nodes[key]
+		if node.Type != "PACKAGE" || node.Name == "" {
+			continue
+		}
+		query, err := PURLToPackageQuery(node.Name)
+		if err != nil {
+			// Packages OSV can't identify are skipped, as they are when querying OSV
+			continue
+		}
+		queries[key] = query
+		wanted[osvPackageKey(query.Package.Ecosystem, query.Package.Name)] = true
+	}
+	export, err := loadOSVExport(exportPath, wanted)
+	if err != nil {
+		return err
+	}
+
+	changes := pkg.NewGraphChanges()
+	for i, key := range keys {
+		if query, ok := queries[key]; ok {
+			changes.Track(nodes[key])
+			added, err := addVulnerabilities(ctx, storage, nodes[key], export.vulnerabilities(query))
+			if err != nil {
+				return err
+			}
+			for _, id := range added {
+				// Vulnerabilities that weren't in the graph before are new in this version
+				if _, ok := nodes[id]; !ok {
+					changes.Created(id)
+				}
+			}
+		}
+		if progress != nil {
+			if err := progress(i+1, len(keys), nodes[key].Name); err != nil {
+				return err
+			}
+		}
+	}
+	return recordVulnerabilityVersion(ctx, storage, changes)
+}
+
+// loadOSVExport reads the vulnerabilities in an OSV export that affect the wanted packages.
+func loadOSVExport(exportPath string, wanted map[string]bool) (osvExport, error) {
+	info, err := os.Stat(exportPath)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing OSV export %s: %w", exportPath, err)
+	}
+	export := osvExport{}
+	if !info.IsDir() {
+		if err := export.load(exportPath, wanted); err != nil {
+			return nil, err
+		}
+		return export, nil
+	}
+	err = filepath.WalkDir(exportPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read OSV export %s: %w", path, err)
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".zip", ".json":
+			return export.load(path, wanted)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// load reads a zip of OSV JSON files or a single OSV JSON file.
+func (e osvExport) load(path string, wanted map[string]bool) error {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read OSV export %s: %w", path, err)
+		}
+		return e.add(path, data, wanted)
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open OSV export %s: %w", path, err)
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(file.Name), ".json") {
+			continue
+		}
+		data, err := readZipFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s in OSV export %s: %w", file.Name, path, err)
+		}
+		if err := e.add(path+"!"+file.Name, data, wanted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds a vulnerability under every wanted package it affects. Withdrawn vulnerabilities are left out.
+func (e osvExport) add(name string, data []byte, wanted map[string]bool) error {
+	var entry Vulnerability
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return fmt.Errorf("failed to parse OSV vulnerability %s: %w", name, err)
+	}
+	if entry.ID == "" {
+		return fmt.Errorf("failed to parse OSV vulnerability %s: %w", name, errors.New("missing id"))
+	}
+	if !entry.Withdrawn.IsZero() {
+		return nil
+	}
+	var added []string
+	for _, affected := range entry.Affected {
+		key := osvPackageKey(affected.Package.Ecosystem, affected.Package.Name)
+		if wanted[key] && !slices.Contains(added, key) {
+			e[key] = append(e[key], &entry)
+			added = append(added, key)
+		}
+	}
+	return nil
+}
+
+// vulnerabilities returns the vulnerabilities that affect a package version.
+// A query without a version matches every vulnerability of the package, as OSV does.
+func (e osvExport) vulnerabilities(query Query) []Vulnerability {
+	key := osvPackageKey(query.Package.Ecosystem, query.Package.Name)
+	var vulns []Vulnerability
+	for _, entry := range e[key] {
+		for _, affected := range entry.Affected {
+			if osvPackageKey(affected.Package.Ecosystem, affected.Package.Name) != key {
+				continue
+			}
+			if query.Version == "" || affectsVersion(affected, Ecosystem(query.Package.Ecosystem), query.Version) {
+				vulns = append(vulns, *entry)
+				break
+			}
+		}
+	}
+	return vulns
+}
+
+// affectsVersion reports whether a version is affected, either because it's listed or because it's in one of the ranges.
+func affectsVersion(a pkg.AffectedPackage, ecosystem Ecosystem, version string) bool {
+	for _, affected := range a.Versions {
+		if affected == version || compareVersions(ecosystem, osvRangeEcosystem, affected, version) == 0 {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if rangeAffects(r, ecosystem, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeAffects evaluates a range as the OSV schema defines: a version is affected from an introduced event
+// until a later fixed event, or up to and including a later last_affected event.
+// GIT ranges can't be ordered without the repository, so only the commits they name as introduced or last affected match.
+func rangeAffects(r pkg.AffectedRange, ecosystem Ecosystem, version string) bool {
+	if r.Type == osvRangeGit {
+		for _, event := range r.Events {
+			if event.Introduced == version || event.LastAffected == version {
+				return true
+			}
+		}
+		return false
+	}
+
+	compare := func(a, b string) int {
+		// An introduced version of 0 is before every version
+		switch {
+		case a == "0" && b == "0":
+			return 0
+		case a == "0":
+			return -1
+		case b == "0":
+			return 1
+		}
+		return compareVersions(ecosystem, r.Type, a, b)
+	}
+	events := slices.Clone(r.Events)
+	slices.SortStableFunc(events, func(a, b pkg.RangeEvent) int {
+		return compare(eventVersion(a), eventVersion(b))
+	})
+
+	affected := false
+	for _, event := range events {
+		switch {
+		case event.Introduced != "" && compare(version, event.Introduced) >= 0:
+			affected = true
+		case event.Fixed != "" && compare(version, event.Fixed) >= 0:
+			affected = false
+		case event.LastAffected != "" && compare(version, event.LastAffected) > 0:
+			affected = false
+		}
+	}
+	return affected
+}
+
+// eventVersion returns the version an event happens at.
+func eventVersion(e pkg.RangeEvent) string {
+	switch {
+	case e.Introduced != "":
+		return e.Introduced
+	case e.Fixed != "":
+		return e.Fixed
+	case e.LastAffected != "":
+		return e.LastAffected
+	}
+	return e.Limit
+}
+
+// FixedVersion returns the earliest version that fixes a vulnerability in the ranges affecting a package, given its purl,
+// or an empty string if the vulnerability isn't fixed or doesn't list the package. Without a version in the purl,
+// the earliest fixed version of every range is returned.
+func FixedVersion(vuln *Vulnerability, purl string) string {
+	query, err := PURLToPackageQuery(purl)
+	if err != nil {
+		return ""
+	}
+	key := osvPackageKey(query.Package.Ecosystem, query.Package.Name)
+	ecosystem := Ecosystem(query.Package.Ecosystem)
+
+	var fixed string
+	var fixedType string
+	for _, affected := range vuln.Affected {
+		if osvPackageKey(affected.Package.Ecosystem, affected.Package.Name) != key {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			if r.Type == osvRangeGit || query.Version != "" && !rangeAffects(r, ecosystem, query.Version) {
+				continue
+			}
+			for _, event := range r.Events {
+				if event.Fixed == "" || query.Version != "" && compareVersions(ecosystem, r.Type, event.Fixed, query.Version) <= 0 {
+					continue
+				}
+				if fixed == "" || compareVersions(ecosystem, fixedType, event.Fixed, fixed) < 0 {
+					fixed, fixedType = event.Fixed, r.Type
+				}
+			}
+		}
+	}
+	return fixed
+}
@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVulnerabilitiesFromOSVExport(t *testing.T) {
+	want := map[string][]string{
+		"pkg:npm/lodash@4.17.10":                      {"CVE-2021-23337", "GHSA-lodash-0002"},
+		"pkg:npm/lodash@4.17.20":                      {"CVE-2021-23337"},
+		"pkg:npm/lodash@4.17.21":                      nil,
+		"pkg:golang/github.com/pkg/errors@v0.8.1":     {"GO-2022-0001"},
+		"pkg:golang/github.com/pkg/errors@v0.9.1":     nil,
+		"pkg:golang/github.com/example/tool@v1.2.0":   {"GO-2022-0001"},
+		"pkg:golang/github.com/example/tool@0a1b2c3d": {"GO-2022-0001"},
+		"pkg:golang/github.com/example/tool@v1.3.0":   nil,
+		"pkg:pypi/django-utils@1.1":                   {"GHSA-django-0001"},
+		"pkg:pypi/django-utils@1.2":                   nil,
+		"pkg:deb/debian/curl@7.88.1-10":               {"DSA-0001-1"},
+		"pkg:deb/debian/curl@7.88.1-10%2Bdeb12u1":     nil,
+		"pkg:generic/not-in-osv@1.0.0":                nil,
+	}
+
+	zipPath := filepath.Join(t.TempDir(), "all.zip")
+	zipDirectory(t, "testdata/osv", zipPath)
+
+	for name, exportPath := range map[string]string{"directory": "testdata/osv", "zip": zipPath} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := pkg.NewMemoryStorage()
+			for purl := range want {
+				_, err := pkg.AddNode(ctx, storage, "PACKAGE", nil, purl)
+				require.NoError(t, err)
+			}
+
+			var calls int
+			err := VulnerabilitiesFromOSVExport(ctx, storage, exportPath, func(done, total int, _ string) error {
+				calls++
+				assert.Equal(t, len(want), total)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, len(want), calls)
+
+			for purl, wantVulns := range want {
+				id, err := storage.NameToID(ctx, purl)
+				require.NoError(t, err)
+				node, err := storage.GetNode(ctx, id)
+				require.NoError(t, err)
+				dependencies, err := storage.GetNodes(ctx, node.Children.ToArray())
+				require.NoError(t, err)
+				var vulns []string
+				for _, dependency := range dependencies {
+					assert.Equal(t, "VULNERABILITY", dependency.Type)
+					vulns = append(vulns, dependency.Name)
+				}
+				assert.ElementsMatch(t, wantVulns, vulns, purl)
+			}
+
+			// The GHSA advisory and the PYSEC record it aliases are one vulnerability, with the advisory's severity
+			id, err := storage.NameToID(ctx, "GHSA-django-0001")
+			require.NoError(t, err)
+			node, err := storage.GetNode(ctx, id)
+			require.NoError(t, err)
+			metadata, err := pkg.NodeVulnerabilityMetadata(node)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"PYSEC-2023-0001"}, metadata.Aliases)
+			assert.Equal(t, "SQL injection in django-utils", metadata.Summary)
+			assert.Equal(t, 9.8, metadata.CVSSScore)
+			assert.Equal(t, pkg.SeverityCritical, metadata.SeverityLevel)
+			aliases, err := storage.GetIndex(ctx, pkg.AliasIndex, "pysec-2023-0001")
+			require.NoError(t, err)
+			assert.Equal(t, []uint32{id}, aliases.ToArray())
+
+			// The ingest is a version of the graph, and ingesting the same vulnerabilities again doesn't create another
+			require.NoError(t, VulnerabilitiesFromOSVExport(ctx, storage, exportPath, nil))
+			versions, err := storage.GetGraphVersions(ctx)
+			require.NoError(t, err)
+			require.Len(t, versions, 1)
+			assert.Equal(t, pkg.VersionSourceVulnerabilities, versions[0].Source)
+		})
+	}
+}
+
+func TestVulnerabilitiesFromOSVExportErrors(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	_, err := pkg.AddNode(ctx, storage, "PACKAGE", nil, "pkg:npm/lodash@4.17.10")
+	require.NoError(t, err)
+
+	assert.Error(t, VulnerabilitiesFromOSVExport(ctx, storage, filepath.Join(t.TempDir(), "missing.zip"), nil))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600))
+	assert.Error(t, VulnerabilitiesFromOSVExport(ctx, storage, dir, nil))
+}
+
+// zipDirectory writes the files in a directory to a zip, flattened the way OSV exports are.
+func zipDirectory(t *testing.T, dir, zipPath string) {
+	t.Helper()
+	file, err := os.Create(zipPath)
+	require.NoError(t, err)
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w, err := writer.Create(entry.Name())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+}
+
+func TestFixedVersion(t *testing.T) {
+	vuln := &Vulnerability{
+		ID: "GHSA-0001",
+		Affected: []pkg.AffectedPackage{
+			{
+				Package: pkg.VulnerablePackage{Ecosystem: "npm", Name: "@scope/lib"},
+				Ranges: []pkg.AffectedRange{
+					{Type: "SEMVER", Events: []pkg.RangeEvent{{Introduced: "2.0.0"}, {Fixed: "2.0.5"}}},
+					{Type: "SEMVER", Events: []pkg.RangeEvent{{Introduced: "1.0.0"}, {Fixed: "1.2.3"}}},
+				},
+			},
+			{
+				Package: pkg.VulnerablePackage{Ecosystem: "PyPI", Name: "Django_Utils"},
+				Ranges:  []pkg.AffectedRange{{Type: "ECOSYSTEM", Events: []pkg.RangeEvent{{Introduced: "0"}, {LastAffected: "1.1"}}}},
+			},
+		},
+	}
+	tests := []struct {
+		purl string
+		want string
+	}{
+		{purl: "pkg:npm/%40scope/lib@1.1.0", want: "1.2.3"},
+		{purl: "pkg:npm/%40scope/lib@2.0.1", want: "2.0.5"},
+		{purl: "pkg:npm/%40scope/lib@2.0.5", want: ""},
+		{purl: "pkg:npm/%40scope/lib", want: "1.2.3"},
+		{purl: "pkg:npm/other@1.1.0", want: ""},
+		{purl: "pkg:pypi/django-utils@1.0", want: ""},
+		{purl: "not a purl", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.purl, func(t *testing.T) {
+			assert.Equal(t, test.want, FixedVersion(vuln, test.purl))
+		})
+	}
+}
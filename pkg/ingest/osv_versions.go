@@ -0,0 +1,249 @@
+package ingest
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/semver"
+)
+
+// OSV range types.
+const (
+	osvRangeSemver    = "SEMVER"
+	osvRangeEcosystem = "ECOSYSTEM"
+	osvRangeGit       = "GIT"
+)
+
+// semverEcosystems are the ecosystems whose versions are semantic versions.
+var semverEcosystems = map[Ecosystem]bool{
+	EcosystemGo:       true,
+	EcosystemNPM:      true,
+	EcosystemCratesIO: true,
+	EcosystemHex:      true,
+}
+
+// compareVersions compares two versions of a package in an ecosystem, the way versions in OSV ranges of the given type are ordered.
+// It returns a negative number if a is before b, zero if they're equal and a positive number if a is after b.
+func compareVersions(ecosystem Ecosystem, rangeType, a, b string) int {
+	switch {
+	case rangeType == osvRangeSemver || semverEcosystems[ecosystem]:
+		if va, vb := canonicalSemver(a), canonicalSemver(b); semver.IsValid(va) && semver.IsValid(vb) {
+			return semver.Compare(va, vb)
+		}
+	case ecosystem == EcosystemDebian || ecosystem == "Ubuntu":
+		return compareDebianVersions(a, b)
+	}
+	return compareGenericVersions(a, b)
+}
+
+// canonicalSemver returns a semantic version with the v prefix the semver package expects.
+func canonicalSemver(version string) string {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version
+}
+
+// versionQualifiers rank the words in versions that mark pre-releases and post-releases, relative to the release itself.
+// Unknown words are ranked as pre-releases, after the known ones.
+var versionQualifiers = map[string]int{
+	"dev":       -7,
+	"alpha":     -6,
+	"a":         -6,
+	"beta":      -5,
+	"b":         -5,
+	"milestone": -4,
+	"m":         -4,
+	"rc":        -3,
+	"c":         -3,
+	"cr":        -3,
+	"pre":       -3,
+	"preview":   -3,
+	"snapshot":  -1,
+	"":          0,
+	"final":     0,
+	"ga":        0,
+	"release":   0,
+	"post":      1,
+	"p":         1,
+	"pl":        1,
+	"sp":        1,
+	"r":         1,
+	"patch":     1,
+}
+
+const unknownQualifier = -2
+
+// compareGenericVersions compares versions of ecosystems such as PyPI, Maven, RubyGems and Alpine,
+// as sequences of numbers and words: missing numbers are zeros, numbers come after words,
+// and words are ordered as pre-releases or post-releases of the version before them.
+func compareGenericVersions(a, b string) int {
+	ta, tb := versionTokens(a), versionTokens(b)
+	for i := 0; i < len(ta) || i < len(tb); i++ {
+		var x, y string
+		if i < len(ta) {
+			x = ta[i]
+		}
+		if i < len(tb) {
+			y = tb[i]
+		}
+		// A missing token is a zero if the other version has a number there, or the release itself if it has a word
+		if x == "" && isNumber(y) {
+			x = "0"
+		}
+		if y == "" && isNumber(x) {
+			y = "0"
+		}
+		if c := compareVersionTokens(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareVersionTokens(x, y string) int {
+	xNumber, yNumber := isNumber(x), isNumber(y)
+	switch {
+	case xNumber && yNumber:
+		x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+		if len(x) != len(y) {
+			return len(x) - len(y)
+		}
+		return strings.Compare(x, y)
+	case xNumber:
+		return 1
+	case yNumber:
+		return -1
+	}
+	rx, okx := versionQualifiers[x]
+	if !okx {
+		rx = unknownQualifier
+	}
+	ry, oky := versionQualifiers[y]
+	if !oky {
+		ry = unknownQualifier
+	}
+	if rx != ry {
+		return rx - ry
+	}
+	if !okx && !oky {
+		return strings.Compare(x, y)
+	}
+	return 0
+}
+
+// versionTokens splits a version into runs of digits and runs of letters, dropping everything else.
+func versionTokens(version string) []string {
+	version = strings.ToLower(version)
+	if len(version) > 1 && version[0] == 'v' && unicode.IsDigit(rune(version[1])) {
+		version = version[1:]
+	}
+	var tokens []string
+	start := -1
+	for i, r := range version {
+		isDigit, isLetter := unicode.IsDigit(r), unicode.IsLetter(r)
+		if start >= 0 && (!isDigit && !isLetter || isDigit != unicode.IsDigit(rune(version[start]))) {
+			tokens = append(tokens, version[start:i])
+			start = -1
+		}
+		if start < 0 && (isDigit || isLetter) {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, version[start:])
+	}
+	return tokens
+}
+
+func isNumber(token string) bool {
+	return token != "" && strings.IndexFunc(token, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+// compareDebianVersions compares Debian package versions the way dpkg does: by epoch, then upstream version, then revision.
+func compareDebianVersions(a, b string) int {
+	epochA, upstreamA, revisionA := splitDebianVersion(a)
+	epochB, upstreamB, revisionB := splitDebianVersion(b)
+	if epochA != epochB {
+		return epochA - epochB
+	}
+	if c := compareDebianPart(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareDebianPart(revisionA, revisionB)
+}
+
+func splitDebianVersion(version string) (int, string, string) {
+	epoch := 0
+	if e, rest, ok := strings.Cut(version, ":"); ok {
+		if n, err := strconv.Atoi(e); err == nil {
+			epoch, version = n, rest
+		}
+	}
+	revision := ""
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version, revision = version[:i], version[i+1:]
+	}
+	return epoch, version, revision
+}
+
+// compareDebianPart compares alternating runs of non-digits and digits, where ~ sorts before anything, even the end of the part.
+func compareDebianPart(a, b string) int {
+	order := func(c byte) int {
+		switch {
+		case c == '~':
+			return -1
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			return int(c)
+		default:
+			return int(c) + 256
+		}
+	}
+	for a != "" || b != "" {
+		for (a != "" && !isDigitByte(a[0])) || (b != "" && !isDigitByte(b[0])) {
+			var ca, cb int
+			if a != "" && !isDigitByte(a[0]) {
+				ca = order(a[0])
+			}
+			if b != "" && !isDigitByte(b[0]) {
+				cb = order(b[0])
+			}
+			if ca != cb {
+				return ca - cb
+			}
+			if a != "" && !isDigitByte(a[0]) {
+				a = a[1:]
+			}
+			if b != "" && !isDigitByte(b[0]) {
+				b = b[1:]
+			}
+		}
+		var na, nb string
+		na, a = leadingDigits(a)
+		nb, b = leadingDigits(b)
+		if c := compareVersionTokens(orZero(na), orZero(nb)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func isDigitByte(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func leadingDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigitByte(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func orZero(number string) string {
+	if number == "" {
+		return "0"
+	}
+	return number
+}
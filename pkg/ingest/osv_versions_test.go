@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		ecosystem Ecosystem
+		rangeType string
+		a, b      string
+		want      int
+	}{
+		{EcosystemNPM, osvRangeSemver, "1.2.3", "1.10.0", -1},
+		{EcosystemNPM, osvRangeSemver, "1.0.0-beta.1", "1.0.0", -1},
+		{EcosystemGo, osvRangeSemver, "v0.9.1", "0.9.1", 0},
+		{EcosystemPyPI, osvRangeEcosystem, "1.0", "1.0.0", 0},
+		{EcosystemPyPI, osvRangeEcosystem, "1.2rc1", "1.2", -1},
+		{EcosystemPyPI, osvRangeEcosystem, "1.2.dev1", "1.2a1", -1},
+		{EcosystemPyPI, osvRangeEcosystem, "1.2.post1", "1.2", 1},
+		{EcosystemPyPI, osvRangeEcosystem, "1.2.post1", "1.2.1", -1},
+		{EcosystemMaven, osvRangeEcosystem, "2.0-SNAPSHOT", "2.0", -1},
+		{EcosystemMaven, osvRangeEcosystem, "2.0.Final", "2.0", 0},
+		{EcosystemRubyGems, osvRangeEcosystem, "6.1.0.rc2", "6.1.0", -1},
+		{EcosystemAlpine, osvRangeEcosystem, "1.2.3-r1", "1.2.3", 1},
+		{EcosystemDebian, osvRangeEcosystem, "7.88.1-10", "7.88.1-10+deb12u1", -1},
+		{EcosystemDebian, osvRangeEcosystem, "1.0~rc1-1", "1.0-1", -1},
+		{EcosystemDebian, osvRangeEcosystem, "1:0.9-1", "2.0-1", 1},
+	}
+	for _, test := range tests {
+		t.Run(string(test.ecosystem)+" "+test.a+" "+test.b, func(t *testing.T) {
+			got := compareVersions(test.ecosystem, test.rangeType, test.a, test.b)
+			assert.Equal(t, test.want, sign(got))
+			assert.Equal(t, -test.want, sign(compareVersions(test.ecosystem, test.rangeType, test.b, test.a)))
+		})
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
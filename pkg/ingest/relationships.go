@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/protobom/protobom/pkg/sbom"
+)
+
+// Relationship is how a SBOM relationship between two components is added to the graph.
+type Relationship string
+
+const (
+	// DependsOn adds the relationship as the component it's from depending on the component it's to.
+	DependsOn Relationship = "dependsOn"
+	// DependencyOf adds the relationship reversed, as the component it's to depending on the component it's from.
+	DependencyOf Relationship = "dependencyOf"
+	// Ignored leaves the relationship out of the graph.
+	Ignored Relationship = "ignore"
+)
+
+// RelationshipMapping maps each SBOM relationship type to how it's added to the graph.
+// Types that aren't in the mapping are added the way DefaultRelationshipMapping adds them.
+type RelationshipMapping map[sbom.Edge_Type]Relationship
+
+// defaultRelationships follow the direction SPDX defines for each relationship, so that a component depends on
+// whatever it contains, is built from, links or needs at runtime, build time or test time.
+// Relationships that don't make one component part of another, such as copies and documentation, are ignored.
+var defaultRelationships = RelationshipMapping{
+	sbom.Edge_UNKNOWN:              DependsOn,
+	sbom.Edge_dependsOn:            DependsOn,
+	sbom.Edge_contains:             DependsOn,
+	sbom.Edge_describes:            DependsOn,
+	sbom.Edge_descendant:           DependsOn,
+	sbom.Edge_dynamicLink:          DependsOn,
+	sbom.Edge_staticLink:           DependsOn,
+	sbom.Edge_generatedFrom:        DependsOn,
+	sbom.Edge_prerequisite:         DependsOn,
+	sbom.Edge_distributionArtifact: DependsOn,
+	sbom.Edge_dependencyOf:         DependencyOf,
+	sbom.Edge_contained_by:         DependencyOf,
+	sbom.Edge_describedBy:          DependencyOf,
+	sbom.Edge_ancestor:             DependencyOf,
+	sbom.Edge_generates:            DependencyOf,
+	sbom.Edge_prerequisiteFor:      DependencyOf,
+	sbom.Edge_buildDependency:      DependencyOf,
+	sbom.Edge_buildTool:            DependencyOf,
+	sbom.Edge_devDependency:        DependencyOf,
+	sbom.Edge_devTool:              DependencyOf,
+	sbom.Edge_optionalComponent:    DependencyOf,
+	sbom.Edge_optionalDependency:   DependencyOf,
+	sbom.Edge_providedDependency:   DependencyOf,
+	sbom.Edge_runtimeDependency:    DependencyOf,
+	sbom.Edge_testDependency:       DependencyOf,
+	sbom.Edge_testTool:             DependencyOf,
+	sbom.Edge_packages:             DependencyOf,
+	sbom.Edge_patch:                DependencyOf,
+	sbom.Edge_dataFile:             DependencyOf,
+	sbom.Edge_metafile:             DependencyOf,
+	sbom.Edge_expandedFromArchive:  DependencyOf,
+	sbom.Edge_amends:               Ignored,
+	sbom.Edge_copy:                 Ignored,
+	sbom.Edge_dependencyManifest:   Ignored,
+	sbom.Edge_documentation:        Ignored,
+	sbom.Edge_example:              Ignored,
+	sbom.Edge_fileAdded:            Ignored,
+	sbom.Edge_fileDeleted:          Ignored,
+	sbom.Edge_fileModified:         Ignored,
+	sbom.Edge_other:                Ignored,
+	sbom.Edge_requirementFor:       Ignored,
+	sbom.Edge_specificationFor:     Ignored,
+	sbom.Edge_test:                 Ignored,
+	sbom.Edge_testCase:             Ignored,
+	sbom.Edge_variant:              Ignored,
+}
+
+// DefaultRelationshipMapping returns a copy of the mapping used when none is configured.
+func DefaultRelationshipMapping() RelationshipMapping {
+	mapping := make(RelationshipMapping, len(defaultRelationships))
+	for edgeType, relationship := range defaultRelationships {
+		mapping[edgeType] = relationship
+	}
+	return mapping
+}
+
+// relationship returns how an edge of the given type is added to the graph.
+func (m RelationshipMapping) relationship(edgeType sbom.Edge_Type) Relationship {
+	if relationship, ok := m[edgeType]; ok {
+		return relationship
+	}
+	if relationship, ok := defaultRelationships[edgeType]; ok {
+		return relationship
+	}
+	return DependsOn
+}
+
+// ParseRelationshipMapping parses overrides of the default mapping, each formatted as TYPE=RELATIONSHIP.
+// Types are protobom edge types such as buildTool or SPDX relationship types such as BUILD_TOOL_OF,
+// and relationships are dependsOn, dependencyOf or ignore.
+func ParseRelationshipMapping(overrides []string) (RelationshipMapping, error) {
+	mapping := DefaultRelationshipMapping()
+	for _, override := range overrides {
+		name, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid relationship mapping %q, expected TYPE=RELATIONSHIP", override)
+		}
+		edgeType, err := parseEdgeType(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		relationship := Relationship(strings.TrimSpace(value))
+		switch relationship {
+		case DependsOn, DependencyOf, Ignored:
+		default:
+			return nil, fmt.Errorf("unknown relationship %q for %s, expected %s, %s or %s", value, name, DependsOn, DependencyOf, Ignored)
+		}
+		mapping[edgeType] = relationship
+	}
+	return mapping, nil
+}
+
+// parseEdgeType parses a protobom edge type name or a SPDX relationship type.
+func parseEdgeType(name string) (sbom.Edge_Type, error) {
+	if value, ok := sbom.Edge_Type_value[name]; ok {
+		return sbom.Edge_Type(value), nil
+	}
+	if edgeType := sbom.EdgeTypeFromSPDX2(name); edgeType != sbom.Edge_UNKNOWN {
+		return edgeType, nil
+	}
+	return sbom.Edge_UNKNOWN, fmt.Errorf("unknown relationship type %q", name)
+}
@@ -0,0 +1,89 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/protobom/protobom/pkg/sbom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRelationshipMapping(t *testing.T) {
+	mapping, err := ParseRelationshipMapping([]string{"CONTAINS=ignore", "buildTool=dependsOn"})
+	require.NoError(t, err)
+	assert.Equal(t, Ignored, mapping.relationship(sbom.Edge_contains))
+	assert.Equal(t, DependsOn, mapping.relationship(sbom.Edge_buildTool))
+	assert.Equal(t, DependencyOf, mapping.relationship(sbom.Edge_devDependency))
+
+	for _, override := range []string{"CONTAINS", "NOT_A_TYPE=ignore", "CONTAINS=sideways"} {
+		_, err := ParseRelationshipMapping([]string{override})
+		assert.Error(t, err, override)
+	}
+}
+
+func TestIngestSBOMRelationships(t *testing.T) {
+	ctx := context.Background()
+
+	// An SPDX style document, where most relationships point from the dependency to the dependent
+	document := sbom.NewDocument()
+	document.Metadata.Id = "urn:uuid:relationships"
+	for _, name := range []string{"app", "lib", "compiler", "linter", "image", "fork"} {
+		document.NodeList.AddNode(&sbom.Node{Id: name, Name: name, Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	}
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependencyOf, From: "lib", To: []string{"app"}})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_buildTool, From: "compiler", To: []string{"app"}})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_devTool, From: "linter", To: []string{"app"}})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_contains, From: "image", To: []string{"app"}})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_variant, From: "fork", To: []string{"lib"}})
+
+	dependencies := func(t *testing.T, storage pkg.Storage, name string) []string {
+		id, err := storage.NameToID(ctx, "pkg:generic/"+name+"@1.0.0")
+		require.NoError(t, err)
+		node, err := storage.GetNode(ctx, id)
+		require.NoError(t, err)
+		var names []string
+		for _, child := range node.Children.ToArray() {
+			childNode, err := storage.GetNode(ctx, child)
+			require.NoError(t, err)
+			names = append(names, childNode.Name)
+		}
+		return names
+	}
+
+	t.Run("default mapping", func(t *testing.T) {
+		storage := pkg.NewMemoryStorage()
+		stats, err := processSBOMDocument(ctx, document, storage, documentOptions{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 4, stats.edges)
+		assert.ElementsMatch(t, []string{"pkg:generic/lib@1.0.0", "pkg:generic/compiler@1.0.0", "pkg:generic/linter@1.0.0"}, dependencies(t, storage, "app"))
+		assert.Equal(t, []string{"pkg:generic/app@1.0.0"}, dependencies(t, storage, "image"))
+		assert.Empty(t, dependencies(t, storage, "fork"))
+		assert.Empty(t, dependencies(t, storage, "lib"))
+
+		// The relationships the edges were declared with are kept for exports
+		app, err := storage.NameToID(ctx, "pkg:generic/app@1.0.0")
+		require.NoError(t, err)
+		lib, err := storage.NameToID(ctx, "pkg:generic/lib@1.0.0")
+		require.NoError(t, err)
+		image, err := storage.NameToID(ctx, "pkg:generic/image@1.0.0")
+		require.NoError(t, err)
+		types, err := storage.GetEdgeTypes(ctx, []pkg.Edge{{From: app, To: lib}, {From: image, To: app}, {From: lib, To: app}})
+		require.NoError(t, err)
+		assert.Equal(t, map[pkg.Edge]pkg.EdgeType{
+			{From: app, To: lib}:   {Type: sbom.Edge_dependencyOf.String(), Reversed: true},
+			{From: image, To: app}: {Type: sbom.Edge_contains.String()},
+		}, types)
+	})
+
+	t.Run("configured mapping", func(t *testing.T) {
+		storage := pkg.NewMemoryStorage()
+		mapping, err := ParseRelationshipMapping([]string{"DEV_TOOL_OF=ignore", "VARIANT_OF=dependsOn"})
+		require.NoError(t, err)
+		_, err = processSBOMDocument(ctx, document, storage, documentOptions{relationships: mapping}, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"pkg:generic/lib@1.0.0", "pkg:generic/compiler@1.0.0"}, dependencies(t, storage, "app"))
+		assert.Equal(t, []string{"pkg:generic/lib@1.0.0"}, dependencies(t, storage, "fork"))
+	})
+}
@@ -1,118 +1,678 @@
 package ingest
 
 import (
-	"errors"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/RoaringBitmap/roaring"
 	"github.com/bit-bom/minefield/pkg"
+	"github.com/protobom/protobom/pkg/formats"
 	"github.com/protobom/protobom/pkg/reader"
 	"github.com/protobom/protobom/pkg/sbom"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// SBOMOptions configures how a SBOM file or directory is ingested.
+type SBOMOptions struct {
+	// Workers is the number of files ingested concurrently, at least one is used.
+	Workers int
+	// Include and Exclude are glob patterns matched against the name and relative path of each entry in a directory or archive.
+	// When Include is set only matching files are ingested, and excluded directories are skipped entirely.
+	Include []string
+	Exclude []string
+	// ContinueOnError records files that fail to ingest in the report instead of stopping at the first one.
+	ContinueOnError bool
+	// Validate checks each document for problems before ingesting it, and doesn't ingest documents with errors.
+	Validate bool
+	// DryRun validates documents and reports what ingesting them would add, without writing to the storage backend.
+	DryRun bool
+	// Relationships maps SBOM relationship types to dependencies in the graph, the default mapping is used if it's nil.
+	Relationships RelationshipMapping
+	// SPDXNamespaceIdentity identifies SPDX documents by their namespace, for tools that keep it the same across versions
+	// of a document. By default they're identified by their name, as the SPDX specification asks for a new namespace
+	// for every version.
+	SPDXNamespaceIdentity bool
+	// Progress, if set, is called after each file.
+	Progress pkg.ProgressFunc
+}
+
+// SBOMReport summarizes an ingestion.
+type SBOMReport struct {
+	// Files is the number of documents ingested successfully, or validated in a dry run, counting each document in an archive or OCI layout.
+	Files int `json:"files"`
+	// Nodes and Edges are the number of nodes and edges that didn't exist before.
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+	// Duplicates is the number of nodes that were already in the storage backend.
+	Duplicates int `json:"duplicates"`
+	// RemovedEdges is the number of edges removed because a re-ingested document no longer declares them,
+	// and no other document does either.
+	RemovedEdges int             `json:"removedEdges"`
+	Errors       []SBOMFileError `json:"errors,omitempty"`
+	// Issues are the problems found validating documents, when validating.
+	Issues []ValidationIssue `json:"issues,omitempty"`
+}
+
+// ValidationErrors returns the number of issues that are errors rather than warnings.
+func (r *SBOMReport) ValidationErrors() int {
+	return countValidationErrors(r.Issues)
+}
+
+// SBOMFileError is the error a single document failed to ingest with.
+type SBOMFileError struct {
+	// Path identifies the document, for documents in an archive it is the archive's path followed by "!" and the path in the archive.
+	Path string
+	Err  error
+}
+
+func (e SBOMFileError) Error() string {
+	return fmt.Sprintf("failed to ingest SBOM from path %s: %v", e.Path, e.Err)
+}
+
+func (e SBOMFileError) Unwrap() error {
+	return e.Err
+}
+
+func (e SBOMFileError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path  string `json:"path"`
+		Error string `json:"error"`
+	}{e.Path, e.Err.Error()})
+}
+
+// documentOptions configures how a parsed SBOM document is added to the graph.
+type documentOptions struct {
+	// relationships maps SBOM relationship types to dependencies in the graph, the default mapping is used if it's nil.
+	relationships RelationshipMapping
+	// spdx is set for documents read from SPDX, which are identified by their namespace only if spdxNamespace is set.
+	spdx, spdxNamespace bool
+}
+
+// ingestStats counts what ingesting a single document changed.
+type ingestStats struct {
+	nodes, edges, duplicates, removedEdges int
+	issues                                 []ValidationIssue
+}
+
 // IngestSBOM ingests a SBOM file or directory into the storage backend.
-func SBOM(sbomPath string, storage pkg.Storage) error {
-	info, err := os.Stat(sbomPath)
+func SBOM(ctx context.Context, sbomPath string, storage pkg.Storage) error {
+	return SBOMWithProgress(ctx, sbomPath, storage, nil)
+}
+
+// SBOMWithProgress ingests a SBOM file or directory into the storage backend, calling progress after each file.
+func SBOMWithProgress(ctx context.Context, sbomPath string, storage pkg.Storage, progress pkg.ProgressFunc) error {
+	_, err := SBOMWithOptions(ctx, sbomPath, storage, SBOMOptions{Progress: progress})
+	return err
+}
+
+// SBOMWithOptions ingests SBOM documents into the storage backend and reports what was ingested.
+// sbomPath is a SBOM file, an archive of SBOM files, an OCI image layout, a directory of any of those, or StdinPath.
+// Unless opts.ContinueOnError is set, the first document that fails stops the ingestion and its error is returned.
+func SBOMWithOptions(ctx context.Context, sbomPath string, storage pkg.Storage, opts SBOMOptions) (*SBOMReport, error) {
+	for _, pattern := range append(slices.Clone(opts.Include), opts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	sources, err := sbomSources(sbomPath, opts.Include, opts.Exclude)
 	if err != nil {
-		return fmt.Errorf("error accessing path %s: %w", sbomPath, err)
+		return nil, err
+	}
+	return ingestSources(ctx, sources, storage, opts)
+}
+
+// ingestSources ingests SBOM documents concurrently, as configured by opts, and records them as one version of the graph.
+func ingestSources(ctx context.Context, sources []sbomSource, storage pkg.Storage, opts SBOMOptions) (*SBOMReport, error) {
+	// The version is recorded even when the ingest stops early, since the documents ingested until then changed the graph
+	recordCtx := context.WithoutCancel(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var changes *pkg.GraphChanges
+	if !opts.DryRun {
+		changes = pkg.NewGraphChanges()
 	}
 
-	if info.IsDir() {
-		entries, err := os.ReadDir(sbomPath)
+	var (
+		mu       sync.Mutex
+		report   = &SBOMReport{}
+		done     int
+		firstErr error
+	)
+	// finish records the outcome of a document, and returns false once the remaining documents shouldn't be ingested
+	finish := func(name string, stats ingestStats, err error) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil {
+			return false
+		}
+
+		done++
+		report.Issues = append(report.Issues, stats.issues...)
 		if err != nil {
-			return fmt.Errorf("failed to read directory %s: %w", sbomPath, err)
+			fileErr := SBOMFileError{Path: name, Err: err}
+			report.Errors = append(report.Errors, fileErr)
+			if !opts.ContinueOnError || ctx.Err() != nil {
+				firstErr = fileErr
+				cancel()
+				return false
+			}
+		} else {
+			report.Files++
+			report.Nodes += stats.nodes
+			report.Edges += stats.edges
+			report.Duplicates += stats.duplicates
+			report.RemovedEdges += stats.removedEdges
 		}
-		for _, entry := range entries {
-			entryPath := filepath.Join(sbomPath, entry.Name())
-			if err := SBOM(entryPath, storage); err != nil {
-				return fmt.Errorf("failed to ingest SBOM from path %s: %w", entryPath, err)
+
+		if opts.Progress != nil {
+			if err := opts.Progress(done, len(sources), name); err != nil {
+				firstErr = err
+				cancel()
+				return false
 			}
 		}
-	} else {
-		return processSBOMFile(sbomPath, storage)
+		return true
 	}
 
-	return nil
+	queue := make(chan sbomSource)
+	var wg sync.WaitGroup
+	for i := 0; i < max(opts.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for source := range queue {
+				stats, err := processSBOMSource(ctx, source, storage, opts, changes)
+				if !finish(source.name, stats, err) {
+					return
+				}
+			}
+		}()
+	}
+
+sendSources:
+	for _, source := range sources {
+		select {
+		case queue <- source:
+		case <-ctx.Done():
+			break sendSources
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	if _, err := changes.Record(recordCtx, storage, pkg.VersionSourceSBOM); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to record graph version: %w", err)
+	}
+	return report, firstErr
 }
 
-// processSBOMFile processes a SBOM file and adds it to the storage backend.
-func processSBOMFile(filePath string, storage pkg.Storage) error {
-	if filePath == "" {
-		return fmt.Errorf("file path is empty")
+// processSBOMSource processes a SBOM document and adds it to the storage backend, validating it first if opts asks to.
+func processSBOMSource(ctx context.Context, source sbomSource, storage pkg.Storage, opts SBOMOptions, changes *pkg.GraphChanges) (ingestStats, error) {
+	data, err := source.read()
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("failed to read %s: %w", source.name, err)
+	}
+	document, format, err := parseSBOM(bytes.NewReader(data))
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("failed to parse SBOM %s: %w", source.name, err)
+	}
+	documentOpts := documentOptions{relationships: opts.Relationships, spdx: format.Type() == formats.SPDXFORMAT, spdxNamespace: opts.SPDXNamespaceIdentity}
+	if !opts.Validate && !opts.DryRun {
+		return processSBOMDocument(ctx, document, storage, documentOpts, changes)
 	}
 
-	_, err := os.Stat(filePath)
+	issues, stats, err := validateDocument(ctx, source.name, document, storage, opts.Relationships)
 	if err != nil {
-		return fmt.Errorf("failed to stat file %s: %w", filePath, err)
+		return ingestStats{}, fmt.Errorf("failed to validate SBOM %s: %w", source.name, err)
+	}
+	stats.issues = issues
+	if opts.DryRun {
+		return stats, nil
+	}
+	if countValidationErrors(issues) > 0 {
+		return ingestStats{issues: issues}, fmt.Errorf("SBOM %s has validation errors", source.name)
+	}
+	stats, err = processSBOMDocument(ctx, document, storage, documentOpts, changes)
+	stats.issues = issues
+	return stats, err
+}
+
+// SBOMFromReader ingests a single SBOM document read from r into the storage backend.
+func SBOMFromReader(ctx context.Context, r io.ReadSeeker, storage pkg.Storage) error {
+	document, format, err := parseSBOM(r)
+	if err != nil {
+		return fmt.Errorf("failed to parse SBOM: %w", err)
+	}
+
+	changes := pkg.NewGraphChanges()
+	if _, err := processSBOMDocument(ctx, document, storage, documentOptions{spdx: format.Type() == formats.SPDXFORMAT}, changes); err != nil {
+		return err
+	}
+	if _, err := changes.Record(ctx, storage, pkg.VersionSourceSBOM); err != nil {
+		return fmt.Errorf("failed to record graph version: %w", err)
 	}
-	sbomReader := reader.New()
+	return nil
+}
 
-	document, err := sbomReader.ParseFile(filePath)
+// parseSBOM parses a SBOM document and returns the format it's in.
+func parseSBOM(r io.ReadSeeker) (*sbom.Document, formats.Format, error) {
+	sniffer := &formatSniffer{}
+	document, err := reader.New(reader.WithSniffer(sniffer)).ParseStream(r)
 	if err != nil {
-		return fmt.Errorf("failed to parse SBOM file %s: %w", filePath, err)
+		return nil, "", err
 	}
+	return document, sniffer.format, nil
+}
+
+// formatSniffer remembers the format of the last document it detected.
+type formatSniffer struct {
+	formats.Sniffer
+	format formats.Format
+}
+
+func (s *formatSniffer) SniffReader(r io.ReadSeeker) (formats.Format, error) {
+	format, err := s.Sniffer.SniffReader(r)
+	s.format = format
+	return format, err
+}
+
+// processSBOMDocument adds the nodes and edges of a parsed SBOM document to the storage backend,
+// along with a document node that records where they came from.
+// If the document was ingested before, whatever it no longer declares is removed.
+// Relationships are added to the graph as mapped by opts.relationships, or by the default mapping if it's nil.
+// The nodes the document changes are collected in changes, for the ingest run to be recorded as a version of the graph.
+func processSBOMDocument(ctx context.Context, document *sbom.Document, storage pkg.Storage, opts documentOptions, changes *pkg.GraphChanges) (ingestStats, error) {
+	var stats ingestStats
 	nameToNodeID := map[string]uint32{}
+	indexed := map[[2]string][]uint32{}
 
 	for _, node := range document.GetNodeList().GetNodes() {
-		purl := string(node.Purl())
-		if purl == "" {
-			purl = fmt.Sprintf("pkg:generic/%s@%s", node.Name, node.Version)
+		purl := nodeName(node)
+		metadata := componentMetadata(node)
+
+		graphNode, created, err := pkg.GetOrAddNode(ctx, storage, node.Type.String(), any(metadata), purl)
+		if err != nil {
+			return stats, fmt.Errorf("failed to add node: %w", err)
+		}
+		if created {
+			stats.nodes++
+			changes.Created(graphNode.ID)
+		} else {
+			stats.duplicates++
+			changes.Track(graphNode)
 		}
+		nameToNodeID[purl] = graphNode.ID
+
+		// Nodes are indexed by what every document declares about them, even when the node already existed
+		for index, values := range metadata.IndexValues() {
+			for _, value := range values {
+				key := [2]string{index, value}
+				indexed[key] = append(indexed[key], graphNode.ID)
+			}
+		}
+	}
+	for key, ids := range indexed {
+		if err := storage.AddToIndex(ctx, key[0], key[1], ids); err != nil {
+			return stats, fmt.Errorf("failed to index nodes: %w", err)
+		}
+	}
+
+	documentNode, err := addDocumentNode(ctx, document, storage, nameToNodeID, opts, changes)
+	if err != nil {
+		return stats, fmt.Errorf("failed to add document node: %w", err)
+	}
+	changes.AddDocument(documentNode.Name)
+	previousNodes, err := storage.GetDocumentNodes(ctx, documentNode.ID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get previously declared nodes: %w", err)
+	}
+	previousEdges, err := storage.GetDocumentEdges(ctx, documentNode.ID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get previously declared edges: %w", err)
+	}
 
-		graphNode, err := pkg.AddNode(storage, node.Type.String(), any(node), purl)
+	edges, edgeTypes, err := documentEdges(document, nameToNodeID, opts.relationships)
+	if err != nil {
+		return stats, fmt.Errorf("failed to add dependencies: %w", err)
+	}
+	nodes := make([]uint32, 0, len(nameToNodeID))
+	for _, id := range nameToNodeID {
+		nodes = append(nodes, id)
+	}
+
+	// Provenance is recorded before the edges are added, so that a concurrent ingest that drops an edge this
+	// document declares sees the edge is still declared and keeps it
+	if err := storage.AddProvenance(ctx, documentNode.ID, nodes, edges); err != nil {
+		return stats, fmt.Errorf("failed to add provenance: %w", err)
+	}
+	if err := storage.SetEdgeTypes(ctx, edgeTypes); err != nil {
+		return stats, fmt.Errorf("failed to add edge types: %w", err)
+	}
+	stats.edges, err = addEdges(ctx, storage, edges)
+	if err != nil {
+		return stats, fmt.Errorf("failed to add dependencies: %w", err)
+	}
+	if changes != nil {
+		// Stale edges may be removed from nodes the document no longer declares
+		declared, stale := roaring.BitmapOf(nodes...), roaring.New()
+		for _, edge := range previousEdges {
+			if !declared.Contains(edge.From) {
+				stale.Add(edge.From)
+			}
+		}
+		staleNodes, err := storage.GetNodes(ctx, stale.ToArray())
 		if err != nil {
-			if errors.Is(err, pkg.ErrNodeAlreadyExists) {
-				// TODO: Add a logger
-				fmt.Println("Skipping...")
-				continue
+			return stats, fmt.Errorf("failed to get nodes: %w", err)
+		}
+		for _, node := range staleNodes {
+			changes.Track(node)
+		}
+	}
+	stats.removedEdges, err = removeStaleContributions(ctx, storage, documentNode.ID, previousNodes, previousEdges, nodes, edges)
+	if err != nil {
+		return stats, fmt.Errorf("failed to remove stale contributions: %w", err)
+	}
+	return stats, nil
+}
+
+// addDocumentNode adds the node representing the document itself, depending on the document's root components.
+func addDocumentNode(ctx context.Context, document *sbom.Document, storage pkg.Storage, nameToNodeID map[string]uint32, opts documentOptions, changes *pkg.GraphChanges) (*pkg.Node, error) {
+	metadata := &pkg.DocumentMetadata{
+		ID:      document.GetMetadata().GetId(),
+		Name:    document.GetMetadata().GetName(),
+		Version: document.GetMetadata().GetVersion(),
+	}
+	for _, author := range document.GetMetadata().GetAuthors() {
+		metadata.Authors = append(metadata.Authors, author.GetName())
+	}
+	for _, tool := range document.GetMetadata().GetTools() {
+		metadata.Tools = append(metadata.Tools, strings.TrimSpace(tool.GetName()+" "+tool.GetVersion()))
+	}
+	metadata.Date = timestampTime(document.GetMetadata().GetDate())
+
+	var roots []uint32
+	for _, rootID := range document.GetNodeList().GetRootElements() {
+		root := document.GetNodeList().GetNodeByID(rootID)
+		if root == nil {
+			continue
+		}
+		metadata.RootElements = append(metadata.RootElements, nodeName(root))
+		roots = append(roots, nameToNodeID[nodeName(root)])
+	}
+
+	name, err := documentName(document, metadata, opts)
+	if err != nil {
+		return nil, err
+	}
+	documentNode, created, err := pkg.GetOrAddNode(ctx, storage, pkg.DocumentNodeType, any(metadata), name)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		changes.Created(documentNode.ID)
+	} else {
+		changes.Track(documentNode)
+		// The document was ingested before, so update its metadata and drop the roots it no longer has
+		if err := storage.SaveNodeMetadata(ctx, documentNode.ID, metadata); err != nil {
+			return nil, fmt.Errorf("failed to save document node: %w", err)
+		}
+		documentNode.Metadata = metadata
+		staleRoots := documentNode.Children.Clone()
+		staleRoots.AndNot(roaring.BitmapOf(roots...))
+		for _, id := range staleRoots.ToArray() {
+			if err := storage.RemoveDependency(ctx, documentNode.ID, id); err != nil {
+				return nil, err
 			}
-			return fmt.Errorf("failed to add node: %w", err)
+			documentNode.Children.Remove(id)
 		}
-		nameToNodeID[purl] = graphNode.ID
 	}
 
-	err = addDependency(document, storage, nameToNodeID)
+	for _, id := range roots {
+		root, err := storage.GetNode(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node: %w", err)
+		}
+		if err := documentNode.SetDependency(ctx, storage, root); err != nil {
+			return nil, fmt.Errorf("failed to set dependency: %w", err)
+		}
+	}
+	return documentNode, nil
+}
+
+// removeStaleContributions removes the provenance of whatever the document declared when it was last ingested but no longer does.
+// Stale edges that no other document declares are removed from the graph, and the number of them is returned.
+func removeStaleContributions(ctx context.Context, storage pkg.Storage, document uint32, previousNodes *roaring.Bitmap, previousEdges []pkg.Edge, nodes []uint32, edges []pkg.Edge) (int, error) {
+	staleNodes := previousNodes.Clone()
+	staleNodes.AndNot(roaring.BitmapOf(nodes...))
+
+	declared := make(map[pkg.Edge]bool, len(edges))
+	for _, edge := range edges {
+		declared[edge] = true
+	}
+	var staleEdges []pkg.Edge
+	for _, edge := range previousEdges {
+		if !declared[edge] {
+			staleEdges = append(staleEdges, edge)
+		}
+	}
+
+	if staleNodes.IsEmpty() && len(staleEdges) == 0 {
+		return 0, nil
+	}
+	if err := storage.RemoveProvenance(ctx, document, staleNodes.ToArray(), staleEdges); err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, edge := range staleEdges {
+		documents, err := storage.GetEdgeProvenance(ctx, edge)
+		if err != nil {
+			return removed, err
+		}
+		if !documents.IsEmpty() {
+			continue
+		}
+		// Removing the edge queues both nodes for caching
+		if err := storage.RemoveDependency(ctx, edge.From, edge.To); err != nil {
+			return removed, err
+		}
+		// A document ingested concurrently may have declared the edge since it was checked, and may have found it
+		// still in the graph, so it is put back for it
+		documents, err = storage.GetEdgeProvenance(ctx, edge)
+		if err != nil {
+			return removed, err
+		}
+		if !documents.IsEmpty() {
+			if err := storage.AddDependency(ctx, edge.From, edge.To); err != nil {
+				return removed, err
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// generatedSPDXNamespace is the prefix of the namespaces protobom makes up for SPDX documents that have none, which
+// are different every time the document is read.
+const generatedSPDXNamespace = "https://spdx.org/spdxdocs/protobom-"
+
+// documentName identifies a document by its serial number, its name, or its root components, in that order.
+// SPDX documents get a new namespace for every version, so they're only identified by it if opts.spdxNamespace is set.
+// Documents with none of these are identified by their content.
+func documentName(document *sbom.Document, metadata *pkg.DocumentMetadata, opts documentOptions) (string, error) {
+	useID := metadata.ID != ""
+	if opts.spdx {
+		useID = useID && opts.spdxNamespace && !strings.HasPrefix(metadata.ID, generatedSPDXNamespace)
+	}
+	switch {
+	case useID:
+		return "document:" + metadata.ID, nil
+	case metadata.Name != "":
+		return "document:" + metadata.Name, nil
+	case len(metadata.RootElements) > 0:
+		roots := slices.Clone(metadata.RootElements)
+		slices.Sort(roots)
+		return "document:" + strings.Join(roots, ","), nil
+	}
+
+	// The made up namespace would make every read of the document different
+	if opts.spdx {
+		document = proto.Clone(document).(*sbom.Document)
+		document.Metadata.Id = ""
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(document)
 	if err != nil {
-		return fmt.Errorf("failed to add dependencies: %w", err)
+		return "", fmt.Errorf("failed to marshal document: %w", err)
+	}
+	return fmt.Sprintf("document:sha256:%x", sha256.Sum256(data)), nil
+}
+
+// nodeName returns the name of the graph node for a SBOM node, its purl if it has one.
+func nodeName(node *sbom.Node) string {
+	if purl := string(node.Purl()); purl != "" {
+		return purl
 	}
+	return fmt.Sprintf("pkg:generic/%s@%s", node.Name, node.Version)
+}
 
-	return nil
+// componentMetadata extracts the details of a SBOM node that are kept in the graph.
+func componentMetadata(node *sbom.Node) *pkg.ComponentMetadata {
+	metadata := &pkg.ComponentMetadata{
+		Name:             node.GetName(),
+		Version:          node.GetVersion(),
+		Description:      node.GetDescription(),
+		Licenses:         node.GetLicenses(),
+		LicenseConcluded: node.GetLicenseConcluded(),
+		Copyright:        node.GetCopyright(),
+		HomeURL:          node.GetUrlHome(),
+		DownloadURL:      node.GetUrlDownload(),
+	}
+	if metadata.Description == "" {
+		metadata.Description = node.GetSummary()
+	}
+	for algorithm, hash := range node.GetHashes() {
+		if metadata.Hashes == nil {
+			metadata.Hashes = map[string]string{}
+		}
+		// Algorithms are named the way they're written in hash(algorithm:value) queries, as in sha256 and sha3-256
+		name := strings.ToLower(strings.ReplaceAll(sbom.HashAlgorithm(algorithm).String(), "_", "-"))
+		metadata.Hashes[name] = strings.ToLower(hash)
+	}
+	for identifierType, identifier := range node.GetIdentifiers() {
+		if metadata.Identifiers == nil {
+			metadata.Identifiers = map[string]string{}
+		}
+		metadata.Identifiers[strings.ToLower(sbom.SoftwareIdentifierType(identifierType).String())] = identifier
+	}
+	for _, supplier := range node.GetSuppliers() {
+		metadata.Suppliers = append(metadata.Suppliers, personName(supplier))
+	}
+	for _, originator := range node.GetOriginators() {
+		metadata.Originators = append(metadata.Originators, personName(originator))
+	}
+	for _, reference := range node.GetExternalReferences() {
+		metadata.ExternalReferences = append(metadata.ExternalReferences, pkg.ExternalReference{
+			Type:    strings.ToLower(reference.GetType().String()),
+			URL:     reference.GetUrl(),
+			Comment: reference.GetComment(),
+		})
+	}
+	metadata.ReleaseDate = timestampTime(node.GetReleaseDate())
+	return metadata
+}
+
+// timestampTime converts a SBOM timestamp, returning the zero time if it's unset.
+func timestampTime(timestamp *timestamppb.Timestamp) time.Time {
+	if !timestamp.IsValid() || (timestamp.GetSeconds() == 0 && timestamp.GetNanos() == 0) {
+		return time.Time{}
+	}
+	return timestamp.AsTime()
 }
 
-// addDependency iterates over all the edges protobom sbom document and creates a dependency edge between each node in an edge
-func addDependency(document *sbom.Document, storage pkg.Storage, nameToNodeID map[string]uint32) error {
+// personName names a supplier or originator, by their email if they have no name.
+func personName(person *sbom.Person) string {
+	if person.GetName() != "" {
+		return person.GetName()
+	}
+	return person.GetEmail()
+}
+
+// documentEdges returns the dependency edges between the nodes of a protobom sbom document.
+// Each edge is in the direction its relationship type is mapped to, or left out if the type is ignored,
+// and the relationship it was declared with is returned alongside it.
+func documentEdges(document *sbom.Document, nameToNodeID map[string]uint32, relationships RelationshipMapping) ([]pkg.Edge, map[pkg.Edge]pkg.EdgeType, error) {
+	var edges []pkg.Edge
+	types := map[pkg.Edge]pkg.EdgeType{}
 	for _, edge := range document.GetNodeList().GetEdges() {
-		fromProtoNode := document.GetNodeList().GetNodeByID(edge.From)
-		fromPurl := string(fromProtoNode.Purl())
-		if fromPurl == "" {
-			fromPurl = fmt.Sprintf("pkg:generic/%s@%s", fromProtoNode.Name, fromProtoNode.Version)
+		relationship := relationships.relationship(edge.Type)
+		if relationship == Ignored {
+			continue
 		}
-		fromNode, err := storage.GetNode(nameToNodeID[fromPurl])
-		if err != nil {
-			return fmt.Errorf("failed to get node: %w", err)
+		fromProtoNode := document.GetNodeList().GetNodeByID(edge.From)
+		if fromProtoNode == nil {
+			return edges, types, fmt.Errorf("edge from %s references a node that isn't in the document", edge.From)
 		}
 		for _, to := range edge.To {
 			toProtoNode := document.GetNodeList().GetNodeByID(to)
-
-			toPurl := string(toProtoNode.Purl())
-			if toPurl == "" {
-				toPurl = fmt.Sprintf("pkg:generic/%s@%s", toProtoNode.Name, toProtoNode.Version)
+			if toProtoNode == nil {
+				return edges, types, fmt.Errorf("edge from %s to %s references a node that isn't in the document", edge.From, to)
 			}
 
-			toNode, err := storage.GetNode(nameToNodeID[toPurl])
-			if err != nil {
-				return fmt.Errorf("failed to get node: %w", err)
+			dependent, dependency := nameToNodeID[nodeName(fromProtoNode)], nameToNodeID[nodeName(toProtoNode)]
+			if relationship == DependencyOf {
+				dependent, dependency = dependency, dependent
+			}
+			if dependent == dependency {
+				continue
 			}
+			dependencyEdge := pkg.Edge{From: dependent, To: dependency}
+			edges = append(edges, dependencyEdge)
+			types[dependencyEdge] = pkg.EdgeType{Type: edge.Type.String(), Reversed: relationship == DependencyOf}
+		}
+	}
+	return edges, types, nil
+}
 
-			err = fromNode.SetDependency(storage, toNode)
-			if errors.Is(err, pkg.ErrSelfDependency) {
+// addEdges adds the edges to the graph and returns how many of them are new.
+func addEdges(ctx context.Context, storage pkg.Storage, edges []pkg.Edge) (int, error) {
+	var created int
+	nodes := map[uint32]*pkg.Node{}
+	for _, edge := range edges {
+		for _, id := range []uint32{edge.From, edge.To} {
+			if _, ok := nodes[id]; ok {
 				continue
 			}
+			node, err := storage.GetNode(ctx, id)
 			if err != nil {
-				return fmt.Errorf("failed to set dependency: %w", err)
+				return created, fmt.Errorf("failed to get node: %w", err)
 			}
+			nodes[id] = node
+		}
+
+		dependent, dependency := nodes[edge.From], nodes[edge.To]
+		exists := dependent.Children.Contains(dependency.ID)
+		if err := dependent.SetDependency(ctx, storage, dependency); err != nil {
+			return created, fmt.Errorf("failed to set dependency: %w", err)
+		}
+		if !exists {
+			created++
 		}
 	}
-	return nil
+	return created, nil
 }
@@ -1,13 +1,24 @@
 package ingest
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 
+	"github.com/RoaringBitmap/roaring"
 	"github.com/bit-bom/minefield/pkg"
+	"github.com/protobom/protobom/pkg/sbom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIngestSBOM(t *testing.T) {
+	ctx := context.Background()
 	tests := []struct {
 		name     string
 		sbomPath string
@@ -30,25 +41,40 @@ func TestIngestSBOM(t *testing.T) {
 				},
 				3: {
 					ID:   3,
-					Type: "PACKAGE",
-					Name: "pkg:generic/lib-A@1.0.0",
+					Type: "DOCUMENT",
+					Name: "document:pkg:generic/dep1@1.0.0",
 				},
 				4: {
 					ID:   4,
 					Type: "PACKAGE",
+					Name: "pkg:generic/lib-A@1.0.0",
+				},
+				5: {
+					ID:   5,
+					Type: "DOCUMENT",
+					Name: "document:pkg:generic/lib-A@1.0.0",
+				},
+				6: {
+					ID:   6,
+					Type: "PACKAGE",
 					Name: "pkg:generic/lib-B@1.0.0",
 				},
+				7: {
+					ID:   7,
+					Type: "DOCUMENT",
+					Name: "document:pkg:generic/lib-B@1.0.0",
+				},
 			},
 		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			storage := pkg.NewMockStorage()
-			if err := SBOM(test.sbomPath, storage); test.wantErr != (err != nil) {
+			storage := pkg.NewMemoryStorage()
+			if err := SBOM(ctx, test.sbomPath, storage); test.wantErr != (err != nil) {
 				t.Errorf("Sbom() error = %v, wantErr = %v", err, test.wantErr)
 			}
 
-			keys, err := storage.GetAllKeys()
+			keys, err := storage.GetAllKeys(ctx)
 			if err != nil {
 				t.Fatalf("Failed to get all keys, %v", err)
 			}
@@ -58,7 +84,7 @@ func TestIngestSBOM(t *testing.T) {
 			})
 
 			for _, key := range keys {
-				node, err := storage.GetNode(key)
+				node, err := storage.GetNode(ctx, key)
 				if err != nil {
 					t.Fatalf("Failed to get node, %v", err)
 				}
@@ -71,6 +97,18 @@ func TestIngestSBOM(t *testing.T) {
 	}
 }
 
+// addTestNode adds a package to the storage backend.
+func addTestNode(t *testing.T, storage pkg.Storage, name string) *pkg.Node {
+	node, err := pkg.AddNode(context.Background(), storage, "PACKAGE", nil, name)
+	require.NoError(t, err)
+	return node
+}
+
+// addTestDependency makes one node depend on another.
+func addTestDependency(t *testing.T, storage pkg.Storage, from, to *pkg.Node) {
+	require.NoError(t, from.SetDependency(context.Background(), storage, to))
+}
+
 func nodeEquals(n, n2 *pkg.Node) bool {
 	if ((n == nil || n2 == nil) && n != n2) ||
 		(n != nil && (n.ID != n2.ID || n.Type != n2.Type)) {
@@ -78,3 +116,488 @@ func nodeEquals(n, n2 *pkg.Node) bool {
 	}
 	return true
 }
+
+func TestIngestSBOMConcurrently(t *testing.T) {
+	ctx := context.Background()
+	const documents, shared = 20, 5
+
+	storage := pkg.NewMemoryStorage()
+	var wg sync.WaitGroup
+	errs := make(chan error, documents)
+	for i := 0; i < documents; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := processSBOMDocument(ctx, sharedDependenciesDocument(i, shared), storage, documentOptions{}, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to ingest SBOM, %v", err)
+		}
+	}
+
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get all keys, %v", err)
+	}
+	// Every document adds its app, and a document node
+	if len(keys) != 2*documents+shared {
+		t.Fatalf("Expected %d nodes, got %d", 2*documents+shared, len(keys))
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		t.Fatalf("Failed to get nodes, %v", err)
+	}
+
+	names := map[string]bool{}
+	for id := uint32(1); id <= uint32(2*documents+shared); id++ {
+		node, ok := nodes[id]
+		if !ok {
+			t.Fatalf("Expected node IDs to be contiguous, missing %d", id)
+		}
+		if names[node.Name] {
+			t.Fatalf("Duplicate node %s", node.Name)
+		}
+		names[node.Name] = true
+	}
+
+	for j := 0; j < shared; j++ {
+		id, err := storage.NameToID(ctx, fmt.Sprintf("pkg:generic/shared-%d@1.0.0", j))
+		if err != nil {
+			t.Fatalf("Failed to get shared node, %v", err)
+		}
+		wantParents := documents
+		if j > 0 {
+			wantParents++
+		}
+		if got := int(nodes[id].Parents.GetCardinality()); got != wantParents {
+			t.Errorf("Expected shared-%d to have %d parents, got %d", j, wantParents, got)
+		}
+	}
+}
+
+// sharedDependenciesDocument returns an SBOM for app-i that depends on the same chain of shared packages as every other app.
+func sharedDependenciesDocument(i, shared int) *sbom.Document {
+	document := sbom.NewDocument()
+	app := &sbom.Node{Id: "app", Name: fmt.Sprintf("app-%d", i), Version: "1.0.0", Type: sbom.Node_PACKAGE}
+	document.NodeList.AddNode(app)
+	for j := 0; j < shared; j++ {
+		id := fmt.Sprintf("shared-%d", j)
+		document.NodeList.AddNode(&sbom.Node{Id: id, Name: id, Version: "1.0.0", Type: sbom.Node_PACKAGE})
+		document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: app.Id, To: []string{id}})
+		if j > 0 {
+			document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: fmt.Sprintf("shared-%d", j-1), To: []string{id}})
+		}
+	}
+	return document
+}
+
+func TestSBOMWithOptions(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	for _, name := range []string{"dep1.json", "libA.json", "libB.json"} {
+		data, err := os.ReadFile(filepath.Join("../../test", name))
+		if err != nil {
+			t.Fatalf("Failed to read test SBOM, %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("Failed to write test SBOM, %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("not an sbom"), 0o600); err != nil {
+		t.Fatalf("Failed to write broken SBOM, %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "vendor"), 0o700); err != nil {
+		t.Fatalf("Failed to create directory, %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "vendor", "other.json"), []byte("not an sbom"), 0o600); err != nil {
+		t.Fatalf("Failed to write excluded file, %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# SBOMs"), 0o600); err != nil {
+		t.Fatalf("Failed to write readme, %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    SBOMOptions
+		want    SBOMReport
+		wantErr bool
+	}{
+		{
+			name: "continue on error",
+			opts: SBOMOptions{Workers: 4, Include: []string{"*.json"}, Exclude: []string{"vendor"}, ContinueOnError: true},
+			want: SBOMReport{Files: 3, Nodes: 4, Edges: 3, Duplicates: 2},
+		},
+		{
+			name: "excluded broken file",
+			opts: SBOMOptions{Workers: 4, Include: []string{"*.json"}, Exclude: []string{"vendor", "broken.json"}},
+			want: SBOMReport{Files: 3, Nodes: 4, Edges: 3, Duplicates: 2},
+		},
+		{
+			name:    "stop on error",
+			opts:    SBOMOptions{Workers: 1, Include: []string{"broken.json"}},
+			wantErr: true,
+		},
+		{
+			name:    "bad pattern",
+			opts:    SBOMOptions{Include: []string{"["}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := pkg.NewMemoryStorage()
+			report, err := SBOMWithOptions(ctx, dir, storage, test.opts)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, test.want.Files, report.Files)
+			assert.Equal(t, test.want.Nodes, report.Nodes)
+			assert.Equal(t, test.want.Edges, report.Edges)
+			assert.Equal(t, test.want.Duplicates, report.Duplicates)
+			if test.opts.ContinueOnError {
+				assert.Len(t, report.Errors, 1)
+				assert.Equal(t, filepath.Join(dir, "broken.json"), report.Errors[0].Path)
+			} else {
+				assert.Empty(t, report.Errors)
+			}
+		})
+	}
+}
+
+func TestIngestSBOMProvenance(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	if err := SBOM(ctx, "../../test", storage); err != nil {
+		t.Fatalf("Failed to ingest SBOMs, %v", err)
+	}
+
+	id := func(name string) uint32 {
+		id, err := storage.NameToID(ctx, name)
+		if err != nil {
+			t.Fatalf("Failed to get node ID for %s, %v", name, err)
+		}
+		return id
+	}
+	dep1, libA := id("pkg:generic/dep1@1.0.0"), id("pkg:generic/lib-A@1.0.0")
+	dep1Document, libADocument, libBDocument := id("document:pkg:generic/dep1@1.0.0"), id("document:pkg:generic/lib-A@1.0.0"), id("document:pkg:generic/lib-B@1.0.0")
+
+	documents, err := storage.GetNodeProvenance(ctx, dep1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{dep1Document, libADocument, libBDocument}, documents.ToArray())
+
+	documents, err = storage.GetEdgeProvenance(ctx, pkg.Edge{From: libA, To: dep1})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{libADocument}, documents.ToArray())
+
+	nodes, err := storage.GetDocumentNodes(ctx, libADocument)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{dep1, libA}, nodes.ToArray())
+
+	documentNode, err := storage.GetNode(ctx, libADocument)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{libA}, documentNode.Children.ToArray(), "Expected the document to depend on its root component")
+	metadata, err := pkg.NodeDocumentMetadata(documentNode)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pkg:generic/lib-A@1.0.0"}, metadata.RootElements)
+}
+
+func TestReingestSBOM(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	product := func(version string, edges map[string][]string) *sbom.Document {
+		document := sbom.NewDocument()
+		document.Metadata.Id = "urn:uuid:product"
+		document.Metadata.Version = version
+		document.NodeList.AddRootNode(&sbom.Node{Id: "app", Name: "app", Version: "1.0.0", Type: sbom.Node_PACKAGE})
+		for from, tos := range edges {
+			for _, to := range tos {
+				if document.NodeList.GetNodeByID(to) == nil {
+					document.NodeList.AddNode(&sbom.Node{Id: to, Name: to, Version: "1.0.0", Type: sbom.Node_PACKAGE})
+				}
+				document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: from, To: []string{to}})
+			}
+		}
+		return document
+	}
+
+	// Each document is ingested as its own run, and so its own version of the graph
+	ingest := func(document *sbom.Document) (ingestStats, error) {
+		changes := pkg.NewGraphChanges()
+		stats, err := processSBOMDocument(ctx, document, storage, documentOptions{}, changes)
+		if err != nil {
+			return stats, err
+		}
+		_, err = changes.Record(ctx, storage, pkg.VersionSourceSBOM)
+		return stats, err
+	}
+
+	_, err := ingest(product("1", map[string][]string{"app": {"a", "b"}, "b": {"c"}}))
+	assert.NoError(t, err)
+	// Another document also claims app depends on b
+	other := product("1", map[string][]string{"app": {"b"}})
+	other.Metadata.Id = "urn:uuid:other"
+	_, err = ingest(other)
+	assert.NoError(t, err)
+	assert.NoError(t, pkg.Cache(ctx, storage))
+
+	stats, err := ingest(product("2", map[string][]string{"app": {"a", "d"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.removedEdges, "Expected only b -> c to be removed")
+
+	id := func(name string) uint32 {
+		id, err := storage.NameToID(ctx, "pkg:generic/"+name+"@1.0.0")
+		assert.NoError(t, err)
+		return id
+	}
+	app, a, b, c, d := id("app"), id("a"), id("b"), id("c"), id("d")
+
+	appNode, err := storage.GetNode(ctx, app)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uint32{a, b, d}, appNode.Children.ToArray())
+	bNode, err := storage.GetNode(ctx, b)
+	assert.NoError(t, err)
+	assert.True(t, bNode.Children.IsEmpty())
+
+	toBeCached, err := storage.ToBeCached(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, toBeCached, b)
+	assert.Contains(t, toBeCached, c)
+
+	documentID, err := storage.NameToID(ctx, "document:urn:uuid:product")
+	assert.NoError(t, err)
+	documents, err := storage.GetNodeProvenance(ctx, c)
+	assert.NoError(t, err)
+	assert.NotContains(t, documents.ToArray(), documentID)
+	documents, err = storage.GetEdgeProvenance(ctx, pkg.Edge{From: app, To: b})
+	assert.NoError(t, err)
+	assert.NotContains(t, documents.ToArray(), documentID)
+	assert.Equal(t, uint64(1), documents.GetCardinality())
+
+	documentNode, err := storage.GetNode(ctx, documentID)
+	assert.NoError(t, err)
+	metadata, err := pkg.NodeDocumentMetadata(documentNode)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", metadata.Version)
+
+	assert.NoError(t, pkg.Cache(ctx, storage))
+	dependencies, err := appNode.QueryDependencies(ctx, storage)
+	assert.NoError(t, err)
+	assert.False(t, dependencies.Contains(c), "Expected c to no longer be a dependency of app")
+
+	// Every ingest is a version of the graph, and the graph can be queried as it was before the reingest
+	versions, err := storage.GetGraphVersions(ctx)
+	assert.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, []string{"document:urn:uuid:other"}, versions[1].Documents)
+	assert.Equal(t, []string{"document:urn:uuid:product"}, versions[2].Documents)
+	assert.Equal(t, pkg.VersionSourceSBOM, versions[2].Source)
+	asOf, err := pkg.GraphAsOf(ctx, storage, versions[0].Version)
+	assert.NoError(t, err)
+	appNode, err = asOf.GetNode(ctx, app)
+	assert.NoError(t, err)
+	dependencies, err = appNode.QueryDependencies(ctx, asOf)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uint32{a, b, c}, dependencies.ToArray())
+	_, err = asOf.GetNode(ctx, d)
+	assert.Error(t, err, "Expected d to be added by the reingest")
+}
+
+// interleavedStorage runs another ingest right after the first check that finds an edge declared by no document,
+// which is when an ingest running at the same time does the most harm.
+type interleavedStorage struct {
+	pkg.Storage
+	interleave func()
+}
+
+func (s *interleavedStorage) GetEdgeProvenance(ctx context.Context, edge pkg.Edge) (*roaring.Bitmap, error) {
+	documents, err := s.Storage.GetEdgeProvenance(ctx, edge)
+	if err == nil && documents.IsEmpty() && s.interleave != nil {
+		interleave := s.interleave
+		s.interleave = nil
+		interleave()
+	}
+	return documents, err
+}
+
+func TestReingestSBOMConcurrently(t *testing.T) {
+	ctx := context.Background()
+	storage := &interleavedStorage{Storage: pkg.NewMemoryStorage()}
+
+	document := func(id string, dependencies ...string) *sbom.Document {
+		document := sbom.NewDocument()
+		document.Metadata.Id = id
+		document.NodeList.AddRootNode(&sbom.Node{Id: "app", Name: "app", Version: "1.0.0", Type: sbom.Node_PACKAGE})
+		for _, dependency := range dependencies {
+			document.NodeList.AddNode(&sbom.Node{Id: dependency, Name: dependency, Version: "1.0.0", Type: sbom.Node_PACKAGE})
+			document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "app", To: []string{dependency}})
+		}
+		return document
+	}
+	_, err := processSBOMDocument(ctx, document("urn:uuid:product", "a", "b"), storage, documentOptions{}, nil)
+	require.NoError(t, err)
+
+	// The product drops app -> b while another document that declares it is ingested, which must keep the edge
+	storage.interleave = func() {
+		_, err := processSBOMDocument(ctx, document("urn:uuid:other", "b"), storage, documentOptions{}, nil)
+		require.NoError(t, err)
+	}
+	_, err = processSBOMDocument(ctx, document("urn:uuid:product", "a"), storage, documentOptions{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, storage.interleave, "Expected the other document to be ingested during the reingest")
+
+	app, err := storage.NameToID(ctx, "pkg:generic/app@1.0.0")
+	require.NoError(t, err)
+	b, err := storage.NameToID(ctx, "pkg:generic/b@1.0.0")
+	require.NoError(t, err)
+	appNode, err := storage.GetNode(ctx, app)
+	require.NoError(t, err)
+	assert.True(t, appNode.Children.Contains(b), "Expected app -> b to be kept for the other document")
+	documents, err := storage.GetEdgeProvenance(ctx, pkg.Edge{From: app, To: b})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), documents.GetCardinality())
+}
+
+func TestIngestSBOMComponentMetadata(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	document := sbom.NewDocument()
+	document.Metadata.Id = "urn:uuid:component-metadata"
+	document.NodeList.AddRootNode(&sbom.Node{
+		Id:               "app",
+		Name:             "app",
+		Version:          "1.0.0",
+		Type:             sbom.Node_PACKAGE,
+		Licenses:         []string{"Apache-2.0 OR MIT"},
+		LicenseConcluded: "MIT",
+		Hashes:           map[int32]string{int32(sbom.HashAlgorithm_SHA256): "ABC123"},
+		Identifiers: map[int32]string{
+			int32(sbom.SoftwareIdentifierType_PURL):  "pkg:generic/app@1.0.0",
+			int32(sbom.SoftwareIdentifierType_CPE23): "cpe:2.3:a:example:app:1.0.0:*:*:*:*:*:*:*",
+		},
+		Suppliers: []*sbom.Person{{Name: "Example Inc", IsOrg: true}},
+		ExternalReferences: []*sbom.ExternalReference{
+			{Type: sbom.ExternalReference_VCS, Url: "https://github.com/example/app"},
+		},
+	})
+	document.NodeList.AddNode(&sbom.Node{
+		Id:       "lib",
+		Name:     "lib",
+		Version:  "2.0.0",
+		Type:     sbom.Node_PACKAGE,
+		Licenses: []string{"GPL-3.0-only WITH Classpath-exception-2.0"},
+		Hashes:   map[int32]string{int32(sbom.HashAlgorithm_SHA3_256): "def456"},
+	})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "app", To: []string{"lib"}})
+
+	_, err := processSBOMDocument(ctx, document, storage, documentOptions{}, nil)
+	require.NoError(t, err)
+
+	id, err := storage.NameToID(ctx, "pkg:generic/app@1.0.0")
+	require.NoError(t, err)
+	node, err := storage.GetNode(ctx, id)
+	require.NoError(t, err)
+	metadata, err := pkg.NodeComponentMetadata(node)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"sha256": "abc123"}, metadata.Hashes)
+	assert.Equal(t, "cpe:2.3:a:example:app:1.0.0:*:*:*:*:*:*:*", metadata.Identifiers["cpe23"])
+	assert.Equal(t, []string{"Example Inc"}, metadata.Suppliers)
+	assert.Equal(t, []pkg.ExternalReference{{Type: "vcs", URL: "https://github.com/example/app"}}, metadata.ExternalReferences)
+
+	lib, err := storage.NameToID(ctx, "pkg:generic/lib@2.0.0")
+	require.NoError(t, err)
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{query: "license(MIT)", want: []uint32{id}},
+		{query: "license(gpl-3.0-only)", want: []uint32{lib}},
+		{query: "license(Classpath-exception-2.0)", want: nil},
+		{query: "hash(sha256:abc123)", want: []uint32{id}},
+		{query: "hash(sha3-256:DEF456)", want: []uint32{lib}},
+		{query: "cpe(cpe:2.3:a:example:app:1.0.0:*:*:*:*:*:*:*)", want: []uint32{id}},
+		{query: "license(Apache-2.0) or license(GPL-3.0-only)", want: []uint32{id, lib}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			result, err := pkg.ParseAndExecute(ctx, test.query, storage, "")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.want, result.ToArray())
+		})
+	}
+}
+
+func TestReingestSPDX(t *testing.T) {
+	ctx := context.Background()
+
+	// Every version of a SPDX document has a new namespace, or none at all, which protobom makes up when reading it
+	spdx := func(namespace string, dependencies ...string) []byte {
+		packages := `{"SPDXID": "SPDXRef-app", "name": "app", "versionInfo": "1.0.0", "downloadLocation": "NOASSERTION"}`
+		relationships := `{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-app"}`
+		for _, dependency := range dependencies {
+			packages += fmt.Sprintf(`, {"SPDXID": "SPDXRef-%s", "name": "%s", "versionInfo": "1.0.0", "downloadLocation": "NOASSERTION"}`, dependency, dependency)
+			relationships += fmt.Sprintf(`, {"spdxElementId": "SPDXRef-app", "relationshipType": "DEPENDS_ON", "relatedSpdxElement": "SPDXRef-%s"}`, dependency)
+		}
+		return []byte(fmt.Sprintf(`{
+			"spdxVersion": "SPDX-2.3", "dataLicense": "CC0-1.0", "SPDXID": "SPDXRef-DOCUMENT", "name": "app",
+			"documentNamespace": %q, "creationInfo": {"created": "2024-01-01T00:00:00Z", "creators": ["Tool: test"]},
+			"packages": [%s], "relationships": [%s]
+		}`, namespace, packages, relationships))
+	}
+	dependencies := func(storage pkg.Storage) []string {
+		app, err := storage.NameToID(ctx, "pkg:generic/app@1.0.0")
+		require.NoError(t, err)
+		node, err := storage.GetNode(ctx, app)
+		require.NoError(t, err)
+		children, err := storage.GetNodes(ctx, node.Children.ToArray())
+		require.NoError(t, err)
+		var names []string
+		for _, child := range children {
+			names = append(names, child.Name)
+		}
+		return names
+	}
+
+	for _, namespaces := range [][2]string{
+		{"https://example.com/app-1", "https://example.com/app-2"},
+		{"", ""},
+	} {
+		storage := pkg.NewMemoryStorage()
+		require.NoError(t, SBOMFromReader(ctx, bytes.NewReader(spdx(namespaces[0], "a", "b")), storage))
+		require.NoError(t, SBOMFromReader(ctx, bytes.NewReader(spdx(namespaces[1], "a")), storage))
+
+		assert.ElementsMatch(t, []string{"pkg:generic/a@1.0.0"}, dependencies(storage), "Expected app -> b to be removed")
+		keys, err := storage.GetAllKeys(ctx)
+		require.NoError(t, err)
+		nodes, err := storage.GetNodes(ctx, keys)
+		require.NoError(t, err)
+		var documents []string
+		for _, node := range nodes {
+			if node.Type == pkg.DocumentNodeType {
+				documents = append(documents, node.Name)
+			}
+		}
+		assert.Equal(t, []string{"document:app"}, documents)
+	}
+
+	// Tools that keep the namespace can have documents identified by it
+	storage := pkg.NewMemoryStorage()
+	for _, name := range []string{"app-1.json", "app-2.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, spdx("https://example.com/app", "a"), 0o600))
+		_, err := SBOMWithOptions(ctx, path, storage, SBOMOptions{SPDXNamespaceIdentity: true})
+		require.NoError(t, err)
+	}
+	_, err := storage.NameToID(ctx, "document:https://example.com/app#DOCUMENT")
+	assert.NoError(t, err)
+}
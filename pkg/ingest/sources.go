@@ -0,0 +1,623 @@
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// StdinPath is the path that makes SBOMWithOptions read a single SBOM or archive from stdin.
+const StdinPath = "-"
+
+// sbomMediaTypes are the OCI media types of blobs that are SBOM documents.
+var sbomMediaTypes = map[string]bool{
+	"application/spdx+json":          true,
+	"text/spdx":                      true,
+	"application/vnd.cyclonedx+json": true,
+	"application/vnd.cyclonedx+xml":  true,
+	"application/vnd.cyclonedx":      true,
+}
+
+// Media types of OCI blobs that may wrap SBOM documents.
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	inTotoMediaType      = "application/vnd.in-toto+json"
+	dsseMediaType        = "application/vnd.dsse.envelope.v1+json"
+)
+
+// maxEntrySize is the largest archive entry that is read once decompressed,
+// so a small archive can't exhaust memory by decompressing to something huge.
+var maxEntrySize int64 = 256 << 20
+
+// sbomSource is a single SBOM document to ingest: a file on disk, an entry that is loaded when it's read,
+// or data that has been read into memory. Entries loaded from a file on disk, such as an archive, have its path.
+type sbomSource struct {
+	name string
+	path string
+	load func() ([]byte, error)
+	data []byte
+}
+
+func (s sbomSource) read() ([]byte, error) {
+	if s.data != nil {
+		return s.data, nil
+	}
+	if s.load != nil {
+		return s.load()
+	}
+	return os.ReadFile(s.path)
+}
+
+// sbomSources returns the SBOM documents at sbomPath, which is StdinPath, a SBOM file, an archive of SBOM files,
+// an OCI image layout, or a directory of any of those.
+// Files in a directory or an archive are only ingested if they match the include and exclude patterns,
+// although archives are expanded whether or not they match.
+func sbomSources(sbomPath string, include, exclude []string) ([]sbomSource, error) {
+	if sbomPath == StdinPath {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		if kind := archiveKind(data); kind != "" {
+			open := func() (*io.SectionReader, func() error, error) {
+				return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), func() error { return nil }, nil
+			}
+			return archiveSources("stdin", kind, open, include, exclude)
+		}
+		return []sbomSource{{name: "stdin", data: data}}, nil
+	}
+
+	info, err := os.Stat(sbomPath)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing path %s: %w", sbomPath, err)
+	}
+	if !info.IsDir() {
+		sources, isArchive, err := fileArchiveSources(sbomPath, include, exclude)
+		if err != nil || isArchive {
+			return sources, err
+		}
+		return []sbomSource{{name: sbomPath, path: sbomPath}}, nil
+	}
+	if isOCILayout(sbomPath) {
+		return ociLayoutSources(sbomPath)
+	}
+
+	var sources []sbomSource
+	err = filepath.WalkDir(sbomPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read directory %s: %w", path, err)
+		}
+		if path == sbomPath {
+			return nil
+		}
+		rel, err := filepath.Rel(sbomPath, path)
+		if err != nil {
+			return err
+		}
+		if matchesAny(exclude, rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if isOCILayout(path) {
+				layoutSources, err := ociLayoutSources(path)
+				if err != nil {
+					return err
+				}
+				sources = append(sources, layoutSources...)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		archived, isArchive, err := fileArchiveSources(path, include, exclude)
+		if err != nil {
+			return err
+		}
+		if isArchive {
+			sources = append(sources, archived...)
+		} else if len(include) == 0 || matchesAny(include, rel) {
+			sources = append(sources, sbomSource{name: path, path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// matchesAny reports whether any of the patterns matches the relative path or its base name.
+// The patterns must have been validated beforehand.
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveKind detects whether data starts like a gzip, zip or tar archive, returning "" if it doesn't.
+func archiveKind(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return "zip"
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return "tar"
+	default:
+		return ""
+	}
+}
+
+// fileArchiveSources returns the SBOM documents in the file at path if it is an archive.
+func fileArchiveSources(path string, include, exclude []string) ([]sbomSource, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	f.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	kind := archiveKind(header[:n])
+	if kind == "" {
+		return nil, false, nil
+	}
+
+	open := func() (*io.SectionReader, func() error, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		return io.NewSectionReader(f, 0, info.Size()), f.Close, nil
+	}
+	sources, err := archiveSources(path, kind, open, include, exclude)
+	for i := range sources {
+		sources[i].path = path
+	}
+	return sources, true, err
+}
+
+// archiveOpener opens an archive for reading, returning it along with a function that closes it.
+type archiveOpener func() (*io.SectionReader, func() error, error)
+
+// readArchive opens an archive again to read one of its entries.
+func readArchive(open archiveOpener, read func(r *io.SectionReader) ([]byte, error)) ([]byte, error) {
+	r, closeArchive, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchive()
+	return read(r)
+}
+
+// readLimited reads an archive entry, failing if it's larger than maxEntrySize.
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxEntrySize {
+		return nil, fmt.Errorf("entry is larger than %d bytes", maxEntrySize)
+	}
+	return data, nil
+}
+
+// archiveSources lists the SBOM documents in an archive. Entries aren't read until the documents are,
+// so only the documents being ingested are held in memory, and none larger than maxEntrySize.
+// Gzip compressed data that isn't a tar archive is treated as a single compressed document.
+func archiveSources(name, kind string, open archiveOpener, include, exclude []string) ([]sbomSource, error) {
+	r, closeArchive, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchive()
+
+	var sources []sbomSource
+	// add adds the entry unless the patterns leave it out, and returns whether it was added
+	add := func(entryName string, load func() ([]byte, error)) bool {
+		entryName = strings.TrimPrefix(path.Clean("/"+entryName), "/")
+		if matchesAny(exclude, entryName) || (len(include) > 0 && !matchesAny(include, entryName)) {
+			return false
+		}
+		sources = append(sources, sbomSource{name: name + "!" + entryName, load: load})
+		return true
+	}
+
+	switch kind {
+	case "zip":
+		archive, err := zip.NewReader(r, r.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip archive %s: %w", name, err)
+		}
+		for i, file := range archive.File {
+			if !file.Mode().IsRegular() {
+				continue
+			}
+			add(file.Name, func() ([]byte, error) {
+				return readArchive(open, func(r *io.SectionReader) ([]byte, error) {
+					archive, err := zip.NewReader(r, r.Size())
+					if err != nil {
+						return nil, fmt.Errorf("failed to read zip archive %s: %w", name, err)
+					}
+					if i >= len(archive.File) || archive.File[i].Name != file.Name {
+						return nil, fmt.Errorf("zip archive %s changed since it was listed", name)
+					}
+					data, err := readZipFile(archive.File[i])
+					if err != nil {
+						return nil, fmt.Errorf("failed to read %s from zip archive %s: %w", file.Name, name, err)
+					}
+					return data, nil
+				})
+			})
+		}
+		return sources, nil
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip archive %s: %w", name, err)
+		}
+		defer gz.Close()
+		header := make([]byte, 512)
+		n, err := io.ReadFull(gz, header)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read gzip archive %s: %w", name, err)
+		}
+		if archiveKind(header[:n]) != "tar" {
+			return []sbomSource{{name: name, load: func() ([]byte, error) {
+				return readArchive(open, func(r *io.SectionReader) ([]byte, error) {
+					gz, err := gzip.NewReader(r)
+					if err != nil {
+						return nil, fmt.Errorf("failed to read gzip archive %s: %w", name, err)
+					}
+					defer gz.Close()
+					return readLimited(gz)
+				})
+			}}}, nil
+		}
+		// Entries of a compressed archive can only be reached by decompressing it up to them, so they're all read
+		// from one stream rather than each decompressing the archive again
+		stream := &tarStream{name: name, open: open, unloaded: map[int]bool{}, passed: map[int]passedEntry{}}
+		index := 0
+		err = tarEntries(name, io.MultiReader(bytes.NewReader(header[:n]), gz), func(entryName string, _, _ int64) {
+			i := index
+			index++
+			if add(entryName, func() ([]byte, error) { return stream.load(i) }) {
+				stream.unloaded[i] = true
+			}
+		})
+		return sources, err
+	case "tar":
+		err := tarEntries(name, r, func(entryName string, offset, size int64) {
+			add(entryName, func() ([]byte, error) {
+				return readArchive(open, func(r *io.SectionReader) ([]byte, error) {
+					return readLimited(io.NewSectionReader(r, offset, size))
+				})
+			})
+		})
+		return sources, err
+	default:
+		return nil, fmt.Errorf("unknown archive kind %s", kind)
+	}
+}
+
+// tarEntries calls entry with the name, offset and size of each regular file in a tar archive.
+func tarEntries(name string, r io.Reader, entry func(entryName string, offset, size int64)) error {
+	counter := &countingReader{r: r}
+	archive := tar.NewReader(counter)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive %s: %w", name, err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			// The tar reader reads whole blocks, so the entry's data starts where the reader stopped
+			entry(header.Name, counter.n, header.Size)
+		}
+	}
+}
+
+// tarStream reads the regular files of a compressed tar archive, identified by their index, decompressing the archive
+// once for all of them as long as they're read in about the order they're listed.
+// Files are read concurrently by the workers they were handed to in order, so a file that is passed over to reach
+// a later one is kept until its worker reads it, which only holds as many files in memory as there are workers.
+type tarStream struct {
+	name string
+	open archiveOpener
+
+	mu           sync.Mutex
+	archive      *tar.Reader
+	closeArchive func() error
+	// next is the index of the next regular file in the archive.
+	next int
+	// unloaded are the files that haven't been read yet, the stream is closed once there are none.
+	unloaded map[int]bool
+	passed   map[int]passedEntry
+}
+
+// passedEntry is a file of a tarStream that was read to reach a later one.
+type passedEntry struct {
+	data []byte
+	err  error
+}
+
+func (s *tarStream) load(index int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.passed[index]; ok {
+		delete(s.passed, index)
+		s.loaded(index)
+		return entry.data, entry.err
+	}
+	// Files are only read again from the start, after the stream has passed them
+	if s.archive == nil || index < s.next {
+		if err := s.reopen(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		header, err := s.archive.Next()
+		if errors.Is(err, io.EOF) {
+			s.close()
+			return nil, fmt.Errorf("tar archive %s changed since it was listed", s.name)
+		}
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("failed to read tar archive %s: %w", s.name, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		current := s.next
+		s.next++
+		switch {
+		case current == index:
+			data, err := readLimited(s.archive)
+			s.loaded(index)
+			return data, err
+		case current > index:
+			return nil, fmt.Errorf("tar archive %s changed since it was listed", s.name)
+		case s.unloaded[current]:
+			if _, ok := s.passed[current]; !ok {
+				data, err := readLimited(s.archive)
+				s.passed[current] = passedEntry{data: data, err: err}
+			}
+		}
+	}
+}
+
+// reopen starts reading the archive again from the start.
+func (s *tarStream) reopen() error {
+	s.close()
+	r, closeArchive, err := s.open()
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		closeArchive()
+		return fmt.Errorf("failed to read gzip archive %s: %w", s.name, err)
+	}
+	s.archive, s.closeArchive, s.next = tar.NewReader(gz), closeArchive, 0
+	return nil
+}
+
+// loaded records that a file was read, and closes the archive once every file was.
+func (s *tarStream) loaded(index int) {
+	delete(s.unloaded, index)
+	if len(s.unloaded) == 0 {
+		s.close()
+	}
+}
+
+func (s *tarStream) close() {
+	if s.closeArchive != nil {
+		s.closeArchive()
+	}
+	s.archive, s.closeArchive = nil, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return readLimited(rc)
+}
+
+// ociDescriptor is the part of an OCI content descriptor needed to find SBOM blobs.
+type ociDescriptor struct {
+	MediaType    string `json:"mediaType"`
+	ArtifactType string `json:"artifactType"`
+	Digest       string `json:"digest"`
+}
+
+// ociManifest is the part of an OCI image manifest or index needed to find SBOM blobs.
+type ociManifest struct {
+	MediaType    string          `json:"mediaType"`
+	ArtifactType string          `json:"artifactType"`
+	Config       ociDescriptor   `json:"config"`
+	Layers       []ociDescriptor `json:"layers"`
+	Manifests    []ociDescriptor `json:"manifests"`
+}
+
+func isOCILayout(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "oci-layout"))
+	return err == nil && !info.IsDir()
+}
+
+// ociLayoutSources finds the SBOM blobs of every image in an OCI image layout, including attestations wrapping SBOMs.
+func ociLayoutSources(dir string) ([]sbomSource, error) {
+	var (
+		sources []sbomSource
+		seen    = map[string]bool{}
+	)
+
+	var walk func(descriptor ociDescriptor) error
+	walk = func(descriptor ociDescriptor) error {
+		if seen[descriptor.Digest] {
+			return nil
+		}
+		seen[descriptor.Digest] = true
+
+		blobPath, err := ociBlobPath(dir, descriptor.Digest)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sbomMediaTypes[descriptor.MediaType]:
+			sources = append(sources, sbomSource{name: dir + "@" + descriptor.Digest, path: blobPath})
+			return nil
+		case descriptor.MediaType == inTotoMediaType || descriptor.MediaType == dsseMediaType:
+			// The attestation is read again when the SBOM is, so it isn't held in memory until then
+			predicate := func() ([]byte, bool, error) {
+				data, err := os.ReadFile(blobPath)
+				if err != nil {
+					return nil, false, fmt.Errorf("failed to read blob %s: %w", descriptor.Digest, err)
+				}
+				predicate, ok, err := attestationPredicate(descriptor.MediaType, data)
+				if err != nil {
+					return nil, false, fmt.Errorf("failed to read attestation %s: %w", descriptor.Digest, err)
+				}
+				return predicate, ok, nil
+			}
+			if _, ok, err := predicate(); err != nil || !ok {
+				return err
+			}
+			sources = append(sources, sbomSource{name: dir + "@" + descriptor.Digest, path: blobPath, load: func() ([]byte, error) {
+				data, _, err := predicate()
+				return data, err
+			}})
+			return nil
+		case descriptor.MediaType == ociManifestMediaType || descriptor.MediaType == ociIndexMediaType:
+			data, err := os.ReadFile(blobPath)
+			if err != nil {
+				return fmt.Errorf("failed to read blob %s: %w", descriptor.Digest, err)
+			}
+			var manifest ociManifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return fmt.Errorf("failed to parse manifest %s: %w", descriptor.Digest, err)
+			}
+			for _, child := range append(manifest.Manifests, manifest.Layers...) {
+				// Artifacts often give their layers a generic media type and describe the content in the artifact type
+				if child.MediaType != ociManifestMediaType && child.MediaType != ociIndexMediaType && sbomMediaTypes[manifest.ArtifactType] {
+					child.MediaType = manifest.ArtifactType
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCI layout index: %w", err)
+	}
+	var index ociManifest
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse OCI layout index: %w", err)
+	}
+	for _, descriptor := range index.Manifests {
+		if err := walk(descriptor); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// ociBlobPath returns the path of a blob in an OCI image layout, rejecting digests that would escape it.
+func ociBlobPath(dir, digest string) (string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || encoded == "" || strings.ContainsAny(digest, `/\.`) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(dir, "blobs", algorithm, encoded), nil
+}
+
+// attestationPredicate returns the SBOM in an in-toto attestation, optionally wrapped in a DSSE envelope.
+// It returns false for attestations that aren't SBOMs.
+func attestationPredicate(mediaType string, data []byte) ([]byte, bool, error) {
+	if mediaType == dsseMediaType {
+		var envelope struct {
+			PayloadType string `json:"payloadType"`
+			Payload     string `json:"payload"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, false, err
+		}
+		if envelope.PayloadType != inTotoMediaType {
+			return nil, false, nil
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decode payload: %w", err)
+		}
+		data = payload
+	}
+
+	var statement struct {
+		PredicateType string          `json:"predicateType"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, false, err
+	}
+	predicateType := strings.ToLower(statement.PredicateType)
+	if !strings.Contains(predicateType, "spdx") && !strings.Contains(predicateType, "cyclonedx") {
+		return nil, false, nil
+	}
+	return statement.Predicate, true, nil
+}
@@ -0,0 +1,282 @@
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSBOMs = []string{"dep1.json", "libA.json", "libB.json"}
+
+func readTestSBOMs(t *testing.T) map[string][]byte {
+	sboms := map[string][]byte{}
+	for _, name := range testSBOMs {
+		data, err := os.ReadFile(filepath.Join("../../test", name))
+		require.NoError(t, err)
+		sboms[name] = data
+	}
+	return sboms
+}
+
+func writeTarGz(t *testing.T, path string, files map[string][]byte) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writeTarTo(t, gz, files)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+func writeTar(t *testing.T, path string, files map[string][]byte) {
+	var buf bytes.Buffer
+	writeTarTo(t, &buf, files)
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+func writeTarTo(t *testing.T, w io.Writer, files map[string][]byte) {
+	tw := tar.NewWriter(w)
+	for name, data := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
+
+func writeZip(t *testing.T, path string, files map[string][]byte) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+// writeBlob adds a blob to an OCI image layout and returns its descriptor.
+func writeBlob(t *testing.T, dir, mediaType string, data []byte) ociDescriptor {
+	digest := fmt.Sprintf("%x", sha256.Sum256(data))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "blobs", "sha256", digest), data, 0o600))
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + digest}
+}
+
+func writeOCILayout(t *testing.T, dir string, sboms map[string][]byte) {
+	marshal := func(v any) []byte {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return data
+	}
+
+	// An image with one SBOM attached as an artifact
+	config := writeBlob(t, dir, "application/vnd.oci.empty.v1+json", []byte("{}"))
+	sbomLayer := writeBlob(t, dir, "application/vnd.cyclonedx+json", sboms["dep1.json"])
+	otherLayer := writeBlob(t, dir, "application/vnd.oci.image.layer.v1.tar+gzip", []byte("not an sbom"))
+	artifact := writeBlob(t, dir, ociManifestMediaType, marshal(map[string]any{
+		"mediaType": ociManifestMediaType,
+		"config":    config,
+		"layers":    []ociDescriptor{sbomLayer, otherLayer},
+	}))
+
+	// Another SBOM attested in an in-toto statement, signed in a DSSE envelope
+	var predicate map[string]any
+	require.NoError(t, json.Unmarshal(sboms["libA.json"], &predicate))
+	statement := marshal(map[string]any{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"predicateType": "https://cyclonedx.org/bom",
+		"predicate":     predicate,
+	})
+	envelope := writeBlob(t, dir, dsseMediaType, marshal(map[string]any{
+		"payloadType": inTotoMediaType,
+		"payload":     base64.StdEncoding.EncodeToString(statement),
+	}))
+	attestation := writeBlob(t, dir, ociManifestMediaType, marshal(map[string]any{
+		"mediaType": ociManifestMediaType,
+		"config":    config,
+		"layers":    []ociDescriptor{envelope},
+	}))
+
+	// The last SBOM is a layer with a generic media type in an artifact that declares its type
+	genericLayer := writeBlob(t, dir, "application/octet-stream", sboms["libB.json"])
+	typedArtifact := writeBlob(t, dir, ociManifestMediaType, marshal(map[string]any{
+		"mediaType":    ociManifestMediaType,
+		"artifactType": "application/vnd.cyclonedx+json",
+		"config":       config,
+		"layers":       []ociDescriptor{genericLayer},
+	}))
+
+	nested := writeBlob(t, dir, ociIndexMediaType, marshal(map[string]any{
+		"mediaType": ociIndexMediaType,
+		"manifests": []ociDescriptor{attestation, typedArtifact},
+	}))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.json"), marshal(map[string]any{
+		"schemaVersion": 2,
+		"manifests":     []ociDescriptor{artifact, nested},
+	}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o600))
+}
+
+func TestSBOMSources(t *testing.T) {
+	ctx := context.Background()
+	sboms := readTestSBOMs(t)
+	dir := t.TempDir()
+
+	writeTarGz(t, filepath.Join(dir, "sboms.tar.gz"), map[string][]byte{
+		"sboms/dep1.json": sboms["dep1.json"],
+		"sboms/libA.json": sboms["libA.json"],
+		"sboms/libB.json": sboms["libB.json"],
+		"sboms/notes.txt": []byte("not an sbom"),
+	})
+	writeZip(t, filepath.Join(dir, "sboms.zip"), sboms)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "layout"), 0o700))
+	writeOCILayout(t, filepath.Join(dir, "layout"), sboms)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "mixed"), 0o700))
+	writeZip(t, filepath.Join(dir, "mixed", "dep1.zip"), map[string][]byte{"dep1.json": sboms["dep1.json"]})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mixed", "libA.json"), sboms["libA.json"], 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mixed", "libB.json"), sboms["libB.json"], 0o600))
+
+	tests := []struct {
+		name string
+		path string
+		opts SBOMOptions
+	}{
+		{name: "tarball", path: filepath.Join(dir, "sboms.tar.gz"), opts: SBOMOptions{Include: []string{"*.json"}}},
+		{name: "zip", path: filepath.Join(dir, "sboms.zip")},
+		{name: "oci layout", path: filepath.Join(dir, "layout")},
+		{name: "directory with archives", path: filepath.Join(dir, "mixed"), opts: SBOMOptions{Include: []string{"*.json"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := pkg.NewMemoryStorage()
+			report, err := SBOMWithOptions(ctx, test.path, storage, test.opts)
+			require.NoError(t, err)
+			assert.Equal(t, 3, report.Files)
+			assert.Equal(t, 4, report.Nodes)
+			assert.Equal(t, 3, report.Edges)
+		})
+	}
+}
+
+func TestArchiveEntriesAreReadLazily(t *testing.T) {
+	sboms := readTestSBOMs(t)
+	dir := t.TempDir()
+	maxSize := maxEntrySize
+	maxEntrySize = 64 << 10
+	t.Cleanup(func() { maxEntrySize = maxSize })
+
+	// A bomb that compresses to almost nothing, next to a document
+	files := map[string][]byte{"dep1.json": sboms["dep1.json"], "bomb.json": bytes.Repeat([]byte{' '}, 1<<20)}
+	writeZip(t, filepath.Join(dir, "sboms.zip"), files)
+	writeTar(t, filepath.Join(dir, "sboms.tar"), files)
+	writeTarGz(t, filepath.Join(dir, "sboms.tar.gz"), files)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(files["bomb.json"])
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bomb.json.gz"), buf.Bytes(), 0o600))
+
+	for _, name := range []string{"sboms.zip", "sboms.tar", "sboms.tar.gz", "bomb.json.gz"} {
+		t.Run(name, func(t *testing.T) {
+			sources, err := sbomSources(filepath.Join(dir, name), nil, nil)
+			require.NoError(t, err)
+			assert.Len(t, sources, len(files)-strings.Count(name, "bomb"))
+			for _, source := range sources {
+				assert.Nil(t, source.data, "%s shouldn't be read while listing", source.name)
+				data, err := source.read()
+				if strings.HasSuffix(source.name, "dep1.json") {
+					assert.NoError(t, err)
+					assert.Equal(t, sboms["dep1.json"], data)
+				} else {
+					assert.ErrorContains(t, err, "larger than")
+				}
+			}
+		})
+	}
+}
+
+func TestSBOMSourcesStdin(t *testing.T) {
+	ctx := context.Background()
+	sboms := readTestSBOMs(t)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = stdin })
+	go func() {
+		_, _ = w.Write(sboms["libA.json"])
+		w.Close()
+	}()
+
+	storage := pkg.NewMemoryStorage()
+	report, err := SBOMWithOptions(ctx, StdinPath, storage, SBOMOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Files)
+	_, err = storage.NameToID(ctx, "pkg:generic/lib-A@1.0.0")
+	assert.NoError(t, err)
+}
+
+func TestOCIBlobPath(t *testing.T) {
+	_, err := ociBlobPath("layout", "sha256:../../etc/passwd")
+	assert.Error(t, err)
+	path, err := ociBlobPath("layout", "sha256:abc")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("layout", "blobs", "sha256", "abc"), path)
+}
+
+func TestTarGzEntriesAreDecompressedOnce(t *testing.T) {
+	files := map[string][]byte{}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("sbom-%d.json", i)] = []byte(fmt.Sprint(i))
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writeTarTo(t, gz, files)
+	require.NoError(t, gz.Close())
+
+	opened := 0
+	open := func() (*io.SectionReader, func() error, error) {
+		opened++
+		return io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len())), func() error { return nil }, nil
+	}
+	sources, err := archiveSources("sboms.tar.gz", "gzip", open, nil, []string{"sbom-9.json"})
+	require.NoError(t, err)
+	require.Len(t, sources, 9)
+
+	// Workers may read the entries handed to them slightly out of order
+	for i := 0; i < len(sources); i += 2 {
+		order := []int{i + 1, i}
+		if i+1 == len(sources) {
+			order = []int{i}
+		}
+		for _, j := range order {
+			data, err := sources[j].read()
+			require.NoError(t, err)
+			assert.Equal(t, files[strings.TrimPrefix(sources[j].name, "sboms.tar.gz!")], data)
+		}
+	}
+	assert.Equal(t, 2, opened, "Expected the archive to be decompressed once to list and once to read its entries")
+
+	// Entries read again are read from the start
+	data, err := sources[0].read()
+	require.NoError(t, err)
+	assert.Equal(t, files[strings.TrimPrefix(sources[0].name, "sboms.tar.gz!")], data)
+}
@@ -0,0 +1,13 @@
+module example.com/app
+
+go 1.22
+
+require (
+	github.com/pkg/errors v0.9.1
+	golang.org/x/text v0.14.0
+	example.com/local v0.0.0
+)
+
+replace golang.org/x/text => golang.org/x/text v0.15.0
+
+replace example.com/local => ../local
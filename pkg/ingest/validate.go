@@ -0,0 +1,382 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/package-url/packageurl-go"
+	"github.com/protobom/protobom/pkg/sbom"
+)
+
+// IssueSeverity is how serious a problem found validating a SBOM is.
+// Documents with errors aren't ingested when validating, warnings are only reported.
+type IssueSeverity string
+
+const (
+	SeverityError   IssueSeverity = "error"
+	SeverityWarning IssueSeverity = "warning"
+)
+
+// Codes of the problems found validating a SBOM.
+const (
+	// IssueDanglingEdge is an edge from or to a node ID that isn't in the document.
+	IssueDanglingEdge = "dangling-edge"
+	// IssueDuplicateID is a node ID used by more than one node.
+	IssueDuplicateID = "duplicate-id"
+	// IssueInvalidPurl is a purl that can't be parsed.
+	IssueInvalidPurl = "invalid-purl"
+	// IssueMissingPurl is a node without a purl, which is ingested under a pkg:generic name made from its name and version.
+	IssueMissingPurl = "missing-purl"
+	// IssueGenericFallback is a node without a purl or a name, which would share its pkg:generic name with every other such node.
+	IssueGenericFallback = "generic-fallback"
+	// IssueCycle is a dependency that would make a package depend on itself.
+	IssueCycle = "cycle"
+)
+
+// ValidationIssue is a problem found validating a SBOM.
+type ValidationIssue struct {
+	Document string        `json:"document"`
+	Severity IssueSeverity `json:"severity"`
+	Code     string        `json:"code"`
+	// Node is the ID of the SBOM node the problem is about, if it's about one.
+	Node    string `json:"node,omitempty"`
+	Message string `json:"message"`
+}
+
+// countValidationErrors returns the number of issues that are errors.
+func countValidationErrors(issues []ValidationIssue) int {
+	var count int
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// validateDocument checks a parsed SBOM for problems, without writing to the storage backend.
+// Besides problems in the document itself, it reports dependencies that would introduce a cycle into the graph in the storage backend.
+// The returned stats are what ingesting the document would add, ignoring anything the document doesn't declare anymore if it was ingested before.
+func validateDocument(ctx context.Context, name string, document *sbom.Document, storage pkg.Storage, relationships RelationshipMapping) ([]ValidationIssue, ingestStats, error) {
+	var (
+		issues []ValidationIssue
+		stats  ingestStats
+	)
+	report := func(severity IssueSeverity, code, node, format string, args ...any) {
+		issues = append(issues, ValidationIssue{Document: name, Severity: severity, Code: code, Node: node, Message: fmt.Sprintf(format, args...)})
+	}
+
+	graph := newValidationGraph(ctx, storage)
+	seen := map[string]bool{}
+	for _, node := range document.GetNodeList().GetNodes() {
+		if seen[node.GetId()] {
+			report(SeverityError, IssueDuplicateID, node.GetId(), "node ID %s is used by more than one node", node.GetId())
+			continue
+		}
+		seen[node.GetId()] = true
+
+		if purl := string(node.Purl()); purl == "" {
+			if node.GetName() == "" {
+				report(SeverityError, IssueGenericFallback, node.GetId(), "node %s has neither a purl nor a name, so it can't be told apart from other such nodes", node.GetId())
+			} else {
+				report(SeverityWarning, IssueMissingPurl, node.GetId(), "node %s has no purl and is ingested as %s", node.GetId(), nodeName(node))
+			}
+		} else if _, err := packageurl.FromString(purl); err != nil {
+			report(SeverityError, IssueInvalidPurl, node.GetId(), "node %s has an invalid purl %q: %v", node.GetId(), purl, err)
+		}
+
+		created, err := graph.addNode(nodeName(node))
+		if err != nil {
+			return nil, stats, err
+		}
+		if created {
+			stats.nodes++
+		} else {
+			stats.duplicates++
+		}
+	}
+
+	var newEdges [][2]uint64
+	for _, edge := range document.GetNodeList().GetEdges() {
+		from := document.GetNodeList().GetNodeByID(edge.GetFrom())
+		if from == nil {
+			report(SeverityError, IssueDanglingEdge, edge.GetFrom(), "edge from %s references a node that isn't in the document", edge.GetFrom())
+			continue
+		}
+		relationship := relationships.relationship(edge.GetType())
+		for _, toID := range edge.GetTo() {
+			to := document.GetNodeList().GetNodeByID(toID)
+			if to == nil {
+				report(SeverityError, IssueDanglingEdge, toID, "edge from %s to %s references a node that isn't in the document", edge.GetFrom(), toID)
+				continue
+			}
+			if relationship == Ignored {
+				continue
+			}
+			dependent, dependency := graph.ids[nodeName(from)], graph.ids[nodeName(to)]
+			if relationship == DependencyOf {
+				dependent, dependency = dependency, dependent
+			}
+			if dependent == dependency {
+				continue
+			}
+			isNew, err := graph.addEdge(dependent, dependency)
+			if err != nil {
+				return nil, stats, err
+			}
+			if isNew {
+				stats.edges++
+				newEdges = append(newEdges, [2]uint64{dependent, dependency})
+			}
+		}
+	}
+
+	// A new dependency introduces a cycle if its dependency already depends on its dependent,
+	// which is when both are in the same strongly connected component
+	dependencies, err := graph.cycleDependencies()
+	if err != nil {
+		return nil, stats, err
+	}
+	components, err := graph.components(newEdges, dependencies)
+	if err != nil {
+		return nil, stats, err
+	}
+	for _, edge := range newEdges {
+		if components[edge[0]] != components[edge[1]] {
+			continue
+		}
+		path, err := graph.path(edge[1], edge[0], dependencies, components)
+		if err != nil {
+			return nil, stats, err
+		}
+		names := make([]string, len(path))
+		for i, id := range path {
+			names[i] = graph.names[id]
+		}
+		report(SeverityWarning, IssueCycle, "", "%s depending on %s introduces a cycle: %s -> %s", graph.names[edge[0]], graph.names[edge[1]], graph.names[edge[0]], strings.Join(names, " -> "))
+	}
+	return issues, stats, nil
+}
+
+// documentNodeOffset is added to the index of nodes that aren't in the storage backend yet,
+// so they can share a key space with the IDs of nodes that are.
+const documentNodeOffset = uint64(1) << 32
+
+// validationGraph is the graph in the storage backend with a document's nodes and edges added, held in memory.
+type validationGraph struct {
+	ctx      context.Context
+	storage  pkg.Storage
+	ids      map[string]uint64
+	names    map[uint64]string
+	children map[uint64]map[uint64]bool
+	// loaded records which nodes in the storage backend have had their dependencies read.
+	loaded map[uint64]bool
+}
+
+func newValidationGraph(ctx context.Context, storage pkg.Storage) *validationGraph {
+	return &validationGraph{
+		ctx:      ctx,
+		storage:  storage,
+		ids:      map[string]uint64{},
+		names:    map[uint64]string{},
+		children: map[uint64]map[uint64]bool{},
+		loaded:   map[uint64]bool{},
+	}
+}
+
+// addNode adds a node by name, reporting whether it's new to the storage backend.
+func (g *validationGraph) addNode(name string) (bool, error) {
+	if _, ok := g.ids[name]; ok {
+		return false, nil
+	}
+	id, err := g.storage.NameToID(g.ctx, name)
+	if errors.Is(err, pkg.ErrNodeNotFound) {
+		key := documentNodeOffset + uint64(len(g.ids))
+		g.ids[name], g.names[key] = key, name
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up node %s: %w", name, err)
+	}
+	g.ids[name], g.names[uint64(id)] = uint64(id), name
+	return false, nil
+}
+
+// addEdge adds a dependency, reporting whether it's new to the storage backend.
+func (g *validationGraph) addEdge(from, to uint64) (bool, error) {
+	children, err := g.dependencies(from)
+	if err != nil {
+		return false, err
+	}
+	if children[to] {
+		return false, nil
+	}
+	children[to] = true
+	return true, nil
+}
+
+// dependencies returns the direct dependencies of a node, reading them from the storage backend the first time.
+func (g *validationGraph) dependencies(id uint64) (map[uint64]bool, error) {
+	if g.children[id] == nil {
+		g.children[id] = map[uint64]bool{}
+	}
+	if id >= documentNodeOffset || g.loaded[id] {
+		return g.children[id], nil
+	}
+	g.loaded[id] = true
+
+	node, err := g.storage.GetNode(g.ctx, uint32(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %d: %w", id, err)
+	}
+	g.names[id] = node.Name
+	dependencies, err := g.storage.GetNodes(g.ctx, node.Children.ToArray())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependencies of %s: %w", node.Name, err)
+	}
+	for childID, child := range dependencies {
+		g.children[id][uint64(childID)] = true
+		g.names[uint64(childID)] = child.Name
+	}
+	return g.children[id], nil
+}
+
+// cycleDependencies returns how to look up the dependencies of a node to find cycles with.
+// When the cache is up to date, only the document's nodes are looked at, each depending on the edges the document adds
+// and on the document's nodes it transitively depends on in the cache. Otherwise, the graph is read as it's walked.
+func (g *validationGraph) cycleDependencies() (func(id uint64) (map[uint64]bool, error), error) {
+	uncached, err := g.storage.ToBeCached(g.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the cache: %w", err)
+	}
+	if len(uncached) > 0 {
+		return g.dependencies, nil
+	}
+
+	stored := roaring.New()
+	for _, id := range g.ids {
+		if id < documentNodeOffset {
+			stored.Add(uint32(id))
+		}
+	}
+	closures := map[uint64]map[uint64]bool{}
+	for _, id := range stored.ToArray() {
+		cache, err := g.storage.GetCache(g.ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dependencies of %s: %w", g.names[uint64(id)], err)
+		}
+		closure := map[uint64]bool{}
+		for _, dependency := range roaring.And(cache.AllChildren(), stored).ToArray() {
+			if dependency != id {
+				closure[uint64(dependency)] = true
+			}
+		}
+		closures[uint64(id)] = closure
+	}
+	return func(id uint64) (map[uint64]bool, error) {
+		// The edges the document adds are in children, which only holds what has been read of stored nodes
+		dependencies := maps.Clone(closures[id])
+		if dependencies == nil {
+			dependencies = map[uint64]bool{}
+		}
+		for child := range g.children[id] {
+			if child >= documentNodeOffset || stored.Contains(uint32(child)) {
+				dependencies[child] = true
+			}
+		}
+		return dependencies, nil
+	}, nil
+}
+
+// components finds the strongly connected components of the graph reachable from the new edges, keyed by node.
+// Nodes in the same component have the same value.
+func (g *validationGraph) components(edges [][2]uint64, dependencies func(id uint64) (map[uint64]bool, error)) (map[uint64]uint64, error) {
+	var stack []uint64
+	var tarjanDFS func(id uint64) error
+
+	currentTarjanID := uint64(0)
+	nodeToTarjanID := map[uint64]uint64{}
+	lowLink := map[uint64]uint64{}
+	inStack := map[uint64]bool{}
+
+	tarjanDFS = func(id uint64) error {
+		currentTarjanID++
+		stack = append(stack, id)
+		inStack[id] = true
+		nodeToTarjanID[id] = currentTarjanID
+		lowLink[id] = currentTarjanID
+
+		next, err := dependencies(id)
+		if err != nil {
+			return err
+		}
+		for child := range next {
+			if _, visited := nodeToTarjanID[child]; !visited {
+				if err := tarjanDFS(child); err != nil {
+					return err
+				}
+				lowLink[id] = min(lowLink[id], lowLink[child])
+			} else if inStack[child] {
+				lowLink[id] = min(lowLink[id], nodeToTarjanID[child])
+			}
+		}
+
+		if nodeToTarjanID[id] == lowLink[id] {
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				delete(inStack, top)
+				lowLink[top] = nodeToTarjanID[id]
+				if top == id {
+					break
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, edge := range edges {
+		for _, id := range edge {
+			if _, visited := nodeToTarjanID[id]; !visited {
+				if err := tarjanDFS(id); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return lowLink, nil
+}
+
+// path returns a dependency path from one node to another in the same strongly connected component.
+// When the dependencies come from the cache, the path only goes through the document's nodes.
+func (g *validationGraph) path(from, to uint64, dependencies func(id uint64) (map[uint64]bool, error), components map[uint64]uint64) ([]uint64, error) {
+	parents := map[uint64]uint64{from: from}
+	queue := []uint64{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			var path []uint64
+			for ; id != from; id = parents[id] {
+				path = append([]uint64{id}, path...)
+			}
+			return append([]uint64{from}, path...), nil
+		}
+		children, err := dependencies(id)
+		if err != nil {
+			return nil, err
+		}
+		for child := range children {
+			if _, ok := parents[child]; !ok && components[child] == components[from] {
+				parents[child] = id
+				queue = append(queue, child)
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/protobom/protobom/pkg/sbom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDocument(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	// The graph already has lib depending on app
+	existing := sbom.NewDocument()
+	existing.NodeList.AddNode(&sbom.Node{Id: "lib", Name: "lib", Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	existing.NodeList.AddNode(&sbom.Node{Id: "app", Name: "app", Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	existing.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "lib", To: []string{"app"}})
+	_, err := processSBOMDocument(ctx, existing, storage, documentOptions{}, nil)
+	require.NoError(t, err)
+	keys, err := storage.GetAllKeys(ctx)
+	require.NoError(t, err)
+
+	purl := func(purl string) map[int32]string {
+		return map[int32]string{int32(sbom.SoftwareIdentifierType_PURL): purl}
+	}
+	document := sbom.NewDocument()
+	document.NodeList.AddNode(&sbom.Node{Id: "app", Name: "app", Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	document.NodeList.AddNode(&sbom.Node{Id: "lib", Name: "lib", Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	document.NodeList.AddNode(&sbom.Node{Id: "lib", Name: "lib", Version: "2.0.0", Type: sbom.Node_PACKAGE})
+	document.NodeList.AddNode(&sbom.Node{Id: "bad", Name: "bad", Type: sbom.Node_PACKAGE, Identifiers: purl("not a purl")})
+	document.NodeList.AddNode(&sbom.Node{Id: "good", Name: "good", Type: sbom.Node_PACKAGE, Identifiers: purl("pkg:npm/good@1.0.0")})
+	document.NodeList.AddNode(&sbom.Node{Id: "anonymous", Type: sbom.Node_PACKAGE})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "app", To: []string{"lib", "good", "missing"}})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "gone", To: []string{"app"}})
+
+	issues, stats, err := validateDocument(ctx, "document.json", document, storage, nil)
+	require.NoError(t, err)
+
+	codes := map[string][]string{}
+	for _, issue := range issues {
+		assert.Equal(t, "document.json", issue.Document)
+		codes[issue.Code] = append(codes[issue.Code], string(issue.Severity)+" "+issue.Node)
+	}
+	assert.Equal(t, map[string][]string{
+		IssueMissingPurl:     {"warning app", "warning lib"},
+		IssueDuplicateID:     {"error lib"},
+		IssueInvalidPurl:     {"error bad"},
+		IssueGenericFallback: {"error anonymous"},
+		IssueDanglingEdge:    {"error missing", "error gone"},
+		IssueCycle:           {"warning "},
+	}, codes)
+	assert.Equal(t, 5, countValidationErrors(issues))
+
+	assert.Equal(t, 3, stats.nodes, "bad, good and anonymous are new")
+	assert.Equal(t, 2, stats.duplicates)
+	assert.Equal(t, 2, stats.edges)
+
+	after, err := storage.GetAllKeys(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, keys, after, "validating shouldn't write anything")
+
+	// Cycles are found the same way from the cached dependencies
+	require.NoError(t, pkg.Cache(ctx, storage))
+	cached, _, err := validateDocument(ctx, "document.json", document, storage, nil)
+	require.NoError(t, err)
+	assert.Equal(t, issues, cached)
+}
+
+func TestValidateDocumentCycles(t *testing.T) {
+	ctx := context.Background()
+
+	// The graph has lib depending on app through a package the document doesn't mention
+	existing := sbom.NewDocument()
+	for _, name := range []string{"lib", "util", "app"} {
+		existing.NodeList.AddNode(&sbom.Node{Id: name, Name: name, Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	}
+	existing.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "lib", To: []string{"util"}})
+	existing.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "util", To: []string{"app"}})
+
+	// The document closes the cycle through a new package, and adds a dependency that isn't in one
+	document := sbom.NewDocument()
+	for _, name := range []string{"app", "plugin", "lib", "tool"} {
+		document.NodeList.AddNode(&sbom.Node{Id: name, Name: name, Version: "1.0.0", Type: sbom.Node_PACKAGE})
+	}
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "app", To: []string{"plugin", "tool"}})
+	document.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_dependsOn, From: "plugin", To: []string{"lib"}})
+
+	for _, cached := range []bool{false, true} {
+		storage := pkg.NewMemoryStorage()
+		_, err := processSBOMDocument(ctx, existing, storage, documentOptions{}, nil)
+		require.NoError(t, err)
+		if cached {
+			require.NoError(t, pkg.Cache(ctx, storage))
+		}
+
+		issues, _, err := validateDocument(ctx, "document.json", document, storage, nil)
+		require.NoError(t, err)
+		var cycles []string
+		for _, issue := range issues {
+			if issue.Code == IssueCycle {
+				cycles = append(cycles, issue.Message)
+			}
+		}
+		assert.Len(t, cycles, 2, "cached: %v", cached)
+		for _, cycle := range cycles {
+			assert.NotContains(t, cycle, "tool", "cached: %v", cached)
+		}
+	}
+}
+
+func TestSBOMWithOptionsValidate(t *testing.T) {
+	ctx := context.Background()
+	sboms := readTestSBOMs(t)
+	dir := t.TempDir()
+	for name, data := range sboms {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+
+	storage := pkg.NewMemoryStorage()
+	report, err := SBOMWithOptions(ctx, dir, storage, SBOMOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Files)
+	assert.Equal(t, 0, report.ValidationErrors())
+	keys, err := storage.GetAllKeys(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	report, err = SBOMWithOptions(ctx, dir, storage, SBOMOptions{Validate: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Files)
+	assert.Equal(t, 4, report.Nodes)
+}
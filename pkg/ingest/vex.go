@@ -0,0 +1,444 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+)
+
+// VEXReport summarizes the VEX documents ingested.
+type VEXReport struct {
+	Documents int `json:"documents"`
+	// Statements is the number of statements recorded, counting a statement once for each dependency on the vulnerability it applies to.
+	Statements int `json:"statements"`
+	// Unmatched is the number of statements whose vulnerability, product or packages aren't in the graph.
+	Unmatched int `json:"unmatched"`
+}
+
+// vexStatement is a statement of an OpenVEX or CycloneDX VEX document.
+type vexStatement struct {
+	// vulnerability is the ID and aliases of the vulnerability.
+	vulnerability []string
+	// product is the name of the product the statement is scoped to, empty if it applies wherever the subcomponents are used.
+	product string
+	// subcomponents are the names of the packages that depend on the vulnerability, or empty for all of the product's dependencies.
+	subcomponents []string
+	statement     pkg.VEXStatement
+}
+
+// openVEXDocument is the subset of an OpenVEX document that is ingested, accepting both the v0.0.1 and v0.2.0 layouts.
+type openVEXDocument struct {
+	Context    string             `json:"@context"`
+	ID         string             `json:"@id"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Statements []openVEXStatement `json:"statements"`
+}
+
+type openVEXStatement struct {
+	Vulnerability   json.RawMessage   `json:"vulnerability"`
+	Products        []json.RawMessage `json:"products"`
+	Subcomponents   []json.RawMessage `json:"subcomponents"`
+	Status          string            `json:"status"`
+	Justification   string            `json:"justification"`
+	ImpactStatement string            `json:"impact_statement"`
+	ActionStatement string            `json:"action_statement"`
+	Timestamp       time.Time         `json:"timestamp"`
+}
+
+// openVEXComponent identifies a product or subcomponent, either by its IRI or by a purl among its identifiers.
+type openVEXComponent struct {
+	ID          string            `json:"@id"`
+	Identifiers map[string]string `json:"identifiers"`
+	// Subcomponents of a product are only in the v0.2.0 layout
+	Subcomponents []openVEXComponent `json:"subcomponents"`
+}
+
+// cycloneDXVEX is the subset of a CycloneDX document that is ingested as VEX.
+type cycloneDXVEX struct {
+	BOMFormat    string `json:"bomFormat"`
+	SerialNumber string `json:"serialNumber"`
+	Metadata     struct {
+		Timestamp time.Time           `json:"timestamp"`
+		Component *cycloneDXComponent `json:"component"`
+	} `json:"metadata"`
+	Components      []cycloneDXComponent `json:"components"`
+	Vulnerabilities []struct {
+		ID         string `json:"id"`
+		References []struct {
+			ID string `json:"id"`
+		} `json:"references"`
+		Analysis *struct {
+			State         string   `json:"state"`
+			Justification string   `json:"justification"`
+			Response      []string `json:"response"`
+			Detail        string   `json:"detail"`
+		} `json:"analysis"`
+		Affects []struct {
+			Ref string `json:"ref"`
+		} `json:"affects"`
+		Updated time.Time `json:"updated"`
+	} `json:"vulnerabilities"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string               `json:"bom-ref"`
+	Name       string               `json:"name"`
+	Version    string               `json:"version"`
+	Purl       string               `json:"purl"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+// cycloneDXStates maps CycloneDX analysis states to VEX statuses.
+var cycloneDXStates = map[string]pkg.VEXStatus{
+	"not_affected":           pkg.VEXNotAffected,
+	"false_positive":         pkg.VEXNotAffected,
+	"resolved":               pkg.VEXFixed,
+	"resolved_with_pedigree": pkg.VEXFixed,
+	"exploitable":            pkg.VEXAffected,
+	"in_triage":              pkg.VEXUnderInvestigation,
+}
+
+// cycloneDXJustifications maps CycloneDX justifications to the closest OpenVEX justification.
+var cycloneDXJustifications = map[string]string{
+	"code_not_present":                "vulnerable_code_not_present",
+	"code_not_reachable":              "vulnerable_code_not_in_execute_path",
+	"requires_configuration":          "vulnerable_code_cannot_be_controlled_by_adversary",
+	"requires_dependency":             "vulnerable_code_cannot_be_controlled_by_adversary",
+	"requires_environment":            "vulnerable_code_cannot_be_controlled_by_adversary",
+	"protected_by_compiler":           "inline_mitigations_already_exist",
+	"protected_at_runtime":            "inline_mitigations_already_exist",
+	"protected_at_perimeter":          "inline_mitigations_already_exist",
+	"protected_by_mitigating_control": "inline_mitigations_already_exist",
+}
+
+// VEX ingests OpenVEX and CycloneDX VEX documents, recording each statement on the dependency edges of the packages
+// it names on the vulnerability, scoped to the product it applies to. A statement without subcomponents applies
+// to every package of the product that depends on the vulnerability. A newer statement for the same product
+// replaces an older one. The path is anything SBOMs can be ingested from: a file, an archive, a directory or stdin.
+func VEX(ctx context.Context, vexPath string, storage pkg.Storage) (*VEXReport, error) {
+	sources, err := sbomSources(vexPath, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := &VEXReport{}
+	for _, source := range sources {
+		data, err := source.read()
+		if err != nil {
+			return report, fmt.Errorf("failed to read VEX document %s: %w", source.name, err)
+		}
+		statements, err := parseVEX(source.name, data)
+		if err != nil {
+			return report, err
+		}
+		for _, statement := range statements {
+			recorded, err := addVEXStatement(ctx, storage, statement)
+			if err != nil {
+				return report, fmt.Errorf("failed to ingest VEX document %s: %w", source.name, err)
+			}
+			if recorded == 0 {
+				report.Unmatched++
+			}
+			report.Statements += recorded
+		}
+		report.Documents++
+	}
+	return report, nil
+}
+
+// parseVEX parses an OpenVEX or CycloneDX VEX document.
+func parseVEX(name string, data []byte) ([]vexStatement, error) {
+	var format struct {
+		Context   string `json:"@context"`
+		BOMFormat string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &format); err != nil {
+		return nil, fmt.Errorf("failed to parse VEX document %s: %w", name, err)
+	}
+	var (
+		statements []vexStatement
+		err        error
+	)
+	switch {
+	case strings.Contains(format.Context, "openvex"):
+		statements, err = parseOpenVEX(name, data)
+	case format.BOMFormat == "CycloneDX":
+		statements, err = parseCycloneDXVEX(name, data)
+	default:
+		err = errors.New("not an OpenVEX or CycloneDX document")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VEX document %s: %w", name, err)
+	}
+	return statements, nil
+}
+
+func parseOpenVEX(name string, data []byte) ([]vexStatement, error) {
+	var document openVEXDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document.ID != "" {
+		name = document.ID
+	}
+
+	var statements []vexStatement
+	for i, s := range document.Statements {
+		status, err := pkg.ParseVEXStatus(s.Status)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+		vulnerability, err := openVEXVulnerability(s.Vulnerability)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+		timestamp := s.Timestamp
+		if timestamp.IsZero() {
+			timestamp = document.Timestamp
+		}
+		statement := pkg.VEXStatement{
+			Status:          status,
+			Justification:   s.Justification,
+			ImpactStatement: s.ImpactStatement,
+			ActionStatement: s.ActionStatement,
+			Timestamp:       timestamp,
+			Document:        name,
+		}
+
+		subcomponents, err := openVEXComponents(s.Subcomponents)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+		products, err := openVEXComponents(s.Products)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i, err)
+		}
+		if len(products) == 0 {
+			return nil, fmt.Errorf("statement %d: %w", i, errors.New("no products"))
+		}
+		for _, product := range products {
+			var names []string
+			for _, subcomponent := range append(slices.Clone(subcomponents), product.Subcomponents...) {
+				names = append(names, subcomponent.name())
+			}
+			statements = append(statements, vexStatement{vulnerability: vulnerability, product: product.name(), subcomponents: names, statement: statement})
+		}
+	}
+	return statements, nil
+}
+
+// openVEXVulnerability returns the name and aliases of a vulnerability, which is a string in the v0.0.1 layout.
+func openVEXVulnerability(data json.RawMessage) ([]string, error) {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil && id != "" {
+		return []string{id}, nil
+	}
+	var vulnerability struct {
+		ID      string   `json:"@id"`
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+	if err := json.Unmarshal(data, &vulnerability); err != nil || vulnerability.Name == "" && vulnerability.ID == "" {
+		return nil, errors.New("missing vulnerability name")
+	}
+	var ids []string
+	for _, id := range append([]string{vulnerability.Name, vulnerability.ID}, vulnerability.Aliases...) {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// openVEXComponents parses products or subcomponents, which are strings in the v0.0.1 layout.
+func openVEXComponents(data []json.RawMessage) ([]openVEXComponent, error) {
+	components := make([]openVEXComponent, 0, len(data))
+	for _, raw := range data {
+		var component openVEXComponent
+		if err := json.Unmarshal(raw, &component.ID); err != nil {
+			if err := json.Unmarshal(raw, &component); err != nil {
+				return nil, fmt.Errorf("invalid component: %w", err)
+			}
+		}
+		if component.name() == "" {
+			return nil, errors.New("component without an identifier")
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// name returns the node name of a component, its purl if it has one.
+func (c openVEXComponent) name() string {
+	if purl := c.Identifiers["purl"]; purl != "" {
+		return purl
+	}
+	return c.ID
+}
+
+func parseCycloneDXVEX(name string, data []byte) ([]vexStatement, error) {
+	var document cycloneDXVEX
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document.SerialNumber != "" {
+		name = document.SerialNumber
+	}
+
+	refs := map[string]string{}
+	var addRefs func(components []cycloneDXComponent)
+	addRefs = func(components []cycloneDXComponent) {
+		for _, component := range components {
+			if component.BOMRef != "" {
+				refs[component.BOMRef] = component.name()
+			}
+			addRefs(component.Components)
+		}
+	}
+	var product string
+	if document.Metadata.Component != nil {
+		product = document.Metadata.Component.name()
+		addRefs([]cycloneDXComponent{*document.Metadata.Component})
+	}
+	addRefs(document.Components)
+
+	var statements []vexStatement
+	for _, vulnerability := range document.Vulnerabilities {
+		// Vulnerabilities that haven't been analyzed are findings, not VEX statements
+		if vulnerability.Analysis == nil || vulnerability.Analysis.State == "" {
+			continue
+		}
+		status, ok := cycloneDXStates[vulnerability.Analysis.State]
+		if !ok {
+			return nil, fmt.Errorf("vulnerability %s: unknown analysis state %q", vulnerability.ID, vulnerability.Analysis.State)
+		}
+		ids := []string{vulnerability.ID}
+		for _, reference := range vulnerability.References {
+			ids = append(ids, reference.ID)
+		}
+		timestamp := vulnerability.Updated
+		if timestamp.IsZero() {
+			timestamp = document.Metadata.Timestamp
+		}
+		justification := vulnerability.Analysis.Justification
+		if mapped, ok := cycloneDXJustifications[justification]; ok {
+			justification = mapped
+		}
+
+		statement := vexStatement{
+			vulnerability: ids,
+			product:       product,
+			statement: pkg.VEXStatement{
+				Status:          status,
+				Justification:   justification,
+				ImpactStatement: vulnerability.Analysis.Detail,
+				ActionStatement: strings.Join(vulnerability.Analysis.Response, ", "),
+				Timestamp:       timestamp,
+				Document:        name,
+			},
+		}
+		for _, affects := range vulnerability.Affects {
+			// References may be BOM-Links to a component in this document, as in urn:cdx:serial/version#ref
+			ref := affects.Ref
+			if strings.HasPrefix(ref, "urn:cdx:") {
+				_, ref, _ = strings.Cut(ref, "#")
+			}
+			component, ok := refs[ref]
+			if !ok {
+				component = ref
+			}
+			if component != product {
+				statement.subcomponents = append(statement.subcomponents, component)
+			}
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// name returns the node name of a component, the same name SBOM ingestion gives it.
+func (c cycloneDXComponent) name() string {
+	if c.Purl != "" {
+		return c.Purl
+	}
+	return fmt.Sprintf("pkg:generic/%s@%s", c.Name, c.Version)
+}
+
+// addVEXStatement records a statement on the dependencies it applies to, returning how many there were.
+// Statements are skipped if a newer statement for the same product is already recorded.
+func addVEXStatement(ctx context.Context, storage pkg.Storage, s vexStatement) (int, error) {
+	vulnerability, err := pkg.FindVulnerability(ctx, storage, s.vulnerability...)
+	if err != nil || vulnerability == nil {
+		return 0, err
+	}
+
+	statement := s.statement
+	var packages *roaring.Bitmap
+	if s.product != "" {
+		product, err := vexNode(ctx, storage, s.product)
+		if err != nil || product == nil {
+			return 0, err
+		}
+		statement.Product = product.ID
+		if len(s.subcomponents) == 0 {
+			// The statement applies to every package of the product that depends on the vulnerability
+			if packages, err = product.QueryDependencies(ctx, storage); err != nil {
+				return 0, fmt.Errorf("failed to query dependencies of %s: %w", product.Name, err)
+			}
+			packages = packages.Clone()
+			packages.Add(product.ID)
+		}
+	}
+	if packages == nil {
+		packages = roaring.New()
+		for _, name := range s.subcomponents {
+			node, err := vexNode(ctx, storage, name)
+			if err != nil {
+				return 0, err
+			}
+			if node != nil {
+				packages.Add(node.ID)
+			}
+		}
+	}
+
+	recorded := 0
+	for _, parent := range roaring.And(packages, vulnerability.Parents).ToArray() {
+		edge := pkg.Edge{From: parent, To: vulnerability.ID}
+		existing, err := storage.GetVEXStatements(ctx, edge)
+		if err != nil {
+			return recorded, err
+		}
+		if slices.ContainsFunc(existing, func(e *pkg.VEXStatement) bool {
+			return e.Product == statement.Product && e.Timestamp.After(statement.Timestamp)
+		}) {
+			continue
+		}
+		if err := storage.SetVEXStatement(ctx, edge, &statement); err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+// vexNode returns the node named in a VEX document, or nil if it isn't in the graph.
+func vexNode(ctx context.Context, storage pkg.Storage, name string) (*pkg.Node, error) {
+	id, err := storage.NameToID(ctx, name)
+	if errors.Is(err, pkg.ErrNodeNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	node, err := storage.GetNode(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %w", name, err)
+	}
+	return node, nil
+}
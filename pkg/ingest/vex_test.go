@@ -0,0 +1,102 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVEX(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+
+	document, err := pkg.AddNode(ctx, storage, pkg.DocumentNodeType, &pkg.DocumentMetadata{Name: "doc"}, "doc")
+	require.NoError(t, err)
+	app, server := addTestNode(t, storage, "pkg:generic/app@1.0.0"), addTestNode(t, storage, "pkg:generic/server@1.0.0")
+	lodash, minimist := addTestNode(t, storage, "pkg:npm/lodash@4.17.20"), addTestNode(t, storage, "pkg:npm/minimist@1.2.5")
+	lodashVuln, err := pkg.AddVulnerability(ctx, storage, &pkg.VulnerabilityMetadata{ID: "GHSA-lodash-0001", Aliases: []string{"CVE-2021-23337"}})
+	require.NoError(t, err)
+	minimistVuln, err := pkg.AddVulnerability(ctx, storage, &pkg.VulnerabilityMetadata{ID: "GHSA-minimist-0001", Aliases: []string{"CVE-2021-44906"}})
+	require.NoError(t, err)
+	addTestDependency(t, storage, document, app)
+	addTestDependency(t, storage, document, server)
+	addTestDependency(t, storage, app, lodash)
+	addTestDependency(t, storage, server, lodash)
+	addTestDependency(t, storage, server, minimist)
+	addTestDependency(t, storage, lodash, lodashVuln)
+	addTestDependency(t, storage, minimist, minimistVuln)
+	require.NoError(t, pkg.Cache(ctx, storage))
+
+	report, err := VEX(ctx, "testdata/vex", storage)
+	require.NoError(t, err)
+	assert.Equal(t, &VEXReport{Documents: 3, Statements: 3, Unmatched: 1}, report)
+
+	statements, err := storage.GetVEXStatements(ctx, pkg.Edge{From: lodash.ID, To: lodashVuln.ID})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*pkg.VEXStatement{
+		{
+			Product:         app.ID,
+			Status:          pkg.VEXNotAffected,
+			Justification:   "vulnerable_code_not_in_execute_path",
+			ImpactStatement: "app never calls lodash.template",
+			Timestamp:       time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			Document:        "https://example.com/vex/app-2024-0001",
+		},
+		{
+			Product:         server.ID,
+			Status:          pkg.VEXFixed,
+			ImpactStatement: "lodash is patched in the vendored copy",
+			ActionStatement: "update",
+			Timestamp:       time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+			Document:        "urn:uuid:3e671687-395b-41f5-a30f-a58921a69b79",
+		},
+	}, statements)
+
+	// Statements about a product without subcomponents apply to every package of the product
+	statement, err := pkg.ProductVEXStatement(ctx, storage, server.ID, pkg.Edge{From: minimist.ID, To: minimistVuln.ID})
+	require.NoError(t, err)
+	assert.Equal(t, pkg.VEXUnderInvestigation, statement.Status)
+
+	exposures, err := pkg.VulnerabilityExposures(ctx, storage, pkg.ExposureOptions{})
+	require.NoError(t, err)
+	require.Len(t, exposures, 1)
+	assert.Equal(t, server.Name, exposures[0].Product)
+	assert.Equal(t, minimistVuln.Name, exposures[0].Vulnerability)
+	assert.Equal(t, pkg.VEXUnderInvestigation, exposures[0].Status)
+
+	// Older statements don't replace newer ones
+	older, err := parseVEX("old.json", []byte(`{
+		"@context": "https://openvex.dev/ns/v0.2.0",
+		"timestamp": "2023-01-01T00:00:00Z",
+		"statements": [{"vulnerability": {"name": "CVE-2021-23337"}, "products": [{"@id": "pkg:generic/app@1.0.0"}], "status": "affected"}]
+	}`))
+	require.NoError(t, err)
+	require.Len(t, older, 1)
+	recorded, err := addVEXStatement(ctx, storage, older[0])
+	require.NoError(t, err)
+	assert.Equal(t, 0, recorded)
+	statement, err = pkg.ProductVEXStatement(ctx, storage, app.ID, pkg.Edge{From: lodash.ID, To: lodashVuln.ID})
+	require.NoError(t, err)
+	assert.Equal(t, pkg.VEXNotAffected, statement.Status)
+}
+
+func TestParseVEXErrors(t *testing.T) {
+	tests := map[string]string{
+		"not VEX":          `{"spdxVersion": "SPDX-2.3"}`,
+		"invalid JSON":     `{`,
+		"unknown status":   `{"@context": "https://openvex.dev/ns/v0.2.0", "statements": [{"vulnerability": {"name": "CVE-1"}, "products": ["p"], "status": "fine"}]}`,
+		"no vulnerability": `{"@context": "https://openvex.dev/ns/v0.2.0", "statements": [{"products": ["p"], "status": "affected"}]}`,
+		"no products":      `{"@context": "https://openvex.dev/ns/v0.2.0", "statements": [{"vulnerability": "CVE-1", "status": "affected"}]}`,
+		"unknown state":    `{"bomFormat": "CycloneDX", "vulnerabilities": [{"id": "CVE-1", "analysis": {"state": "fine"}}]}`,
+	}
+	for name, document := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseVEX(name, []byte(document))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -3,20 +3,18 @@ package ingest
 // Based on the osv-scanner's query code to OSV.dev
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/bit-bom/minefield/pkg"
 	"github.com/package-url/packageurl-go"
 )
 
-type Vulnerability struct {
-	ID string `json:"id"`
-}
+// Vulnerability is an OSV record, which is kept as the metadata of the vulnerability's node.
+type Vulnerability = pkg.VulnerabilityMetadata
 
 type Package struct {
 	PURL      string `json:"purl,omitempty"`
@@ -63,43 +61,126 @@ var purlEcosystems = map[string]map[string]Ecosystem{
 }
 var ErrBadPurl = fmt.Errorf("bad purl")
 
-func Vulnerabilities(storage pkg.Storage) error {
-	keys, err := storage.GetAllKeys()
+func Vulnerabilities(ctx context.Context, storage pkg.Storage) error {
+	return VulnerabilitiesWithProgress(ctx, storage, nil)
+}
+
+// VulnerabilitiesWithProgress queries OSV for every package in the storage backend, calling progress after each node.
+func VulnerabilitiesWithProgress(ctx context.Context, storage pkg.Storage, progress pkg.ProgressFunc) error {
+	return VulnerabilitiesWithClient(ctx, storage, NewOSVClient(OSVClientOptions{}), progress)
+}
+
+// VulnerabilitiesWithClient queries OSV with the given client for every package in the storage backend,
+// and adds the known vulnerabilities of each package as its dependencies, calling progress after each node.
+func VulnerabilitiesWithClient(ctx context.Context, storage pkg.Storage, client *OSVClient, progress pkg.ProgressFunc) error {
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		return err
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
 	if err != nil {
 		return err
 	}
 
+	// Packages sharing a purl are only queried once
+	var queries []Query
+	queryIndexes := map[uint32]int{}
+	purlIndexes := map[string]int{}
 	for _, key := range keys {
-		node, err := storage.GetNode(key)
-		if err != nil {
+		node := nodes[key]
+		if node.Type != "PACKAGE" || node.Name == "" {
+			continue
+		}
+		if index, ok := purlIndexes[node.Name]; ok {
+			queryIndexes[key] = index
+			continue
+		}
+		query, err := PURLToPackageQuery(node.Name)
+		if errors.Is(err, ErrBadPurl) {
+			continue
+		} else if err != nil {
 			return err
 		}
+		queryIndexes[key], purlIndexes[node.Name] = len(queries), len(queries)
+		queries = append(queries, query)
+	}
+	results, err := client.Query(ctx, queries)
+	if err != nil {
+		return err
+	}
 
-		if node.Type == "PACKAGE" {
-			if node.Name == "" {
-				continue
-			}
-			vulns, err := queryOSV(node.Name)
+	// Queries only return the IDs of the vulnerabilities, so fetch their records
+	var vulns []Vulnerability
+	for _, result := range results {
+		vulns = append(vulns, result...)
+	}
+	records, err := client.FetchVulnerabilities(ctx, vulns)
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		results[i], records = records[:len(results[i])], records[len(results[i]):]
+	}
+
+	changes := pkg.NewGraphChanges()
+	for i, key := range keys {
+		if index, ok := queryIndexes[key]; ok {
+			changes.Track(nodes[key])
+			added, err := addVulnerabilities(ctx, storage, nodes[key], results[index])
 			if err != nil {
 				return err
 			}
-
-			for _, vuln := range vulns {
-				vulnNode, err := pkg.AddNode(storage, "VULNERABILITY", any(vuln), vuln.ID)
-				if err != nil {
-					return err
-				}
-
-				if err := node.SetDependency(storage, vulnNode); err != nil {
-					return err
+			for _, id := range added {
+				// Vulnerabilities that weren't in the graph before are new in this version
+				if _, ok := nodes[id]; !ok {
+					changes.Created(id)
 				}
 			}
 		}
+		if progress != nil {
+			if err := progress(i+1, len(keys), nodes[key].Name); err != nil {
+				return err
+			}
+		}
 	}
 
+	return recordVulnerabilityVersion(ctx, storage, changes)
+}
+
+// recordVulnerabilityVersion records the version of the graph created by adding vulnerabilities, if any were added.
+func recordVulnerabilityVersion(ctx context.Context, storage pkg.Storage, changes *pkg.GraphChanges) error {
+	if _, err := changes.Record(ctx, storage, pkg.VersionSourceVulnerabilities); err != nil {
+		return fmt.Errorf("failed to record graph version: %w", err)
+	}
 	return nil
 }
 
+// addVulnerabilities adds vulnerabilities as dependencies of the package node they affect, returning the IDs of the
+// vulnerabilities that weren't dependencies of the package yet.
+// Records of the same vulnerability from different databases, such as a GHSA advisory and its CVE, share a node.
+func addVulnerabilities(ctx context.Context, storage pkg.Storage, node *pkg.Node, vulns []Vulnerability) ([]uint32, error) {
+	vulns = slices.Clone(vulns)
+	pkg.SortVulnerabilities(vulns)
+	var added []uint32
+	for _, vuln := range vulns {
+		vulnNode, err := pkg.AddVulnerability(ctx, storage, &vuln)
+		if err != nil {
+			return added, err
+		}
+		// Records of the same vulnerability share a node, which only needs adding once
+		if node.Children.Contains(vulnNode.ID) {
+			continue
+		}
+
+		if err := node.SetDependency(ctx, storage, vulnNode); err != nil {
+			return added, err
+		}
+		added = append(added, vulnNode.ID)
+	}
+
+	return added, nil
+}
+
 func getPURLEcosystem(pkgURL packageurl.PackageURL) (Ecosystem, error) {
 	ecoMap, ok := purlEcosystems[pkgURL.Type]
 	if !ok {
@@ -160,44 +241,3 @@ func PURLToPackageQuery(purl string) (Query, error) {
 		},
 	}, nil
 }
-
-func queryOSV(purl string) ([]Vulnerability, error) {
-	query, err := PURLToPackageQuery(purl)
-	if errors.Is(err, ErrBadPurl) {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
-	}
-
-	queryBytes, err := json.Marshal(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal query: %w", err)
-	}
-
-	requestBuf := bytes.NewBuffer(queryBytes)
-	req, err := http.NewRequest(http.MethodPost, "https://api.osv.dev/v1/query", requestBuf)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query OSV, query = %s, purl = %s : %w", string(queryBytes), purl, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("OSV query failed with status, query = %s, purl = %s : %s", string(queryBytes), purl, resp.Status)
-	}
-
-	var result struct {
-		Vulns []Vulnerability `json:"vulns"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode OSV response: %w", err)
-	}
-
-	return result.Vulns, nil
-}
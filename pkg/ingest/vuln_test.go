@@ -1,6 +1,7 @@
 package ingest
 
 import (
+	"context"
 	"testing"
 
 	"github.com/bit-bom/minefield/pkg"
@@ -9,18 +10,19 @@ import (
 )
 
 func TestVulnerabilities(t *testing.T) {
-	storage := pkg.NewMockStorage()
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
 	// Add mock nodes to storage
-	_, err := pkg.AddNode(storage, "PACKAGE", "metadata1", "pkg:golang/stdlib")
+	_, err := pkg.AddNode(ctx, storage, "PACKAGE", "metadata1", "pkg:golang/stdlib")
 	assert.NoError(t, err)
-	_, err = pkg.AddNode(storage, "PACKAGE", "metadata2", "pkg:golang/github/docker/docker@19.0.0")
+	_, err = pkg.AddNode(ctx, storage, "PACKAGE", "metadata2", "pkg:golang/github/docker/docker@19.0.0")
 	assert.NoError(t, err)
 
-	err = Vulnerabilities(storage)
+	err = Vulnerabilities(ctx, storage)
 	assert.NoError(t, err)
 
 	// Check if vulnerabilities were added
-	keys, err := storage.GetAllKeys()
+	keys, err := storage.GetAllKeys(ctx)
 	assert.NoError(t, err)
 	assert.Greater(t, len(keys), 2) // Should have more than the initial 2 nodes
 }
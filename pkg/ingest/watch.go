@@ -0,0 +1,392 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long Watch waits for changes to settle when no debounce is configured.
+const DefaultWatchDebounce = 2 * time.Second
+
+// WatchOptions configures how a directory is watched for SBOMs.
+type WatchOptions struct {
+	// SBOMOptions configures how each batch of SBOMs is ingested. Failed documents never stop the watch.
+	SBOMOptions
+	// Debounce is how long to wait after the last change before ingesting, so files that are still being written are ingested once.
+	Debounce time.Duration
+	// Cache caches the graph after each batch that ingested something.
+	Cache bool
+	// StatePath, if set, is a file the content hashes of the files of ingested documents are kept in,
+	// so documents that were ingested before a restart aren't ingested again.
+	StatePath string
+	// OnBatch, if set, is called with the outcome of each batch.
+	OnBatch func(report *SBOMReport, err error)
+}
+
+// Watch ingests the SBOMs in a directory, and then keeps ingesting SBOMs as they're added or changed until ctx is done.
+// Documents are remembered by the content hash of their file, so a file that is written again with the same content isn't ingested again,
+// and forgotten when their file is removed or renamed.
+// Errors ingesting a batch are passed to opts.OnBatch, and only an error watching the directory stops the watch.
+func Watch(ctx context.Context, dir string, storage pkg.Storage, opts WatchOptions) error {
+	for _, pattern := range append(slices.Clone(opts.Include), opts.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("error accessing path %s: %w", dir, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+	opts.ContinueOnError = true
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	w := &sbomWatcher{dir: dir, storage: storage, opts: opts, watcher: watcher, hashes: map[string]string{}, ignored: map[string]bool{}}
+	if opts.StatePath != "" {
+		// Saving the state mustn't trigger another batch when it's kept in the watched directory
+		for _, path := range []string{opts.StatePath, opts.StatePath + ".tmp"} {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return fmt.Errorf("error accessing path %s: %w", path, err)
+			}
+			w.ignored[abs] = true
+		}
+	}
+	if err := w.loadState(); err != nil {
+		return err
+	}
+	if err := w.watchDir(dir); err != nil {
+		return err
+	}
+
+	// Ingest what is already there, then whatever changes
+	if err := w.ingest(ctx, nil); err != nil {
+		return err
+	}
+	timer := time.NewTimer(opts.Debounce)
+	timer.Stop()
+	changed := map[string]bool{}
+	rescan := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if w.isIgnored(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				w.forget(event.Name)
+				continue
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				// Files may have been created in a new directory before it was watched, so look at all of it
+				if err := w.watchDir(event.Name); err != nil {
+					return err
+				}
+				rescan = true
+			}
+			changed[event.Name] = true
+			timer.Reset(opts.Debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				return fmt.Errorf("failed to watch %s: %w", dir, err)
+			}
+			// Some events were dropped, so look at everything
+			rescan = true
+			timer.Reset(opts.Debounce)
+		case <-timer.C:
+			if rescan {
+				changed = nil
+			}
+			if err := w.ingest(ctx, changed); err != nil {
+				return err
+			}
+			changed, rescan = map[string]bool{}, false
+		}
+	}
+}
+
+type sbomWatcher struct {
+	dir     string
+	storage pkg.Storage
+	opts    WatchOptions
+	watcher *fsnotify.Watcher
+	// hashes are the content hashes of the files the ingested documents are in, by document name.
+	hashes map[string]string
+	// ignored are the absolute paths of the files the watch writes itself.
+	ignored map[string]bool
+}
+
+func (w *sbomWatcher) isIgnored(path string) bool {
+	abs, err := filepath.Abs(path)
+	return err == nil && w.ignored[abs]
+}
+
+// forget forgets the documents in a removed or renamed file or directory, so they're ingested again if they come back.
+func (w *sbomWatcher) forget(path string) {
+	forgotten := false
+	for name := range w.hashes {
+		if name == path || strings.HasPrefix(name, path+"!") || strings.HasPrefix(name, path+"@") ||
+			strings.HasPrefix(name, path+string(filepath.Separator)) {
+			delete(w.hashes, name)
+			forgotten = true
+		}
+	}
+	if !forgotten {
+		return
+	}
+	if err := w.saveState(); err != nil {
+		w.onBatch(nil, err)
+	}
+}
+
+// watchDir watches a directory and its subdirectories, skipping excluded ones.
+func (w *sbomWatcher) watchDir(root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to read directory %s: %w", path, err)
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(w.dir, path); err == nil && path != w.dir && matchesAny(w.opts.Exclude, rel) {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// ingest ingests the documents that changed since they were last ingested.
+// Only the documents in the changed files are looked at, or every document if changed is nil.
+// The error is only returned if ctx is done, other errors are passed to OnBatch.
+func (w *sbomWatcher) ingest(ctx context.Context, changed map[string]bool) error {
+	var sources []sbomSource
+	var err error
+	if changed == nil {
+		sources, err = sbomSources(w.dir, w.opts.Include, w.opts.Exclude)
+	} else {
+		sources, err = w.changedSources(changed)
+	}
+	if err != nil {
+		w.onBatch(nil, err)
+		return nil
+	}
+
+	// Files are hashed as a stream and documents are left for the workers to load, so a batch isn't held in memory.
+	// A changed archive has all of its documents ingested again.
+	var batch []sbomSource
+	hashes := map[string]string{}
+	fileHashes := map[string]string{}
+	for _, source := range sources {
+		if source.path != "" && w.isIgnored(source.path) {
+			continue
+		}
+		hash, err := sourceHash(source, fileHashes)
+		if err != nil {
+			// The file may have been removed since the directory was read
+			continue
+		}
+		if w.hashes[source.name] == hash {
+			continue
+		}
+		batch = append(batch, source)
+		hashes[source.name] = hash
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	report, err := ingestSources(ctx, batch, w.storage, w.opts.SBOMOptions)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// Failed documents are tried again the next time they change
+	for _, fileErr := range report.Errors {
+		delete(hashes, fileErr.Path)
+	}
+	for name, hash := range hashes {
+		w.hashes[name] = hash
+	}
+	if stateErr := w.saveState(); stateErr != nil && err == nil {
+		err = stateErr
+	}
+	if err == nil && w.opts.Cache && report.Files > 0 && !w.opts.DryRun {
+		if cacheErr := pkg.Cache(ctx, w.storage); cacheErr != nil {
+			err = fmt.Errorf("failed to cache: %w", cacheErr)
+		}
+	}
+	w.onBatch(report, err)
+	return nil
+}
+
+// sourceHash returns the content hash of the file a document is in, hashing each file once per batch.
+// Documents that aren't in a file are hashed themselves.
+func sourceHash(source sbomSource, fileHashes map[string]string) (string, error) {
+	if source.path == "" {
+		data, err := source.read()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+	}
+	if hash, ok := fileHashes[source.path]; ok {
+		return hash, nil
+	}
+	f, err := os.Open(source.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := fmt.Sprintf("%x", h.Sum(nil))
+	fileHashes[source.path] = hash
+	return hash, nil
+}
+
+func (w *sbomWatcher) onBatch(report *SBOMReport, err error) {
+	if w.opts.OnBatch != nil {
+		w.opts.OnBatch(report, err)
+	}
+}
+
+// changedSources returns the documents in the changed files, without reading the rest of the directory.
+// A changed file in an OCI image layout means every document in the layout is looked at.
+func (w *sbomWatcher) changedSources(changed map[string]bool) ([]sbomSource, error) {
+	if isOCILayout(w.dir) {
+		return sbomSources(w.dir, w.opts.Include, w.opts.Exclude)
+	}
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var sources []sbomSource
+	layouts := map[string]bool{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(w.dir, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		layout, excluded := w.enclosingLayout(rel)
+		if excluded {
+			continue
+		}
+		if layout != "" {
+			if layouts[layout] {
+				continue
+			}
+			layouts[layout] = true
+			layoutSources, err := ociLayoutSources(layout)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, layoutSources...)
+			continue
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			// The file may have been removed since it changed
+			continue
+		}
+		archived, isArchive, err := fileArchiveSources(path, w.opts.Include, w.opts.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		if isArchive {
+			sources = append(sources, archived...)
+		} else if len(w.opts.Include) == 0 || matchesAny(w.opts.Include, rel) {
+			sources = append(sources, sbomSource{name: path, path: path})
+		}
+	}
+	return sources, nil
+}
+
+// enclosingLayout returns the OCI image layout a path relative to the watched directory is in, if any,
+// and whether the path or one of its parent directories is excluded, the same way sbomSources walks the directory.
+func (w *sbomWatcher) enclosingLayout(rel string) (string, bool) {
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i := range parts {
+		parent := filepath.Join(parts[:i+1]...)
+		if matchesAny(w.opts.Exclude, parent) {
+			return "", true
+		}
+		if i < len(parts)-1 && isOCILayout(filepath.Join(w.dir, parent)) {
+			return filepath.Join(w.dir, parent), false
+		}
+	}
+	return "", false
+}
+
+func (w *sbomWatcher) loadState() error {
+	if w.opts.StatePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(w.opts.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read watch state: %w", err)
+	}
+	if err := json.Unmarshal(data, &w.hashes); err != nil {
+		return fmt.Errorf("failed to parse watch state %s: %w", w.opts.StatePath, err)
+	}
+	return nil
+}
+
+func (w *sbomWatcher) saveState() error {
+	if w.opts.StatePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(w.hashes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal watch state: %w", err)
+	}
+	// Write the state atomically, so it isn't lost if the watch is stopped while saving
+	tmp := w.opts.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write watch state: %w", err)
+	}
+	if err := os.Rename(tmp, w.opts.StatePath); err != nil {
+		return fmt.Errorf("failed to write watch state: %w", err)
+	}
+	return nil
+}
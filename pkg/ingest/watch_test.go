@@ -0,0 +1,211 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	copySBOM := func(name string) {
+		data, err := os.ReadFile(filepath.Join("../../test", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+	copySBOM("dep1.json")
+
+	storage := pkg.NewMemoryStorage()
+	watch := func() (chan *SBOMReport, func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		batches := make(chan *SBOMReport, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- Watch(ctx, dir, storage, WatchOptions{
+				SBOMOptions: SBOMOptions{Workers: 2, Include: []string{"*.json"}},
+				Debounce:    50 * time.Millisecond,
+				Cache:       true,
+				StatePath:   statePath,
+				OnBatch: func(report *SBOMReport, err error) {
+					assert.NoError(t, err)
+					batches <- report
+				},
+			})
+		}()
+		return batches, func() {
+			cancel()
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Watch didn't stop after the context was canceled")
+			}
+		}
+	}
+	next := func(batches chan *SBOMReport) *SBOMReport {
+		select {
+		case report := <-batches:
+			return report
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a batch")
+			return nil
+		}
+	}
+	noBatch := func(batches chan *SBOMReport) {
+		select {
+		case report := <-batches:
+			t.Fatalf("Expected no batch, got %+v", report)
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+
+	batches, stop := watch()
+	// What is already in the directory is ingested first
+	assert.Equal(t, 1, next(batches).Files)
+
+	copySBOM("libA.json")
+	assert.Equal(t, 1, next(batches).Files)
+
+	// Writing the same content again doesn't ingest it again
+	copySBOM("dep1.json")
+	noBatch(batches)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "more"), 0o700))
+	data, err := os.ReadFile("../../test/libB.json")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "more", "libB.json"), data, 0o600))
+	assert.Equal(t, 1, next(batches).Files)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("not an sbom"), 0o600))
+	report := next(batches)
+	assert.Equal(t, 0, report.Files)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, filepath.Join(dir, "broken.json"), report.Errors[0].Path)
+	stop()
+
+	toBeCached, err := storage.ToBeCached(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, toBeCached, "expected the graph to be cached after each batch")
+
+	// A restarted watch remembers what was ingested, and tries failed SBOMs again
+	batches, stop = watch()
+	report = next(batches)
+	assert.Equal(t, 0, report.Files)
+	assert.Len(t, report.Errors, 1)
+	noBatch(batches)
+
+	// Removing a file forgets it, so it's ingested again when it comes back
+	require.NoError(t, os.Remove(filepath.Join(dir, "libA.json")))
+	noBatch(batches)
+	copySBOM("libA.json")
+	assert.Equal(t, 1, next(batches).Files)
+	stop()
+}
+
+func TestWatchStateInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("../../test/dep1.json")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dep1.json"), data, 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batches := make(chan *SBOMReport, 10)
+	go func() {
+		assert.NoError(t, Watch(ctx, dir, pkg.NewMemoryStorage(), WatchOptions{
+			Debounce:  50 * time.Millisecond,
+			StatePath: filepath.Join(dir, "state.json"),
+			OnBatch: func(report *SBOMReport, err error) {
+				assert.NoError(t, err)
+				batches <- report
+			},
+		}))
+	}()
+
+	select {
+	case report := <-batches:
+		assert.Equal(t, 1, report.Files)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a batch")
+	}
+	// Saving the state after the batch doesn't trigger another one
+	select {
+	case report := <-batches:
+		t.Fatalf("Expected no batch, got %+v", report)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestChangedSources(t *testing.T) {
+	sboms := readTestSBOMs(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.json"), sboms["dep1.json"], 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.json"), sboms["libA.json"], 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an sbom"), 0o600))
+	writeZip(t, filepath.Join(dir, "bundle.zip"), map[string][]byte{"libB.json": sboms["libB.json"]})
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "image"), 0o700))
+	writeOCILayout(t, filepath.Join(dir, "image"), sboms)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "vendor"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vendor", "app.json"), sboms["dep1.json"], 0o600))
+
+	blobs, err := os.ReadDir(filepath.Join(dir, "image", "blobs", "sha256"))
+	require.NoError(t, err)
+	w := &sbomWatcher{dir: dir, opts: WatchOptions{SBOMOptions: SBOMOptions{Include: []string{"*.json"}, Exclude: []string{"vendor"}}}}
+	sources, err := w.changedSources(map[string]bool{
+		filepath.Join(dir, "app.json"):                                  true,
+		filepath.Join(dir, "notes.txt"):                                 true,
+		filepath.Join(dir, "bundle.zip"):                                true,
+		filepath.Join(dir, "image", "index.json"):                       true,
+		filepath.Join(dir, "image", "blobs", "sha256", blobs[0].Name()): true,
+		filepath.Join(dir, "vendor", "app.json"):                        true,
+		filepath.Join(dir, "removed.json"):                              true,
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for _, source := range sources {
+		names = append(names, source.name)
+	}
+	// lib.json didn't change, and the layout is only listed once
+	assert.Len(t, names, 5)
+	assert.Contains(t, names, filepath.Join(dir, "app.json"))
+	assert.Contains(t, names, filepath.Join(dir, "bundle.zip")+"!libB.json")
+	assert.NotContains(t, names, filepath.Join(dir, "lib.json"))
+	assert.NotContains(t, names, filepath.Join(dir, "vendor", "app.json"))
+}
+
+func TestWatchArchives(t *testing.T) {
+	sboms := readTestSBOMs(t)
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "sboms.tar.gz")
+	writeTarGz(t, archive, map[string][]byte{"dep1.json": sboms["dep1.json"], "libA.json": sboms["libA.json"]})
+
+	var reports []*SBOMReport
+	w := &sbomWatcher{dir: dir, storage: pkg.NewMemoryStorage(), hashes: map[string]string{}, ignored: map[string]bool{}, opts: WatchOptions{
+		OnBatch: func(report *SBOMReport, err error) {
+			assert.NoError(t, err)
+			reports = append(reports, report)
+		},
+	}}
+	ctx := context.Background()
+	require.NoError(t, w.ingest(ctx, nil))
+	require.Len(t, reports, 1)
+	assert.Equal(t, 2, reports[0].Files)
+
+	// An unchanged archive isn't read again
+	require.NoError(t, w.ingest(ctx, map[string]bool{archive: true}))
+	assert.Len(t, reports, 1)
+
+	// A changed archive has all of its documents ingested again
+	writeTarGz(t, archive, map[string][]byte{"dep1.json": sboms["dep1.json"], "libA.json": sboms["libA.json"], "libB.json": sboms["libB.json"]})
+	require.NoError(t, w.ingest(ctx, map[string]bool{archive: true}))
+	require.Len(t, reports, 2)
+	assert.Equal(t, 3, reports[1].Files)
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrJobCanceled = errors.New("job was canceled")
+
+type JobType string
+
+const (
+	IngestSBOMJob JobType = "ingest-sbom"
+	IngestOSVJob  JobType = "ingest-osv"
+	CacheJob      JobType = "cache"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// ProgressFunc is called by long running operations each time they finish a unit of work.
+// Returning an error stops the operation and the error is passed back to the caller.
+type ProgressFunc func(done, total int, message string) error
+
+// Job is the persisted record of a background operation.
+// CancelRequested is set with Storage.RequestJobCancel, saving a job doesn't change it.
+type Job struct {
+	ID              string    `json:"id"`
+	Type            JobType   `json:"type"`
+	Args            []string  `json:"args,omitempty"`
+	Status          JobStatus `json:"status"`
+	Done            int       `json:"done"`
+	Total           int       `json:"total"`
+	Logs            []string  `json:"logs,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	CancelRequested bool      `json:"cancelRequested,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	StartedAt       time.Time `json:"startedAt,omitempty"`
+	FinishedAt      time.Time `json:"finishedAt,omitempty"`
+}
+
+// Finished returns true once the job can no longer change state.
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
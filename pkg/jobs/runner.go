@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/bit-bom/minefield/pkg/ingest"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxJobLogs is the number of log messages kept for a job, older messages are dropped.
+	maxJobLogs = 1000
+	// progressSaveInterval is how often a running job's progress is saved at most.
+	progressSaveInterval = time.Second
+)
+
+// Runner runs jobs in the background and keeps their records in the storage backend up to date.
+type Runner struct {
+	storage pkg.Storage
+	mu      sync.Mutex
+	running map[string]*runningJob
+	wg      sync.WaitGroup
+}
+
+type runningJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRunner(storage pkg.Storage) *Runner {
+	return &Runner{
+		storage: storage,
+		running: make(map[string]*runningJob),
+	}
+}
+
+// FailOrphaned marks the jobs left pending or running by a runner that stopped without finishing them, such as a
+// server that crashed, as failed, and returns how many there were.
+// It must be called before the runner runs any jobs, and assumes no other runner uses the storage backend.
+func (r *Runner) FailOrphaned(ctx context.Context) (int, error) {
+	jobs, err := r.storage.GetJobs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get jobs: %w", err)
+	}
+	orphaned := 0
+	for _, job := range jobs {
+		if job.Finished() {
+			continue
+		}
+		job.Status = pkg.JobFailed
+		job.Error = "the runner stopped before the job finished"
+		job.FinishedAt = time.Now()
+		if err := r.storage.SaveJob(ctx, job); err != nil {
+			return orphaned, fmt.Errorf("failed to save job: %w", err)
+		}
+		orphaned++
+	}
+	return orphaned, nil
+}
+
+// Submit saves a new pending job and starts running it in the background.
+// The job keeps running after ctx is done, use Cancel to stop it.
+func (r *Runner) Submit(ctx context.Context, jobType pkg.JobType, args []string) (*pkg.Job, error) {
+	work, err := r.work(jobType, args)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &pkg.Job{
+		ID:        uuid.NewString(),
+		Type:      jobType,
+		Args:      args,
+		Status:    pkg.JobPending,
+		CreatedAt: time.Now(),
+	}
+	if err := r.storage.SaveJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+
+	// The running job updates its own copy of the record
+	submitted := *job
+
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	running := &runningJob{cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	r.running[job.ID] = running
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.running, job.ID)
+			r.mu.Unlock()
+			cancel()
+			close(running.done)
+		}()
+		r.run(jobCtx, job, work)
+	}()
+
+	return &submitted, nil
+}
+
+// Done returns a channel that is closed once the job has finished.
+// Jobs this runner isn't running are treated as finished.
+func (r *Runner) Done(id string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if running, ok := r.running[id]; ok {
+		return running.done
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// Cancel requests that a job stops.
+// Jobs run by another process notice the request the next time they report progress.
+func (r *Runner) Cancel(ctx context.Context, id string) error {
+	if err := Cancel(ctx, r.storage, id); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	running, ok := r.running[id]
+	r.mu.Unlock()
+	if ok {
+		running.cancel()
+	}
+	return nil
+}
+
+// Wait blocks until every submitted job has finished.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Cancel marks a job in the storage backend as canceled, for whichever runner is running it to pick up.
+func Cancel(ctx context.Context, storage pkg.Storage, id string) error {
+	job, err := storage.GetJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.Finished() {
+		return fmt.Errorf("job %s has already finished with status %s", id, job.Status)
+	}
+	return storage.RequestJobCancel(ctx, id)
+}
+
+func (r *Runner) work(jobType pkg.JobType, args []string) (func(context.Context, pkg.ProgressFunc) error, error) {
+	switch jobType {
+	case pkg.IngestSBOMJob:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s jobs take exactly one path argument", jobType)
+		}
+		return func(ctx context.Context, progress pkg.ProgressFunc) error {
+			return ingest.SBOMWithProgress(ctx, args[0], r.storage, progress)
+		}, nil
+	case pkg.IngestOSVJob:
+		if len(args) > 1 {
+			return nil, fmt.Errorf("%s jobs take at most one OSV export path argument", jobType)
+		}
+		if len(args) == 1 {
+			return func(ctx context.Context, progress pkg.ProgressFunc) error {
+				return ingest.VulnerabilitiesFromOSVExport(ctx, r.storage, args[0], progress)
+			}, nil
+		}
+		return func(ctx context.Context, progress pkg.ProgressFunc) error {
+			return ingest.VulnerabilitiesWithProgress(ctx, r.storage, progress)
+		}, nil
+	case pkg.CacheJob:
+		return func(ctx context.Context, progress pkg.ProgressFunc) error {
+			return pkg.CacheWithProgress(ctx, r.storage, progress)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown job type %s", jobType)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job *pkg.Job, work func(context.Context, pkg.ProgressFunc) error) {
+	// The job record has to be updated even after the job itself is canceled
+	recordCtx := context.WithoutCancel(ctx)
+
+	job.Status = pkg.JobRunning
+	job.StartedAt = time.Now()
+	// The record is saved again once the job finishes, so a failure here is not fatal
+	_ = r.storage.SaveJob(recordCtx, job)
+
+	// Progress is saved at most once per interval, as jobs can report it for every node of a large graph
+	var saved time.Time
+	err := work(ctx, func(done, total int, message string) error {
+		job.Done, job.Total = done, total
+		if message != "" {
+			job.Logs = append(job.Logs, message)
+			if len(job.Logs) > maxJobLogs {
+				job.Logs = slices.Delete(job.Logs, 0, len(job.Logs)-maxJobLogs)
+			}
+		}
+		if time.Since(saved) < progressSaveInterval {
+			return nil
+		}
+		saved = time.Now()
+		if err := r.storage.SaveJob(recordCtx, job); err != nil {
+			return err
+		}
+		if saved, err := r.storage.GetJob(recordCtx, job.ID); err == nil && saved.CancelRequested {
+			return pkg.ErrJobCanceled
+		}
+		return nil
+	})
+
+	job.FinishedAt = time.Now()
+	switch {
+	case errors.Is(err, pkg.ErrJobCanceled), errors.Is(err, context.Canceled):
+		job.Status = pkg.JobCanceled
+	case err != nil:
+		job.Status = pkg.JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = pkg.JobSucceeded
+	}
+	_ = r.storage.SaveJob(recordCtx, job)
+}
@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerSubmit(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	runner := NewRunner(storage)
+
+	job, err := runner.Submit(ctx, pkg.IngestSBOMJob, []string{"../../test"})
+	require.NoError(t, err)
+	assert.Equal(t, pkg.JobPending, job.Status)
+
+	<-runner.Done(job.ID)
+
+	saved, err := storage.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.JobSucceeded, saved.Status, saved.Error)
+	assert.Equal(t, 3, saved.Done)
+	assert.Equal(t, 3, saved.Total)
+	assert.Len(t, saved.Logs, 3)
+	assert.False(t, saved.FinishedAt.IsZero())
+
+	keys, err := storage.GetAllKeys(ctx)
+	require.NoError(t, err)
+	// 4 packages and a document node for each of the 3 SBOMs
+	assert.Len(t, keys, 7)
+
+	job, err = runner.Submit(ctx, pkg.CacheJob, nil)
+	require.NoError(t, err)
+	runner.Wait()
+
+	saved, err = storage.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.JobSucceeded, saved.Status, saved.Error)
+
+	jobs, err := storage.GetJobs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, jobs, 2)
+}
+
+func TestRunnerSubmitInvalid(t *testing.T) {
+	ctx := context.Background()
+	runner := NewRunner(pkg.NewMemoryStorage())
+
+	_, err := runner.Submit(ctx, "unknown", nil)
+	assert.Error(t, err)
+
+	_, err = runner.Submit(ctx, pkg.IngestSBOMJob, nil)
+	assert.Error(t, err)
+
+	_, err = runner.Submit(ctx, pkg.IngestOSVJob, []string{"a.zip", "b.zip"})
+	assert.Error(t, err)
+}
+
+func TestRunnerFailedJob(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	runner := NewRunner(storage)
+
+	job, err := runner.Submit(ctx, pkg.IngestSBOMJob, []string{"does-not-exist"})
+	require.NoError(t, err)
+	<-runner.Done(job.ID)
+
+	saved, err := storage.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.JobFailed, saved.Status)
+	assert.NotEmpty(t, saved.Error)
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	runner := NewRunner(storage)
+	job := &pkg.Job{ID: "job", Type: pkg.CacheJob, Status: pkg.JobRunning, CreatedAt: time.Now()}
+	require.NoError(t, storage.SaveJob(ctx, job))
+
+	// Cancellation requested by another process is noticed the next time the job reports progress
+	require.NoError(t, Cancel(ctx, storage, job.ID))
+	// Saving a copy of the record read before the request doesn't drop it
+	require.NoError(t, storage.SaveJob(ctx, job))
+	runner.run(ctx, job, func(_ context.Context, progress pkg.ProgressFunc) error {
+		return progress(1, 2, "step")
+	})
+
+	saved, err := storage.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.JobCanceled, saved.Status)
+
+	assert.Error(t, Cancel(ctx, storage, job.ID), "finished jobs can't be canceled")
+	assert.Error(t, Cancel(ctx, storage, "missing"))
+}
+
+// countingStorage counts the times jobs are saved.
+type countingStorage struct {
+	pkg.Storage
+	saves int
+}
+
+func (s *countingStorage) SaveJob(ctx context.Context, job *pkg.Job) error {
+	s.saves++
+	return s.Storage.SaveJob(ctx, job)
+}
+
+func TestRunnerProgress(t *testing.T) {
+	ctx := context.Background()
+	storage := &countingStorage{Storage: pkg.NewMemoryStorage()}
+	runner := NewRunner(storage)
+	job := &pkg.Job{ID: "job", Type: pkg.CacheJob, Status: pkg.JobPending, CreatedAt: time.Now()}
+	require.NoError(t, storage.SaveJob(ctx, job))
+
+	// Jobs reporting progress for every node are saved a few times, with their latest logs
+	const steps = 3 * maxJobLogs
+	runner.run(ctx, job, func(_ context.Context, progress pkg.ProgressFunc) error {
+		for i := 1; i <= steps; i++ {
+			if err := progress(i, steps, fmt.Sprint("step ", i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	saved, err := storage.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.JobSucceeded, saved.Status)
+	assert.Equal(t, steps, saved.Done)
+	require.Len(t, saved.Logs, maxJobLogs)
+	assert.Equal(t, fmt.Sprint("step ", steps), saved.Logs[maxJobLogs-1])
+	assert.Less(t, storage.saves, 10)
+}
+
+func TestRunnerFailOrphaned(t *testing.T) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	for _, job := range []*pkg.Job{
+		{ID: "pending", Type: pkg.CacheJob, Status: pkg.JobPending},
+		{ID: "running", Type: pkg.CacheJob, Status: pkg.JobRunning},
+		{ID: "succeeded", Type: pkg.CacheJob, Status: pkg.JobSucceeded},
+	} {
+		require.NoError(t, storage.SaveJob(ctx, job))
+	}
+
+	orphaned, err := NewRunner(storage).FailOrphaned(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, orphaned)
+	for id, want := range map[string]pkg.JobStatus{"pending": pkg.JobFailed, "running": pkg.JobFailed, "succeeded": pkg.JobSucceeded} {
+		saved, err := storage.GetJob(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, want, saved.Status, id)
+	}
+}
@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// LeaderboardEntry is a node together with the output of a leaderboard script run against it.
+type LeaderboardEntry struct {
+	Node   *Node
+	Output []uint32
+}
+
+// CustomLeaderboard runs the script against every named node, other than document nodes, and sorts the nodes by the length of their output, longest first.
+func CustomLeaderboard(ctx context.Context, storage Storage, script string) ([]*LeaderboardEntry, error) {
+	uncachedNodes, err := storage.ToBeCached(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(uncachedNodes) != 0 {
+		return nil, fmt.Errorf("cannot use sorted leaderboards without caching")
+	}
+
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keys: %w", err)
+	}
+
+	var entries []*LeaderboardEntry
+
+	for _, key := range keys {
+		node, err := storage.GetNode(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Document nodes depend on every root they declare, which isn't a dependency worth ranking
+		if node.Name == "" || node.Type == DocumentNodeType {
+			continue
+		}
+
+		execute, err := ParseAndExecute(ctx, script, storage, node.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &LeaderboardEntry{Node: node, Output: execute.ToArray()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return len(entries[i].Output) > len(entries[j].Output)
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	libA, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/lib-A@1.0.0")
+	assert.NoError(t, err)
+	libB, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/lib-B@1.0.0")
+	assert.NoError(t, err)
+	dep1, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/dep1@1.0.0")
+	assert.NoError(t, err)
+
+	assert.NoError(t, libA.SetDependency(ctx, storage, dep1))
+	assert.NoError(t, libB.SetDependency(ctx, storage, dep1))
+	// Document nodes depend on their roots, but aren't ranked
+	document, err := AddNode(ctx, storage, DocumentNodeType, nil, "document:pkg:generic/lib-A@1.0.0")
+	assert.NoError(t, err)
+	assert.NoError(t, document.SetDependency(ctx, storage, libA))
+
+	_, err = CustomLeaderboard(ctx, storage, "dependents PACKAGE")
+	assert.Error(t, err, "expected an error when the graph is not cached")
+
+	assert.NoError(t, Cache(ctx, storage))
+
+	entries, err := CustomLeaderboard(ctx, storage, "dependents PACKAGE")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, dep1.ID, entries[0].Node.ID)
+	assert.ElementsMatch(t, []uint32{libA.ID, libB.ID}, entries[0].Output)
+
+	entries, err = CustomLeaderboard(ctx, storage, "dependencies PACKAGE")
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotEqual(t, document.ID, entry.Node.ID)
+	}
+}
@@ -0,0 +1,649 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+// MemoryStorage keeps graphs in memory, one per namespace, such as the snapshots diff compares.
+type MemoryStorage struct {
+	*memoryGraph
+	namespaces *memoryNamespaces
+}
+
+// memoryNamespaces is the graphs of every namespace, shared by the storages of all of them.
+type memoryNamespaces struct {
+	mu     sync.Mutex
+	graphs map[string]*memoryGraph
+	// created is the namespaces that were created, which are listed along with the default one.
+	created map[string]bool
+}
+
+// memoryGraph is the graph of one namespace.
+type memoryGraph struct {
+	nodes        map[uint32]*Node
+	dependencies map[uint32]*roaring.Bitmap
+	dependents   map[uint32]*roaring.Bitmap
+	nameToID     map[string]uint32
+	idCounter    uint32
+	fullyCached  bool
+	mu           sync.Mutex
+	cache        map[uint32]*NodeCache
+	toBeCached   []uint32
+	jobs         map[string]Job
+	canceledJobs map[string]bool
+	provenance   map[string]*roaring.Bitmap
+	documents    map[uint32]*roaring.Bitmap
+	docEdges     map[uint32]map[Edge]bool
+	edgeTypes    map[Edge]EdgeType
+	indexes      map[string]*roaring.Bitmap
+	vex          map[Edge]map[uint32]VEXStatement
+	versions     []*GraphVersion
+	history      map[uint32]map[uint32]*roaring.Bitmap
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	graph := newMemoryGraph()
+	return &MemoryStorage{
+		memoryGraph: graph,
+		namespaces: &memoryNamespaces{
+			graphs:  map[string]*memoryGraph{DefaultNamespace: graph},
+			created: map[string]bool{},
+		},
+	}
+}
+
+func newMemoryGraph() *memoryGraph {
+	return &memoryGraph{
+		nodes:        make(map[uint32]*Node),
+		dependencies: make(map[uint32]*roaring.Bitmap),
+		dependents:   make(map[uint32]*roaring.Bitmap),
+		nameToID:     make(map[string]uint32),
+		idCounter:    0,
+		jobs:         make(map[string]Job),
+		canceledJobs: make(map[string]bool),
+		provenance:   make(map[string]*roaring.Bitmap),
+		documents:    make(map[uint32]*roaring.Bitmap),
+		docEdges:     make(map[uint32]map[Edge]bool),
+		edgeTypes:    make(map[Edge]EdgeType),
+		indexes:      make(map[string]*roaring.Bitmap),
+		vex:          make(map[Edge]map[uint32]VEXStatement),
+		history:      make(map[uint32]map[uint32]*roaring.Bitmap),
+	}
+}
+
+func (m *MemoryStorage) SaveNode(_ context.Context, node *Node) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.nameToID[node.Name]; ok && existing != node.ID {
+		return fmt.Errorf("failed to save node %d: %w: %s is node %d", node.ID, ErrNodeAlreadyExists, node.Name, existing)
+	}
+	m.nameToID[node.Name] = node.ID
+	m.nodes[node.ID] = cloneNode(node)
+	m.toBeCached = append(m.toBeCached, node.ID)
+	// Nodes saved with their own IDs, as from a snapshot, must not be given to new nodes
+	m.idCounter = max(m.idCounter, node.ID)
+	return nil
+}
+
+func (m *MemoryStorage) SaveNodeMetadata(_ context.Context, id uint32, metadata any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, ok := m.nodes[id]
+	if !ok {
+		return fmt.Errorf("node %d not found", id)
+	}
+	node.Metadata = metadata
+	return nil
+}
+
+func (m *MemoryStorage) CreateNode(_ context.Context, node *Node) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, exists := m.nameToID[node.Name]; exists {
+		return id, ErrNodeAlreadyExists
+	}
+	m.idCounter++
+	node.ID = m.idCounter
+	m.nameToID[node.Name] = node.ID
+	m.nodes[node.ID] = cloneNode(node)
+	m.toBeCached = append(m.toBeCached, node.ID)
+	return node.ID, nil
+}
+
+func (m *MemoryStorage) AddDependency(_ context.Context, from, to uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fromNode, exists := m.nodes[from]
+	if !exists {
+		return fmt.Errorf("node %v not found", from)
+	}
+	toNode, exists := m.nodes[to]
+	if !exists {
+		return fmt.Errorf("node %v not found", to)
+	}
+	fromNode.Children.Add(to)
+	toNode.Parents.Add(from)
+	m.toBeCached = append(m.toBeCached, from, to)
+	return nil
+}
+
+func (m *MemoryStorage) RemoveDependency(_ context.Context, from, to uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fromNode, exists := m.nodes[from]
+	if !exists {
+		return fmt.Errorf("node %v not found", from)
+	}
+	toNode, exists := m.nodes[to]
+	if !exists {
+		return fmt.Errorf("node %v not found", to)
+	}
+	fromNode.Children.Remove(to)
+	toNode.Parents.Remove(from)
+	m.toBeCached = append(m.toBeCached, from, to)
+	return nil
+}
+
+func (m *MemoryStorage) GetNode(_ context.Context, id uint32) (*Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, exists := m.nodes[id]
+	if !exists {
+		return nil, fmt.Errorf("node %v not found", id)
+	}
+	return cloneNode(node), nil
+}
+
+func (m *MemoryStorage) GetAllKeys(_ context.Context) ([]uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]uint32, 0, len(m.nodes))
+	for k := range m.nodes {
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (m *MemoryStorage) SaveCache(_ context.Context, cache *NodeCache) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cache == nil {
+		m.cache = map[uint32]*NodeCache{}
+	}
+	m.cache[cache.nodeID] = cache
+	return nil
+}
+
+func (m *MemoryStorage) ToBeCached(_ context.Context) ([]uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.toBeCached, nil
+}
+
+func (m *MemoryStorage) AddNodeToCachedStack(_ context.Context, id uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toBeCached = append(m.toBeCached, id)
+
+	return nil
+}
+
+func (m *MemoryStorage) ClearCacheStack(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toBeCached = []uint32{}
+
+	return nil
+}
+
+func (m *MemoryStorage) GetCache(_ context.Context, id uint32) (*NodeCache, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.cache[id]; !ok {
+		return nil, errors.New("cacheHelper not found")
+	}
+	// Copy the cache so callers can't modify it without saving it again
+	return NewNodeCache(id, cloneBitmap(m.cache[id].allParents), cloneBitmap(m.cache[id].allChildren)), nil
+}
+
+func (m *MemoryStorage) GenerateID(_ context.Context) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idCounter++
+	return m.idCounter, nil
+}
+
+func (m *MemoryStorage) NameToID(_ context.Context, name string) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.nameToID[name]; !exists {
+		return 0, ErrNodeNotFound
+	}
+	return m.nameToID[name], nil
+}
+
+func (m *MemoryStorage) GetNodes(_ context.Context, ids []uint32) (map[uint32]*Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make(map[uint32]*Node, len(ids))
+	for _, id := range ids {
+		node, exists := m.nodes[id]
+		if !exists {
+			continue // Skip missing nodes
+		}
+		nodes[id] = cloneNode(node)
+	}
+
+	return nodes, nil
+}
+
+func (m *MemoryStorage) SaveCaches(_ context.Context, caches []*NodeCache) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, cache := range caches {
+		if m.cache == nil {
+			m.cache = map[uint32]*NodeCache{}
+		}
+		m.cache[cache.nodeID] = cache
+	}
+	return nil
+}
+
+func (m *MemoryStorage) SaveJob(_ context.Context, job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (m *MemoryStorage) GetJob(_ context.Context, id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, exists := m.jobs[id]
+	if !exists {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	job = copyJob(&job)
+	job.CancelRequested = m.canceledJobs[id]
+	return &job, nil
+}
+
+func (m *MemoryStorage) GetJobs(_ context.Context) ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for id, job := range m.jobs {
+		job = copyJob(&job)
+		job.CancelRequested = m.canceledJobs[id]
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStorage) RequestJobCancel(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.canceledJobs[id] = true
+	return nil
+}
+
+func (m *MemoryStorage) AddProvenance(_ context.Context, document uint32, nodes []uint32, edges []Edge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.documents[document] == nil {
+		m.documents[document] = roaring.New()
+	}
+	if m.docEdges[document] == nil {
+		m.docEdges[document] = map[Edge]bool{}
+	}
+	for _, id := range nodes {
+		m.addProvenance(fmt.Sprintf("node:%d", id), document)
+		m.documents[document].Add(id)
+	}
+	for _, edge := range edges {
+		m.addProvenance(fmt.Sprint("edge:", edge), document)
+		m.docEdges[document][edge] = true
+	}
+	return nil
+}
+
+func (m *MemoryStorage) RemoveProvenance(_ context.Context, document uint32, nodes []uint32, edges []Edge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range nodes {
+		if provenance, ok := m.provenance[fmt.Sprintf("node:%d", id)]; ok {
+			provenance.Remove(document)
+		}
+		if declared, ok := m.documents[document]; ok {
+			declared.Remove(id)
+		}
+	}
+	for _, edge := range edges {
+		if provenance, ok := m.provenance[fmt.Sprint("edge:", edge)]; ok {
+			provenance.Remove(document)
+		}
+		delete(m.docEdges[document], edge)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) addProvenance(key string, document uint32) {
+	if m.provenance[key] == nil {
+		m.provenance[key] = roaring.New()
+	}
+	m.provenance[key].Add(document)
+}
+
+func (m *MemoryStorage) GetNodeProvenance(_ context.Context, id uint32) (*roaring.Bitmap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cloneBitmap(m.provenance[fmt.Sprintf("node:%d", id)]), nil
+}
+
+func (m *MemoryStorage) GetEdgeProvenance(_ context.Context, edge Edge) (*roaring.Bitmap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cloneBitmap(m.provenance[fmt.Sprint("edge:", edge)]), nil
+}
+
+func (m *MemoryStorage) SetEdgeTypes(_ context.Context, types map[Edge]EdgeType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	maps.Copy(m.edgeTypes, types)
+	return nil
+}
+
+func (m *MemoryStorage) GetEdgeTypes(_ context.Context, edges []Edge) (map[Edge]EdgeType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	types := map[Edge]EdgeType{}
+	for _, edge := range edges {
+		if edgeType, ok := m.edgeTypes[edge]; ok {
+			types[edge] = edgeType
+		}
+	}
+	return types, nil
+}
+
+func (m *MemoryStorage) GetDocumentNodes(_ context.Context, document uint32) (*roaring.Bitmap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cloneBitmap(m.documents[document]), nil
+}
+
+func (m *MemoryStorage) GetDocumentEdges(_ context.Context, document uint32) ([]Edge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	edges := make([]Edge, 0, len(m.docEdges[document]))
+	for edge := range m.docEdges[document] {
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+func (m *MemoryStorage) AddToIndex(_ context.Context, index, value string, ids []uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := index + ":" + value
+	if m.indexes[key] == nil {
+		m.indexes[key] = roaring.New()
+	}
+	m.indexes[key].AddMany(ids)
+	return nil
+}
+
+func (m *MemoryStorage) GetIndex(_ context.Context, index, value string) (*roaring.Bitmap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cloneBitmap(m.indexes[index+":"+value]), nil
+}
+
+func (m *MemoryStorage) SetVEXStatement(_ context.Context, edge Edge, statement *VEXStatement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.vex[edge] == nil {
+		m.vex[edge] = map[uint32]VEXStatement{}
+	}
+	m.vex[edge][statement.Product] = *statement
+	return nil
+}
+
+func (m *MemoryStorage) GetVEXStatements(_ context.Context, edge Edge) ([]*VEXStatement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statements := make([]*VEXStatement, 0, len(m.vex[edge]))
+	for _, statement := range m.vex[edge] {
+		statements = append(statements, &statement)
+	}
+	return statements, nil
+}
+
+func (m *MemoryStorage) AddGraphVersion(_ context.Context, version *GraphVersion, baseline, children map[uint32]*roaring.Bitmap) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	version.Version = uint32(len(m.versions) + 1)
+	saved := *version
+	saved.Documents = slices.Clone(version.Documents)
+	m.versions = append(m.versions, &saved)
+	for id, bitmap := range baseline {
+		if m.history[id] == nil {
+			m.history[id] = map[uint32]*roaring.Bitmap{BaselineGraphVersion: cloneBitmap(bitmap)}
+		}
+	}
+	for id, bitmap := range children {
+		if m.history[id] == nil {
+			m.history[id] = map[uint32]*roaring.Bitmap{}
+		}
+		m.history[id][version.Version] = cloneBitmap(bitmap)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetGraphVersions(_ context.Context) ([]*GraphVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := make([]*GraphVersion, 0, len(m.versions))
+	for _, version := range m.versions {
+		c := *version
+		c.Documents = slices.Clone(version.Documents)
+		versions = append(versions, &c)
+	}
+	return versions, nil
+}
+
+func (m *MemoryStorage) GetNodeHistories(_ context.Context, ids []uint32) (map[uint32]map[uint32]*roaring.Bitmap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	histories := make(map[uint32]map[uint32]*roaring.Bitmap, len(ids))
+	for _, id := range ids {
+		if len(m.history[id]) == 0 {
+			continue
+		}
+		histories[id] = make(map[uint32]*roaring.Bitmap, len(m.history[id]))
+		for version, bitmap := range m.history[id] {
+			histories[id][version] = cloneBitmap(bitmap)
+		}
+	}
+	return histories, nil
+}
+
+func (m *MemoryStorage) UseNamespace(name string) error {
+	if err := ValidateNamespace(name); err != nil {
+		return err
+	}
+	m.memoryGraph = m.namespaces.graph(name)
+	return nil
+}
+
+func (m *MemoryStorage) InNamespace(name string) (Storage, error) {
+	if err := ValidateNamespace(name); err != nil {
+		return nil, err
+	}
+	return &MemoryStorage{memoryGraph: m.namespaces.graph(name), namespaces: m.namespaces}, nil
+}
+
+func (m *MemoryStorage) Namespaces(_ context.Context) ([]string, error) {
+	m.namespaces.mu.Lock()
+	defer m.namespaces.mu.Unlock()
+	names := []string{DefaultNamespace}
+	for name := range m.namespaces.created {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (m *MemoryStorage) CreateNamespace(_ context.Context, name string) error {
+	if err := ValidateNamespace(name); err != nil {
+		return err
+	}
+	m.namespaces.mu.Lock()
+	defer m.namespaces.mu.Unlock()
+	if name == DefaultNamespace || m.namespaces.created[name] {
+		return fmt.Errorf("failed to create namespace %s: %w", name, ErrNamespaceExists)
+	}
+	m.namespaces.created[name] = true
+	return nil
+}
+
+func (m *MemoryStorage) CopyNamespace(_ context.Context, from, to string) error {
+	if err := ValidateNamespace(to); err != nil {
+		return err
+	}
+	m.namespaces.mu.Lock()
+	defer m.namespaces.mu.Unlock()
+	if from != DefaultNamespace && !m.namespaces.created[from] {
+		return fmt.Errorf("failed to copy namespace %s: %w", from, ErrNamespaceNotFound)
+	}
+	if to == DefaultNamespace || m.namespaces.created[to] {
+		return fmt.Errorf("failed to copy namespace %s to %s: %w", from, to, ErrNamespaceExists)
+	}
+	source := m.namespaces.graphs[from]
+	if source == nil {
+		source = newMemoryGraph()
+	}
+	m.namespaces.graphs[to] = source.clone()
+	m.namespaces.created[to] = true
+	return nil
+}
+
+func (m *MemoryStorage) DropNamespace(_ context.Context, name string) error {
+	if name == DefaultNamespace {
+		return fmt.Errorf("the %s namespace can't be dropped", DefaultNamespace)
+	}
+	m.namespaces.mu.Lock()
+	defer m.namespaces.mu.Unlock()
+	if !m.namespaces.created[name] {
+		return fmt.Errorf("failed to drop namespace %s: %w", name, ErrNamespaceNotFound)
+	}
+	delete(m.namespaces.created, name)
+	delete(m.namespaces.graphs, name)
+	return nil
+}
+
+// graph returns the graph of a namespace, which is empty until something is saved in it.
+func (n *memoryNamespaces) graph(name string) *memoryGraph {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.graphs[name] == nil {
+		n.graphs[name] = newMemoryGraph()
+	}
+	return n.graphs[name]
+}
+
+// clone copies everything in a graph, for copying namespaces.
+func (g *memoryGraph) clone() *memoryGraph {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := newMemoryGraph()
+	for id, node := range g.nodes {
+		c.nodes[id] = cloneNode(node)
+	}
+	for id, bitmap := range g.dependencies {
+		c.dependencies[id] = cloneBitmap(bitmap)
+	}
+	for id, bitmap := range g.dependents {
+		c.dependents[id] = cloneBitmap(bitmap)
+	}
+	maps.Copy(c.nameToID, g.nameToID)
+	c.idCounter = g.idCounter
+	c.fullyCached = g.fullyCached
+	if g.cache != nil {
+		c.cache = make(map[uint32]*NodeCache, len(g.cache))
+		for id, cache := range g.cache {
+			c.cache[id] = NewNodeCache(id, cloneBitmap(cache.allParents), cloneBitmap(cache.allChildren))
+		}
+	}
+	c.toBeCached = slices.Clone(g.toBeCached)
+	for id, job := range g.jobs {
+		c.jobs[id] = copyJob(&job)
+	}
+	maps.Copy(c.canceledJobs, g.canceledJobs)
+	for key, bitmap := range g.provenance {
+		c.provenance[key] = cloneBitmap(bitmap)
+	}
+	for id, bitmap := range g.documents {
+		c.documents[id] = cloneBitmap(bitmap)
+	}
+	for id, edges := range g.docEdges {
+		c.docEdges[id] = maps.Clone(edges)
+	}
+	maps.Copy(c.edgeTypes, g.edgeTypes)
+	for key, bitmap := range g.indexes {
+		c.indexes[key] = cloneBitmap(bitmap)
+	}
+	for edge, statements := range g.vex {
+		c.vex[edge] = maps.Clone(statements)
+	}
+	for _, version := range g.versions {
+		v := *version
+		v.Documents = slices.Clone(version.Documents)
+		c.versions = append(c.versions, &v)
+	}
+	for id, history := range g.history {
+		c.history[id] = make(map[uint32]*roaring.Bitmap, len(history))
+		for version, bitmap := range history {
+			c.history[id][version] = cloneBitmap(bitmap)
+		}
+	}
+	return c
+}
+
+// cloneBitmap copies a bitmap, returning an empty one for nil.
+func cloneBitmap(bitmap *roaring.Bitmap) *roaring.Bitmap {
+	c := roaring.New()
+	if bitmap != nil {
+		c.Or(bitmap)
+	}
+	return c
+}
+
+// cloneNode copies a node so callers can't modify a saved node without saving it again.
+func cloneNode(node *Node) *Node {
+	c := *node
+	if node.Children != nil {
+		c.Children = cloneBitmap(node.Children)
+	}
+	if node.Parents != nil {
+		c.Parents = cloneBitmap(node.Parents)
+	}
+	return &c
+}
+
+// copyJob copies a job so callers can't modify a saved job without saving it again.
+func copyJob(job *Job) Job {
+	c := *job
+	c.Args = slices.Clone(job.Args)
+	c.Logs = slices.Clone(job.Logs)
+	return c
+}
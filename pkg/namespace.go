@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// DefaultNamespace is the namespace storage backends use unless another is chosen.
+// Graphs stored before namespaces existed are in it.
+const DefaultNamespace = "default"
+
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+)
+
+// namespaceName is what namespace names are made of, which keeps them safe to use in storage keys and key patterns.
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateNamespace checks that a namespace name is made of letters, digits, dots, dashes and underscores.
+func ValidateNamespace(name string) error {
+	if !namespaceName.MatchString(name) {
+		return fmt.Errorf("invalid namespace %q, expected letters, digits, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// AllNamespaces selects every namespace in NamespaceStorages.
+const AllNamespaces = "*"
+
+// NamespaceStorages returns storages for the graphs of the named namespaces, or of all of them for AllNamespaces,
+// keyed by namespace, for queries across namespaces.
+func NamespaceStorages(ctx context.Context, storage Storage, names []string) (map[string]Storage, error) {
+	namespaces, err := storage.Namespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	if slices.Contains(names, AllNamespaces) {
+		names = namespaces
+	}
+	storages := make(map[string]Storage, len(names))
+	for _, name := range names {
+		if !slices.Contains(namespaces, name) {
+			return nil, fmt.Errorf("namespace %s: %w", name, ErrNamespaceNotFound)
+		}
+		if storages[name], err = storage.InNamespace(name); err != nil {
+			return nil, err
+		}
+	}
+	return storages, nil
+}
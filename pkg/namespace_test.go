@@ -0,0 +1,85 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaces(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	app, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/app@1.0.0")
+	require.NoError(t, err)
+	lib, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/lib@1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, app.SetDependency(ctx, storage, lib))
+
+	require.NoError(t, storage.CreateNamespace(ctx, "team-b"))
+	assert.ErrorIs(t, storage.CreateNamespace(ctx, "team-b"), ErrNamespaceExists)
+	assert.ErrorIs(t, storage.CreateNamespace(ctx, DefaultNamespace), ErrNamespaceExists)
+	assert.Error(t, storage.CreateNamespace(ctx, "team b"))
+	require.NoError(t, storage.CopyNamespace(ctx, DefaultNamespace, "team-a"))
+	assert.ErrorIs(t, storage.CopyNamespace(ctx, "team-c", "team-d"), ErrNamespaceNotFound)
+	assert.ErrorIs(t, storage.CopyNamespace(ctx, DefaultNamespace, "team-b"), ErrNamespaceExists)
+	namespaces, err := storage.Namespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultNamespace, "team-a", "team-b"}, namespaces)
+
+	// Namespaces keep separate graphs, and copies don't change with the original
+	teamA, err := storage.InNamespace("team-a")
+	require.NoError(t, err)
+	teamB, err := storage.InNamespace("team-b")
+	require.NoError(t, err)
+	_, err = teamB.NameToID(ctx, app.Name)
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+	other, err := AddNode(ctx, teamB, "PACKAGE", nil, "pkg:generic/other@1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), other.ID, "IDs are assigned per namespace")
+
+	util, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/util@1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, lib.SetDependency(ctx, storage, util))
+	require.NoError(t, Cache(ctx, teamA))
+	copied, err := teamA.GetNode(ctx, app.ID)
+	require.NoError(t, err)
+	dependencies, err := copied.QueryDependencies(ctx, teamA)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{lib.ID}, dependencies.ToArray())
+
+	// Queries run in another namespace only when it's asked for
+	storages, err := NamespaceStorages(ctx, storage, []string{AllNamespaces})
+	require.NoError(t, err)
+	assert.Len(t, storages, 3)
+	for namespace, want := range map[string]bool{DefaultNamespace: true, "team-a": true, "team-b": false} {
+		result, err := ParseAndExecute(ctx, "dependencies PACKAGE pkg:generic/app@1.0.0", storages[namespace], "")
+		if !want {
+			assert.Error(t, err, namespace)
+			continue
+		}
+		require.NoError(t, err, namespace)
+		assert.True(t, result.Contains(lib.ID), namespace)
+	}
+	_, err = NamespaceStorages(ctx, storage, []string{"team-c"})
+	assert.ErrorIs(t, err, ErrNamespaceNotFound)
+
+	// Switching namespaces switches the graph the storage reads and writes
+	require.NoError(t, storage.UseNamespace("team-b"))
+	_, err = storage.NameToID(ctx, other.Name)
+	assert.NoError(t, err)
+	require.NoError(t, storage.UseNamespace(DefaultNamespace))
+	_, err = storage.NameToID(ctx, other.Name)
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+
+	require.NoError(t, storage.DropNamespace(ctx, "team-b"))
+	assert.ErrorIs(t, storage.DropNamespace(ctx, "team-b"), ErrNamespaceNotFound)
+	assert.Error(t, storage.DropNamespace(ctx, DefaultNamespace))
+	teamB, err = storage.InNamespace("team-b")
+	require.NoError(t, err)
+	keys, err := teamB.GetAllKeys(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -1,14 +1,16 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/RoaringBitmap/roaring"
 )
 
 // ParseAndExecute parses and executes a script using the given storage backend.
-func ParseAndExecute(script string, storage Storage, defaultNodeName string) (*roaring.Bitmap, error) {
+func ParseAndExecute(ctx context.Context, script string, storage Storage, defaultNodeName string) (*roaring.Bitmap, error) {
 	var stack []*roaring.Bitmap
 	var operators []string
 
@@ -57,19 +59,19 @@ func ParseAndExecute(script string, storage Storage, defaultNodeName string) (*r
 				tokenIndex++
 				token = tokens[tokenIndex]
 			}
-			nodeID, err := storage.NameToID(token)
+			nodeID, err := storage.NameToID(ctx, token)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get node ID for name %s: %w", token, err)
 			}
-			node, err := storage.GetNode(nodeID)
+			node, err := storage.GetNode(ctx, nodeID)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get node for id %v: %w", nodeID, err)
 			}
 			var bitmap *roaring.Bitmap
 			if strings.TrimSpace(dir) == "dependents" {
-				bitmap, err = node.QueryDependents(storage)
+				bitmap, err = node.QueryDependents(ctx, storage)
 			} else {
-				bitmap, err = node.QueryDependencies(storage)
+				bitmap, err = node.QueryDependencies(ctx, storage)
 			}
 			if err != nil {
 				return nil, fmt.Errorf("failed to query dependents for node ID %d: %w", nodeID, err)
@@ -78,19 +80,49 @@ func ParseAndExecute(script string, storage Storage, defaultNodeName string) (*r
 				continue
 			}
 
-			for _, id := range bitmap.ToArray() {
-				node, err := storage.GetNode(id)
+			reachable := bitmap.Clone()
+			for _, id := range reachable.ToArray() {
+				dependency, err := storage.GetNode(ctx, id)
 				if err != nil {
 					return nil, err
 				}
 
-				if node.Type != nodeTypeQueried {
+				if dependency.Type != nodeTypeQueried {
 					bitmap.Remove(id)
+				} else if dependency.Type == VulnerabilityNodeType && dir == "dependencies" {
+					// Vulnerabilities the node isn't exposed to, according to VEX statements, are left out
+					suppressed, err := VulnerabilitySuppressed(ctx, storage, node.ID, reachable, dependency)
+					if err != nil {
+						return nil, err
+					}
+					if suppressed {
+						bitmap.Remove(id)
+					}
 				}
 			}
 
 			stack = append(stack, bitmap)
 
+		case isIndexAtom(token):
+			// Atoms such as license(MIT) and hash(sha256:...) look the nodes up in an index
+			index, value, _ := strings.Cut(strings.TrimSuffix(token, ")"), "(")
+			if index == HashIndex && !strings.Contains(value, ":") {
+				return nil, fmt.Errorf("hash %s must be prefixed by its algorithm, as in sha256:%s", value, value)
+			}
+			bitmap, err := storage.GetIndex(ctx, index, normalizeIndexValue(value))
+			if err != nil {
+				return nil, fmt.Errorf("failed to query %s index for %s: %w", index, value, err)
+			}
+			stack = append(stack, bitmap)
+
+		case strings.HasPrefix(token, "vulns(") && strings.HasSuffix(token, ")"):
+			// Atoms such as vulns(severity>=HIGH) select the vulnerabilities meeting every condition
+			bitmap, err := queryVulnerabilities(ctx, storage, strings.TrimSuffix(strings.TrimPrefix(token, "vulns("), ")"))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, bitmap)
+
 		case token == "or", token == "xor", token == "and":
 			// Before pushing new operator, apply any previous operators if not blocked by '('
 			for len(operators) > 0 && operators[len(operators)-1] != "[" {
@@ -136,3 +168,37 @@ func ParseAndExecute(script string, storage Storage, defaultNodeName string) (*r
 	}
 	return stack[0], nil
 }
+
+// isIndexAtom reports whether token queries one of the component or vulnerability indexes, as in license(MIT).
+func isIndexAtom(token string) bool {
+	index, value, ok := strings.Cut(token, "(")
+	return ok && (slices.Contains(ComponentIndexes, index) || slices.Contains(VulnerabilityIndexes, index)) && strings.HasSuffix(value, ")") && len(value) > 1
+}
+
+// queryVulnerabilities returns the vulnerability nodes that meet the comma separated conditions.
+func queryVulnerabilities(ctx context.Context, storage Storage, conditions string) (*roaring.Bitmap, error) {
+	filters, err := parseVulnerabilityFilters(conditions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vulns atom vulns(%s): %w", conditions, err)
+	}
+	ids, err := VulnerabilityNodes(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := storage.GetNodes(ctx, ids.ToArray())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	bitmap := roaring.New()
+	for id, node := range nodes {
+		metadata, err := NodeVulnerabilityMetadata(node)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(filters, func(filter vulnerabilityFilter) bool { return !filter(metadata) }) {
+			bitmap.Add(id)
+		}
+	}
+	return bitmap, nil
+}
@@ -1,48 +1,79 @@
 package pkg
 
 import (
+	"context"
 	"testing"
 
 	"github.com/RoaringBitmap/roaring"
 )
 
 func TestParseAndExecute(t *testing.T) {
-	storage := NewMockStorage()
+	ctx := context.Background()
+	storage := NewMemoryStorage()
 
-	node1, err := AddNode(storage, "PACKAGE", nil, "pkg:generic/lib-A@1.0.0")
+	node1, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/lib-A@1.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	node2, err := AddNode(storage, "PACKAGE", nil, "pkg:generic/lib-B@1.0.0")
+	node2, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/lib-B@1.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	node3, err := AddNode(storage, "PACKAGE", nil, "pkg:generic/dep1@1.0.0")
+	node3, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/dep1@1.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	node4, err := AddNode(storage, "PACKAGE", nil, "pkg:generic/dep2@1.0.0")
+	node4, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/dep2@1.0.0")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if err := Cache(storage); err != nil {
+	if err := Cache(ctx, storage); err != nil {
 		t.Fatal(err)
 	}
 
-	err = node1.SetDependency(storage, node3)
+	err = node1.SetDependency(ctx, storage, node3)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = node2.SetDependency(storage, node3)
+	err = node2.SetDependency(ctx, storage, node3)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = node3.SetDependency(storage, node4)
+	err = node3.SetDependency(ctx, storage, node4)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if err := storage.AddToIndex(ctx, LicenseIndex, "mit", []uint32{node1.ID, node4.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.AddToIndex(ctx, HashIndex, "sha256:abc", []uint32{node3.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	critical, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{
+		ID:       "GHSA-aaaa-bbbb-cccc",
+		Aliases:  []string{"CVE-2024-1234"},
+		Severity: []VulnerabilitySeverity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderate, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{
+		ID:               "GHSA-dddd-eeee-ffff",
+		DatabaseSpecific: map[string]any{"severity": "MODERATE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node4.SetDependency(ctx, storage, critical); err != nil {
+		t.Fatal(err)
+	}
+	if err := node3.SetDependency(ctx, storage, moderate); err != nil {
+		t.Fatal(err)
+	}
+
 	tests := []struct {
 		name            string
 		script          string
@@ -80,17 +111,77 @@ func TestParseAndExecute(t *testing.T) {
 			wantErr:         true,
 			defaultNodeName: "",
 		},
+		{
+			name:   "License query",
+			script: "license(MIT)",
+			want:   roaring.BitmapOf(1, 4),
+		},
+		{
+			name:   "Hash query combined with dependents",
+			script: "hash(SHA256:ABC) or dependents PACKAGE pkg:generic/dep1@1.0.0",
+			want:   roaring.BitmapOf(1, 2, 3),
+		},
+		{
+			name:   "License query and dependencies",
+			script: "license(mit) and dependencies PACKAGE pkg:generic/lib-A@1.0.0",
+			want:   roaring.BitmapOf(4),
+		},
+		{
+			name:    "Hash without an algorithm",
+			script:  "hash(abc)",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown index",
+			script:  "supplier(example)",
+			wantErr: true,
+		},
+		{
+			name:   "Vulnerabilities by severity",
+			script: "vulns(severity>=HIGH)",
+			want:   roaring.BitmapOf(5),
+		},
+		{
+			name:   "Vulnerabilities by database severity",
+			script: "vulns(severity>=medium)",
+			want:   roaring.BitmapOf(5, 6),
+		},
+		{
+			name:   "Vulnerabilities by score",
+			script: "vulns(score>=9.8,severity=CRITICAL)",
+			want:   roaring.BitmapOf(5),
+		},
+		{
+			name:   "Vulnerabilities of a package by severity",
+			script: "vulns(severity<CRITICAL) and dependencies VULNERABILITY pkg:generic/lib-A@1.0.0",
+			want:   roaring.BitmapOf(6),
+		},
+		{
+			name:   "Vulnerability by alias",
+			script: "alias(cve-2024-1234)",
+			want:   roaring.BitmapOf(5),
+		},
+		{
+			name:    "Unknown severity",
+			script:  "vulns(severity>=SEVERE)",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown vulnerability field",
+			script:  "vulns(owner=me)",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ParseAndExecute(tt.script, storage, tt.defaultNodeName)
+			result, err := ParseAndExecute(ctx, tt.script, storage, tt.defaultNodeName)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseAndExecute() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ParseAndExecute(ctx, ) error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !tt.wantErr && !result.Equals(tt.want) {
-				t.Errorf("ParseAndExecute() got = %v, want %v", result, tt.want)
+				t.Errorf("ParseAndExecute(ctx, ) got = %v, want %v", result, tt.want)
 			}
 		})
 	}
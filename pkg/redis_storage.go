@@ -1,52 +1,246 @@
 package pkg
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/RoaringBitmap/roaring"
 	"github.com/go-redis/redis/v8"
 )
 
 type RedisStorage struct {
-	client *redis.Client
+	client    *redis.Client
+	namespace string
 }
 
 func NewRedisStorage(addr string) Storage {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: addr,
 	})
-	return &RedisStorage{client: rdb}
+	return &RedisStorage{client: rdb, namespace: DefaultNamespace}
 }
 
-func (r *RedisStorage) GenerateID() (uint32, error) {
-	id, err := r.client.Incr(context.Background(), "id_counter").Result()
+// namespacesKey is the set of the namespaces that were created, which is shared by all of them.
+const namespacesKey = "namespaces"
+
+// namespacePrefix is the prefix of the keys of a namespace. The keys of DefaultNamespace have none, so graphs stored
+// before namespaces existed are in it.
+func namespacePrefix(namespace string) string {
+	if namespace == "" || namespace == DefaultNamespace {
+		return ""
+	}
+	return "namespace:" + namespace + ":"
+}
+
+// key returns the key of the storage's namespace for the key formatted from format and args.
+func (r *RedisStorage) key(format string, args ...any) string {
+	return namespacePrefix(r.namespace) + fmt.Sprintf(format, args...)
+}
+
+func (r *RedisStorage) GenerateID(ctx context.Context) (uint32, error) {
+	id, err := r.client.Incr(ctx, r.key("id_counter")).Result()
 	if err != nil {
 		return 0, fmt.Errorf("failed to generate ID: %w", err)
 	}
 	return uint32(id), nil
 }
 
-func (r *RedisStorage) SaveNode(node *Node) error {
+// saveNodeScript saves a node with its ID, unless its name already belongs to another node, in which case it returns
+// that node's ID. Nodes saved with their own IDs, as from a snapshot, raise the ID counter so they aren't given to new nodes.
+// KEYS are the name's key, the node's key, the ID counter and the to_be_cached set, ARGV[1] is the ID and ARGV[2] the node.
+var saveNodeScript = redis.NewScript(`
+local existing = redis.call("GET", KEYS[1])
+if existing and existing ~= ARGV[1] then
+	return tonumber(existing)
+end
+redis.call("SET", KEYS[1], ARGV[1])
+redis.call("SET", KEYS[2], ARGV[2])
+redis.call("SADD", KEYS[4], ARGV[1])
+if tonumber(redis.call("GET", KEYS[3]) or 0) < tonumber(ARGV[1]) then
+	redis.call("SET", KEYS[3], ARGV[1])
+end
+return 0
+`)
+
+func (r *RedisStorage) SaveNode(ctx context.Context, node *Node) error {
 	data, err := node.MarshalJSON()
 	if err != nil {
 		return fmt.Errorf("failed to marshal node: %w", err)
 	}
-	if err := r.client.Set(context.Background(), fmt.Sprintf("node:%d", node.ID), data, 0).Err(); err != nil {
-		return fmt.Errorf("failed to save node data: %w", err)
+	keys := []string{r.key("name_to_id:%s", node.Name), r.key("node:%d", node.ID), r.key("id_counter"), r.key("to_be_cached")}
+	existing, err := saveNodeScript.Run(ctx, r.client, keys, node.ID, data).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to save node %s: %w", node.Name, err)
+	}
+	if existing != 0 {
+		return fmt.Errorf("failed to save node %d: %w: %s is node %d", node.ID, ErrNodeAlreadyExists, node.Name, existing)
+	}
+	return nil
+}
+
+func (r *RedisStorage) SaveNodeMetadata(ctx context.Context, id uint32, metadata any) error {
+	key := r.key("node:%d", id)
+	txn := func(tx *redis.Tx) error {
+		node, err := r.getNodeTx(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		node.Metadata = metadata
+		data, err := node.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal node: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
 	}
-	if err := r.client.Set(context.Background(), fmt.Sprint("name_to_id:", node.Name), strconv.Itoa(int(node.ID)), 0).Err(); err != nil {
-		return fmt.Errorf("failed to save node name to ID mapping: %w", err)
+	if err := r.watch(ctx, txn, key); err != nil {
+		return fmt.Errorf("failed to save metadata of node %d: %w", id, err)
+	}
+	return nil
+}
+
+// maxWatchRetries is how often a transaction is retried when one of the keys it watches is modified concurrently.
+const maxWatchRetries = 100
+
+// createNodeScript looks up the node's name and only if it's unknown assigns the next ID and saves the node, so IDs
+// stay contiguous. It returns whether the node was created and its ID.
+// KEYS are the name's key, the ID counter and the to_be_cached set, ARGV[1] is the node's encoding up to the value of
+// its ID, which is its last field, and ARGV[2] the prefix of node keys.
+var createNodeScript = redis.NewScript(`
+local existing = redis.call("GET", KEYS[1])
+if existing then
+	return {0, tonumber(existing)}
+end
+local id = redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], id)
+redis.call("SET", ARGV[2] .. id, ARGV[1] .. cjson.encode(id) .. "}")
+redis.call("SADD", KEYS[3], id)
+return {1, id}
+`)
+
+// nodeIDSuffix is how the encoding of a node without an ID ends.
+var nodeIDSuffix = []byte(`,"ID":0}`)
+
+func (r *RedisStorage) CreateNode(ctx context.Context, node *Node) (uint32, error) {
+	unsaved := *node
+	unsaved.ID = 0
+	data, err := unsaved.MarshalJSON()
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal node: %w", err)
+	}
+	if !bytes.HasSuffix(data, nodeIDSuffix) {
+		return 0, fmt.Errorf("failed to create node %s: the encoding doesn't end with its ID", node.Name)
+	}
+	prefix := data[:len(data)-len("0}")]
+
+	keys := []string{r.key("name_to_id:%s", node.Name), r.key("id_counter"), r.key("to_be_cached")}
+	result, err := createNodeScript.Run(ctx, r.client, keys, prefix, r.key("node:")).Int64Slice()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create node %s: %w", node.Name, err)
+	}
+	id := uint32(result[1])
+	if result[0] == 0 {
+		return id, ErrNodeAlreadyExists
+	}
+	node.ID = id
+	return id, nil
+}
+
+func (r *RedisStorage) AddDependency(ctx context.Context, from, to uint32) error {
+	err := r.updateDependency(ctx, from, to, func(fromNode, toNode *Node) {
+		fromNode.Children.Add(to)
+		toNode.Parents.Add(from)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add dependency from %d to %d: %w", from, to, err)
 	}
-	if err := r.AddNodeToCachedStack(node.ID); err != nil {
-		return fmt.Errorf("failed to add node ID to to_be_cached set: %w", err)
+	return nil
+}
+
+func (r *RedisStorage) RemoveDependency(ctx context.Context, from, to uint32) error {
+	err := r.updateDependency(ctx, from, to, func(fromNode, toNode *Node) {
+		fromNode.Children.Remove(to)
+		toNode.Parents.Remove(from)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove dependency from %d to %d: %w", from, to, err)
 	}
 	return nil
 }
 
-func (r *RedisStorage) NameToID(name string) (uint32, error) {
-	id, err := r.client.Get(context.Background(), fmt.Sprintf("name_to_id:%s", name)).Result()
+// updateDependency atomically applies update to both nodes of a dependency and queues them for caching.
+func (r *RedisStorage) updateDependency(ctx context.Context, from, to uint32, update func(fromNode, toNode *Node)) error {
+	fromKey, toKey := r.key("node:%d", from), r.key("node:%d", to)
+	txn := func(tx *redis.Tx) error {
+		fromNode, err := r.getNodeTx(ctx, tx, fromKey)
+		if err != nil {
+			return err
+		}
+		toNode, err := r.getNodeTx(ctx, tx, toKey)
+		if err != nil {
+			return err
+		}
+		update(fromNode, toNode)
+
+		fromData, err := fromNode.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal node: %w", err)
+		}
+		toData, err := toNode.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal node: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, fromKey, fromData, 0)
+			pipe.Set(ctx, toKey, toData, 0)
+			pipe.SAdd(ctx, r.key("to_be_cached"), from, to)
+			return nil
+		})
+		return err
+	}
+
+	return r.watch(ctx, txn, fromKey, toKey)
+}
+
+// watch runs the transaction, retrying it while the watched keys are modified concurrently.
+func (r *RedisStorage) watch(ctx context.Context, txn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxWatchRetries; i++ {
+		err := r.client.Watch(ctx, txn, keys...)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("too many concurrent modifications")
+}
+
+func (r *RedisStorage) getNodeTx(ctx context.Context, tx *redis.Tx, key string) (*Node, error) {
+	data, err := tx.Get(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node data for %s: %w", key, err)
+	}
+	var node Node
+	if err := node.UnmarshalJSON([]byte(data)); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal node data: %w", err)
+	}
+	return &node, nil
+}
+
+func (r *RedisStorage) NameToID(ctx context.Context, name string) (uint32, error) {
+	id, err := r.client.Get(ctx, r.key("name_to_id:%s", name)).Result()
+	if err == redis.Nil {
+		return 0, fmt.Errorf("failed to get ID for name %s: %w", name, ErrNodeNotFound)
+	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to get ID for name %s: %w", name, err)
 	}
@@ -58,9 +252,8 @@ func (r *RedisStorage) NameToID(name string) (uint32, error) {
 	return uint32(idInt), nil
 }
 
-func (r *RedisStorage) GetNode(id uint32) (*Node, error) {
-	ctx := context.Background()
-	data, err := r.client.Get(ctx, fmt.Sprintf("node:%d", id)).Result()
+func (r *RedisStorage) GetNode(ctx context.Context, id uint32) (*Node, error) {
+	data, err := r.client.Get(ctx, r.key("node:%d", id)).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node data for ID %d: %w", id, err)
 	}
@@ -71,14 +264,14 @@ func (r *RedisStorage) GetNode(id uint32) (*Node, error) {
 	return &node, nil
 }
 
-func (r *RedisStorage) GetAllKeys() ([]uint32, error) {
-	keys, err := r.client.Keys(context.Background(), "node:*").Result()
+func (r *RedisStorage) GetAllKeys(ctx context.Context) ([]uint32, error) {
+	keys, err := r.client.Keys(ctx, r.key("node:*")).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all keys: %w", err)
 	}
 	var result []uint32
 	for _, key := range keys {
-		id, err := strconv.ParseUint(strings.TrimPrefix(key, "node:"), 10, 32)
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, r.key("node:")), 10, 32)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse key %s: %w", key, err)
 		}
@@ -87,19 +280,17 @@ func (r *RedisStorage) GetAllKeys() ([]uint32, error) {
 	return result, nil
 }
 
-func (r *RedisStorage) SaveCache(cache *NodeCache) error {
-	ctx := context.Background()
+func (r *RedisStorage) SaveCache(ctx context.Context, cache *NodeCache) error {
 	data, err := cache.MarshalJSON()
 	if err != nil {
 		return fmt.Errorf("failed to marshal cache: %w", err)
 	}
-	return r.client.Set(ctx, fmt.Sprintf("cache:%d", cache.nodeID), data, 0).Err()
+	return r.client.Set(ctx, r.key("cache:%d", cache.nodeID), data, 0).Err()
 }
 
-func (r *RedisStorage) ToBeCached() ([]uint32, error) {
-	ctx := context.Background()
+func (r *RedisStorage) ToBeCached(ctx context.Context) ([]uint32, error) {
 	// Use SMEMBERS to get all members of the set
-	data, err := r.client.SMembers(ctx, "to_be_cached").Result()
+	data, err := r.client.SMembers(ctx, r.key("to_be_cached")).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get to_be_cached data: %w", err)
 	}
@@ -116,27 +307,24 @@ func (r *RedisStorage) ToBeCached() ([]uint32, error) {
 	return result, nil
 }
 
-func (r *RedisStorage) AddNodeToCachedStack(nodeID uint32) error {
-	ctx := context.Background()
-	err := r.client.SAdd(ctx, "to_be_cached", nodeID).Err()
+func (r *RedisStorage) AddNodeToCachedStack(ctx context.Context, nodeID uint32) error {
+	err := r.client.SAdd(ctx, r.key("to_be_cached"), nodeID).Err()
 	if err != nil {
 		return fmt.Errorf("failed to add node %d to cached stack: %w", nodeID, err)
 	}
 	return nil
 }
 
-func (r *RedisStorage) ClearCacheStack() error {
-	ctx := context.Background()
-	err := r.client.Del(ctx, "to_be_cached").Err()
+func (r *RedisStorage) ClearCacheStack(ctx context.Context) error {
+	err := r.client.Del(ctx, r.key("to_be_cached")).Err()
 	if err != nil {
 		return fmt.Errorf("failed to clear cache stack: %w", err)
 	}
 	return nil
 }
 
-func (r *RedisStorage) GetCache(nodeID uint32) (*NodeCache, error) {
-	ctx := context.Background()
-	data, err := r.client.Get(ctx, fmt.Sprintf("cache:%d", nodeID)).Result()
+func (r *RedisStorage) GetCache(ctx context.Context, nodeID uint32) (*NodeCache, error) {
+	data, err := r.client.Get(ctx, r.key("cache:%d", nodeID)).Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cache for node %d: %w", nodeID, err)
 	}
@@ -147,13 +335,12 @@ func (r *RedisStorage) GetCache(nodeID uint32) (*NodeCache, error) {
 	return &cache, nil
 }
 
-func (r *RedisStorage) GetNodes(ids []uint32) (map[uint32]*Node, error) {
-	ctx := context.Background()
+func (r *RedisStorage) GetNodes(ctx context.Context, ids []uint32) (map[uint32]*Node, error) {
 	pipe := r.client.Pipeline()
 
 	cmds := make([]*redis.StringCmd, len(ids))
 	for i, id := range ids {
-		cmds[i] = pipe.Get(ctx, fmt.Sprintf("node:%d", id))
+		cmds[i] = pipe.Get(ctx, r.key("node:%d", id))
 	}
 
 	_, err := pipe.Exec(ctx)
@@ -180,8 +367,7 @@ func (r *RedisStorage) GetNodes(ids []uint32) (map[uint32]*Node, error) {
 	return nodes, nil
 }
 
-func (r *RedisStorage) SaveCaches(caches []*NodeCache) error {
-	ctx := context.Background()
+func (r *RedisStorage) SaveCaches(ctx context.Context, caches []*NodeCache) error {
 	pipe := r.client.Pipeline()
 
 	for _, cache := range caches {
@@ -189,7 +375,7 @@ func (r *RedisStorage) SaveCaches(caches []*NodeCache) error {
 		if err != nil {
 			return fmt.Errorf("failed to marshal cache: %w", err)
 		}
-		pipe.Set(ctx, fmt.Sprintf("cache:%d", cache.nodeID), data, 0)
+		pipe.Set(ctx, r.key("cache:%d", cache.nodeID), data, 0)
 	}
 
 	_, err := pipe.Exec(ctx)
@@ -198,3 +384,466 @@ func (r *RedisStorage) SaveCaches(caches []*NodeCache) error {
 	}
 	return nil
 }
+
+func (r *RedisStorage) SaveJob(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, r.key("job:%s", job.ID), data, 0)
+	pipe.SAdd(ctx, r.key("jobs"), job.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetJob(ctx context.Context, id string) (*Job, error) {
+	pipe := r.client.Pipeline()
+	get := pipe.Get(ctx, r.key("job:%s", id))
+	canceled := pipe.SIsMember(ctx, r.key("canceled_jobs"), id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get job %s: %w", id, err)
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(get.Val()), &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job data: %w", err)
+	}
+	job.CancelRequested = canceled.Val()
+	return &job, nil
+}
+
+func (r *RedisStorage) GetJobs(ctx context.Context) ([]*Job, error) {
+	ids, err := r.client.SMembers(ctx, r.key("jobs")).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job IDs: %w", err)
+	}
+	canceled, err := r.client.SMembersMap(ctx, r.key("canceled_jobs")).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canceled job IDs: %w", err)
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.Get(ctx, r.key("job:%s", id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get jobs: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(ids))
+	for i, cmd := range cmds {
+		data, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get job %s: %w", ids[i], err)
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job data: %w", err)
+		}
+		_, job.CancelRequested = canceled[ids[i]]
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (r *RedisStorage) RequestJobCancel(ctx context.Context, id string) error {
+	if err := r.client.SAdd(ctx, r.key("canceled_jobs"), id).Err(); err != nil {
+		return fmt.Errorf("failed to request cancellation of job %s: %w", id, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) AddProvenance(ctx context.Context, document uint32, nodes []uint32, edges []Edge) error {
+	pipe := r.client.TxPipeline()
+	for _, id := range nodes {
+		pipe.SAdd(ctx, r.key("provenance:node:%d", id), document)
+		pipe.SAdd(ctx, r.key("document:%d:nodes", document), id)
+	}
+	for _, edge := range edges {
+		pipe.SAdd(ctx, r.key("provenance:edge:%s", edge), document)
+		pipe.SAdd(ctx, r.key("document:%d:edges", document), edge.String())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save provenance of document %d: %w", document, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) RemoveProvenance(ctx context.Context, document uint32, nodes []uint32, edges []Edge) error {
+	pipe := r.client.TxPipeline()
+	for _, id := range nodes {
+		pipe.SRem(ctx, r.key("provenance:node:%d", id), document)
+		pipe.SRem(ctx, r.key("document:%d:nodes", document), id)
+	}
+	for _, edge := range edges {
+		pipe.SRem(ctx, r.key("provenance:edge:%s", edge), document)
+		pipe.SRem(ctx, r.key("document:%d:edges", document), edge.String())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to remove provenance of document %d: %w", document, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetNodeProvenance(ctx context.Context, id uint32) (*roaring.Bitmap, error) {
+	return r.getIDSet(ctx, r.key("provenance:node:%d", id))
+}
+
+func (r *RedisStorage) GetEdgeProvenance(ctx context.Context, edge Edge) (*roaring.Bitmap, error) {
+	return r.getIDSet(ctx, r.key("provenance:edge:%s", edge))
+}
+
+func (r *RedisStorage) SetEdgeTypes(ctx context.Context, types map[Edge]EdgeType) error {
+	if len(types) == 0 {
+		return nil
+	}
+	values := make(map[string]any, len(types))
+	for edge, edgeType := range types {
+		data, err := json.Marshal(edgeType)
+		if err != nil {
+			return fmt.Errorf("failed to marshal type of edge %s: %w", edge, err)
+		}
+		values[edge.String()] = data
+	}
+	if err := r.client.HSet(ctx, r.key("edge_types"), values).Err(); err != nil {
+		return fmt.Errorf("failed to save edge types: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetEdgeTypes(ctx context.Context, edges []Edge) (map[Edge]EdgeType, error) {
+	types := map[Edge]EdgeType{}
+	if len(edges) == 0 {
+		return types, nil
+	}
+	fields := make([]string, len(edges))
+	for i, edge := range edges {
+		fields[i] = edge.String()
+	}
+	values, err := r.client.HMGet(ctx, r.key("edge_types"), fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get edge types: %w", err)
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var edgeType EdgeType
+		if err := json.Unmarshal([]byte(data), &edgeType); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal type of edge %s: %w", edges[i], err)
+		}
+		types[edges[i]] = edgeType
+	}
+	return types, nil
+}
+
+func (r *RedisStorage) GetDocumentNodes(ctx context.Context, document uint32) (*roaring.Bitmap, error) {
+	return r.getIDSet(ctx, r.key("document:%d:nodes", document))
+}
+
+func (r *RedisStorage) GetDocumentEdges(ctx context.Context, document uint32) ([]Edge, error) {
+	members, err := r.client.SMembers(ctx, r.key("document:%d:edges", document)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get edges of document %d: %w", document, err)
+	}
+	edges := make([]Edge, 0, len(members))
+	for _, member := range members {
+		edge, err := ParseEdge(member)
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+func (r *RedisStorage) AddToIndex(ctx context.Context, index, value string, ids []uint32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	if err := r.client.SAdd(ctx, r.key("index:%s:%s", index, value), members...).Err(); err != nil {
+		return fmt.Errorf("failed to add to %s index: %w", index, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetIndex(ctx context.Context, index, value string) (*roaring.Bitmap, error) {
+	return r.getIDSet(ctx, r.key("index:%s:%s", index, value))
+}
+
+func (r *RedisStorage) SetVEXStatement(ctx context.Context, edge Edge, statement *VEXStatement) error {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal VEX statement: %w", err)
+	}
+	if err := r.client.HSet(ctx, r.key("vex:edge:%s", edge), strconv.FormatUint(uint64(statement.Product), 10), data).Err(); err != nil {
+		return fmt.Errorf("failed to save VEX statement on edge %s: %w", edge, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetVEXStatements(ctx context.Context, edge Edge) ([]*VEXStatement, error) {
+	values, err := r.client.HVals(ctx, r.key("vex:edge:%s", edge)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VEX statements on edge %s: %w", edge, err)
+	}
+	statements := make([]*VEXStatement, 0, len(values))
+	for _, value := range values {
+		var statement VEXStatement
+		if err := json.Unmarshal([]byte(value), &statement); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal VEX statement: %w", err)
+		}
+		statements = append(statements, &statement)
+	}
+	return statements, nil
+}
+
+// baselineScript records the baseline children of a node, unless the node already has a history.
+// KEYS[1] is the node's history, ARGV[1] the baseline version and ARGV[2] the children.
+var baselineScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+end
+return 0
+`)
+
+func (r *RedisStorage) AddGraphVersion(ctx context.Context, version *GraphVersion, baseline, children map[uint32]*roaring.Bitmap) error {
+	number, err := r.client.Incr(ctx, r.key("graph_version_counter")).Result()
+	if err != nil {
+		return fmt.Errorf("failed to generate graph version: %w", err)
+	}
+	version.Version = uint32(number)
+	data, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("failed to marshal graph version: %w", err)
+	}
+
+	field := strconv.FormatUint(uint64(version.Version), 10)
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, r.key("graph_versions"), field, data)
+	// Baselines go first, so that they are only recorded for nodes this version is the first to record
+	for id, bitmap := range baseline {
+		bitmapData, err := bitmap.ToBytes()
+		if err != nil {
+			return fmt.Errorf("failed to marshal baseline children of node %d: %w", id, err)
+		}
+		baselineScript.Eval(ctx, pipe, []string{r.key("history:node:%d", id)}, BaselineGraphVersion, bitmapData)
+	}
+	for id, bitmap := range children {
+		bitmapData, err := bitmap.ToBytes()
+		if err != nil {
+			return fmt.Errorf("failed to marshal children of node %d: %w", id, err)
+		}
+		pipe.HSet(ctx, r.key("history:node:%d", id), field, bitmapData)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save graph version %d: %w", version.Version, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetGraphVersions(ctx context.Context) ([]*GraphVersion, error) {
+	values, err := r.client.HVals(ctx, r.key("graph_versions")).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph versions: %w", err)
+	}
+	versions := make([]*GraphVersion, 0, len(values))
+	for _, value := range values {
+		var version GraphVersion
+		if err := json.Unmarshal([]byte(value), &version); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal graph version: %w", err)
+		}
+		versions = append(versions, &version)
+	}
+	slices.SortFunc(versions, func(a, b *GraphVersion) int { return cmp.Compare(a.Version, b.Version) })
+	return versions, nil
+}
+
+func (r *RedisStorage) GetNodeHistories(ctx context.Context, ids []uint32) (map[uint32]map[uint32]*roaring.Bitmap, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, r.key("history:node:%d", id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get node histories: %w", err)
+	}
+
+	histories := make(map[uint32]map[uint32]*roaring.Bitmap, len(ids))
+	for i, cmd := range cmds {
+		values, err := cmd.Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get history of node %d: %w", ids[i], err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		history := make(map[uint32]*roaring.Bitmap, len(values))
+		for field, value := range values {
+			version, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse version %s of node %d: %w", field, ids[i], err)
+			}
+			bitmap := roaring.New()
+			if _, err := bitmap.FromBuffer([]byte(value)); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal children of node %d: %w", ids[i], err)
+			}
+			history[uint32(version)] = bitmap
+		}
+		histories[ids[i]] = history
+	}
+	return histories, nil
+}
+
+func (r *RedisStorage) UseNamespace(name string) error {
+	if err := ValidateNamespace(name); err != nil {
+		return err
+	}
+	r.namespace = name
+	return nil
+}
+
+func (r *RedisStorage) InNamespace(name string) (Storage, error) {
+	if err := ValidateNamespace(name); err != nil {
+		return nil, err
+	}
+	return &RedisStorage{client: r.client, namespace: name}, nil
+}
+
+func (r *RedisStorage) Namespaces(ctx context.Context) ([]string, error) {
+	members, err := r.client.SMembers(ctx, namespacesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespaces: %w", err)
+	}
+	names := append([]string{DefaultNamespace}, members...)
+	slices.Sort(names)
+	return names, nil
+}
+
+func (r *RedisStorage) CreateNamespace(ctx context.Context, name string) error {
+	if err := ValidateNamespace(name); err != nil {
+		return err
+	}
+	if name == DefaultNamespace {
+		return fmt.Errorf("failed to create namespace %s: %w", name, ErrNamespaceExists)
+	}
+	added, err := r.client.SAdd(ctx, namespacesKey, name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to create namespace %s: %w", name, err)
+	}
+	if added == 0 {
+		return fmt.Errorf("failed to create namespace %s: %w", name, ErrNamespaceExists)
+	}
+	return nil
+}
+
+// CopyNamespace copies the keys of a namespace one at a time with DUMP and RESTORE, without blocking writes to it.
+func (r *RedisStorage) CopyNamespace(ctx context.Context, from, to string) error {
+	if from != DefaultNamespace {
+		exists, err := r.client.SIsMember(ctx, namespacesKey, from).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get namespace %s: %w", from, err)
+		}
+		if !exists {
+			return fmt.Errorf("failed to copy namespace %s: %w", from, ErrNamespaceNotFound)
+		}
+	}
+	// Creating the namespace first keeps two copies to the same namespace from mixing their keys
+	if err := r.CreateNamespace(ctx, to); err != nil {
+		return err
+	}
+	if err := r.deleteNamespaceKeys(ctx, to); err != nil {
+		return err
+	}
+
+	keys, err := r.namespaceKeys(ctx, from)
+	if err != nil {
+		return err
+	}
+	fromPrefix, toPrefix := namespacePrefix(from), namespacePrefix(to)
+	for _, key := range keys {
+		data, err := r.client.Dump(ctx, key).Result()
+		if err == redis.Nil {
+			continue // The key was deleted since it was listed
+		} else if err != nil {
+			return fmt.Errorf("failed to dump %s: %w", key, err)
+		}
+		if err := r.client.RestoreReplace(ctx, toPrefix+strings.TrimPrefix(key, fromPrefix), 0, data).Err(); err != nil {
+			return fmt.Errorf("failed to copy %s to namespace %s: %w", key, to, err)
+		}
+	}
+	return nil
+}
+
+func (r *RedisStorage) DropNamespace(ctx context.Context, name string) error {
+	if name == DefaultNamespace {
+		return fmt.Errorf("the %s namespace can't be dropped", DefaultNamespace)
+	}
+	removed, err := r.client.SRem(ctx, namespacesKey, name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to drop namespace %s: %w", name, err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("failed to drop namespace %s: %w", name, ErrNamespaceNotFound)
+	}
+	return r.deleteNamespaceKeys(ctx, name)
+}
+
+// namespaceKeys lists the keys of a namespace.
+func (r *RedisStorage) namespaceKeys(ctx context.Context, namespace string) ([]string, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, namespacePrefix(namespace)+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		// The keys of the default namespace have no prefix, so the keys of the others have to be left out
+		if namespacePrefix(namespace) == "" && (strings.HasPrefix(key, "namespace:") || key == namespacesKey) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list keys of namespace %s: %w", namespace, err)
+	}
+	return keys, nil
+}
+
+// deleteNamespaceKeys deletes every key of a namespace.
+func (r *RedisStorage) deleteNamespaceKeys(ctx context.Context, namespace string) error {
+	keys, err := r.namespaceKeys(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += 1000 {
+		if err := r.client.Del(ctx, keys[start:min(start+1000, len(keys))]...).Err(); err != nil {
+			return fmt.Errorf("failed to delete keys of namespace %s: %w", namespace, err)
+		}
+	}
+	return nil
+}
+
+// getIDSet reads a set of node IDs into a bitmap.
+func (r *RedisStorage) getIDSet(ctx context.Context, key string) (*roaring.Bitmap, error) {
+	members, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	bitmap := roaring.New()
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse member %s of %s: %w", member, key, err)
+		}
+		bitmap.Add(uint32(id))
+	}
+	return bitmap, nil
+}
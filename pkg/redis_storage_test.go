@@ -2,7 +2,10 @@ package pkg
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/RoaringBitmap/roaring"
 	"github.com/go-redis/redis/v8"
@@ -18,83 +21,319 @@ func setupTestRedis() *RedisStorage {
 }
 
 func TestGenerateID(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
-	id, err := r.GenerateID()
+	id, err := r.GenerateID(ctx)
 	assert.NoError(t, err)
 	assert.NotEqual(t, 0, id)
 }
 
 func TestSaveNode(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
 	node := &Node{ID: 1, Name: "test_node", Children: roaring.New(), Parents: roaring.New()}
-	err := r.SaveNode(node)
+	err := r.SaveNode(ctx, node)
 	assert.NoError(t, err)
 
 	// Verify node data is saved
-	savedNode, err := r.GetNode(node.ID)
+	savedNode, err := r.GetNode(ctx, node.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, node.ID, savedNode.ID)
 	assert.Equal(t, node.Name, savedNode.Name)
+
+	// A name can't be moved to another node
+	err = r.SaveNode(ctx, &Node{ID: 2, Name: "test_node", Children: roaring.New(), Parents: roaring.New()})
+	assert.ErrorIs(t, err, ErrNodeAlreadyExists)
+	next, err := r.GenerateID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), next)
 }
 
 func TestNameToID(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
 	node := &Node{ID: 1, Name: "test_node", Children: roaring.New(), Parents: roaring.New()}
-	err := r.SaveNode(node)
+	err := r.SaveNode(ctx, node)
 	assert.NoError(t, err)
 
-	id, err := r.NameToID(node.Name)
+	id, err := r.NameToID(ctx, node.Name)
 	assert.NoError(t, err)
 	assert.Equal(t, node.ID, id)
 }
 
+func TestCreateNode(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+
+	var wg sync.WaitGroup
+	ids := make([]uint32, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node := &Node{Name: "test_node", Metadata: map[string]any{"index": i}, Children: roaring.New(), Parents: roaring.New()}
+			id, err := r.CreateNode(ctx, node)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrNodeAlreadyExists)
+			}
+			ids[i] = id
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		assert.Equal(t, uint32(1), id, "Expected every creation to resolve to the same node")
+	}
+	savedNode, err := r.GetNode(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), savedNode.ID)
+	assert.Equal(t, "test_node", savedNode.Name)
+}
+
+func TestCreateNodeEncoding(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	node := &Node{Name: `pkg:generic/odd@1.0.0?x=0}`, Metadata: map[string]any{"note": `ends with "0}`}, Children: roaring.New(), Parents: roaring.New()}
+	id, err := r.CreateNode(ctx, node)
+	assert.NoError(t, err)
+
+	savedNode, err := r.GetNode(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, id, savedNode.ID)
+	assert.Equal(t, node.Name, savedNode.Name)
+	assert.Equal(t, node.Metadata, savedNode.Metadata)
+	next, err := r.GenerateID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, id+1, next)
+}
+
+func TestAddDependency(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	parent := &Node{Name: "parent", Children: roaring.New(), Parents: roaring.New()}
+	_, err := r.CreateNode(ctx, parent)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		child := &Node{Name: fmt.Sprint("child", i), Children: roaring.New(), Parents: roaring.New()}
+		_, err := r.CreateNode(ctx, child)
+		assert.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.AddDependency(ctx, parent.ID, child.ID))
+		}()
+	}
+	wg.Wait()
+
+	savedParent, err := r.GetNode(ctx, parent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), savedParent.Children.GetCardinality())
+}
+
+func TestSaveNodeMetadata(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	parent := &Node{Name: "parent", Metadata: "old", Children: roaring.New(), Parents: roaring.New()}
+	_, err := r.CreateNode(ctx, parent)
+	assert.NoError(t, err)
+	child := &Node{Name: "child", Children: roaring.New(), Parents: roaring.New()}
+	_, err = r.CreateNode(ctx, child)
+	assert.NoError(t, err)
+	assert.NoError(t, r.AddDependency(ctx, parent.ID, child.ID))
+
+	assert.NoError(t, r.SaveNodeMetadata(ctx, parent.ID, "new"))
+	savedParent, err := r.GetNode(ctx, parent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", savedParent.Metadata)
+	assert.Equal(t, []uint32{child.ID}, savedParent.Children.ToArray())
+}
+
 func TestGetAllKeys(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
 	node1 := &Node{ID: 1, Name: "node1", Children: roaring.New(), Parents: roaring.New()}
 	node2 := &Node{ID: 1, Name: "node2", Children: roaring.New(), Parents: roaring.New()}
-	err := r.SaveNode(node1)
+	err := r.SaveNode(ctx, node1)
 	assert.NoError(t, err)
-	err = r.SaveNode(node2)
+	err = r.SaveNode(ctx, node2)
 	assert.NoError(t, err)
 
-	keys, err := r.GetAllKeys()
+	keys, err := r.GetAllKeys(ctx)
 	assert.NoError(t, err)
 	assert.Contains(t, keys, node1.ID)
 	assert.Contains(t, keys, node2.ID)
 }
 
 func TestSaveCache(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
 	cache := &NodeCache{nodeID: 1, allParents: roaring.New(), allChildren: roaring.New()}
-	err := r.SaveCache(cache)
+	err := r.SaveCache(ctx, cache)
 	assert.NoError(t, err)
 
-	savedCache, err := r.GetCache(cache.nodeID)
+	savedCache, err := r.GetCache(ctx, cache.nodeID)
 	assert.NoError(t, err)
 	assert.Equal(t, cache.nodeID, savedCache.nodeID)
 }
 
 func TestToBeCached(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
 	nodeID := uint32(1)
-	err := r.AddNodeToCachedStack(nodeID)
+	err := r.AddNodeToCachedStack(ctx, nodeID)
 	assert.NoError(t, err)
 
-	toBeCached, err := r.ToBeCached()
+	toBeCached, err := r.ToBeCached(ctx)
 	assert.NoError(t, err)
 	assert.Contains(t, toBeCached, nodeID)
 }
 
 func TestClearCacheStack(t *testing.T) {
+	ctx := context.Background()
 	r := setupTestRedis()
 	nodeID := uint32(1)
-	err := r.AddNodeToCachedStack(nodeID)
+	err := r.AddNodeToCachedStack(ctx, nodeID)
 	assert.NoError(t, err)
 
-	err = r.ClearCacheStack()
+	err = r.ClearCacheStack(ctx)
 	assert.NoError(t, err)
 
-	toBeCached, err := r.ToBeCached()
+	toBeCached, err := r.ToBeCached(ctx)
 	assert.NoError(t, err)
 	assert.NotContains(t, toBeCached, nodeID)
 }
+
+func TestSaveJob(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	job := &Job{ID: "job1", Type: CacheJob, Status: JobPending, Logs: []string{"started"}}
+	err := r.SaveJob(ctx, job)
+	assert.NoError(t, err)
+
+	savedJob, err := r.GetJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, job.Type, savedJob.Type)
+	assert.Equal(t, job.Logs, savedJob.Logs)
+	assert.False(t, savedJob.CancelRequested)
+
+	assert.NoError(t, r.RequestJobCancel(ctx, job.ID))
+	assert.NoError(t, r.SaveJob(ctx, job))
+
+	jobs, err := r.GetJobs(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.True(t, jobs[0].CancelRequested)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	err := r.AddToIndex(ctx, LicenseIndex, "mit", []uint32{1, 2})
+	assert.NoError(t, err)
+
+	ids, err := r.GetIndex(ctx, LicenseIndex, "mit")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1, 2}, ids.ToArray())
+
+	ids, err = r.GetIndex(ctx, LicenseIndex, "apache-2.0")
+	assert.NoError(t, err)
+	assert.True(t, ids.IsEmpty())
+}
+
+func TestVEXStatements(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	edge := Edge{From: 1, To: 2}
+	assert.NoError(t, r.SetVEXStatement(ctx, edge, &VEXStatement{Status: VEXAffected}))
+	assert.NoError(t, r.SetVEXStatement(ctx, edge, &VEXStatement{Product: 3, Status: VEXAffected}))
+	assert.NoError(t, r.SetVEXStatement(ctx, edge, &VEXStatement{Product: 3, Status: VEXNotAffected, Justification: "component_not_present"}))
+
+	statements, err := r.GetVEXStatements(ctx, edge)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []*VEXStatement{
+		{Status: VEXAffected},
+		{Product: 3, Status: VEXNotAffected, Justification: "component_not_present"},
+	}, statements)
+
+	statements, err = r.GetVEXStatements(ctx, Edge{From: 2, To: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, statements)
+}
+
+func TestEdgeTypes(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	edge := Edge{From: 1, To: 2}
+	assert.NoError(t, r.SetEdgeTypes(ctx, map[Edge]EdgeType{edge: {Type: "devDependency", Reversed: true}}))
+
+	types, err := r.GetEdgeTypes(ctx, []Edge{edge, {From: 2, To: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[Edge]EdgeType{edge: {Type: "devDependency", Reversed: true}}, types)
+}
+
+func TestGraphVersions(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	first := &GraphVersion{Created: time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC), Source: VersionSourceSBOM, Documents: []string{"document:a"}}
+	assert.NoError(t, r.AddGraphVersion(ctx, first, map[uint32]*roaring.Bitmap{1: roaring.BitmapOf(3)}, map[uint32]*roaring.Bitmap{1: roaring.BitmapOf(2, 3), 2: roaring.New()}))
+	second := &GraphVersion{Created: first.Created.Add(time.Hour), Source: VersionSourceVulnerabilities}
+	// Node 1 already has a history, so its baseline is kept
+	assert.NoError(t, r.AddGraphVersion(ctx, second, map[uint32]*roaring.Bitmap{1: roaring.New()}, map[uint32]*roaring.Bitmap{1: roaring.BitmapOf(2)}))
+	assert.Equal(t, uint32(1), first.Version)
+	assert.Equal(t, uint32(2), second.Version)
+
+	versions, err := r.GetGraphVersions(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*GraphVersion{first, second}, versions)
+
+	histories, err := r.GetNodeHistories(ctx, []uint32{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Len(t, histories, 2)
+	assert.Equal(t, []uint32{3}, histories[1][BaselineGraphVersion].ToArray())
+	assert.Equal(t, []uint32{2, 3}, histories[1][1].ToArray())
+	assert.Equal(t, []uint32{2}, histories[1][2].ToArray())
+	assert.True(t, histories[2][1].IsEmpty())
+}
+
+func TestRedisNamespaces(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRedis()
+	node := &Node{Name: "pkg:generic/app@1.0.0", Type: "PACKAGE", Children: roaring.New(), Parents: roaring.New()}
+	_, err := r.CreateNode(ctx, node)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.CreateNamespace(ctx, "team-b"))
+	assert.ErrorIs(t, r.CreateNamespace(ctx, "team-b"), ErrNamespaceExists)
+	assert.NoError(t, r.CopyNamespace(ctx, DefaultNamespace, "team-a"))
+	namespaces, err := r.Namespaces(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DefaultNamespace, "team-a", "team-b"}, namespaces)
+
+	teamA, err := r.InNamespace("team-a")
+	assert.NoError(t, err)
+	id, err := teamA.NameToID(ctx, node.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, node.ID, id)
+
+	teamB, err := r.InNamespace("team-b")
+	assert.NoError(t, err)
+	other := &Node{Name: "pkg:generic/other@1.0.0", Type: "PACKAGE", Children: roaring.New(), Parents: roaring.New()}
+	id, err = teamB.CreateNode(ctx, other)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), id)
+	keys, err := r.GetAllKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{node.ID}, keys)
+
+	assert.NoError(t, r.DropNamespace(ctx, "team-b"))
+	assert.ErrorIs(t, r.DropNamespace(ctx, "team-b"), ErrNamespaceNotFound)
+	keys, err = teamB.GetAllKeys(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+	keys, err = r.GetAllKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{node.ID}, keys)
+}
@@ -0,0 +1,294 @@
+package render
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+const (
+	nodeWidth  = 180.0
+	nodeHeight = 36.0
+	// layerGap and columnGap separate the layers and the nodes of a layer in layered layouts.
+	layerGap  = 70.0
+	columnGap = 30.0
+	margin    = 20.0
+	// forceIterations is how many times the force-directed layout moves the nodes.
+	forceIterations = 300
+	// sweeps is how many times the layered layout reorders the layers to reduce crossings.
+	sweeps = 8
+)
+
+type point struct {
+	x, y float64
+}
+
+// acyclic returns whether the diagram's edges have no cycles.
+func (d *diagram) acyclic() bool {
+	_, ok := d.topologicalOrder()
+	return ok
+}
+
+// topologicalOrder orders the nodes so that every node comes after its parents, if there are no cycles.
+func (d *diagram) topologicalOrder() ([]int, bool) {
+	indegree := make([]int, len(d.nodes))
+	for _, edge := range d.edges {
+		indegree[edge.to]++
+	}
+	var queue, order []int
+	for i := range d.nodes {
+		if indegree[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		order = append(order, current)
+		for _, child := range d.children[current] {
+			indegree[child]--
+			if indegree[child] == 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+	return order, len(order) == len(d.nodes)
+}
+
+// layoutLayered lays out an acyclic diagram in layers, with every edge pointing down, in the Sugiyama style:
+// nodes are assigned to layers by their longest path from a root, edges spanning several layers are routed through
+// dummy nodes, and the layers are reordered by the barycenters of their neighbors to reduce crossings.
+func (d *diagram) layoutLayered() {
+	order, _ := d.topologicalOrder()
+	layer := make([]int, len(d.nodes))
+	for _, current := range order {
+		for _, child := range d.children[current] {
+			layer[child] = max(layer[child], layer[current]+1)
+		}
+	}
+
+	// Every edge is split into segments between adjacent layers, through dummy vertices
+	type vertex struct {
+		node  int // the index of the node, or -1 for dummies
+		layer int
+	}
+	var vertices []vertex
+	for i := range d.nodes {
+		vertices = append(vertices, vertex{node: i, layer: layer[i]})
+	}
+	up := make([][]int, len(vertices))
+	down := make([][]int, len(vertices))
+	routes := make([][]int, len(d.edges))
+	for e, edge := range d.edges {
+		previous := edge.from
+		route := []int{previous}
+		for l := layer[edge.from] + 1; l < layer[edge.to]; l++ {
+			vertices = append(vertices, vertex{node: -1, layer: l})
+			up, down = append(up, nil), append(down, nil)
+			dummy := len(vertices) - 1
+			down[previous] = append(down[previous], dummy)
+			up[dummy] = append(up[dummy], previous)
+			route = append(route, dummy)
+			previous = dummy
+		}
+		down[previous] = append(down[previous], edge.to)
+		up[edge.to] = append(up[edge.to], previous)
+		routes[e] = append(route, edge.to)
+	}
+
+	depth := slices.Max(layer) + 1
+	layers := make([][]int, depth)
+	for v, vertex := range vertices {
+		layers[vertex.layer] = append(layers[vertex.layer], v)
+	}
+	position := make([]float64, len(vertices))
+	reindex := func(l int) {
+		for i, v := range layers[l] {
+			position[v] = float64(i)
+		}
+	}
+	for l := range layers {
+		reindex(l)
+	}
+	reorder := func(l int, neighbors [][]int) {
+		barycenter := map[int]float64{}
+		for _, v := range layers[l] {
+			barycenter[v] = position[v]
+			if len(neighbors[v]) > 0 {
+				sum := 0.0
+				for _, neighbor := range neighbors[v] {
+					sum += position[neighbor]
+				}
+				barycenter[v] = sum / float64(len(neighbors[v]))
+			}
+		}
+		sort.SliceStable(layers[l], func(i, j int) bool {
+			return barycenter[layers[l][i]] < barycenter[layers[l][j]]
+		})
+		reindex(l)
+	}
+	for range sweeps {
+		for l := 1; l < depth; l++ {
+			reorder(l, up)
+		}
+		for l := depth - 2; l >= 0; l-- {
+			reorder(l, down)
+		}
+	}
+
+	// Layers are centered on the widest one
+	widest := 0
+	for _, vertices := range layers {
+		widest = max(widest, len(vertices))
+	}
+	center := make([]point, len(vertices))
+	for l, vertices := range layers {
+		offset := float64(widest-len(vertices)) * (nodeWidth + columnGap) / 2
+		for i, v := range vertices {
+			center[v] = point{
+				x: margin + offset + float64(i)*(nodeWidth+columnGap) + nodeWidth/2,
+				y: margin + float64(l)*(nodeHeight+layerGap) + nodeHeight/2,
+			}
+		}
+	}
+	for i := range d.nodes {
+		d.nodes[i].center = center[i]
+	}
+	for e, route := range routes {
+		var points []point
+		for i, v := range route {
+			p := center[v]
+			switch i {
+			case 0:
+				p.y += nodeHeight / 2
+			case len(route) - 1:
+				p.y -= nodeHeight / 2
+			}
+			points = append(points, p)
+		}
+		d.edges[e].points = points
+	}
+	d.width = 2*margin + float64(widest)*(nodeWidth+columnGap) - columnGap
+	d.height = 2*margin + float64(depth)*(nodeHeight+layerGap) - layerGap
+}
+
+// layoutForce lays out a diagram with the Fruchterman-Reingold force-directed algorithm: nodes repel each other
+// and edges pull the nodes they connect together. The nodes start on a circle, so the layout is deterministic.
+func (d *diagram) layoutForce() {
+	n := len(d.nodes)
+	// k is the ideal distance between nodes, large enough to fit their boxes
+	k := nodeWidth + columnGap
+	radius := k * math.Sqrt(float64(n))
+	positions := make([]point, n)
+	for i := range positions {
+		angle := 2 * math.Pi * float64(i) / float64(n)
+		positions[i] = point{x: radius * math.Cos(angle), y: radius * math.Sin(angle)}
+	}
+
+	temperature := radius / 2
+	for iteration := range forceIterations {
+		displacement := make([]point, n)
+		for i := range n {
+			for j := i + 1; j < n; j++ {
+				dx, dy := positions[i].x-positions[j].x, positions[i].y-positions[j].y
+				distance := math.Max(math.Hypot(dx, dy), 0.01)
+				force := k * k / distance
+				displacement[i].x += dx / distance * force
+				displacement[i].y += dy / distance * force
+				displacement[j].x -= dx / distance * force
+				displacement[j].y -= dy / distance * force
+			}
+		}
+		for _, edge := range d.edges {
+			dx, dy := positions[edge.from].x-positions[edge.to].x, positions[edge.from].y-positions[edge.to].y
+			distance := math.Max(math.Hypot(dx, dy), 0.01)
+			force := distance * distance / k
+			displacement[edge.from].x -= dx / distance * force
+			displacement[edge.from].y -= dy / distance * force
+			displacement[edge.to].x += dx / distance * force
+			displacement[edge.to].y += dy / distance * force
+		}
+		for i := range positions {
+			length := math.Max(math.Hypot(displacement[i].x, displacement[i].y), 0.01)
+			step := math.Min(length, temperature)
+			positions[i].x += displacement[i].x / length * step
+			positions[i].y += displacement[i].y / length * step
+		}
+		temperature = radius / 2 * (1 - float64(iteration+1)/forceIterations)
+	}
+
+	removeOverlaps(positions)
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range positions {
+		minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+		maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+	}
+	for i := range d.nodes {
+		d.nodes[i].center = point{
+			x: positions[i].x - minX + margin + nodeWidth/2,
+			y: positions[i].y - minY + margin + nodeHeight/2,
+		}
+	}
+	for e, edge := range d.edges {
+		from, to := d.nodes[edge.from].center, d.nodes[edge.to].center
+		d.edges[e].points = []point{boxBoundary(from, to), boxBoundary(to, from)}
+	}
+	d.width = maxX - minX + 2*margin + nodeWidth
+	d.height = maxY - minY + 2*margin + nodeHeight
+}
+
+// removeOverlaps moves apart the boxes of nodes that overlap, along the axis they overlap least on.
+func removeOverlaps(positions []point) {
+	const gap = 10.0
+	for range forceIterations {
+		moved := false
+		for i := range positions {
+			for j := i + 1; j < len(positions); j++ {
+				dx, dy := positions[j].x-positions[i].x, positions[j].y-positions[i].y
+				overlapX := nodeWidth + gap - math.Abs(dx)
+				overlapY := nodeHeight + gap - math.Abs(dy)
+				if overlapX <= 0 || overlapY <= 0 {
+					continue
+				}
+				moved = true
+				if overlapX < overlapY {
+					shift := math.Copysign(overlapX/2, dx)
+					if dx == 0 {
+						shift = overlapX / 2
+					}
+					positions[i].x -= shift
+					positions[j].x += shift
+				} else {
+					shift := math.Copysign(overlapY/2, dy)
+					if dy == 0 {
+						shift = overlapY / 2
+					}
+					positions[i].y -= shift
+					positions[j].y += shift
+				}
+			}
+		}
+		if !moved {
+			return
+		}
+	}
+}
+
+// boxBoundary returns where the line from the center of a node's box towards another point leaves the box.
+func boxBoundary(center, towards point) point {
+	dx, dy := towards.x-center.x, towards.y-center.y
+	if dx == 0 && dy == 0 {
+		return center
+	}
+	t := math.Inf(1)
+	if dx != 0 {
+		t = math.Min(t, nodeWidth/2/math.Abs(dx))
+	}
+	if dy != 0 {
+		t = math.Min(t, nodeHeight/2/math.Abs(dy))
+	}
+	t = math.Min(t, 1)
+	return point{x: center.x + dx*t, y: center.y + dy*t}
+}
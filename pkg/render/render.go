@@ -0,0 +1,355 @@
+// Package render draws subgraphs as SVG diagrams without external tools.
+package render
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+)
+
+const (
+	// LayoutAuto lays out acyclic subgraphs in layers and others with forces.
+	LayoutAuto = "auto"
+	// LayoutLayered lays out subgraphs in layers, with every edge pointing down. It needs an acyclic subgraph.
+	LayoutLayered = "layered"
+	// LayoutForce lays out subgraphs with a force-directed algorithm.
+	LayoutForce = "force"
+)
+
+// DefaultMaxNodes is the number of nodes rendered unless another limit is given, as larger diagrams are unreadable.
+const DefaultMaxNodes = 200
+
+// maxLabelLength is the number of characters of a node's name that fit in its box.
+const maxLabelLength = 26
+
+// typeColors are the fill colors of the node types, other types get one of otherColors.
+var (
+	typeColors = map[string]string{
+		"PACKAGE":                 "#aec7e8",
+		"FILE":                    "#ffbb78",
+		pkg.DocumentNodeType:      "#c5b0d5",
+		pkg.VulnerabilityNodeType: "#ff9896",
+	}
+	otherColors = []string{"#98df8a", "#dbdb8d", "#9edae5", "#f7b6d2", "#c49c94", "#c7c7c7"}
+)
+
+const (
+	edgeColor        = "#999999"
+	highlightedColor = "#d62728"
+)
+
+// Options configure rendered diagrams.
+type Options struct {
+	// Layout is LayoutAuto, LayoutLayered or LayoutForce, LayoutAuto by default.
+	Layout string
+	// MaxDepth leaves out the nodes more than this many edges below the roots of the subgraph, unless it is 0.
+	MaxDepth int
+	// MaxNodes limits the number of nodes, keeping those closest to the roots of the subgraph. It is DefaultMaxNodes
+	// when 0 and unlimited when negative.
+	MaxNodes int
+}
+
+// Result describes a rendered diagram.
+type Result struct {
+	Layout string `json:"layout"`
+	Nodes  int    `json:"nodes"`
+	Edges  int    `json:"edges"`
+	// Omitted is the number of nodes left out by the depth and size limits.
+	Omitted int `json:"omitted"`
+}
+
+type diagramNode struct {
+	id       uint32
+	name     string
+	nodeType string
+	center   point
+}
+
+type diagramEdge struct {
+	from, to int
+	// points are where the edge is drawn through, from the source's box to the target's.
+	points []point
+	// highlighted edges lead to a vulnerability.
+	highlighted bool
+}
+
+// diagram is the subgraph being rendered, with the nodes and edges indexed by their position.
+type diagram struct {
+	nodes         []diagramNode
+	edges         []diagramEdge
+	children      [][]int
+	width, height float64
+}
+
+// SVG renders the subgraph of the given nodes, or of the whole graph if nodes is nil, as an SVG diagram.
+// Nodes are colored by type, and the edges on paths to vulnerabilities are highlighted.
+func SVG(ctx context.Context, storage pkg.Storage, nodes *roaring.Bitmap, w io.Writer, opts Options) (*Result, error) {
+	if opts.Layout == "" {
+		opts.Layout = LayoutAuto
+	}
+	if opts.Layout != LayoutAuto && opts.Layout != LayoutLayered && opts.Layout != LayoutForce {
+		return nil, fmt.Errorf("unknown layout %s, expected %s, %s or %s", opts.Layout, LayoutAuto, LayoutLayered, LayoutForce)
+	}
+	if opts.MaxNodes == 0 {
+		opts.MaxNodes = DefaultMaxNodes
+	}
+
+	d, omitted, err := selectDiagram(ctx, storage, nodes, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Layout: opts.Layout, Nodes: len(d.nodes), Edges: len(d.edges), Omitted: omitted}
+	if result.Layout == LayoutAuto {
+		result.Layout = LayoutForce
+		if d.acyclic() {
+			result.Layout = LayoutLayered
+		}
+	}
+	switch {
+	case len(d.nodes) == 0:
+		d.width, d.height = 2*margin, 2*margin
+	case result.Layout == LayoutLayered:
+		if !d.acyclic() {
+			return nil, fmt.Errorf("the subgraph has cycles, so it can't be laid out in layers")
+		}
+		d.layoutLayered()
+	default:
+		d.layoutForce()
+	}
+	d.highlightVulnerabilityPaths()
+
+	if _, err := io.WriteString(w, d.svg()); err != nil {
+		return nil, fmt.Errorf("failed to write SVG: %w", err)
+	}
+	return result, nil
+}
+
+// selectDiagram gets the nodes to render, walking the subgraph breadth-first from its roots, the nodes without parents
+// in it, until the depth or size limits are reached. It returns the diagram and the number of nodes left out.
+func selectDiagram(ctx context.Context, storage pkg.Storage, ids *roaring.Bitmap, opts Options) (*diagram, int, error) {
+	var keys []uint32
+	if ids == nil {
+		var err error
+		keys, err = storage.GetAllKeys(ctx)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get nodes: %w", err)
+		}
+	} else {
+		keys = ids.ToArray()
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	slices.Sort(keys)
+
+	var roots []uint32
+	for _, id := range keys {
+		node, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		root := true
+		for _, parent := range node.Parents.ToArray() {
+			if _, ok := nodes[parent]; ok && parent != id {
+				root = false
+				break
+			}
+		}
+		if root {
+			roots = append(roots, id)
+		}
+	}
+
+	// Nodes only reachable through cycles have no roots, so the smallest of them is another root
+	reachable := map[uint32]bool{}
+	reach := func(id uint32) {
+		queue := []uint32{id}
+		reachable[id] = true
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, child := range nodes[current].Children.ToArray() {
+				if _, ok := nodes[child]; ok && !reachable[child] {
+					reachable[child] = true
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+	for _, root := range roots {
+		reach(root)
+	}
+	for _, id := range keys {
+		if _, ok := nodes[id]; ok && !reachable[id] {
+			roots = append(roots, id)
+			reach(id)
+		}
+	}
+
+	index := map[uint32]int{}
+	d := &diagram{}
+	full := func() bool {
+		return opts.MaxNodes > 0 && len(d.nodes) >= opts.MaxNodes
+	}
+	queue := slices.Clone(roots)
+	depth := map[uint32]int{}
+	add := func(id uint32) {
+		index[id] = len(d.nodes)
+		d.nodes = append(d.nodes, diagramNode{id: id, name: nodes[id].Name, nodeType: nodes[id].Type})
+	}
+	for _, root := range roots {
+		if !full() {
+			add(root)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if _, ok := index[current]; !ok || (opts.MaxDepth > 0 && depth[current] >= opts.MaxDepth) {
+			continue
+		}
+		for _, child := range nodes[current].Children.ToArray() {
+			if _, ok := nodes[child]; !ok {
+				continue
+			}
+			if _, ok := index[child]; ok || full() {
+				continue
+			}
+			add(child)
+			depth[child] = depth[current] + 1
+			queue = append(queue, child)
+		}
+	}
+
+	d.children = make([][]int, len(d.nodes))
+	for from, node := range d.nodes {
+		for _, child := range nodes[node.id].Children.ToArray() {
+			if to, ok := index[child]; ok && to != from {
+				d.edges = append(d.edges, diagramEdge{from: from, to: to})
+				d.children[from] = append(d.children[from], to)
+			}
+		}
+	}
+	return d, len(nodes) - len(d.nodes), nil
+}
+
+// highlightVulnerabilityPaths highlights the edges to vulnerabilities and to the nodes that depend on one.
+func (d *diagram) highlightVulnerabilityPaths() {
+	parents := make([][]int, len(d.nodes))
+	for _, edge := range d.edges {
+		parents[edge.to] = append(parents[edge.to], edge.from)
+	}
+	exposed := make([]bool, len(d.nodes))
+	var queue []int
+	for i, node := range d.nodes {
+		if node.nodeType == pkg.VulnerabilityNodeType {
+			exposed[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, parent := range parents[current] {
+			if !exposed[parent] {
+				exposed[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	for e := range d.edges {
+		d.edges[e].highlighted = exposed[d.edges[e].to]
+	}
+}
+
+// typeColor returns the fill color of a node type.
+func typeColor(nodeType string) string {
+	if color, ok := typeColors[nodeType]; ok {
+		return color
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(nodeType))
+	return otherColors[h.Sum32()%uint32(len(otherColors))]
+}
+
+// label shortens a node's name to fit in its box.
+func label(name string) string {
+	if utf8.RuneCountInString(name) <= maxLabelLength {
+		return name
+	}
+	return string([]rune(name)[:maxLabelLength-1]) + "…"
+}
+
+func (d *diagram) svg() string {
+	var types []string
+	for _, node := range d.nodes {
+		if !slices.Contains(types, node.nodeType) {
+			types = append(types, node.nodeType)
+		}
+	}
+	slices.Sort(types)
+	legendHeight := 0.0
+	if len(types) > 0 {
+		legendHeight = 24
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="12">`+"\n",
+		d.width, d.height+legendHeight, d.width, d.height+legendHeight)
+	b.WriteString("<defs>\n")
+	for _, marker := range [][2]string{{"arrow", edgeColor}, {"arrow-highlighted", highlightedColor}} {
+		fmt.Fprintf(&b, `<marker id="%s" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="%s"/></marker>`+"\n", marker[0], marker[1])
+	}
+	b.WriteString("</defs>\n")
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+
+	// Highlighted edges are drawn last so they stay visible where edges overlap
+	b.WriteString(`<g class="edges">` + "\n")
+	for _, highlighted := range []bool{false, true} {
+		for _, edge := range d.edges {
+			if edge.highlighted != highlighted {
+				continue
+			}
+			var points []string
+			for _, p := range edge.points {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", p.x, p.y))
+			}
+			color, width, marker := edgeColor, 1.2, "arrow"
+			if highlighted {
+				color, width, marker = highlightedColor, 2.5, "arrow-highlighted"
+			}
+			fmt.Fprintf(&b, `<polyline class="edge" data-from="%d" data-to="%d" points="%s" fill="none" stroke="%s" stroke-width="%.1f" marker-end="url(#%s)"/>`+"\n",
+				d.nodes[edge.from].id, d.nodes[edge.to].id, strings.Join(points, " "), color, width, marker)
+		}
+	}
+	b.WriteString("</g>\n")
+
+	b.WriteString(`<g class="nodes">` + "\n")
+	for _, node := range d.nodes {
+		fmt.Fprintf(&b, `<g class="node" data-id="%d" data-type="%s"><title>%s (%s)</title>`, node.id, html.EscapeString(node.nodeType), html.EscapeString(node.name), html.EscapeString(node.nodeType))
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.0f" height="%.0f" rx="6" fill="%s" stroke="#555555"/>`,
+			node.center.x-nodeWidth/2, node.center.y-nodeHeight/2, nodeWidth, nodeHeight, typeColor(node.nodeType))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" dominant-baseline="central">%s</text></g>`+"\n",
+			node.center.x, node.center.y, html.EscapeString(label(node.name)))
+	}
+	b.WriteString("</g>\n")
+
+	b.WriteString(`<g class="legend">` + "\n")
+	x := margin
+	for _, nodeType := range types {
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s" stroke="#555555"/><text x="%.1f" y="%.1f" dominant-baseline="central">%s</text>`+"\n",
+			x, d.height+2, typeColor(nodeType), x+16, d.height+8, html.EscapeString(nodeType))
+		x += 16 + float64(len(nodeType))*7 + 16
+	}
+	b.WriteString("</g>\n</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/bit-bom/minefield/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type svgDocument struct {
+	Polylines []struct {
+		From   uint32 `xml:"data-from,attr"`
+		To     uint32 `xml:"data-to,attr"`
+		Points string `xml:"points,attr"`
+		Stroke string `xml:"stroke,attr"`
+	} `xml:"g>polyline"`
+	Nodes []struct {
+		ID    uint32 `xml:"data-id,attr"`
+		Type  string `xml:"data-type,attr"`
+		Title string `xml:"title"`
+		Rect  struct {
+			X    float64 `xml:"x,attr"`
+			Y    float64 `xml:"y,attr"`
+			Fill string  `xml:"fill,attr"`
+		} `xml:"rect"`
+		Text string `xml:"text"`
+	} `xml:"g>g"`
+}
+
+func render(t *testing.T, storage pkg.Storage, nodes *roaring.Bitmap, opts Options) (*Result, *svgDocument) {
+	var buf bytes.Buffer
+	result, err := SVG(context.Background(), storage, nodes, &buf, opts)
+	require.NoError(t, err)
+	var document svgDocument
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &document))
+	return result, &document
+}
+
+// graph adds app -> lib -> util, app -> util and lib -> vuln, with names that need escaping.
+func graph(t *testing.T) (pkg.Storage, map[string]*pkg.Node) {
+	ctx := context.Background()
+	storage := pkg.NewMemoryStorage()
+	nodes := map[string]*pkg.Node{}
+	for _, node := range []struct{ key, nodeType, name string }{
+		{"app", "PACKAGE", "pkg:generic/app@1.0.0"},
+		{"lib", "PACKAGE", "pkg:npm/%40scope/lib-with-a-long-name@2.0.0"},
+		{"util", "FILE", "util<&>.js"},
+		{"vuln", pkg.VulnerabilityNodeType, "GHSA-lib-0001"},
+	} {
+		added, err := pkg.AddNode(ctx, storage, node.nodeType, nil, node.name)
+		require.NoError(t, err)
+		nodes[node.key] = added
+	}
+	for _, edge := range [][2]string{{"app", "lib"}, {"lib", "util"}, {"app", "util"}, {"lib", "vuln"}} {
+		require.NoError(t, nodes[edge[0]].SetDependency(ctx, storage, nodes[edge[1]]))
+	}
+	return storage, nodes
+}
+
+func TestSVGLayered(t *testing.T) {
+	storage, nodes := graph(t)
+	result, document := render(t, storage, nil, Options{})
+	assert.Equal(t, &Result{Layout: LayoutLayered, Nodes: 4, Edges: 4}, result)
+
+	rects := map[uint32]float64{}
+	for _, node := range document.Nodes {
+		rects[node.ID] = node.Rect.Y
+	}
+	// Every edge points down, and app -> util skips the layer of lib
+	assert.Less(t, rects[nodes["app"].ID], rects[nodes["lib"].ID])
+	assert.Less(t, rects[nodes["lib"].ID], rects[nodes["util"].ID])
+	assert.Less(t, rects[nodes["lib"].ID], rects[nodes["vuln"].ID])
+	for _, polyline := range document.Polylines {
+		if polyline.From == nodes["app"].ID && polyline.To == nodes["util"].ID {
+			assert.Len(t, strings.Fields(polyline.Points), 3, "long edges are routed through a dummy vertex")
+		}
+	}
+
+	// Nodes are colored by type, with escaped and shortened labels
+	for _, node := range document.Nodes {
+		assert.Equal(t, typeColor(node.Type), node.Rect.Fill)
+		if node.ID == nodes["util"].ID {
+			assert.Equal(t, "util<&>.js (FILE)", node.Title)
+			assert.Equal(t, "util<&>.js", node.Text)
+		}
+		if node.ID == nodes["lib"].ID {
+			assert.Equal(t, "pkg:npm/%40scope/lib-with…", node.Text)
+		}
+	}
+	assert.NotEqual(t, typeColor("PACKAGE"), typeColor("FILE"))
+
+	// The edges on the path to the vulnerability are highlighted
+	highlighted := map[[2]uint32]bool{}
+	for _, polyline := range document.Polylines {
+		highlighted[[2]uint32{polyline.From, polyline.To}] = polyline.Stroke == highlightedColor
+	}
+	assert.Equal(t, map[[2]uint32]bool{
+		{nodes["app"].ID, nodes["lib"].ID}:  true,
+		{nodes["lib"].ID, nodes["vuln"].ID}: true,
+		{nodes["lib"].ID, nodes["util"].ID}: false,
+		{nodes["app"].ID, nodes["util"].ID}: false,
+	}, highlighted)
+}
+
+func TestSVGLimits(t *testing.T) {
+	storage, nodes := graph(t)
+
+	result, _ := render(t, storage, nil, Options{MaxDepth: 1})
+	assert.Equal(t, &Result{Layout: LayoutLayered, Nodes: 3, Edges: 3, Omitted: 1}, result)
+
+	result, document := render(t, storage, nil, Options{MaxNodes: 2})
+	assert.Equal(t, &Result{Layout: LayoutLayered, Nodes: 2, Edges: 1, Omitted: 2}, result)
+	assert.Equal(t, nodes["app"].ID, document.Nodes[0].ID)
+
+	// Queries select the subgraph, whose roots are the nodes without parents in it
+	result, document = render(t, storage, roaring.BitmapOf(nodes["lib"].ID, nodes["util"].ID), Options{})
+	assert.Equal(t, &Result{Layout: LayoutLayered, Nodes: 2, Edges: 1}, result)
+	assert.Equal(t, nodes["lib"].ID, document.Nodes[0].ID)
+}
+
+func TestSVGForce(t *testing.T) {
+	ctx := context.Background()
+	storage, nodes := graph(t)
+	require.NoError(t, nodes["util"].SetDependency(ctx, storage, nodes["app"]))
+
+	result, document := render(t, storage, nil, Options{})
+	assert.Equal(t, &Result{Layout: LayoutForce, Nodes: 4, Edges: 5}, result)
+	require.Len(t, document.Nodes, 4)
+	for i, a := range document.Nodes {
+		assert.GreaterOrEqual(t, a.Rect.X, 0.0)
+		assert.GreaterOrEqual(t, a.Rect.Y, 0.0)
+		for _, b := range document.Nodes[i+1:] {
+			overlap := a.Rect.X < b.Rect.X+nodeWidth && b.Rect.X < a.Rect.X+nodeWidth && a.Rect.Y < b.Rect.Y+nodeHeight && b.Rect.Y < a.Rect.Y+nodeHeight
+			assert.False(t, overlap, "nodes %d and %d overlap", a.ID, b.ID)
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err := SVG(ctx, storage, nil, &buf, Options{Layout: LayoutLayered})
+	assert.Error(t, err, "cyclic subgraphs can't be laid out in layers")
+	_, err = SVG(ctx, storage, nil, &buf, Options{Layout: "circular"})
+	assert.Error(t, err)
+
+	// The layout is deterministic
+	_, again := render(t, storage, nil, Options{})
+	assert.Equal(t, document, again)
+}
+
+func TestSVGEmpty(t *testing.T) {
+	result, document := render(t, pkg.NewMemoryStorage(), roaring.New(), Options{})
+	assert.Equal(t, &Result{Layout: LayoutLayered}, result)
+	assert.Empty(t, document.Nodes)
+}
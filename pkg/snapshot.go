@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot format.
+const SnapshotVersion = 1
+
+// Snapshot is a copy of every node of a graph, with its metadata and edges, and the VEX statements on its edges, that
+// can be loaded into another storage.
+type Snapshot struct {
+	Version int                    `json:"version"`
+	Created time.Time              `json:"created"`
+	Nodes   []*Node                `json:"nodes"`
+	VEX     []SnapshotVEXStatement `json:"vex,omitempty"`
+}
+
+// SnapshotVEXStatement is a VEX statement on the edge of a package on a vulnerability.
+type SnapshotVEXStatement struct {
+	From      uint32        `json:"from"`
+	To        uint32        `json:"to"`
+	Statement *VEXStatement `json:"statement"`
+}
+
+// TakeSnapshot copies every node of the graph.
+func TakeSnapshot(ctx context.Context, storage Storage) (*Snapshot, error) {
+	keys, err := storage.GetAllKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get keys: %w", err)
+	}
+	nodes, err := storage.GetNodes(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	snapshot := &Snapshot{Version: SnapshotVersion, Created: time.Now().UTC(), Nodes: make([]*Node, 0, len(nodes))}
+	for _, node := range nodes {
+		snapshot.Nodes = append(snapshot.Nodes, node)
+	}
+	slices.SortFunc(snapshot.Nodes, func(a, b *Node) int { return cmp.Compare(a.ID, b.ID) })
+
+	for _, node := range snapshot.Nodes {
+		if node.Type != VulnerabilityNodeType {
+			continue
+		}
+		for _, parent := range node.Parents.ToArray() {
+			statements, err := storage.GetVEXStatements(ctx, Edge{From: parent, To: node.ID})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get VEX statements: %w", err)
+			}
+			slices.SortFunc(statements, func(a, b *VEXStatement) int { return cmp.Compare(a.Product, b.Product) })
+			for _, statement := range statements {
+				snapshot.VEX = append(snapshot.VEX, SnapshotVEXStatement{From: parent, To: node.ID, Statement: statement})
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+// WriteSnapshot writes a snapshot of the graph as JSON.
+func WriteSnapshot(ctx context.Context, storage Storage, w io.Writer) error {
+	snapshot, err := TakeSnapshot(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", snapshot.Version, SnapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+// LoadSnapshot saves the nodes and VEX statements of a snapshot into an empty storage, keeping their IDs, rebuilds the
+// indexes queries use and caches the graph.
+func LoadSnapshot(ctx context.Context, snapshot *Snapshot, storage Storage) error {
+	for _, node := range snapshot.Nodes {
+		if err := storage.SaveNode(ctx, node); err != nil {
+			return fmt.Errorf("failed to save node %s: %w", node.Name, err)
+		}
+	}
+	for _, vex := range snapshot.VEX {
+		if err := storage.SetVEXStatement(ctx, Edge{From: vex.From, To: vex.To}, vex.Statement); err != nil {
+			return fmt.Errorf("failed to save VEX statement: %w", err)
+		}
+	}
+
+	indexed := map[[2]string][]uint32{}
+	for _, node := range snapshot.Nodes {
+		switch node.Type {
+		case DocumentNodeType:
+		case VulnerabilityNodeType:
+			metadata, err := NodeVulnerabilityMetadata(node)
+			if err != nil {
+				return err
+			}
+			if err := indexVulnerability(ctx, storage, node, metadata); err != nil {
+				return err
+			}
+		default:
+			metadata, err := NodeComponentMetadata(node)
+			if err != nil {
+				return err
+			}
+			for index, values := range metadata.IndexValues() {
+				for _, value := range values {
+					key := [2]string{index, value}
+					indexed[key] = append(indexed[key], node.ID)
+				}
+			}
+		}
+	}
+	for key, ids := range indexed {
+		if err := storage.AddToIndex(ctx, key[0], key[1], ids); err != nil {
+			return fmt.Errorf("failed to index nodes: %w", err)
+		}
+	}
+
+	if err := Cache(ctx, storage); err != nil {
+		return fmt.Errorf("failed to cache snapshot: %w", err)
+	}
+	return nil
+}
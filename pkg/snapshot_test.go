@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	app, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:generic/app@1.0.0")
+	require.NoError(t, err)
+	lib, err := AddNode(ctx, storage, "PACKAGE", &ComponentMetadata{Licenses: []string{"MIT"}}, "pkg:generic/lib@1.0.0")
+	require.NoError(t, err)
+	vulnerability, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GHSA-0001", Aliases: []string{"CVE-2024-0001"}})
+	require.NoError(t, err)
+	require.NoError(t, app.SetDependency(ctx, storage, lib))
+	require.NoError(t, lib.SetDependency(ctx, storage, vulnerability))
+	statement := &VEXStatement{Product: app.ID, Status: VEXNotAffected, Justification: "vulnerable_code_not_in_execute_path"}
+	require.NoError(t, storage.SetVEXStatement(ctx, Edge{From: lib.ID, To: vulnerability.ID}, statement))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteSnapshot(ctx, storage, &buf))
+	snapshot, err := ReadSnapshot(&buf)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Nodes, 3)
+	assert.Equal(t, app.ID, snapshot.Nodes[0].ID)
+
+	loaded := NewMemoryStorage()
+	require.NoError(t, LoadSnapshot(ctx, snapshot, loaded))
+
+	// Nodes keep their IDs and edges, and the loaded graph is cached
+	id, err := loaded.NameToID(ctx, lib.Name)
+	require.NoError(t, err)
+	assert.Equal(t, lib.ID, id)
+	node, err := loaded.GetNode(ctx, app.ID)
+	require.NoError(t, err)
+	dependencies, err := node.QueryDependencies(ctx, loaded)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint32{lib.ID, vulnerability.ID}, dependencies.ToArray())
+	toBeCached, err := loaded.ToBeCached(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, toBeCached)
+
+	// The indexes are rebuilt
+	licensed, err := loaded.GetIndex(ctx, LicenseIndex, "mit")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{lib.ID}, licensed.ToArray())
+	found, err := FindVulnerability(ctx, loaded, "CVE-2024-0001")
+	require.NoError(t, err)
+	assert.Equal(t, vulnerability.ID, found.ID)
+
+	// VEX statements are kept
+	statements, err := loaded.GetVEXStatements(ctx, Edge{From: lib.ID, To: vulnerability.ID})
+	require.NoError(t, err)
+	require.Len(t, statements, 1)
+	assert.Equal(t, statement.Justification, statements[0].Justification)
+
+	// New nodes don't reuse the IDs of the loaded ones
+	added, err := AddNode(ctx, loaded, "PACKAGE", nil, "pkg:generic/other@1.0.0")
+	require.NoError(t, err)
+	assert.Greater(t, added.ID, vulnerability.ID)
+
+	// Names already used by other nodes aren't moved to the snapshot's nodes
+	other := NewMemoryStorage()
+	_, err = AddNode(ctx, other, "PACKAGE", nil, lib.Name)
+	require.NoError(t, err)
+	assert.ErrorIs(t, LoadSnapshot(ctx, snapshot, other), ErrNodeAlreadyExists)
+
+	_, err = ReadSnapshot(strings.NewReader(`{"version": 2}`))
+	assert.Error(t, err)
+}
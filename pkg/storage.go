@@ -1,17 +1,81 @@
 package pkg
 
+import (
+	"context"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
 // Storage is the interface that wraps the methods for a storage backend.
 type Storage interface {
-	NameToID(name string) (uint32, error)
-	SaveNode(node *Node) error
-	GetNode(id uint32) (*Node, error)
-	GetNodes(ids []uint32) (map[uint32]*Node, error)
-	GetAllKeys() ([]uint32, error)
-	SaveCache(cache *NodeCache) error
-	SaveCaches(cache []*NodeCache) error
-	ToBeCached() ([]uint32, error)
-	AddNodeToCachedStack(id uint32) error
-	GetCache(id uint32) (*NodeCache, error)
-	ClearCacheStack() error
-	GenerateID() (uint32, error)
+	NameToID(ctx context.Context, name string) (uint32, error)
+	SaveNode(ctx context.Context, node *Node) error
+	// SaveNodeMetadata atomically replaces the metadata of a node, keeping its dependencies as they are.
+	SaveNodeMetadata(ctx context.Context, id uint32, metadata any) error
+	// CreateNode atomically assigns the next ID to node and saves it, unless a node with the same name exists.
+	// In that case nothing is saved and the existing node's ID is returned along with ErrNodeAlreadyExists.
+	CreateNode(ctx context.Context, node *Node) (uint32, error)
+	// AddDependency atomically records that the node from depends on the node to.
+	AddDependency(ctx context.Context, from, to uint32) error
+	// RemoveDependency atomically removes the dependency of the node from on the node to.
+	RemoveDependency(ctx context.Context, from, to uint32) error
+	GetNode(ctx context.Context, id uint32) (*Node, error)
+	GetNodes(ctx context.Context, ids []uint32) (map[uint32]*Node, error)
+	GetAllKeys(ctx context.Context) ([]uint32, error)
+	SaveCache(ctx context.Context, cache *NodeCache) error
+	SaveCaches(ctx context.Context, cache []*NodeCache) error
+	ToBeCached(ctx context.Context) ([]uint32, error)
+	AddNodeToCachedStack(ctx context.Context, id uint32) error
+	GetCache(ctx context.Context, id uint32) (*NodeCache, error)
+	ClearCacheStack(ctx context.Context) error
+	GenerateID(ctx context.Context) (uint32, error)
+	SaveJob(ctx context.Context, job *Job) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+	GetJobs(ctx context.Context) ([]*Job, error)
+	// RequestJobCancel records that the job should stop. The request is kept apart from the job record, so SaveJob never overwrites it.
+	RequestJobCancel(ctx context.Context, id string) error
+	// AddProvenance records that the document declared the nodes and edges.
+	AddProvenance(ctx context.Context, document uint32, nodes []uint32, edges []Edge) error
+	// RemoveProvenance removes the record that the document declared the nodes and edges.
+	RemoveProvenance(ctx context.Context, document uint32, nodes []uint32, edges []Edge) error
+	// GetNodeProvenance returns the documents that declared the node.
+	GetNodeProvenance(ctx context.Context, id uint32) (*roaring.Bitmap, error)
+	// GetEdgeProvenance returns the documents that declared the edge.
+	GetEdgeProvenance(ctx context.Context, edge Edge) (*roaring.Bitmap, error)
+	// SetEdgeTypes records the SBOM relationship each of the edges was last declared with.
+	SetEdgeTypes(ctx context.Context, types map[Edge]EdgeType) error
+	// GetEdgeTypes returns the SBOM relationships the edges were declared with, leaving out edges that have none.
+	GetEdgeTypes(ctx context.Context, edges []Edge) (map[Edge]EdgeType, error)
+	// GetDocumentNodes returns the nodes the document declared.
+	GetDocumentNodes(ctx context.Context, document uint32) (*roaring.Bitmap, error)
+	// GetDocumentEdges returns the edges the document declared.
+	GetDocumentEdges(ctx context.Context, document uint32) ([]Edge, error)
+	// AddToIndex records that the nodes have the value in the index, such as a license in the license index.
+	AddToIndex(ctx context.Context, index, value string, ids []uint32) error
+	// GetIndex returns the nodes that have the value in the index.
+	GetIndex(ctx context.Context, index, value string) (*roaring.Bitmap, error)
+	// SetVEXStatement records a VEX statement on the edge of a package on a vulnerability, replacing the statement for the same product.
+	SetVEXStatement(ctx context.Context, edge Edge, statement *VEXStatement) error
+	// GetVEXStatements returns the VEX statements recorded on the edge of a package on a vulnerability.
+	GetVEXStatements(ctx context.Context, edge Edge) ([]*VEXStatement, error)
+	// AddGraphVersion assigns the next version number to version and records it, with the children each of the nodes had in it.
+	// The baseline children of nodes that have no history yet are recorded as their BaselineGraphVersion.
+	AddGraphVersion(ctx context.Context, version *GraphVersion, baseline, children map[uint32]*roaring.Bitmap) error
+	// GetGraphVersions returns every version of the graph, oldest first.
+	GetGraphVersions(ctx context.Context) ([]*GraphVersion, error)
+	// GetNodeHistories returns the children each of the nodes had in the versions it was recorded in, keyed by node and version.
+	GetNodeHistories(ctx context.Context, ids []uint32) (map[uint32]map[uint32]*roaring.Bitmap, error)
+	// UseNamespace switches the storage to the graph of another namespace. It must not be called while the storage is in use.
+	UseNamespace(name string) error
+	// InNamespace returns a storage for the graph of another namespace of the same backend, for queries across namespaces.
+	InNamespace(name string) (Storage, error)
+	// Namespaces returns the namespaces that were created, along with DefaultNamespace.
+	Namespaces(ctx context.Context) ([]string, error)
+	// CreateNamespace creates an empty namespace.
+	CreateNamespace(ctx context.Context, name string) error
+	// CopyNamespace creates the namespace to with a copy of everything in the namespace from.
+	// The copy isn't atomic, so writes to the namespace from during the copy may be only partly copied.
+	CopyNamespace(ctx context.Context, from, to string) error
+	// DropNamespace deletes a namespace and everything in it. DefaultNamespace can't be dropped.
+	DropNamespace(ctx context.Context, name string) error
 }
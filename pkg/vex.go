@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+// VEXStatus is the status a VEX statement gives a vulnerability, as OpenVEX names them.
+type VEXStatus string
+
+const (
+	VEXNotAffected        VEXStatus = "not_affected"
+	VEXAffected           VEXStatus = "affected"
+	VEXFixed              VEXStatus = "fixed"
+	VEXUnderInvestigation VEXStatus = "under_investigation"
+)
+
+// VEXStatuses are the known VEX statuses.
+var VEXStatuses = []VEXStatus{VEXNotAffected, VEXAffected, VEXFixed, VEXUnderInvestigation}
+
+// VEXStatement is what a VEX document states about a vulnerability in a package, as it is used in a product.
+// Statements are recorded on the dependency edge of the package on the vulnerability.
+type VEXStatement struct {
+	// Product is the ID of the node the statement applies to, or 0 if it applies wherever the package is used.
+	Product         uint32    `json:"product,omitempty"`
+	Status          VEXStatus `json:"status"`
+	Justification   string    `json:"justification,omitempty"`
+	ImpactStatement string    `json:"impactStatement,omitempty"`
+	ActionStatement string    `json:"actionStatement,omitempty"`
+	Timestamp       time.Time `json:"timestamp,omitempty"`
+	// Document identifies the VEX document the statement comes from.
+	Document string `json:"document,omitempty"`
+}
+
+// Suppresses reports whether the statement says the vulnerability can't be exploited, because it isn't affected or it's been fixed.
+func (s *VEXStatement) Suppresses() bool {
+	return s != nil && (s.Status == VEXNotAffected || s.Status == VEXFixed)
+}
+
+// ProductVEXStatement returns the statement that applies to an edge when it's part of a product:
+// the statement scoped to the product if there is one, otherwise the statement that applies everywhere, or nil.
+func ProductVEXStatement(ctx context.Context, storage Storage, product uint32, edge Edge) (*VEXStatement, error) {
+	statements, err := storage.GetVEXStatements(ctx, edge)
+	if err != nil {
+		return nil, err
+	}
+	var statement *VEXStatement
+	for _, s := range statements {
+		switch s.Product {
+		case product:
+			return s, nil
+		case 0:
+			statement = s
+		}
+	}
+	return statement, nil
+}
+
+// VulnerabilitySuppressed reports whether VEX statements suppress every dependency on a vulnerability
+// of the product and the nodes it reaches, so that the product isn't exposed to it.
+func VulnerabilitySuppressed(ctx context.Context, storage Storage, product uint32, reachable *roaring.Bitmap, vulnerability *Node) (bool, error) {
+	for _, parent := range vulnerability.Parents.ToArray() {
+		if parent != product && !reachable.Contains(parent) {
+			continue
+		}
+		statement, err := ProductVEXStatement(ctx, storage, product, Edge{From: parent, To: vulnerability.ID})
+		if err != nil {
+			return false, err
+		}
+		if !statement.Suppresses() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ParseVEXStatus parses a VEX status.
+func ParseVEXStatus(value string) (VEXStatus, error) {
+	status := VEXStatus(value)
+	if !slices.Contains(VEXStatuses, status) {
+		return "", fmt.Errorf("unknown VEX status %q, expected one of not_affected, affected, fixed or under_investigation", value)
+	}
+	return status, nil
+}
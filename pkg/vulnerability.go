@@ -0,0 +1,506 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+// VulnerabilityNodeType is the type of the nodes that represent vulnerabilities.
+const VulnerabilityNodeType = "VULNERABILITY"
+
+// AliasIndex indexes vulnerabilities by their IDs and aliases, such as CVE and GHSA IDs.
+const AliasIndex = "alias"
+
+// typeIndex indexes nodes by their type, so that every vulnerability can be found without scanning the graph.
+const typeIndex = "type"
+
+// VulnerabilityIndexes are the indexes built from vulnerability metadata, which can be queried as atoms such as alias(CVE-2021-44228).
+var VulnerabilityIndexes = []string{AliasIndex}
+
+// SeverityLevel is the qualitative severity of a vulnerability, as CVSS defines it.
+type SeverityLevel string
+
+const (
+	SeverityNone     SeverityLevel = "NONE"
+	SeverityLow      SeverityLevel = "LOW"
+	SeverityMedium   SeverityLevel = "MEDIUM"
+	SeverityHigh     SeverityLevel = "HIGH"
+	SeverityCritical SeverityLevel = "CRITICAL"
+)
+
+// severityLevels are the severity levels from least to most severe.
+var severityLevels = []SeverityLevel{SeverityNone, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// ParseSeverityLevel parses a severity level case insensitively, accepting MODERATE for MEDIUM as GitHub advisories use it.
+func ParseSeverityLevel(value string) (SeverityLevel, error) {
+	level := SeverityLevel(strings.ToUpper(strings.TrimSpace(value)))
+	if level == "MODERATE" {
+		level = SeverityMedium
+	}
+	if !slices.Contains(severityLevels, level) {
+		return "", fmt.Errorf("unknown severity %q, expected one of NONE, LOW, MEDIUM, HIGH or CRITICAL", value)
+	}
+	return level, nil
+}
+
+// SeverityLevelForScore returns the severity level of a CVSS score.
+func SeverityLevelForScore(score float64) SeverityLevel {
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	}
+	return SeverityNone
+}
+
+// Compare returns a negative number if l is less severe than other, zero if they're the same and a positive number if it's more severe.
+// Unknown levels are less severe than every known level.
+func (l SeverityLevel) Compare(other SeverityLevel) int {
+	return slices.Index(severityLevels, l) - slices.Index(severityLevels, other)
+}
+
+// VulnerabilityMetadata is the metadata of a vulnerability node, an OSV record with the severity computed from it.
+type VulnerabilityMetadata struct {
+	ID        string    `json:"id"`
+	Aliases   []string  `json:"aliases,omitempty"`
+	Related   []string  `json:"related,omitempty"`
+	Summary   string    `json:"summary,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	Modified  time.Time `json:"modified,omitempty"`
+	Published time.Time `json:"published,omitempty"`
+	Withdrawn time.Time `json:"withdrawn,omitempty"`
+	// Severity are the severity scores of the vulnerability, such as CVSS vectors.
+	Severity   []VulnerabilitySeverity  `json:"severity,omitempty"`
+	Affected   []AffectedPackage        `json:"affected,omitempty"`
+	References []VulnerabilityReference `json:"references,omitempty"`
+	// DatabaseSpecific holds fields specific to the database the record is from, such as the severity of GitHub advisories.
+	DatabaseSpecific map[string]any `json:"database_specific,omitempty"`
+
+	// CVSSScore is the highest base score of the vulnerability's CVSS vectors.
+	CVSSScore float64 `json:"cvssScore,omitempty"`
+	// SeverityLevel is the severity of the CVSS score, or the severity the database rates the vulnerability if it has no CVSS vector.
+	SeverityLevel SeverityLevel `json:"severityLevel,omitempty"`
+}
+
+// VulnerabilitySeverity is a severity score of a vulnerability, such as a CVSS_V3 vector.
+type VulnerabilitySeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// AffectedPackage is a package a vulnerability affects, and the versions of it that are affected.
+type AffectedPackage struct {
+	Package  VulnerablePackage `json:"package"`
+	Ranges   []AffectedRange   `json:"ranges,omitempty"`
+	Versions []string          `json:"versions,omitempty"`
+	// EcosystemSpecific and DatabaseSpecific hold fields specific to the package's ecosystem and the database the record is from.
+	EcosystemSpecific map[string]any `json:"ecosystem_specific,omitempty"`
+	DatabaseSpecific  map[string]any `json:"database_specific,omitempty"`
+}
+
+// VulnerablePackage identifies a package in an ecosystem.
+type VulnerablePackage struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Purl      string `json:"purl,omitempty"`
+}
+
+// AffectedRange is a range of affected versions, as SEMVER, ECOSYSTEM or GIT events.
+type AffectedRange struct {
+	Type   string       `json:"type"`
+	Repo   string       `json:"repo,omitempty"`
+	Events []RangeEvent `json:"events"`
+}
+
+// RangeEvent is a version a range is introduced, fixed, last affected or limited at.
+type RangeEvent struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// VulnerabilityReference is a link to more information about a vulnerability, such as an advisory or a fix.
+type VulnerabilityReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// NodeVulnerabilityMetadata returns the metadata of a vulnerability node, whether or not it has been through the storage backend.
+func NodeVulnerabilityMetadata(node *Node) (*VulnerabilityMetadata, error) {
+	if metadata, ok := node.Metadata.(*VulnerabilityMetadata); ok {
+		return metadata, nil
+	}
+
+	// Metadata loaded from the storage backend is decoded into generic JSON values
+	data, err := json.Marshal(node.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal vulnerability metadata: %w", err)
+	}
+	var metadata VulnerabilityMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vulnerability metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// IDs returns the ID of the vulnerability followed by its aliases.
+func (m *VulnerabilityMetadata) IDs() []string {
+	ids := []string{m.ID}
+	for _, alias := range m.Aliases {
+		if !slices.Contains(ids, alias) {
+			ids = append(ids, alias)
+		}
+	}
+	return ids
+}
+
+// preferredIDPrefixes are the prefixes of the IDs vulnerability nodes are named after, most preferred first.
+var preferredIDPrefixes = []string{"CVE-", "GHSA-"}
+
+// idPreference ranks an ID by how preferred it is to name a vulnerability node after, lower first.
+func idPreference(id string) int {
+	for i, prefix := range preferredIDPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return i
+		}
+	}
+	return len(preferredIDPrefixes)
+}
+
+// PreferredID returns the ID a vulnerability node is named after: its CVE ID if it has one, then its GHSA ID, then its own ID.
+// Records of the same vulnerability from different databases alias each other, so they all prefer the same ID.
+func (m *VulnerabilityMetadata) PreferredID() string {
+	preferred := m.ID
+	for _, id := range m.IDs() {
+		if idPreference(id) < idPreference(preferred) {
+			preferred = id
+		}
+	}
+	return preferred
+}
+
+// SortVulnerabilities sorts records so that those with preferred IDs, such as CVE records, come first.
+// Adding records in this order names the node of a vulnerability the same whichever of its records were found.
+func SortVulnerabilities(vulns []VulnerabilityMetadata) {
+	slices.SortStableFunc(vulns, func(a, b VulnerabilityMetadata) int {
+		return idPreference(a.ID) - idPreference(b.ID)
+	})
+}
+
+// IndexValues returns the values the vulnerability is indexed by, keyed by index.
+func (m *VulnerabilityMetadata) IndexValues() map[string][]string {
+	var aliases []string
+	for _, id := range m.IDs() {
+		if value := normalizeIndexValue(id); value != "" && !slices.Contains(aliases, value) {
+			aliases = append(aliases, value)
+		}
+	}
+	slices.Sort(aliases)
+	return map[string][]string{AliasIndex: aliases}
+}
+
+// Score computes the CVSS score and severity level of the vulnerability from its severity vectors.
+// Vectors that can't be scored are skipped, falling back to the severity the database rates the vulnerability.
+func (m *VulnerabilityMetadata) Score() {
+	m.CVSSScore, m.SeverityLevel = 0, ""
+	scored := false
+	for _, severity := range m.Severity {
+		switch severity.Type {
+		case "CVSS_V3", "CVSS_V4":
+			score, err := CVSSBaseScore(severity.Score)
+			if err != nil {
+				continue
+			}
+			m.CVSSScore, scored = math.Max(m.CVSSScore, score), true
+		}
+	}
+	if scored {
+		m.SeverityLevel = SeverityLevelForScore(m.CVSSScore)
+		return
+	}
+
+	// Without a CVSS vector, use the highest severity rated by a database, such as a GitHub advisory or Ubuntu
+	ratings := []any{m.DatabaseSpecific["severity"]}
+	for _, severity := range m.Severity {
+		if severity.Type == "Ubuntu" {
+			ratings = append(ratings, severity.Score)
+		}
+	}
+	for _, affected := range m.Affected {
+		ratings = append(ratings, affected.DatabaseSpecific["severity"], affected.EcosystemSpecific["severity"])
+	}
+	for _, rating := range ratings {
+		value, ok := rating.(string)
+		if !ok {
+			continue
+		}
+		if level, err := ParseSeverityLevel(value); err == nil && level.Compare(m.SeverityLevel) > 0 {
+			m.SeverityLevel = level
+		}
+	}
+}
+
+// Merge adds what another record of the same vulnerability knows about it.
+// A newer version of the same record updates what the record says, such as its summary, severities and withdrawal,
+// keeping what other records added, while an older version only adds its aliases.
+// Records from other databases add their aliases, severities, affected packages and references.
+func (m *VulnerabilityMetadata) Merge(other *VulnerabilityMetadata) {
+	aliases := append(m.IDs(), other.IDs()...)
+	update := other.ID == m.ID
+	if !update || !other.Modified.Before(m.Modified) {
+		m.Related = appendMissing(m.Related, other.Related...)
+		if m.Summary == "" || update && other.Summary != "" {
+			m.Summary = other.Summary
+		}
+		if m.Details == "" || update && other.Details != "" {
+			m.Details = other.Details
+		}
+		if other.Modified.After(m.Modified) {
+			m.Modified = other.Modified
+		}
+		if m.Published.IsZero() || !other.Published.IsZero() && other.Published.Before(m.Published) {
+			m.Published = other.Published
+		}
+		switch {
+		case update:
+			m.Withdrawn = other.Withdrawn
+		case other.Withdrawn.IsZero():
+			// The vulnerability is only withdrawn if every record of it is
+			m.Withdrawn = time.Time{}
+		}
+		if update {
+			// The new version's scores replace the ones of the same type
+			m.Severity = slices.DeleteFunc(m.Severity, func(s VulnerabilitySeverity) bool {
+				return slices.ContainsFunc(other.Severity, func(o VulnerabilitySeverity) bool { return o.Type == s.Type })
+			})
+		}
+		m.Severity = appendMissing(m.Severity, other.Severity...)
+		// Each affected package is kept once, keyed by its ecosystem and name, so that a newer version of the record
+		// replaces the ranges it corrected instead of adding to them
+		for _, affected := range other.Affected {
+			i := slices.IndexFunc(m.Affected, func(a AffectedPackage) bool {
+				return a.Package.Ecosystem == affected.Package.Ecosystem && a.Package.Name == affected.Package.Name
+			})
+			switch {
+			case i < 0:
+				m.Affected = append(m.Affected, affected)
+			case update:
+				m.Affected[i] = affected
+			}
+		}
+		for _, reference := range other.References {
+			if !slices.ContainsFunc(m.References, func(r VulnerabilityReference) bool { return r.URL == reference.URL }) {
+				m.References = append(m.References, reference)
+			}
+		}
+		for key, value := range other.DatabaseSpecific {
+			if _, ok := m.DatabaseSpecific[key]; ok && !update {
+				continue
+			}
+			if m.DatabaseSpecific == nil {
+				m.DatabaseSpecific = map[string]any{}
+			}
+			m.DatabaseSpecific[key] = value
+		}
+	}
+
+	m.Aliases = nil
+	for _, alias := range aliases {
+		if alias != m.ID {
+			m.Aliases = appendMissing(m.Aliases, alias)
+		}
+	}
+	m.Score()
+}
+
+func appendMissing[T comparable](values []T, more ...T) []T {
+	for _, value := range more {
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// AddVulnerability adds a vulnerability node, or merges the record into the node of the same vulnerability if there is one.
+// Records are the same vulnerability if any of their IDs and aliases match, so a GHSA advisory and the CVE it aliases share a node,
+// which is named after the preferred ID of the first record added.
+func AddVulnerability(ctx context.Context, storage Storage, vulnerability *VulnerabilityMetadata) (*Node, error) {
+	metadata := *vulnerability
+	metadata.Score()
+
+	existing, err := FindVulnerability(ctx, storage, metadata.IDs()...)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		node, created, err := GetOrAddNode(ctx, storage, VulnerabilityNodeType, &metadata, metadata.PreferredID())
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return node, indexVulnerability(ctx, storage, node, &metadata)
+		}
+		existing = node
+	}
+
+	current, err := NodeVulnerabilityMetadata(existing)
+	if err != nil {
+		return nil, err
+	}
+	before, err := json.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal vulnerability %s: %w", existing.Name, err)
+	}
+	// The record is merged into a copy, so that it can be compared with what is saved
+	merged := &VulnerabilityMetadata{}
+	if err := json.Unmarshal(before, merged); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vulnerability %s: %w", existing.Name, err)
+	}
+	if merged.ID == "" {
+		// Nodes added before vulnerabilities kept their records only have an ID
+		merged = &metadata
+	} else {
+		merged.Merge(&metadata)
+	}
+	after, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal vulnerability %s: %w", existing.Name, err)
+	}
+	existing.Metadata = merged
+	// Records are merged again every time vulnerabilities are ingested, and most of them haven't changed
+	if bytes.Equal(before, after) {
+		return existing, nil
+	}
+	if err := storage.SaveNodeMetadata(ctx, existing.ID, merged); err != nil {
+		return nil, fmt.Errorf("failed to save vulnerability %s: %w", existing.Name, err)
+	}
+	return existing, indexVulnerability(ctx, storage, existing, merged)
+}
+
+// FindVulnerability returns the vulnerability node known by any of the IDs, or nil if there is none.
+func FindVulnerability(ctx context.Context, storage Storage, ids ...string) (*Node, error) {
+	for _, id := range ids {
+		value := normalizeIndexValue(id)
+		if value == "" {
+			continue
+		}
+		matches, err := storage.GetIndex(ctx, AliasIndex, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up vulnerability %s: %w", id, err)
+		}
+		if !matches.IsEmpty() {
+			node, err := storage.GetNode(ctx, matches.Minimum())
+			if err != nil {
+				return nil, fmt.Errorf("failed to get vulnerability %s: %w", id, err)
+			}
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+func indexVulnerability(ctx context.Context, storage Storage, node *Node, metadata *VulnerabilityMetadata) error {
+	if err := storage.AddToIndex(ctx, typeIndex, normalizeIndexValue(VulnerabilityNodeType), []uint32{node.ID}); err != nil {
+		return fmt.Errorf("failed to index vulnerability %s: %w", node.Name, err)
+	}
+	for index, values := range metadata.IndexValues() {
+		for _, value := range append(values, normalizeIndexValue(node.Name)) {
+			if err := storage.AddToIndex(ctx, index, value, []uint32{node.ID}); err != nil {
+				return fmt.Errorf("failed to index vulnerability %s: %w", node.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// VulnerabilityNodes returns the IDs of every vulnerability node.
+func VulnerabilityNodes(ctx context.Context, storage Storage) (*roaring.Bitmap, error) {
+	ids, err := storage.GetIndex(ctx, typeIndex, normalizeIndexValue(VulnerabilityNodeType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vulnerabilities: %w", err)
+	}
+	return ids, nil
+}
+
+// vulnerabilityFilter is a condition on vulnerabilities, such as severity>=HIGH or score<9.
+type vulnerabilityFilter func(*VulnerabilityMetadata) bool
+
+// parseVulnerabilityFilters parses the comma separated conditions of a vulns atom, all of which a vulnerability has to meet.
+func parseVulnerabilityFilters(conditions string) ([]vulnerabilityFilter, error) {
+	var filters []vulnerabilityFilter
+	for _, condition := range strings.Split(conditions, ",") {
+		if strings.TrimSpace(condition) == "" {
+			continue
+		}
+		field, operator, value, err := splitCondition(condition)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(field) {
+		case "severity":
+			level, err := ParseSeverityLevel(value)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, func(m *VulnerabilityMetadata) bool {
+				return m.SeverityLevel != "" && compare(m.SeverityLevel.Compare(level), operator)
+			})
+		case "score":
+			score, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid score %q: %w", value, err)
+			}
+			filters = append(filters, func(m *VulnerabilityMetadata) bool {
+				return m.CVSSScore > 0 && compare(int(math.Round((m.CVSSScore-score)*10)), operator)
+			})
+		default:
+			return nil, fmt.Errorf("unknown vulnerability field %q, expected severity or score", field)
+		}
+	}
+	return filters, nil
+}
+
+// splitCondition splits a condition such as severity>=HIGH into its field, operator and value.
+func splitCondition(condition string) (string, string, string, error) {
+	for _, operator := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if field, value, ok := strings.Cut(condition, operator); ok {
+			return strings.TrimSpace(field), operator, strings.TrimSpace(value), nil
+		}
+	}
+	return "", "", "", fmt.Errorf("invalid condition %q, expected a field, an operator such as >= and a value", condition)
+}
+
+// compare reports whether the result of comparing two values satisfies an operator.
+func compare(result int, operator string) bool {
+	switch operator {
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	case "!=":
+		return result != 0
+	default:
+		return result == 0
+	}
+}
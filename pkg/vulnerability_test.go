@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSeverityLevel(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SeverityLevel
+		wantErr bool
+	}{
+		{value: "critical", want: SeverityCritical},
+		{value: " High ", want: SeverityHigh},
+		{value: "MODERATE", want: SeverityMedium},
+		{value: "none", want: SeverityNone},
+		{value: "severe", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			level, err := ParseSeverityLevel(test.value)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, level)
+		})
+	}
+	assert.Positive(t, SeverityCritical.Compare(SeverityHigh))
+	assert.Negative(t, SeverityLow.Compare(SeverityMedium))
+	assert.Negative(t, SeverityLevel("").Compare(SeverityNone))
+}
+
+func TestVulnerabilityScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  VulnerabilityMetadata
+		wantScore float64
+		wantLevel SeverityLevel
+	}{
+		{
+			name: "highest CVSS score",
+			metadata: VulnerabilityMetadata{Severity: []VulnerabilitySeverity{
+				{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N"},
+				{Type: "CVSS_V4", Score: "CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N"},
+			}},
+			wantScore: 9.3,
+			wantLevel: SeverityCritical,
+		},
+		{
+			name: "invalid vectors are skipped",
+			metadata: VulnerabilityMetadata{
+				Severity:         []VulnerabilitySeverity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N"}},
+				DatabaseSpecific: map[string]any{"severity": "MODERATE"},
+			},
+			wantLevel: SeverityMedium,
+		},
+		{
+			name: "highest database severity",
+			metadata: VulnerabilityMetadata{
+				Severity: []VulnerabilitySeverity{{Type: "Ubuntu", Score: "low"}},
+				Affected: []AffectedPackage{{DatabaseSpecific: map[string]any{"severity": "HIGH"}}},
+			},
+			wantLevel: SeverityHigh,
+		},
+		{
+			name: "unrated",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.metadata.Score()
+			assert.Equal(t, test.wantScore, test.metadata.CVSSScore)
+			assert.Equal(t, test.wantLevel, test.metadata.SeverityLevel)
+		})
+	}
+}
+
+func TestVulnerabilityPreferredID(t *testing.T) {
+	assert.Equal(t, "CVE-2024-0001", (&VulnerabilityMetadata{ID: "GHSA-0001", Aliases: []string{"PYSEC-0001", "CVE-2024-0001"}}).PreferredID())
+	assert.Equal(t, "GHSA-0001", (&VulnerabilityMetadata{ID: "PYSEC-0001", Aliases: []string{"GHSA-0001"}}).PreferredID())
+	assert.Equal(t, "GO-0001", (&VulnerabilityMetadata{ID: "GO-0001"}).PreferredID())
+
+	vulns := []VulnerabilityMetadata{{ID: "GO-0001"}, {ID: "GHSA-0001"}, {ID: "PYSEC-0001"}, {ID: "CVE-2024-0001"}}
+	SortVulnerabilities(vulns)
+	assert.Equal(t, []VulnerabilityMetadata{{ID: "CVE-2024-0001"}, {ID: "GHSA-0001"}, {ID: "GO-0001"}, {ID: "PYSEC-0001"}}, vulns)
+}
+
+func TestVulnerabilityMerge(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+
+	// A newer version of the same record replaces it
+	metadata := &VulnerabilityMetadata{ID: "GHSA-0001", Aliases: []string{"CVE-2024-0001"}, Summary: "old", Modified: older}
+	metadata.Merge(&VulnerabilityMetadata{ID: "GHSA-0001", Summary: "new", Modified: newer})
+	assert.Equal(t, "new", metadata.Summary)
+	assert.Equal(t, []string{"CVE-2024-0001"}, metadata.Aliases)
+
+	// An older version doesn't
+	metadata.Merge(&VulnerabilityMetadata{ID: "GHSA-0001", Summary: "old", Modified: older})
+	assert.Equal(t, "new", metadata.Summary)
+	assert.Equal(t, newer, metadata.Modified)
+
+	// Records from other databases add to it
+	metadata.Merge(&VulnerabilityMetadata{
+		ID:         "PYSEC-0001",
+		Aliases:    []string{"GHSA-0001"},
+		Summary:    "other",
+		Severity:   []VulnerabilitySeverity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}},
+		References: []VulnerabilityReference{{Type: "WEB", URL: "https://example.com/PYSEC-0001"}},
+		Withdrawn:  newer,
+	})
+	assert.Equal(t, "GHSA-0001", metadata.ID)
+	assert.Equal(t, "new", metadata.Summary)
+	assert.Equal(t, []string{"CVE-2024-0001", "PYSEC-0001"}, metadata.Aliases)
+	assert.Len(t, metadata.References, 1)
+	assert.True(t, metadata.Withdrawn.IsZero())
+	assert.Equal(t, 9.8, metadata.CVSSScore)
+	assert.Equal(t, SeverityCritical, metadata.SeverityLevel)
+
+	// A newer version of the same record keeps what the other records added
+	newest := newer.Add(24 * time.Hour)
+	metadata.Merge(&VulnerabilityMetadata{
+		ID:       "GHSA-0001",
+		Summary:  "newest",
+		Modified: newest,
+		Severity: []VulnerabilitySeverity{{Type: "Ubuntu", Score: "low"}},
+	})
+	assert.Equal(t, "newest", metadata.Summary)
+	assert.Equal(t, newest, metadata.Modified)
+	assert.Equal(t, []string{"CVE-2024-0001", "PYSEC-0001"}, metadata.Aliases)
+	assert.Len(t, metadata.References, 1)
+	assert.Len(t, metadata.Severity, 2)
+	assert.Equal(t, 9.8, metadata.CVSSScore)
+
+	// and replaces its own scores of the same type
+	metadata.Merge(&VulnerabilityMetadata{ID: "GHSA-0001", Modified: newest, Severity: []VulnerabilitySeverity{{Type: "Ubuntu", Score: "medium"}}})
+	assert.Equal(t, []VulnerabilitySeverity{metadata.Severity[0], {Type: "Ubuntu", Score: "medium"}}, metadata.Severity)
+	assert.Equal(t, "newest", metadata.Summary)
+
+	// Affected packages are kept once per package, with the ranges of the newest version of the record
+	affected := func(fixed string) []AffectedPackage {
+		return []AffectedPackage{{
+			Package: VulnerablePackage{Ecosystem: "PyPI", Name: "requests"},
+			Ranges:  []AffectedRange{{Type: "ECOSYSTEM", Events: []RangeEvent{{Introduced: "0"}, {Fixed: fixed}}}},
+		}}
+	}
+	metadata.Merge(&VulnerabilityMetadata{ID: "GHSA-0001", Modified: newest, Affected: affected("2.0.0")})
+	metadata.Merge(&VulnerabilityMetadata{ID: "GHSA-0001", Modified: newest.Add(time.Hour), Affected: affected("2.0.1")})
+	metadata.Merge(&VulnerabilityMetadata{ID: "PYSEC-0001", Affected: affected("1.9.0")})
+	assert.Equal(t, affected("2.0.1"), metadata.Affected)
+}
+
+func TestAddVulnerability(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+
+	ghsa, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GHSA-0001", Aliases: []string{"CVE-2024-0001"}})
+	require.NoError(t, err)
+	assert.Equal(t, "CVE-2024-0001", ghsa.Name)
+	assert.Equal(t, VulnerabilityNodeType, ghsa.Type)
+
+	// A record aliasing the same CVE is merged into the same node
+	pysec, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{
+		ID:       "PYSEC-0001",
+		Aliases:  []string{"CVE-2024-0001"},
+		Severity: []VulnerabilitySeverity{{Type: "CVSS_V3", Score: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:N/A:N"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ghsa.ID, pysec.ID)
+
+	node, err := storage.GetNode(ctx, ghsa.ID)
+	require.NoError(t, err)
+	metadata, err := NodeVulnerabilityMetadata(node)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"GHSA-0001", "CVE-2024-0001", "PYSEC-0001"}, metadata.IDs())
+	assert.Equal(t, 7.5, metadata.CVSSScore)
+	assert.Equal(t, SeverityHigh, metadata.SeverityLevel)
+
+	for _, alias := range []string{"ghsa-0001", "cve-2024-0001", "pysec-0001"} {
+		ids, err := storage.GetIndex(ctx, AliasIndex, alias)
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{ghsa.ID}, ids.ToArray(), alias)
+	}
+
+	// Adding a record again doesn't save the node, nor queue it for caching
+	require.NoError(t, storage.ClearCacheStack(ctx))
+	_, err = AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GHSA-0001", Aliases: []string{"CVE-2024-0001"}})
+	require.NoError(t, err)
+	toBeCached, err := storage.ToBeCached(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, toBeCached)
+
+	// nor does merging a record into it change its dependencies
+	pkgNode, err := AddNode(ctx, storage, "PACKAGE", nil, "pkg:pypi/requests@2.0.0")
+	require.NoError(t, err)
+	require.NoError(t, pkgNode.SetDependency(ctx, storage, ghsa))
+	_, err = AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "PYSEC-0002", Aliases: []string{"CVE-2024-0001"}})
+	require.NoError(t, err)
+	node, err = storage.GetNode(ctx, ghsa.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{pkgNode.ID}, node.Parents.ToArray())
+
+	other, err := AddVulnerability(ctx, storage, &VulnerabilityMetadata{ID: "GO-0001"})
+	require.NoError(t, err)
+	assert.NotEqual(t, ghsa.ID, other.ID)
+}
@@ -1,6 +1,7 @@
 package weightedNACD
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -35,7 +36,7 @@ type Weights struct {
 	} `json:"scorecard,omitempty"`
 }
 
-func WeightedNACD(storage pkg.Storage, weights Weights) ([]*PkgAndValue, error) {
+func WeightedNACD(ctx context.Context, storage pkg.Storage, weights Weights) ([]*PkgAndValue, error) {
 	weightsForEachType := map[string]weightsForType{}
 
 	if weights.Dependencies != nil {
@@ -56,20 +57,20 @@ func WeightedNACD(storage pkg.Storage, weights Weights) ([]*PkgAndValue, error)
 
 	var scoresPerPkg []*PkgAndValue
 
-	ids, err := storage.GetAllKeys()
+	ids, err := storage.GetAllKeys(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting all leaderboard: %w", err)
 	}
 
 	for _, id := range ids {
-		node, err := storage.GetNode(id)
+		node, err := storage.GetNode(ctx, id)
 		if err != nil {
 			return nil, fmt.Errorf("error getting node with Id %d: %w", id, err)
 		}
 
 		// We can really only calculate the algo on package nodes
 		if node.Type == "PACKAGE" {
-			deps, err := node.QueryDependencies(storage)
+			deps, err := node.QueryDependencies(ctx, storage)
 			if err != nil {
 				return nil, fmt.Errorf("error querying dependencies for node with Id %d: %w", id, err)
 			}
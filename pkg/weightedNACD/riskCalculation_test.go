@@ -1,6 +1,7 @@
 package weightedNACD
 
 import (
+	"context"
 	"math"
 	"testing"
 
@@ -18,6 +19,7 @@ func compareWithNaNComparison(x, y float64) bool {
 }
 
 func TestWeightedNACD(t *testing.T) {
+	ctx := context.Background()
 	tests := []struct {
 		name    string
 		weights Weights
@@ -49,18 +51,18 @@ func TestWeightedNACD(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			storage := pkg.NewMockStorage()
+			storage := pkg.NewMemoryStorage()
 			// Add mock nodes to storage
-			node1, err := pkg.AddNode(storage, "PACKAGE", "metadata1", "pkg:generic/dep1@1.0.0")
+			node1, err := pkg.AddNode(ctx, storage, "PACKAGE", "metadata1", "pkg:generic/dep1@1.0.0")
 			assert.NoError(t, err)
-			node2, err := pkg.AddNode(storage, "PACKAGE", "metadata2", "pkg:generic/dep2@1.0.0")
+			node2, err := pkg.AddNode(ctx, storage, "PACKAGE", "metadata2", "pkg:generic/dep2@1.0.0")
 			assert.NoError(t, err)
 
 			// Set dependencies
-			err = node1.SetDependency(storage, node2)
+			err = node1.SetDependency(ctx, storage, node2)
 			assert.NoError(t, err)
 
-			got, err := WeightedNACD(storage, test.weights)
+			got, err := WeightedNACD(ctx, storage, test.weights)
 			if (err != nil) != test.wantErr {
 				t.Errorf("WeightedNACD() error = %v, wantErr %v", err, test.wantErr)
 				return